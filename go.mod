@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/getlantern/systray v1.2.2
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/sys v0.15.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -19,5 +20,4 @@ require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
-	golang.org/x/sys v0.15.0 // indirect
 )
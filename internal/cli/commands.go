@@ -1,19 +1,34 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/control"
 	"github.com/yasinkuyu/Stacker/internal/dumps"
+	"github.com/yasinkuyu/Stacker/internal/events"
 	"github.com/yasinkuyu/Stacker/internal/forge"
 	"github.com/yasinkuyu/Stacker/internal/logs"
 	"github.com/yasinkuyu/Stacker/internal/mail"
 	"github.com/yasinkuyu/Stacker/internal/node"
 	"github.com/yasinkuyu/Stacker/internal/php"
+	"github.com/yasinkuyu/Stacker/internal/procinfo"
+	"github.com/yasinkuyu/Stacker/internal/project"
+	"github.com/yasinkuyu/Stacker/internal/scaffold"
+	"github.com/yasinkuyu/Stacker/internal/secrets"
 	"github.com/yasinkuyu/Stacker/internal/server"
 	"github.com/yasinkuyu/Stacker/internal/services"
 	"github.com/yasinkuyu/Stacker/internal/tray"
@@ -25,6 +40,23 @@ import (
 )
 
 var cfgFile string
+var noDaemon bool
+
+// daemonClient returns a client for the running Stacker instance, or nil when
+// none is running (or --no-daemon is set) and the command should act directly.
+func daemonClient() *control.Client {
+	if noDaemon {
+		return nil
+	}
+	client, err := control.Dial()
+	if err != nil {
+		if err != control.ErrNotRunning {
+			fmt.Printf("⚠️  Running instance unreachable, using direct mode: %v\n", err)
+		}
+		return nil
+	}
+	return client
+}
 
 var rootCmd = &cobra.Command{
 	Use:   "stacker",
@@ -62,9 +94,10 @@ var trayAppCmd = &cobra.Command{
 		url := fmt.Sprintf("http://localhost:%d", port)
 
 		// Run tray manager (this blocks until quit)
-		tm := tray.NewTrayManager()
+		tm := tray.NewTrayManager(ws.ServiceManager())
 		tm.SetWebURL(url)
 		tm.Run()
+		ws.Close()
 
 		// Shutdown services after UI is gone (Background Worker logic)
 		fmt.Println("🛑 Stacker is shutting down services...")
@@ -106,9 +139,10 @@ var uiCmd = &cobra.Command{
 		go tray.OpenBrowser(url)
 
 		// Run tray manager (blocks)
-		tm := tray.NewTrayManager()
+		tm := tray.NewTrayManager(ws.ServiceManager())
 		tm.SetWebURL(url)
 		tm.Run()
+		ws.Close()
 
 		// Shutdown services after UI is gone (Background Worker logic)
 		fmt.Println("🛑 Stacker is shutting down services...")
@@ -140,31 +174,47 @@ var serveCmd = &cobra.Command{
 	},
 }
 
+var addPHP string
+var addSSL bool
+var addServer string
+var addFramework string
+
 var addCmd = &cobra.Command{
 	Use:   "add [name] [path]",
 	Short: "Add a new site",
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		path := args[1]
-		cfg := config.Load(cfgFile)
-		cfg.AddSite(name, path)
-		stackerConfig, _ := config.LoadStackerYaml(path)
-		if stackerConfig.PHP != "" {
-			pm := php.NewPHPManager()
-			pm.PinSite(name, stackerConfig.PHP)
+		path, err := filepath.Abs(args[1])
+		if err != nil {
+			fmt.Printf("❌ Invalid path: %v\n", err)
+			return
+		}
+
+		site := config.Site{Name: name, Path: path, PHP: addPHP, SSL: addSSL, Server: addServer, Framework: addFramework}
+		if site.PHP == "" {
+			if stackerConfig, err := config.LoadStackerYaml(path); err == nil {
+				site.PHP = stackerConfig.PHP
+			}
+		}
+
+		if client := daemonClient(); client != nil {
+			err = client.Call("sites.add", site, &site)
+		} else {
+			site, err = web.NewSiteConfigurator(nil).Register(site)
+			if err == nil && site.PHP != "" {
+				pm := php.NewPHPManager()
+				pm.PinSite(site.Name, site.PHP)
+			}
 		}
-		if err := cfg.Save(); err != nil {
+		if err != nil {
 			fmt.Printf("❌ Failed to add site: %v\n", err)
 			return
 		}
-		prefs := config.GetPreferences()
-		ext := prefs.DomainExtension
-		if ext == "" {
-			ext = "local"
+		if err := utils.AddToHosts(site.Name); err != nil {
+			fmt.Printf("⚠️  Failed to add %s to hosts file: %v\n", site.Name, err)
 		}
-		utils.AddToHosts(name + "." + ext)
-		fmt.Printf("✅ Site added: %s -> %s\n", name, path)
+		fmt.Printf("✅ Site added: %s -> %s\n", site.Name, site.Path)
 	},
 }
 
@@ -172,19 +222,25 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all sites",
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg := config.Load(cfgFile)
-		if len(cfg.Sites) == 0 {
+		sites := config.GetSiteRegistry().List()
+		if len(sites) == 0 {
 			fmt.Println("No sites configured")
 			return
 		}
-		prefs := config.GetPreferences()
-		ext := prefs.DomainExtension
-		if ext == "" {
-			ext = "local"
-		}
 		fmt.Println("Configured sites:")
-		for _, site := range cfg.Sites {
-			fmt.Printf("  🌐 %s.%s -> %s\n", site.Name, ext, site.Path)
+		sc := web.NewSiteConfigurator(nil)
+		for _, site := range sites {
+			details := ""
+			if fw, err := sc.Layout(site); err == nil {
+				details += " [" + fw.Name + "]"
+			}
+			if site.PHP != "" {
+				details += " php " + site.PHP
+			}
+			if site.SSL {
+				details += " 🔒"
+			}
+			fmt.Printf("  🌐 %s -> %s%s\n", site.Name, site.Path, details)
 		}
 	},
 }
@@ -194,26 +250,102 @@ var removeCmd = &cobra.Command{
 	Short: "Remove a site",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
-		cfg := config.Load(cfgFile)
-		if !cfg.RemoveSite(name) {
-			fmt.Printf("❌ Site not found: %s\n", name)
+		var site *config.Site
+		var err error
+		if client := daemonClient(); client != nil {
+			err = client.Call("sites.remove", web.ControlName{Name: args[0]}, &site)
+		} else {
+			site, err = web.NewSiteConfigurator(nil).Unregister(args[0])
+			if err == nil {
+				php.NewPHPManager().UnpinSite(site.Name)
+			}
+		}
+		if err != nil {
+			fmt.Printf("❌ Site not found: %s\n", args[0])
+			return
+		}
+		utils.RemoveFromHosts(site.Name)
+		fmt.Printf("✅ Site removed: %s\n", site.Name)
+	},
+}
+
+var snippetCmd = &cobra.Command{
+	Use:   "snippet",
+	Short: "Manage per-site nginx/apache config snippets",
+	Long: "Snippets are included in a site's generated config at a hook point (" + strings.Join(web.SnippetHooks, ", ") + ")\n" +
+		"and survive regeneration. Each change is checked with nginx -t / httpd -t and rolled back on failure.",
+}
+
+var snippetShowCmd = &cobra.Command{
+	Use:   "show [site]",
+	Short: "Show a site's snippets",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var snippets []web.SiteSnippet
+		if client := daemonClient(); client != nil {
+			if err := client.Call("sites.snippets", web.ControlName{Name: args[0]}, &snippets); err != nil {
+				fmt.Printf("❌ Failed to read snippets: %v\n", err)
+				return
+			}
+		} else {
+			snippets = web.NewSiteConfigurator(nil).Snippets(config.SiteHost(args[0]))
+		}
+		if len(snippets) == 0 {
+			fmt.Printf("No snippets for %s\n", config.SiteHost(args[0]))
 			return
 		}
-		if err := cfg.Save(); err != nil {
-			fmt.Printf("❌ Failed to remove site: %v\n", err)
+		for _, snippet := range snippets {
+			fmt.Printf("📝 %s %s (%s)\n%s\n", snippet.Server, snippet.Hook, snippet.Path, snippet.Content)
+		}
+	},
+}
+
+var snippetSetCmd = &cobra.Command{
+	Use:   "set [site] [nginx|apache] [hook] [file]",
+	Short: "Set a snippet from a file, or stdin with \"-\"",
+	Args:  cobra.ExactArgs(4),
+	Run: func(cmd *cobra.Command, args []string) {
+		var content []byte
+		var err error
+		if args[3] == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(args[3])
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to read snippet: %v\n", err)
 			return
 		}
-		prefs := config.GetPreferences()
-		ext := prefs.DomainExtension
-		if ext == "" {
-			ext = "local"
+		if err := saveSnippet(args[0], args[1], args[2], string(content)); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Snippet %s %s saved for %s\n", args[1], args[2], config.SiteHost(args[0]))
+	},
+}
+
+var snippetRemoveCmd = &cobra.Command{
+	Use:   "remove [site] [nginx|apache] [hook]",
+	Short: "Remove a snippet",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := saveSnippet(args[0], args[1], args[2], ""); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
 		}
-		utils.RemoveFromHosts(name + "." + ext)
-		fmt.Printf("✅ Site removed: %s\n", name)
+		fmt.Printf("🗑️  Snippet %s %s removed from %s\n", args[1], args[2], config.SiteHost(args[0]))
 	},
 }
 
+// saveSnippet saves through the running instance, which also reloads the
+// web servers, or directly with a config test against the installed servers
+func saveSnippet(site, server, hook, content string) error {
+	if client := daemonClient(); client != nil {
+		return client.Call("sites.snippet", web.SiteSnippet{Site: site, Server: server, Hook: hook, Content: content}, nil)
+	}
+	return web.NewSiteConfigurator(services.NewServiceManager()).SaveSnippet(config.SiteHost(site), server, hook, content)
+}
+
 var dumpsCmd = &cobra.Command{
 	Use:   "dumps",
 	Short: "View and manage dumps",
@@ -342,238 +474,1682 @@ var servicesListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all services",
 	Run: func(cmd *cobra.Command, args []string) {
+		if client := daemonClient(); client != nil {
+			var status string
+			if err := client.Call("services.status", nil, &status); err != nil {
+				fmt.Printf("❌ Failed to list services: %v\n", err)
+				return
+			}
+			fmt.Println(status)
+			return
+		}
 		sm := services.NewServiceManager()
 		fmt.Println(sm.FormatStatus())
 	},
 }
 
-var servicesAddCmd = &cobra.Command{
-	Use:   "add [type] [version]",
-	Short: "Install a service (mysql, mariadb, nginx, apache, redis)",
-	Args:  cobra.ExactArgs(2),
+var (
+	eventTypes  []string
+	eventLimit  int
+	eventFollow bool
+)
+
+var servicesEventsCmd = &cobra.Command{
+	Use:   "events [name]",
+	Short: "Show service starts, stops, restarts, crashes and config changes",
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		svcType := args[0]
-		version := args[1]
+		filter := events.Filter{Limit: eventLimit}
+		if len(args) > 0 {
+			filter.Service = args[0]
+		}
+		for _, t := range eventTypes {
+			filter.Types = append(filter.Types, events.Type(t))
+		}
 
-		fmt.Printf("📦 Installing %s %s...\n", svcType, version)
-		sm := services.NewServiceManager()
+		client := daemonClient()
+		read := func(filter events.Filter) ([]events.Event, error) {
+			if client == nil {
+				// The history file is readable without the running instance
+				return events.NewBus(services.EventLogPath()).History(filter), nil
+			}
+			var list []events.Event
+			err := client.Call("events.list", filter, &list)
+			return list, err
+		}
 
-		if err := sm.InstallService(svcType, version); err != nil {
-			fmt.Printf("❌ Failed to install service: %v\n", err)
+		list, err := read(filter)
+		if err != nil {
+			fmt.Printf("❌ Failed to read events: %v\n", err)
+			return
+		}
+		if len(list) == 0 && !eventFollow {
+			fmt.Println("No service events")
+			return
+		}
+		for _, event := range list {
+			printEvent(event)
+			filter.After = event.ID
+		}
+		if !eventFollow {
+			return
+		}
+		if client == nil {
+			fmt.Println("❌ Stacker is not running; --follow needs the running instance")
 			return
 		}
 
-		fmt.Printf("✅ Service %s-%s installed successfully\n", svcType, version)
-		fmt.Printf("   Use 'stacker services start %s-%s' to start\n", svcType, version)
+		filter.Limit = 0
+		for {
+			time.Sleep(time.Second)
+			list, err := read(filter)
+			if err != nil {
+				fmt.Printf("❌ Failed to read events: %v\n", err)
+				return
+			}
+			for _, event := range list {
+				printEvent(event)
+				filter.After = event.ID
+			}
+		}
 	},
 }
 
-var servicesStartCmd = &cobra.Command{
-	Use:   "start [name]",
-	Short: "Start a service",
-	Args:  cobra.ExactArgs(1),
+func printEvent(event events.Event) {
+	line := fmt.Sprintf("%s  %-15s %-14s", event.Time.Format("2006-01-02 15:04:05"), event.Service, event.Type)
+	if event.PID > 0 {
+		line += fmt.Sprintf(" pid %d", event.PID)
+	}
+	if event.Attempt > 0 {
+		line += fmt.Sprintf(" #%d", event.Attempt)
+	}
+	if event.Backoff != "" {
+		line += " in " + event.Backoff
+	}
+	if event.Type == events.InstallProgress {
+		line += fmt.Sprintf(" %d%%", event.Progress)
+	}
+	if event.Message != "" {
+		line += "  " + event.Message
+	}
+	fmt.Println(line)
+}
+
+var eventWebhookTypes []string
+
+var servicesWebhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Post service events to local URLs",
+}
+
+var servicesWebhooksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List event webhooks",
 	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
-		sm := services.NewServiceManager()
-		if err := sm.StartService(name); err != nil {
-			fmt.Printf("❌ Failed to start service: %v\n", err)
+		var hooks []config.EventWebhook
+		if client := daemonClient(); client != nil {
+			if err := client.Call("events.webhooks.list", nil, &hooks); err != nil {
+				fmt.Printf("❌ Failed to list webhooks: %v\n", err)
+				return
+			}
+		} else {
+			hooks = events.Webhooks()
+		}
+		if len(hooks) == 0 {
+			fmt.Println("No event webhooks")
 			return
 		}
-		fmt.Printf("✅ Service started: %s\n", name)
+		for _, hook := range hooks {
+			types := "all events"
+			if len(hook.Events) > 0 {
+				types = strings.Join(hook.Events, ", ")
+			}
+			fmt.Printf("  • %s  (%s)\n", hook.URL, types)
+		}
 	},
 }
 
-var servicesStopCmd = &cobra.Command{
-	Use:   "stop [name]",
-	Short: "Stop a service",
+var servicesWebhooksAddCmd = &cobra.Command{
+	Use:   "add [url]",
+	Short: "Post events to a URL on this machine",
+	Long: `Post events as JSON to a URL on this machine. The event type is also sent
+in the X-Stacker-Event header.
+
+  stacker services webhooks add http://127.0.0.1:9000/stacker --event crashed --event restarting`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		hook := config.EventWebhook{URL: args[0], Events: eventWebhookTypes}
+		var err error
+		if client := daemonClient(); client != nil {
+			err = client.Call("events.webhooks.add", hook, nil)
+		} else {
+			err = events.AddWebhook(hook)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to add webhook: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Events will be posted to %s\n", hook.URL)
+	},
+}
+
+var servicesWebhooksRemoveCmd = &cobra.Command{
+	Use:   "remove [url]",
+	Short: "Stop posting events to a URL",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
-		sm := services.NewServiceManager()
-		if err := sm.StopService(name); err != nil {
-			fmt.Printf("❌ Failed to stop service: %v\n", err)
+		var err error
+		if client := daemonClient(); client != nil {
+			err = client.Call("events.webhooks.remove", config.EventWebhook{URL: args[0]}, nil)
+		} else {
+			err = events.RemoveWebhook(args[0])
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to remove webhook: %v\n", err)
 			return
 		}
-		fmt.Printf("⏹️  Service stopped: %s\n", name)
+		fmt.Printf("✅ Webhook %s removed\n", args[0])
 	},
 }
 
-var servicesStopAllCmd = &cobra.Command{
-	Use:   "stop-all",
-	Short: "Stop all services",
+var configVersion int
+
+var servicesConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Edit, validate and restore service config files",
+	Long: `Every save is checked with the service's own checker first (nginx -t, httpd -t,
+mysqld --validate-config, ...) and kept as a version, so any earlier version can be
+compared or restored. A running service is reloaded after a save.`,
+}
+
+// serviceConfig reads a version of a service's config file; 0 is the file on disk
+func serviceConfig(name string, version int) (string, error) {
+	var content string
+	if client := daemonClient(); client != nil {
+		err := client.Call("services.config.get", web.ControlServiceConfig{Name: name, Version: version}, &content)
+		return content, err
+	}
+	return services.NewServiceManager().ConfigAtVersion(name, version)
+}
+
+// saveServiceConfig validates and saves a service's config file
+func saveServiceConfig(name, content string) error {
+	if client := daemonClient(); client != nil {
+		return client.Call("services.config.save", web.ControlServiceConfig{Name: name, Content: content}, nil)
+	}
+	return services.NewServiceManager().SaveServiceConfig(name, content)
+}
+
+var servicesConfigShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Print the config file of a service, or a saved version of it",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		sm := services.NewServiceManager()
-		sm.StopAll()
-		fmt.Println("⏹️  All services stopped")
+		content, err := serviceConfig(args[0], configVersion)
+		if err != nil {
+			fmt.Printf("❌ Failed to read config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(content)
 	},
 }
 
-var servicesUninstallCmd = &cobra.Command{
-	Use:   "uninstall [name]",
-	Short: "Uninstall a service",
+var servicesConfigEditCmd = &cobra.Command{
+	Use:   "edit [name]",
+	Short: "Edit the config file of a service in $EDITOR",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		sm := services.NewServiceManager()
+		content, err := serviceConfig(name, 0)
+		if err != nil {
+			fmt.Printf("❌ Failed to read config: %v\n", err)
+			os.Exit(1)
+		}
 
-		fmt.Printf("🗑️  Uninstalling service: %s\n", name)
-		if err := sm.UninstallService(name); err != nil {
-			fmt.Printf("❌ Failed to uninstall service: %v\n", err)
-			return
+		f, err := os.CreateTemp("", "stacker-"+name+"-*.conf")
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
 		}
+		f.WriteString(content)
+		f.Close()
 
-		fmt.Printf("✅ Service %s uninstalled successfully\n", name)
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+			if runtime.GOOS == "windows" {
+				editor = "notepad"
+			}
+		}
+		editorArgs := append(strings.Fields(editor), f.Name())
+		edit := exec.Command(editorArgs[0], editorArgs[1:]...)
+		edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := edit.Run(); err != nil {
+			fmt.Printf("❌ Editor failed: %v\n", err)
+			os.Remove(f.Name())
+			os.Exit(1)
+		}
+
+		edited, err := os.ReadFile(f.Name())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if string(edited) == content {
+			os.Remove(f.Name())
+			fmt.Println("No changes")
+			return
+		}
+		if err := saveServiceConfig(name, string(edited)); err != nil {
+			fmt.Printf("❌ Config not saved: %v\n", err)
+			fmt.Printf("💡 Your edit is kept in %s (stacker services config apply %s %s)\n", f.Name(), name, f.Name())
+			os.Exit(1)
+		}
+		os.Remove(f.Name())
+		fmt.Printf("✅ Config of %s saved\n", name)
 	},
 }
 
-var servicesInstallCmd = &cobra.Command{
-	Use:   "install [type] [version]",
-	Short: "Install a service (mysql, mariadb, nginx, apache, redis)",
+var servicesConfigApplyCmd = &cobra.Command{
+	Use:   "apply [name] [file]",
+	Short: "Validate a file and save it as the config of a service",
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		svcType := args[0]
-		version := args[1]
-
-		fmt.Printf("📦 Installing %s %s...\n", svcType, version)
-		sm := services.NewServiceManager()
-
-		if err := sm.InstallService(svcType, version); err != nil {
-			fmt.Printf("❌ Failed to install service: %v\n", err)
-			return
+		content, err := os.ReadFile(args[1])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
 		}
-
-		fmt.Printf("✅ Service %s-%s installed successfully\n", svcType, version)
-		fmt.Printf("   Use 'stacker services start %s-%s' to start\n", svcType, version)
+		if err := saveServiceConfig(args[0], string(content)); err != nil {
+			fmt.Printf("❌ Config not saved: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Config of %s saved\n", args[0])
 	},
 }
 
-var servicesVersionsCmd = &cobra.Command{
-	Use:   "versions [type]",
-	Short: "List available service versions",
-	Args:  cobra.MaximumNArgs(1),
+var servicesConfigValidateCmd = &cobra.Command{
+	Use:   "validate [name] [file]",
+	Short: "Check a file, or the current config, with the service's own checker",
+	Args:  cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
-		svcType := ""
-		if len(args) > 0 {
-			svcType = args[0]
+		name := args[0]
+		var content string
+		var err error
+		if len(args) > 1 {
+			var data []byte
+			data, err = os.ReadFile(args[1])
+			content = string(data)
+		} else {
+			content, err = serviceConfig(name, 0)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
 		}
 
-		sm := services.NewServiceManager()
-		versions := sm.GetAvailableVersions(svcType)
+		if client := daemonClient(); client != nil {
+			err = client.Call("services.config.validate", web.ControlServiceConfig{Name: name, Content: content}, nil)
+		} else {
+			err = services.NewServiceManager().ValidateServiceConfig(name, content)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ Config is valid")
+	},
+}
 
+var servicesConfigHistoryCmd = &cobra.Command{
+	Use:   "history [name]",
+	Short: "List the saved versions of a service's config",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var versions []services.ConfigVersion
+		var err error
+		if client := daemonClient(); client != nil {
+			err = client.Call("services.config.history", web.ControlServiceConfig{Name: args[0]}, &versions)
+		} else {
+			versions, err = services.NewServiceManager().ConfigHistory(args[0])
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to read config history: %v\n", err)
+			os.Exit(1)
+		}
 		if len(versions) == 0 {
-			fmt.Println("No available versions found")
+			fmt.Println("No saved versions yet")
 			return
 		}
-
-		fmt.Println("Available Service Versions:")
-		fmt.Println("═════════════════════════")
-
+		fmt.Printf("%-8s %-20s %8s  %s\n", "VERSION", "SAVED", "SIZE", "NOTE")
 		for _, v := range versions {
-			fmt.Printf("  • %s %s (%s)\n", strings.ToUpper(v.Type), v.Version, v.Arch)
+			note := v.Note
+			if v.Current {
+				note += " (current)"
+			}
+			fmt.Printf("%-8d %-20s %8d  %s\n", v.Version, v.Time.Format("2006-01-02 15:04:05"), v.Size, note)
 		}
 	},
 }
 
-var phpCmd = &cobra.Command{
-	Use:   "php",
-	Short: "Manage PHP versions",
-}
-
-var phpListCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List PHP versions",
+var servicesConfigDiffCmd = &cobra.Command{
+	Use:   "diff [name] [from] [to]",
+	Short: "Show the changes between two versions; to defaults to the current file",
+	Args:  cobra.RangeArgs(2, 3),
 	Run: func(cmd *cobra.Command, args []string) {
-		pm := php.NewPHPManager()
-		pm.DetectPHPVersions()
-		fmt.Println(pm.FormatVersions())
-	},
-}
+		from, err := strconv.Atoi(args[1])
+		to := 0
+		if err == nil && len(args) > 2 {
+			to, err = strconv.Atoi(args[2])
+		}
+		if err != nil {
+			fmt.Println("❌ Versions must be numbers, see stacker services config history")
+			os.Exit(1)
+		}
 
-var phpSetCmd = &cobra.Command{
-	Use:   "set [version]",
-	Short: "Set default PHP version",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		version := args[0]
-		pm := php.NewPHPManager()
-		if err := pm.SetDefault(version); err != nil {
-			fmt.Printf("❌ Failed to set PHP version: %v\n", err)
+		var diff string
+		if client := daemonClient(); client != nil {
+			err = client.Call("services.config.diff", web.ControlServiceConfig{Name: args[0], From: from, To: to}, &diff)
+		} else {
+			diff, err = services.NewServiceManager().DiffServiceConfig(args[0], from, to)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if diff == "" {
+			fmt.Println("No differences")
 			return
 		}
-		fmt.Printf("✅ Default PHP version set to %s\n", version)
+		fmt.Print(diff)
 	},
 }
 
-var xdebugCmd = &cobra.Command{
-	Use:   "xdebug",
-	Short: "Manage XDebug",
-}
-
-var xdebugEnableCmd = &cobra.Command{
-	Use:   "enable",
-	Short: "Enable XDebug",
+var servicesConfigRestoreCmd = &cobra.Command{
+	Use:   "restore [name] [version]",
+	Short: "Save a previous version as the config of a service again",
+	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		xm := xdebug.NewXDebugManager()
-		xm.SetEnabled(true)
-		fmt.Println("✅ XDebug enabled")
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version <= 0 {
+			fmt.Println("❌ Version must be a positive number, see stacker services config history")
+			os.Exit(1)
+		}
+		if client := daemonClient(); client != nil {
+			err = client.Call("services.config.restore", web.ControlServiceConfig{Name: args[0], Version: version}, nil)
+		} else {
+			err = services.NewServiceManager().RestoreServiceConfig(args[0], version)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to restore config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Config of %s restored to version %d\n", args[0], version)
 	},
 }
 
-var xdebugDisableCmd = &cobra.Command{
+var (
+	topOnce     bool
+	topInterval time.Duration
+)
+
+var servicesTopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show CPU, memory, threads and open files of running services",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := daemonClient()
+		var sm *services.ServiceManager
+		if client == nil {
+			sm = services.NewServiceManager()
+		}
+		read := func() ([]*services.DetailedStatus, error) {
+			if client != nil {
+				var statuses []*services.DetailedStatus
+				err := client.Call("services.top", nil, &statuses)
+				return statuses, err
+			}
+			// Nothing samples in the background without the daemon, so each
+			// reading takes a sample and CPU usage covers the time since the
+			// previous one
+			for _, svc := range sm.GetServices() {
+				if svc.Status == "running" {
+					sm.SampleResources(svc.Name)
+				}
+			}
+			return sm.DetailedStatuses(), nil
+		}
+
+		if client == nil {
+			// CPU usage is measured between two samples
+			read()
+			time.Sleep(time.Second)
+		}
+		for {
+			statuses, err := read()
+			if err != nil {
+				fmt.Printf("❌ Failed to read service metrics: %v\n", err)
+				return
+			}
+			if !topOnce {
+				fmt.Print("\033[H\033[2J")
+			}
+			printServiceTop(statuses)
+			if topOnce {
+				return
+			}
+			time.Sleep(topInterval)
+		}
+	},
+}
+
+func printServiceTop(statuses []*services.DetailedStatus) {
+	if len(statuses) == 0 {
+		fmt.Println("No running services")
+		return
+	}
+	fmt.Printf("%-18s %7s %7s %10s %8s %6s %6s  %s\n", "SERVICE", "PID", "CPU%", "MEMORY", "THREADS", "FDS", "PROCS", "UPTIME")
+	for _, s := range statuses {
+		fmt.Printf("%-18s %7d %7.1f %10s %8d %6d %6d  %s\n",
+			s.Name, s.PID, s.CPU, formatMemory(s.Memory),
+			s.Resources["threads"], s.Resources["fds"], s.Resources["processes"], s.Uptime)
+	}
+}
+
+func formatMemory(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	default:
+		return fmt.Sprintf("%d KB", bytes>>10)
+	}
+}
+
+var servicesAddCmd = &cobra.Command{
+	Use:   "add [type] [version]",
+	Short: "Install a service (mysql, mariadb, nginx, apache, redis)",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		svcType := args[0]
+		version := args[1]
+
+		fmt.Printf("📦 Installing %s %s...\n", svcType, version)
+		if err := installService(svcType, version); err != nil {
+			fmt.Printf("❌ Failed to install service: %v\n", err)
+			return
+		}
+
+		fmt.Printf("✅ Service %s-%s installed successfully\n", svcType, version)
+		fmt.Printf("   Use 'stacker services start %s-%s' to start\n", svcType, version)
+	},
+}
+
+var (
+	customEnv        []string
+	customDir        string
+	customPort       int
+	customHealth     string
+	customHealthPath string
+	customHealthCmd  string
+	customLog        string
+)
+
+var servicesCustomCmd = &cobra.Command{
+	Use:   "custom",
+	Short: "Manage user-defined services (queue workers, Meilisearch, Vite...)",
+}
+
+var servicesCustomListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List custom services",
+	Run: func(cmd *cobra.Command, args []string) {
+		var defs map[string]config.CustomService
+		if client := daemonClient(); client != nil {
+			if err := client.Call("services.custom.list", nil, &defs); err != nil {
+				fmt.Printf("❌ Failed to list custom services: %v\n", err)
+				return
+			}
+		} else {
+			defs = config.GetPreferences().CustomServices
+		}
+		if len(defs) == 0 {
+			fmt.Println("No custom services")
+			return
+		}
+		names := make([]string, 0, len(defs))
+		for name := range defs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			def := defs[name]
+			line := fmt.Sprintf("  • %-20s %s", name, strings.Join(append([]string{def.Command}, def.Args...), " "))
+			if def.Port > 0 {
+				line += fmt.Sprintf("  (port %d)", def.Port)
+			}
+			fmt.Println(line)
+		}
+	},
+}
+
+var servicesCustomAddCmd = &cobra.Command{
+	Use:   "add [name] -- [command] [args...]",
+	Short: "Register a command as a managed service",
+	Long: `Register a command as a managed service with the same start, stop, PID and
+auto-restart handling as installed services. Args may use ${PORT}.
+
+  stacker services custom add horizon -- php artisan horizon
+  stacker services custom add vite --port 5173 --health http -- npm run dev -- --port '${PORT}'
+  stacker services custom add meilisearch --port 7700 --health http --health-path /health -- meilisearch --http-addr '127.0.0.1:${PORT}'`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		dir := customDir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+
+		def := config.CustomService{
+			Command:    args[1],
+			Args:       args[2:],
+			WorkingDir: dir,
+			Port:       customPort,
+			LogFile:    customLog,
+			HealthCheck: config.HealthCheck{
+				Type:    customHealth,
+				Path:    customHealthPath,
+				Command: strings.Fields(customHealthCmd),
+			},
+		}
+		if len(customEnv) > 0 {
+			def.Env = make(map[string]string)
+			for _, kv := range customEnv {
+				key, value, ok := strings.Cut(kv, "=")
+				if !ok || key == "" {
+					fmt.Printf("❌ Invalid --env %q, expected KEY=VALUE\n", kv)
+					return
+				}
+				def.Env[key] = value
+			}
+		}
+
+		var err error
+		if client := daemonClient(); client != nil {
+			err = client.Call("services.custom.add", web.ControlCustomService{Name: name, Service: def}, nil)
+		} else {
+			err = services.NewServiceManager().AddCustomService(name, def)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to add custom service: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Custom service %s added\n", name)
+		fmt.Printf("   Use 'stacker services start %s' to start\n", name)
+	},
+}
+
+var servicesCustomRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Stop and remove a custom service",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if err := runServiceCommand("services.custom.remove", name, func(sm *services.ServiceManager) error {
+			return sm.RemoveCustomService(name)
+		}); err != nil {
+			fmt.Printf("❌ Failed to remove custom service: %v\n", err)
+			return
+		}
+		fmt.Printf("🗑️ Custom service %s removed\n", name)
+	},
+}
+
+var instancePort int
+
+var servicesInstanceCmd = &cobra.Command{
+	Use:   "instance",
+	Short: "Run extra named instances of MySQL, MariaDB or Redis",
+}
+
+var servicesInstanceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List named instances and how to connect to them",
+	Run: func(cmd *cobra.Command, args []string) {
+		var instances []web.ServiceInstanceInfo
+		if client := daemonClient(); client != nil {
+			if err := client.Call("services.instances.list", nil, &instances); err != nil {
+				fmt.Printf("❌ Failed to list instances: %v\n", err)
+				return
+			}
+		} else {
+			sm := services.NewServiceManager()
+			for name, inst := range sm.Instances() {
+				conn, _ := sm.ConnectionInfo(name)
+				instances = append(instances, web.ServiceInstanceInfo{Name: name, Service: inst.Service, Connection: conn})
+			}
+			sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+		}
+		if len(instances) == 0 {
+			fmt.Println("No instances")
+			return
+		}
+		for _, inst := range instances {
+			fmt.Printf("  • %-20s %-15s", inst.Name, inst.Service)
+			if conn := inst.Connection; conn != nil {
+				fmt.Printf(" %-8s %s", conn.Status, redactURL(conn.URL))
+			}
+			fmt.Println()
+		}
+	},
+}
+
+var servicesInstanceAddCmd = &cobra.Command{
+	Use:   "add [name] [service]",
+	Short: "Create a named instance of an installed service, e.g. add cache2 redis-7.2",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		req := web.ControlInstance{Name: args[0], Service: args[1], Port: instancePort}
+		var conn *services.ConnectionInfo
+		if client := daemonClient(); client != nil {
+			if err := client.Call("services.instances.add", req, &conn); err != nil {
+				fmt.Printf("❌ Failed to add instance: %v\n", err)
+				return
+			}
+		} else {
+			sm := services.NewServiceManager()
+			if _, err := sm.AddInstance(req.Name, req.Service, req.Port); err != nil {
+				fmt.Printf("❌ Failed to add instance: %v\n", err)
+				return
+			}
+			conn, _ = sm.ConnectionInfo(req.Name)
+		}
+		fmt.Printf("✅ Instance %s of %s added on port %d\n", req.Name, req.Service, conn.Port)
+		fmt.Printf("   Use 'stacker services start %s' to start\n", req.Name)
+	},
+}
+
+var servicesInstanceRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Stop an instance and delete its config and data",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if err := runServiceCommand("services.instances.remove", name, func(sm *services.ServiceManager) error {
+			return sm.RemoveInstance(name)
+		}); err != nil {
+			fmt.Printf("❌ Failed to remove instance: %v\n", err)
+			return
+		}
+		fmt.Printf("🗑️ Instance %s removed\n", name)
+	},
+}
+
+var servicesConnectionCmd = &cobra.Command{
+	Use:   "connection [name]",
+	Short: "Show how to connect to a service",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var conn *services.ConnectionInfo
+		var err error
+		if client := daemonClient(); client != nil {
+			err = client.Call("services.connection", web.ControlName{Name: args[0]}, &conn)
+		} else {
+			conn, err = services.NewServiceManager().ConnectionInfo(args[0])
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		fmt.Printf("Service:  %s (%s)\n", conn.Service, conn.Status)
+		fmt.Printf("Host:     %s\n", conn.Host)
+		fmt.Printf("Port:     %d\n", conn.Port)
+		if conn.Socket != "" {
+			fmt.Printf("Socket:   %s\n", conn.Socket)
+		}
+		if conn.Username != "" {
+			fmt.Printf("Username: %s\n", conn.Username)
+			fmt.Printf("Password: %s\n", conn.Password)
+		}
+		if conn.URL != "" {
+			fmt.Printf("URL:      %s\n", conn.URL)
+		}
+	},
+}
+
+// redactURL hides the password of a connection URL
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+var servicesStartCmd = &cobra.Command{
+	Use:   "start [name]",
+	Short: "Start a service",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if err := runServiceCommand("services.start", name, func(sm *services.ServiceManager) error {
+			return sm.StartWithDependencies(name)
+		}); err != nil {
+			fmt.Printf("❌ Failed to start service: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Service started: %s\n", name)
+	},
+}
+
+var servicesStopCmd = &cobra.Command{
+	Use:   "stop [name]",
+	Short: "Stop a service",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if err := runServiceCommand("services.stop", name, func(sm *services.ServiceManager) error {
+			return sm.StopService(name)
+		}); err != nil {
+			fmt.Printf("❌ Failed to stop service: %v\n", err)
+			return
+		}
+		fmt.Printf("⏹️  Service stopped: %s\n", name)
+	},
+}
+
+var servicesReloadCmd = &cobra.Command{
+	Use:   "reload [name]",
+	Short: "Apply config changes to a running service without a full restart",
+	Long: `Tests the config of a running service and reloads it in place: nginx -s reload,
+apache -k graceful, SIGUSR2 for PHP-FPM and CONFIG SET for Redis. When the test fails
+the last working config is restored and the service keeps running. Services that
+cannot reload are restarted.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if err := runServiceCommand("services.reload", name, func(sm *services.ServiceManager) error {
+			return sm.ReloadService(name)
+		}); err != nil {
+			fmt.Printf("❌ Failed to reload service: %v\n", err)
+			return
+		}
+		fmt.Printf("♻️  Service reloaded: %s\n", name)
+	},
+}
+
+var servicesStopAllCmd = &cobra.Command{
+	Use:   "stop-all",
+	Short: "Stop all services",
+	Run: func(cmd *cobra.Command, args []string) {
+		if client := daemonClient(); client != nil {
+			if err := client.Call("services.stop-all", nil, nil); err != nil {
+				fmt.Printf("❌ Failed to stop services: %v\n", err)
+				return
+			}
+		} else {
+			sm := services.NewServiceManager()
+			sm.StopAll()
+		}
+		fmt.Println("⏹️  All services stopped")
+	},
+}
+
+var servicesUninstallCmd = &cobra.Command{
+	Use:   "uninstall [name]",
+	Short: "Uninstall a service",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		fmt.Printf("🗑️  Uninstalling service: %s\n", name)
+		if err := runServiceCommand("services.uninstall", name, func(sm *services.ServiceManager) error {
+			return sm.UninstallService(name)
+		}); err != nil {
+			fmt.Printf("❌ Failed to uninstall service: %v\n", err)
+			return
+		}
+
+		fmt.Printf("✅ Service %s uninstalled successfully\n", name)
+	},
+}
+
+var servicesInstallCmd = &cobra.Command{
+	Use:   "install [type] [version]",
+	Short: "Install a service (mysql, mariadb, nginx, apache, redis)",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		svcType := args[0]
+		version := args[1]
+
+		fmt.Printf("📦 Installing %s %s...\n", svcType, version)
+		if err := installService(svcType, version); err != nil {
+			fmt.Printf("❌ Failed to install service: %v\n", err)
+			return
+		}
+
+		fmt.Printf("✅ Service %s-%s installed successfully\n", svcType, version)
+		fmt.Printf("   Use 'stacker services start %s-%s' to start\n", svcType, version)
+	},
+}
+
+var servicesVersionsCmd = &cobra.Command{
+	Use:   "versions [type]",
+	Short: "List available service versions",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		svcType := ""
+		if len(args) > 0 {
+			svcType = args[0]
+		}
+
+		sm := services.NewServiceManager()
+		versions := sm.GetAvailableVersions(svcType)
+
+		if len(versions) == 0 {
+			fmt.Println("No available versions found")
+			return
+		}
+
+		fmt.Println("Available Service Versions:")
+		fmt.Println("═════════════════════════")
+
+		for _, v := range versions {
+			fmt.Printf("  • %s %s (%s)\n", strings.ToUpper(v.Type), v.Version, v.Arch)
+		}
+	},
+}
+
+// runServiceCommand sends a single-service method to the running instance,
+// or runs direct against a fresh service manager when there is none.
+func runServiceCommand(method, name string, direct func(*services.ServiceManager) error) error {
+	if client := daemonClient(); client != nil {
+		return client.Call(method, web.ControlName{Name: name}, nil)
+	}
+	return direct(services.NewServiceManager())
+}
+
+func installService(svcType, version string) error {
+	if client := daemonClient(); client != nil {
+		return client.Call("services.install", web.ControlInstall{Type: svcType, Version: version}, nil)
+	}
+	sm := services.NewServiceManager()
+	return sm.InstallService(svcType, version)
+}
+
+var phpCmd = &cobra.Command{
+	Use:   "php",
+	Short: "Manage PHP versions",
+}
+
+var phpListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List PHP versions",
+	Run: func(cmd *cobra.Command, args []string) {
+		if client := daemonClient(); client != nil {
+			var versions string
+			if err := client.Call("php.list", nil, &versions); err == nil {
+				fmt.Println(versions)
+				return
+			}
+		}
+		pm := php.NewPHPManager()
+		pm.DetectPHPVersions()
+		fmt.Println(pm.FormatVersions())
+	},
+}
+
+var phpSetCmd = &cobra.Command{
+	Use:   "set [version]",
+	Short: "Set default PHP version",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		version := args[0]
+		var err error
+		if client := daemonClient(); client != nil {
+			err = client.Call("php.set", map[string]string{"version": version}, nil)
+		} else {
+			pm := php.NewPHPManager()
+			pm.DetectPHPVersions()
+			err = pm.SetDefault(version)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to set PHP version: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Default PHP version set to %s\n", version)
+	},
+}
+
+var xdebugCmd = &cobra.Command{
+	Use:   "xdebug",
+	Short: "Manage XDebug",
+}
+
+var xdebugEnableCmd = &cobra.Command{
+	Use:   "enable [php-version]",
+	Short: "Enable XDebug (defaults to the default PHP version)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		version := xdebugTargetVersion(args)
+		if version == "" {
+			fmt.Println("❌ No PHP version found. Pass one explicitly, e.g. 'stacker xdebug enable 8.3'")
+			return
+		}
+		xm := xdebug.NewXDebugManager()
+		if err := xm.Enable(version); err != nil {
+			fmt.Printf("❌ Failed to enable XDebug for PHP %s: %v\n", version, err)
+			return
+		}
+		fmt.Printf("✅ XDebug enabled for PHP %s (%s)\n", version, xm.IniPath(version))
+	},
+}
+
+var xdebugDisableCmd = &cobra.Command{
+	Use:   "disable [php-version]",
+	Short: "Disable XDebug (defaults to the default PHP version)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		version := xdebugTargetVersion(args)
+		if version == "" {
+			fmt.Println("❌ No PHP version found. Pass one explicitly, e.g. 'stacker xdebug disable 8.3'")
+			return
+		}
+		xm := xdebug.NewXDebugManager()
+		if err := xm.Disable(version); err != nil {
+			fmt.Printf("❌ Failed to disable XDebug for PHP %s: %v\n", version, err)
+			return
+		}
+		fmt.Printf("⏹️  XDebug disabled for PHP %s\n", version)
+	},
+}
+
+var xdebugProxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Run the DBGp proxy in the foreground (multi-IDE debugging)",
+	Run: func(cmd *cobra.Command, args []string) {
+		xm := xdebug.NewXDebugManager()
+		proxy := xm.NewProxy()
+		if err := proxy.Start(); err != nil {
+			fmt.Printf("❌ Failed to start DBGp proxy: %v\n", err)
+			return
+		}
+		fmt.Printf("   IDEs register with: proxyinit -p <ide-port> -k <idekey> on 127.0.0.1:%d\n", proxy.IDEPort())
+		fmt.Println("Press Ctrl+C to stop")
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		<-sigChan
+		proxy.Stop()
+		fmt.Println("\n🛑 DBGp proxy stopped")
+	},
+}
+
+var xdebugProxyEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Start the DBGp proxy together with Stacker",
+	Run: func(cmd *cobra.Command, args []string) {
+		xm := xdebug.NewXDebugManager()
+		xm.SetProxyEnabled(true)
+		if err := xm.Save(); err != nil {
+			fmt.Printf("❌ Failed to save XDebug settings: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ DBGp proxy enabled (Xdebug: %d, IDE: %d). Restart Stacker to apply.\n", xm.GetPort(), xm.GetProxyPort())
+	},
+}
+
+var xdebugProxyDisableCmd = &cobra.Command{
 	Use:   "disable",
-	Short: "Disable XDebug",
+	Short: "Stop starting the DBGp proxy together with Stacker",
+	Run: func(cmd *cobra.Command, args []string) {
+		xm := xdebug.NewXDebugManager()
+		xm.SetProxyEnabled(false)
+		if err := xm.Save(); err != nil {
+			fmt.Printf("❌ Failed to save XDebug settings: %v\n", err)
+			return
+		}
+		fmt.Println("⏹️  DBGp proxy disabled. Restart Stacker to apply.")
+	},
+}
+
+var xdebugModeCmd = &cobra.Command{
+	Use:   "mode [mode]",
+	Short: "Set xdebug.mode (e.g. debug, profile, debug,profile)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		xm := xdebug.NewXDebugManager()
+		if err := xm.SetMode(args[0]); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if err := xm.Save(); err != nil {
+			fmt.Printf("❌ Failed to save XDebug settings: %v\n", err)
+			return
+		}
+		// Rewrite the ini of every version that has Xdebug enabled
+		for _, version := range xm.EnabledVersions() {
+			if err := xm.Enable(version); err != nil {
+				fmt.Printf("⚠️ PHP %s: %v\n", version, err)
+			}
+		}
+		fmt.Printf("✅ XDebug mode set to %s\n", xm.GetMode())
+	},
+}
+
+var ideConfigIDE string
+
+var xdebugIDEConfigCmd = &cobra.Command{
+	Use:   "ide-config [site]",
+	Short: "Generate IDE debugger configuration for a site",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		site, ok := xdebugIDESite(args[0])
+		if !ok {
+			fmt.Printf("❌ Site '%s' not found\n", args[0])
+			return
+		}
+
+		xm := xdebug.NewXDebugManager()
+		files, err := xm.WriteIDEConfig(ideConfigIDE, site)
+		if err != nil {
+			fmt.Printf("❌ Failed to generate IDE config: %v\n", err)
+			return
+		}
+		for _, f := range files {
+			fmt.Printf("✅ Wrote %s\n", f)
+		}
+		fmt.Printf("   Host: %s, port: %d, IDE key: %s\n", site.Host, xm.GetPort(), xm.GetIDEKey())
+		if ideConfigIDE == "phpstorm" || ideConfigIDE == "idea" {
+			fmt.Printf("   Make sure PhpStorm listens on port %d (Settings > PHP > Debug)\n", xm.GetPort())
+		}
+	},
+}
+
+// xdebugIDESite resolves a site from the site registry
+func xdebugIDESite(name string) (xdebug.IDESite, bool) {
+	site := config.GetSiteRegistry().Get(name)
+	if site == nil {
+		return xdebug.IDESite{}, false
+	}
+	return xdebug.IDESite{Name: name, Host: site.Name, Path: site.Path}, true
+}
+
+var profileSort string
+var profileLimit int
+var profileKeep int
+var profileMaxDays int
+
+var xdebugProfilesCmd = &cobra.Command{
+	Use:   "profiles [site]",
+	Short: "List collected Xdebug profiles",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		site := ""
+		if len(args) > 0 {
+			site = args[0]
+		}
+		pm := xdebug.NewXDebugManager().NewProfileManager()
+		if err := pm.Collect(); err != nil {
+			fmt.Printf("⚠️ Failed to collect profiles: %v\n", err)
+		}
+		profiles := pm.List(site)
+		if len(profiles) == 0 {
+			fmt.Println("No profiles collected. Enable profiling with 'stacker xdebug mode debug,profile'")
+			return
+		}
+		fmt.Println("Xdebug Profiles:")
+		for _, p := range profiles {
+			fmt.Printf("  📊 %-25s %s (%d KB) - %s\n", p.Site, p.Name, p.Size/1024, p.Created.Format("2006-01-02 15:04:05"))
+		}
+	},
+}
+
+var xdebugProfilesShowCmd = &cobra.Command{
+	Use:   "show [site] [name]",
+	Short: "Show the most expensive functions of a profile",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		pm := xdebug.NewXDebugManager().NewProfileManager()
+		profile, err := pm.Load(args[0], args[1])
+		if err != nil {
+			fmt.Printf("❌ Failed to load profile: %v\n", err)
+			return
+		}
+		xdebug.SortFunctions(profile.Functions, profileSort)
+
+		timeEvent := ""
+		if len(profile.Events) > 0 {
+			timeEvent = profile.Events[0]
+		}
+		fmt.Printf("📊 %s\n", profile.Cmd)
+		if len(profile.Summary) > 0 {
+			fmt.Printf("   Total: %s\n\n", xdebug.FormatCost(timeEvent, profile.Summary[0]))
+		}
+		fmt.Printf("  %-12s %-12s %-8s %s\n", "INCLUSIVE", "EXCLUSIVE", "CALLS", "FUNCTION")
+		for i, fn := range profile.Functions {
+			if profileLimit > 0 && i >= profileLimit {
+				break
+			}
+			fmt.Printf("  %-12s %-12s %-8d %s\n",
+				xdebug.FormatCost(timeEvent, fn.Inclusive[0]),
+				xdebug.FormatCost(timeEvent, fn.Exclusive[0]),
+				fn.Calls, fn.Name)
+		}
+	},
+}
+
+var xdebugProfilesPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Apply profile retention limits now",
+	Run: func(cmd *cobra.Command, args []string) {
+		xm := xdebug.NewXDebugManager()
+		if cmd.Flags().Changed("keep") || cmd.Flags().Changed("max-days") {
+			xm.SetProfileRetention(profileKeep, time.Duration(profileMaxDays)*24*time.Hour)
+			if err := xm.Save(); err != nil {
+				fmt.Printf("❌ Failed to save XDebug settings: %v\n", err)
+				return
+			}
+		}
+		if err := xm.NewProfileManager().Collect(); err != nil {
+			fmt.Printf("❌ Failed to prune profiles: %v\n", err)
+			return
+		}
+		fmt.Println("🗑️  Old profiles pruned")
+	},
+}
+
+// xdebugTargetVersion returns the PHP version given on the command line,
+// falling back to the detected default version.
+func xdebugTargetVersion(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	pm := php.NewPHPManager()
+	pm.DetectPHPVersions()
+	if def := pm.GetDefault(); def != nil {
+		return def.Version
+	}
+	return ""
+}
+
+var forgeCmd = &cobra.Command{
+	Use:   "forge",
+	Short: "Manage Laravel Forge integration",
+}
+
+// newForgeClient creates a Forge client from FORGE_API_KEY or the credential
+// vault (and FORGE_API_URL if set)
+func newForgeClient() (*forge.ForgeClient, bool) {
+	apiKey := os.Getenv("FORGE_API_KEY")
+	if apiKey == "" {
+		apiKey = secrets.Lookup(secrets.ForgeAPIKey)
+	}
+	if apiKey == "" {
+		fmt.Printf("❌ No Forge API key. Run 'stacker secrets set %s' or set FORGE_API_KEY\n", secrets.ForgeAPIKey)
+		return nil, false
+	}
+	fc := forge.NewForgeClient(apiKey)
+	if url := os.Getenv("FORGE_API_URL"); url != "" {
+		fc.SetBaseURL(url)
+	}
+	return fc, true
+}
+
+var forgeServersCmd = &cobra.Command{
+	Use:   "servers",
+	Short: "List Forge servers",
+	Run: func(cmd *cobra.Command, args []string) {
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+		servers, err := fc.GetServers()
+		if err != nil {
+			fmt.Printf("❌ Failed to get servers: %v\n", err)
+			return
+		}
+		fmt.Println("Forge Servers:")
+		for _, server := range servers {
+			fmt.Printf("  • [%s] %s (%s) - %s\n", server.ID, server.Name, server.IP, server.Status)
+		}
+	},
+}
+
+var forgeSitesCmd = &cobra.Command{
+	Use:   "sites [server-id]",
+	Short: "List sites on a Forge server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+		sites, err := fc.GetSites(args[0])
+		if err != nil {
+			fmt.Printf("❌ Failed to get sites: %v\n", err)
+			return
+		}
+		fmt.Println("Forge Sites:")
+		for _, site := range sites {
+			fmt.Printf("  • [%s] %s - %s\n", site.ID, site.Name, site.Status)
+		}
+	},
+}
+
+var forgeDeployNoWait bool
+var forgeDeployTimeout time.Duration
+
+var forgeDeployCmd = &cobra.Command{
+	Use:   "deploy [server-id] [site-id]",
+	Short: "Deploy a site via Forge and stream the deployment log",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+		serverID := args[0]
+		siteID := args[1]
+
+		previousID, err := fc.LatestDeploymentID(serverID, siteID)
+		if err != nil {
+			fmt.Printf("❌ Failed to read deployment history: %v\n", err)
+			return
+		}
+		if err := fc.DeploySite(serverID, siteID); err != nil {
+			fmt.Printf("❌ Deployment failed: %v\n", err)
+			return
+		}
+		fmt.Println("🚀 Deployment started")
+		if forgeDeployNoWait {
+			return
+		}
+
+		deployment, err := fc.WaitForDeployment(serverID, siteID, previousID, 3*time.Second, forgeDeployTimeout, func(output string) {
+			fmt.Print(output)
+		})
+		if err != nil {
+			fmt.Printf("\n❌ %v\n", err)
+			return
+		}
+		fmt.Printf("\n✅ Deployment %s finished (%s)\n", deployment.ID, deployment.CommitHash)
+	},
+}
+
+var forgeDeploymentsCmd = &cobra.Command{
+	Use:   "deployments [server-id] [site-id]",
+	Short: "Show the deployment history of a site",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+		deployments, err := fc.GetDeployments(args[0], args[1])
+		if err != nil {
+			fmt.Printf("❌ Failed to get deployments: %v\n", err)
+			return
+		}
+		if len(deployments) == 0 {
+			fmt.Println("No deployments yet")
+			return
+		}
+		fmt.Println("Deployments:")
+		for _, d := range deployments {
+			icon := "🔄"
+			switch d.Status {
+			case "finished":
+				icon = "✅"
+			case "failed":
+				icon = "❌"
+			}
+			commit := d.CommitHash
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			fmt.Printf("  %s [%s] %s %s %s - %s\n", icon, d.ID, d.StartedAt, commit, d.CommitAuthor, strings.SplitN(d.CommitMessage, "\n", 2)[0])
+		}
+	},
+}
+
+var forgeLogCmd = &cobra.Command{
+	Use:   "log [server-id] [site-id] [deployment-id]",
+	Short: "Show the latest deployment log, or the output of a given deployment",
+	Args:  cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+		var output string
+		var err error
+		if len(args) == 3 {
+			output, err = fc.GetDeploymentOutput(args[0], args[1], args[2])
+		} else {
+			output, err = fc.GetDeploymentLog(args[0], args[1])
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to get deployment log: %v\n", err)
+			return
+		}
+		fmt.Println(output)
+	},
+}
+
+var forgeScriptCmd = &cobra.Command{
+	Use:   "script",
+	Short: "Manage a site's deploy script",
+}
+
+var forgeScriptGetCmd = &cobra.Command{
+	Use:   "get [server-id] [site-id]",
+	Short: "Print the deploy script",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+		script, err := fc.GetDeploymentScript(args[0], args[1])
+		if err != nil {
+			fmt.Printf("❌ Failed to get deploy script: %v\n", err)
+			return
+		}
+		fmt.Println(script)
+	},
+}
+
+var forgeScriptSetCmd = &cobra.Command{
+	Use:   "set [server-id] [site-id] [file]",
+	Short: "Replace the deploy script with the contents of a file (- for stdin)",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+		var data []byte
+		var err error
+		if args[2] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[2])
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to read script: %v\n", err)
+			return
+		}
+		if err := fc.UpdateDeploymentScript(args[0], args[1], string(data)); err != nil {
+			fmt.Printf("❌ Failed to update deploy script: %v\n", err)
+			return
+		}
+		fmt.Println("✅ Deploy script updated")
+	},
+}
+
+var envPullAll bool
+var envPullKeys []string
+var envPullPrune bool
+var envPushYes bool
+
+// forgeProject loads the Forge link from the project's stacker.yml
+func forgeProject(args []string) (string, *config.ForgeConfig, bool) {
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+	stackerConfig, err := config.LoadStackerYaml(path)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return "", nil, false
+	}
+	if stackerConfig.Forge == nil || stackerConfig.Forge.ServerID == "" || stackerConfig.Forge.SiteID == "" {
+		fmt.Printf("❌ No forge server_id/site_id configured in %s\n", filepath.Join(path, "stacker.yml"))
+		return "", nil, false
+	}
+	return path, stackerConfig.Forge, true
+}
+
+// printEnvChanges prints a masked key-level diff
+func printEnvChanges(changes []forge.EnvChange, sourceName, targetName string) {
+	for _, c := range changes {
+		switch c.Kind {
+		case "added":
+			fmt.Printf("  + %s=%s (only %s)\n", c.Key, forge.MaskValue(c.Key, c.Source), sourceName)
+		case "removed":
+			fmt.Printf("  - %s=%s (only %s)\n", c.Key, forge.MaskValue(c.Key, c.Target), targetName)
+		case "changed":
+			fmt.Printf("  ~ %s: %s=%s, %s=%s\n", c.Key, targetName, forge.MaskValue(c.Key, c.Target), sourceName, forge.MaskValue(c.Key, c.Source))
+		}
+	}
+}
+
+// confirm asks a yes/no question on the terminal
+func confirm(reader *bufio.Reader, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+var forgePullEnvCmd = &cobra.Command{
+	Use:   "pull-env [project-path]",
+	Short: "Diff the Forge site .env against the local .env and merge selected keys",
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		xm := xdebug.NewXDebugManager()
-		xm.SetEnabled(false)
-		fmt.Println("⏹️  XDebug disabled")
+		path, link, ok := forgeProject(args)
+		if !ok {
+			return
+		}
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+
+		remote, err := fc.GetSiteEnv(link.ServerID, link.SiteID)
+		if err != nil {
+			fmt.Printf("❌ Failed to fetch Forge .env: %v\n", err)
+			return
+		}
+		envFile := filepath.Join(path, ".env")
+		local, _ := os.ReadFile(envFile)
+
+		changes := forge.DiffEnv(remote, string(local))
+		if len(changes) == 0 {
+			fmt.Println("✅ Local .env matches Forge")
+			return
+		}
+		fmt.Printf("Differences (Forge -> %s):\n", envFile)
+		printEnvChanges(changes, "forge", "local")
+
+		selected := make(map[string]bool)
+		for _, key := range envPullKeys {
+			selected[key] = true
+		}
+		reader := bufio.NewReader(os.Stdin)
+		updates := make(map[string]string)
+		var remove []string
+		for _, c := range changes {
+			if c.Kind == "removed" && !envPullPrune {
+				continue
+			}
+			apply := envPullAll || selected[c.Key]
+			if !apply && len(envPullKeys) == 0 && !envPullAll {
+				action := "Take Forge value of"
+				if c.Kind == "removed" {
+					action = "Remove"
+				}
+				apply = confirm(reader, fmt.Sprintf("%s %s?", action, c.Key))
+			}
+			if !apply {
+				continue
+			}
+			if c.Kind == "removed" {
+				remove = append(remove, c.Key)
+			} else {
+				updates[c.Key] = c.Source
+			}
+		}
+
+		if len(updates) == 0 && len(remove) == 0 {
+			fmt.Println("No changes applied")
+			return
+		}
+		if len(local) > 0 {
+			os.WriteFile(envFile+".bak", local, 0600)
+		}
+		if err := os.WriteFile(envFile, []byte(forge.MergeEnv(string(local), updates, remove)), 0600); err != nil {
+			fmt.Printf("❌ Failed to write %s: %v\n", envFile, err)
+			return
+		}
+		fmt.Printf("✅ Merged %d key(s) into %s\n", len(updates)+len(remove), envFile)
 	},
 }
 
-var forgeCmd = &cobra.Command{
-	Use:   "forge",
-	Short: "Manage Laravel Forge integration",
+var forgePushEnvCmd = &cobra.Command{
+	Use:   "push-env [project-path]",
+	Short: "Replace the Forge site .env with the local .env",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, link, ok := forgeProject(args)
+		if !ok {
+			return
+		}
+		fc, ok := newForgeClient()
+		if !ok {
+			return
+		}
+
+		envFile := filepath.Join(path, ".env")
+		local, err := os.ReadFile(envFile)
+		if err != nil {
+			fmt.Printf("❌ Failed to read %s: %v\n", envFile, err)
+			return
+		}
+		remote, err := fc.GetSiteEnv(link.ServerID, link.SiteID)
+		if err != nil {
+			fmt.Printf("❌ Failed to fetch Forge .env: %v\n", err)
+			return
+		}
+
+		changes := forge.DiffEnv(string(local), remote)
+		if len(changes) == 0 {
+			fmt.Println("✅ Forge .env already matches local")
+			return
+		}
+		fmt.Printf("Differences (%s -> Forge):\n", envFile)
+		printEnvChanges(changes, "local", "forge")
+
+		if !envPushYes && !confirm(bufio.NewReader(os.Stdin), "Push local .env to Forge?") {
+			fmt.Println("Aborted")
+			return
+		}
+		if err := fc.UpdateSiteEnv(link.ServerID, link.SiteID, string(local)); err != nil {
+			fmt.Printf("❌ Failed to push .env: %v\n", err)
+			return
+		}
+		fmt.Println("✅ Forge .env updated")
+	},
 }
 
-var forgeServersCmd = &cobra.Command{
-	Use:   "servers",
-	Short: "List Forge servers",
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the encrypted credential vault",
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set [name] [value]",
+	Short: "Store a secret (reads the value from stdin if omitted)",
+	Args:  cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
-		apiKey := os.Getenv("FORGE_API_KEY")
-		if apiKey == "" {
-			fmt.Println("❌ FORGE_API_KEY environment variable not set")
+		var value string
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			fmt.Printf("Value for %s: ", args[0])
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			value = strings.TrimRight(line, "\r\n")
+		}
+		if value == "" {
+			fmt.Println("❌ Empty value")
 			return
 		}
-		fc := forge.NewForgeClient(apiKey)
-		servers, err := fc.GetServers()
+		vault, err := secrets.Open()
 		if err != nil {
-			fmt.Printf("❌ Failed to get servers: %v\n", err)
+			fmt.Printf("❌ Failed to open vault: %v\n", err)
 			return
 		}
-		fmt.Println("Forge Servers:")
-		for _, server := range servers {
-			fmt.Printf("  • %s (%s) - %s\n", server.Name, server.IP, server.Status)
+		if err := vault.Set(args[0], value); err != nil {
+			fmt.Printf("❌ Failed to store secret: %v\n", err)
+			return
 		}
+		fmt.Printf("✅ Stored %s (%s)\n", args[0], vault.Source())
 	},
 }
 
-var forgeDeployCmd = &cobra.Command{
-	Use:   "deploy [server-id] [site-id]",
-	Short: "Deploy a site via Forge",
-	Args:  cobra.ExactArgs(2),
+var secretsGetCmd = &cobra.Command{
+	Use:   "get [name]",
+	Short: "Print a secret",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		apiKey := os.Getenv("FORGE_API_KEY")
-		if apiKey == "" {
-			fmt.Println("❌ FORGE_API_KEY environment variable not set")
+		vault, err := secrets.Open()
+		if err != nil {
+			fmt.Printf("❌ Failed to open vault: %v\n", err)
 			return
 		}
-		serverID := args[0]
-		siteID := args[1]
-		fc := forge.NewForgeClient(apiKey)
-		if err := fc.DeploySite(serverID, siteID); err != nil {
-			fmt.Printf("❌ Deployment failed: %v\n", err)
+		value, ok := vault.Get(args[0])
+		if !ok {
+			fmt.Printf("❌ Secret %s not found\n", args[0])
+			return
+		}
+		fmt.Println(value)
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored secret names",
+	Run: func(cmd *cobra.Command, args []string) {
+		vault, err := secrets.Open()
+		if err != nil {
+			fmt.Printf("❌ Failed to open vault: %v\n", err)
 			return
 		}
-		fmt.Println("✅ Deployment started")
+		names := vault.List()
+		if len(names) == 0 {
+			fmt.Println("No secrets stored")
+			return
+		}
+		fmt.Printf("Secrets (key: %s):\n", vault.Source())
+		for _, name := range names {
+			fmt.Printf("  🔑 %s\n", name)
+		}
+	},
+}
+
+var secretsDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Remove a secret",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vault, err := secrets.Open()
+		if err != nil {
+			fmt.Printf("❌ Failed to open vault: %v\n", err)
+			return
+		}
+		if err := vault.Delete(args[0]); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Deleted %s\n", args[0])
 	},
 }
 
@@ -628,16 +2204,11 @@ var statusCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Stacker Status")
 		fmt.Println("═══════════════")
-		cfg := config.Load(cfgFile)
-		if len(cfg.Sites) > 0 {
-			fmt.Printf("\n🌐 Sites (%d):\n", len(cfg.Sites))
-			for _, site := range cfg.Sites {
-				prefs := config.GetPreferences()
-				ext := prefs.DomainExtension
-				if ext == "" {
-					ext = "local"
-				}
-				fmt.Printf("   • %s.%s\n", site.Name, ext)
+		sites := config.GetSiteRegistry().List()
+		if len(sites) > 0 {
+			fmt.Printf("\n🌐 Sites (%d):\n", len(sites))
+			for _, site := range sites {
+				fmt.Printf("   • %s\n", site.Name)
 			}
 		}
 		sm := services.NewServiceManager()
@@ -655,14 +2226,481 @@ var statusCmd = &cobra.Command{
 	},
 }
 
+var upProfile string
+
+var upCmd = &cobra.Command{
+	Use:   "up [project-path]",
+	Short: "Start the services, PHP version and site declared in stacker.yml",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "."
+		if len(args) > 0 {
+			path = args[0]
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			fmt.Printf("❌ Invalid path: %v\n", err)
+			return
+		}
+		if _, err := os.Stat(filepath.Join(path, "stacker.yml")); err != nil {
+			fmt.Printf("❌ No stacker.yml in %s\n", path)
+			return
+		}
+
+		fmt.Printf("🚀 Bringing up %s...\n", path)
+		var state *project.State
+		if client := daemonClient(); client != nil {
+			err = client.Call("project.up", web.ControlProject{Path: path, Profile: upProfile}, &state)
+		} else {
+			state, err = directStack().Up(path, upProfile)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to bring project up: %v\n", err)
+			return
+		}
+
+		if err := utils.AddToHosts(state.Site); err != nil {
+			fmt.Printf("⚠️  Failed to add %s to hosts file: %v\n", state.Site, err)
+		}
+		for _, ps := range state.Services {
+			fmt.Printf("  ⚙️  %s on port %d\n", ps.Name, ps.Port)
+		}
+		if state.PHP != "" {
+			fmt.Printf("  🐘 PHP %s\n", state.PHP)
+		}
+		if state.Profile != "" {
+			fmt.Printf("  🏷️  Profile %s\n", state.Profile)
+		}
+		fmt.Printf("✅ %s is up: http://%s\n", filepath.Base(path), state.Site)
+	},
+}
+
+var downCmd = &cobra.Command{
+	Use:   "down [project-path]",
+	Short: "Stop what 'stacker up' started for the project",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "."
+		if len(args) > 0 {
+			path = args[0]
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			fmt.Printf("❌ Invalid path: %v\n", err)
+			return
+		}
+
+		if client := daemonClient(); client != nil {
+			err = client.Call("project.down", web.ControlProject{Path: path}, nil)
+		} else {
+			_, err = directStack().Down(path)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to bring project down: %v\n", err)
+			return
+		}
+		fmt.Printf("⏹️  %s is down\n", filepath.Base(path))
+	},
+}
+
+var stackerConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Validate and document stacker.yml",
+}
+
+var configProfile string
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [project-path]",
+	Short: "Validate stacker.yml and show the resolved configuration",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "."
+		if len(args) > 0 {
+			path = args[0]
+		}
+		file := filepath.Join(path, "stacker.yml")
+		if _, err := os.Stat(file); err != nil {
+			fmt.Printf("❌ No stacker.yml in %s\n", path)
+			os.Exit(1)
+		}
+
+		stackerConfig, err := config.LoadStackerYamlProfile(path, configProfile)
+		if err != nil {
+			if errs, ok := err.(config.ValidationErrors); ok {
+				fmt.Printf("❌ %d problem(s) in %s:\n", len(errs), file)
+				for _, e := range errs {
+					fmt.Printf("  %s\n", e.Error())
+				}
+			} else {
+				fmt.Printf("❌ %v\n", err)
+			}
+			os.Exit(1)
+		}
+
+		fmt.Printf("✅ %s is valid (schema version %d)\n", file, stackerConfig.Version)
+		if stackerConfig.Profile != "" {
+			fmt.Printf("  Profile:  %s\n", stackerConfig.Profile)
+		}
+		if names := stackerConfig.ProfileNames(); len(names) > 0 {
+			fmt.Printf("  Profiles: %s\n", strings.Join(names, ", "))
+		}
+		if stackerConfig.PHP != "" {
+			fmt.Printf("  PHP:      %s\n", stackerConfig.PHP)
+		}
+		for _, svc := range stackerConfig.Services {
+			version, port := svc.Version, "default port"
+			if version == "" {
+				version = "latest"
+			}
+			if svc.Port > 0 {
+				port = fmt.Sprintf("port %d", svc.Port)
+			}
+			fmt.Printf("  Service:  %s %s (%s)\n", svc.Type, version, port)
+		}
+		keys := make([]string, 0, len(stackerConfig.Env))
+		for key := range stackerConfig.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  Env:      %s=%s\n", key, forge.MaskValue(key, stackerConfig.Env[key]))
+		}
+	},
+}
+
+var configExplainCmd = &cobra.Command{
+	Use:   "explain [field]",
+	Short: "Document the stacker.yml schema, or one field (e.g. services.port)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		field := ""
+		if len(args) > 0 {
+			field = args[0]
+		}
+		text, err := config.ExplainStackerSchema(field)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		fmt.Print(text)
+	},
+}
+
+var newTemplate string
+var newPHP string
+var newPath string
+var newNoDB bool
+
+var newCmd = &cobra.Command{
+	Use:   "new [name]",
+	Short: "Create a new project from a framework template and serve it over SSL",
+	Long: "Create a new project (" + strings.Join(scaffold.Templates, ", ") + "), its database,\n" +
+		"an environment file pointing at Stacker's services and mail catcher, a stacker.yml,\n" +
+		"and an SSL site. Templates in <data dir>/templates/<template> take precedence.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		sm := services.NewServiceManager()
+		prefs := config.GetPreferences()
+		sm.UpdatePorts(prefs.ApachePort, prefs.NginxPort, prefs.MySQLPort)
+		pm := php.NewPHPManager()
+
+		fmt.Printf("🏗️  Creating %s project %s...\n", newTemplate, name)
+		result, err := scaffold.NewScaffolder(sm, pm).Create(scaffold.Options{
+			Name:     name,
+			Template: newTemplate,
+			Dir:      newPath,
+			PHP:      newPHP,
+			NoDB:     newNoDB,
+		})
+		if err != nil {
+			fmt.Printf("❌ Failed to create project: %v\n", err)
+			return
+		}
+
+		site := config.Site{Name: config.SiteHost(name), Path: result.Path, PHP: result.PHP, SSL: true}
+		if client := daemonClient(); client != nil {
+			err = client.Call("sites.add", site, &site)
+		} else {
+			site, err = web.NewSiteConfigurator(sm).Register(site)
+			if err == nil && site.PHP != "" {
+				pm.PinSite(site.Name, site.PHP)
+			}
+		}
+		if err != nil {
+			fmt.Printf("❌ Project created in %s but the site could not be added: %v\n", result.Path, err)
+			return
+		}
+		if err := utils.AddToHosts(site.Name); err != nil {
+			fmt.Printf("⚠️  Failed to add %s to hosts file: %v\n", site.Name, err)
+		}
+
+		fmt.Printf("✅ Project created: %s\n", result.Path)
+		if result.Database != "" {
+			fmt.Printf("  🗄️  Database %s on %s (port %d)\n", result.Database, result.DBService.Name, result.DBService.Port)
+		}
+		if result.EnvFile != "" {
+			fmt.Printf("  📝 %s\n", result.EnvFile)
+		}
+		if result.PHP != "" {
+			fmt.Printf("  🐘 PHP %s\n", result.PHP)
+		}
+		fmt.Printf("  📧 Mail goes to Stacker on port 1025\n")
+		fmt.Printf("  🌐 https://%s\n", site.Name)
+	},
+}
+
+// directStack is used by up/down when no Stacker instance is running
+func directStack() *project.Stack {
+	prefs := config.GetPreferences()
+	sm := services.NewServiceManager()
+	sm.UpdatePorts(prefs.ApachePort, prefs.NginxPort, prefs.MySQLPort)
+	return project.NewStack(sm, php.NewFPMManager(), php.NewPHPManager(), web.NewSiteConfigurator(sm))
+}
+
+var daemonLogFile string
+var daemonPIDFile string
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run Stacker headless: web UI, control socket and all services",
+	Long: `Runs the web server and starts all installed services without a tray.
+SIGTERM/SIGINT stop all services gracefully, SIGHUP reloads the configuration.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		stackerDir := utils.GetStackerDir()
+		if daemonPIDFile == "" {
+			daemonPIDFile = filepath.Join(stackerDir, "stacker.pid")
+		}
+		if daemonLogFile == "" {
+			daemonLogFile = filepath.Join(stackerDir, "logs", "daemon.log")
+		}
+
+		if pid := readPIDFile(daemonPIDFile); procinfo.Alive(pid) {
+			fmt.Printf("❌ Stacker daemon already running (pid %d)\n", pid)
+			os.Exit(1)
+		}
+
+		if daemonLogFile != "-" {
+			os.MkdirAll(filepath.Dir(daemonLogFile), 0755)
+			logFile, err := os.OpenFile(daemonLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				fmt.Printf("❌ Failed to open log file: %v\n", err)
+				os.Exit(1)
+			}
+			defer logFile.Close()
+			fmt.Printf("📝 Logging to %s\n", daemonLogFile)
+			os.Stdout = logFile
+			os.Stderr = logFile
+		}
+
+		if err := os.WriteFile(daemonPIDFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+			fmt.Printf("❌ Failed to write PID file: %v\n", err)
+			os.Exit(1)
+		}
+		defer os.Remove(daemonPIDFile)
+
+		cfg := config.Load(cfgFile)
+		ws := web.NewWebServer(cfg)
+		sm := ws.ServiceManager()
+
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- ws.Start()
+		}()
+
+		fmt.Printf("🚀 Stacker daemon started (pid %d)\n", os.Getpid())
+		utils.LogInfo(fmt.Sprintf("Daemon started (pid %d)", os.Getpid()))
+		sm.StartAll()
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+		exitCode := 0
+	loop:
+		for {
+			select {
+			case sig := <-sigChan:
+				if sig == syscall.SIGHUP {
+					fmt.Println("🔄 Reloading configuration...")
+					ws.Reload(config.Reload(cfgFile))
+					continue
+				}
+				fmt.Printf("🛑 Received %s, stopping services...\n", sig)
+				break loop
+			case err := <-serverErr:
+				fmt.Printf("❌ Web server stopped: %v\n", err)
+				utils.LogError(fmt.Sprintf("Daemon web server stopped: %v", err))
+				exitCode = 1
+				break loop
+			}
+		}
+
+		ws.Close()
+		sm.Stop()
+		if err := sm.GracefulStopAll(); err != nil {
+			fmt.Printf("⚠️ Graceful stop had errors: %v\n", err)
+			sm.ForceStopAll()
+		}
+		sm.Wait()
+		utils.LogInfo("Daemon stopped")
+		fmt.Println("👋 Stacker daemon stopped")
+		if exitCode != 0 {
+			os.Remove(daemonPIDFile)
+			os.Exit(exitCode)
+		}
+	},
+}
+
+var daemonInstallPrint bool
+
+var daemonInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install a systemd user unit (Linux) or launchd agent (macOS) for the daemon",
+	Run: func(cmd *cobra.Command, args []string) {
+		exePath, err := os.Executable()
+		if err != nil {
+			fmt.Printf("❌ Failed to locate stacker binary: %v\n", err)
+			return
+		}
+		if resolved, err := filepath.EvalSymlinks(exePath); err == nil {
+			exePath = resolved
+		}
+		homeDir, _ := os.UserHomeDir()
+		logPath := filepath.Join(utils.GetStackerDir(), "logs", "daemon.log")
+
+		var unitPath, content string
+		var next []string
+		switch runtime.GOOS {
+		case "linux":
+			unitPath = filepath.Join(homeDir, ".config", "systemd", "user", "stacker.service")
+			content = systemdUnit(exePath)
+			next = []string{
+				"systemctl --user daemon-reload",
+				"systemctl --user enable --now stacker",
+				"loginctl enable-linger $USER   # keep running after logout",
+			}
+		case "darwin":
+			unitPath = filepath.Join(homeDir, "Library", "LaunchAgents", "com.insya.stacker.daemon.plist")
+			content = launchdPlist(exePath, logPath)
+			next = []string{"launchctl load -w " + unitPath}
+		default:
+			fmt.Printf("❌ Daemon install is not supported on %s\n", runtime.GOOS)
+			return
+		}
+
+		if daemonInstallPrint {
+			fmt.Print(content)
+			return
+		}
+
+		os.MkdirAll(filepath.Dir(unitPath), 0755)
+		if err := os.WriteFile(unitPath, []byte(content), 0644); err != nil {
+			fmt.Printf("❌ Failed to write %s: %v\n", unitPath, err)
+			return
+		}
+		fmt.Printf("✅ Wrote %s\n", unitPath)
+		fmt.Println("   To start the daemon now and at login, run:")
+		for _, line := range next {
+			fmt.Printf("     %s\n", line)
+		}
+	},
+}
+
+// systemdUnit returns a systemd user unit running "stacker daemon". Output
+// goes to the journal, so the daemon does not write its own log file.
+func systemdUnit(exePath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Stacker PHP development environment
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=%s daemon --log-file -
+ExecReload=/bin/kill -HUP $MAINPID
+KillSignal=SIGTERM
+TimeoutStopSec=60
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`, exePath)
+}
+
+// launchdPlist returns a launchd agent running "stacker daemon" at login
+func launchdPlist(exePath, logPath string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>com.insya.stacker.daemon</string>
+    <key>ProgramArguments</key>
+    <array>
+        <string>%s</string>
+        <string>daemon</string>
+    </array>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <dict>
+        <key>SuccessfulExit</key>
+        <false/>
+    </dict>
+    <key>ExitTimeOut</key>
+    <integer>60</integer>
+    <key>StandardErrorPath</key>
+    <string>%s</string>
+</dict>
+</plist>
+`, exePath, logPath)
+}
+
+// readPIDFile returns the PID stored in path, or 0
+func readPIDFile(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.stacker-app/config.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&noDaemon, "no-daemon", false, "act directly instead of through the running Stacker instance")
 
 	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(upCmd)
+	upCmd.Flags().StringVar(&upProfile, "profile", os.Getenv(config.ProfileEnv), "stacker.yml profile to apply (or set "+config.ProfileEnv+")")
+	rootCmd.AddCommand(stackerConfigCmd)
+	stackerConfigCmd.AddCommand(configValidateCmd)
+	configValidateCmd.Flags().StringVar(&configProfile, "profile", os.Getenv(config.ProfileEnv), "profile to apply")
+	stackerConfigCmd.AddCommand(configExplainCmd)
+	rootCmd.AddCommand(downCmd)
+	rootCmd.AddCommand(newCmd)
+	newCmd.Flags().StringVar(&newTemplate, "template", "laravel", "project template: "+strings.Join(scaffold.Templates, ", "))
+	newCmd.Flags().StringVar(&newPHP, "php", "", "PHP version for the project (default PHP if empty)")
+	newCmd.Flags().StringVar(&newPath, "path", ".", "directory to create the project in")
+	newCmd.Flags().BoolVar(&newNoDB, "no-db", false, "do not create a database")
+	daemonCmd.Flags().StringVar(&daemonLogFile, "log-file", "", "log file, \"-\" for stdout (default <data dir>/logs/daemon.log)")
+	daemonCmd.Flags().StringVar(&daemonPIDFile, "pid-file", "", "PID file (default <data dir>/stacker.pid)")
+	daemonCmd.AddCommand(daemonInstallCmd)
+	daemonInstallCmd.Flags().BoolVar(&daemonInstallPrint, "print", false, "print the unit instead of writing it")
 	rootCmd.AddCommand(uiCmd)
 	rootCmd.AddCommand(trayAppCmd)
 	rootCmd.AddCommand(addCmd)
+	addCmd.Flags().StringVar(&addPHP, "php", "", "PHP version to pin (defaults to stacker.yml)")
+	addCmd.Flags().BoolVar(&addSSL, "ssl", false, "create a local SSL certificate")
+	addCmd.Flags().StringVar(&addServer, "server", "", "web server: apache or nginx (default apache)")
+	addCmd.Flags().StringVar(&addFramework, "framework", "", "config preset: "+strings.Join(web.Frameworks, ", ")+" (detected if empty)")
 	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(snippetCmd)
+	snippetCmd.AddCommand(snippetShowCmd)
+	snippetCmd.AddCommand(snippetSetCmd)
+	snippetCmd.AddCommand(snippetRemoveCmd)
 	rootCmd.AddCommand(removeCmd)
 	rootCmd.AddCommand(statusCmd)
 
@@ -681,11 +2719,50 @@ func init() {
 
 	rootCmd.AddCommand(servicesCmd)
 	servicesCmd.AddCommand(servicesListCmd)
+	servicesCmd.AddCommand(servicesEventsCmd)
+	servicesEventsCmd.Flags().StringSliceVar(&eventTypes, "type", nil, "only these event types (started, stopped, exited, crashed, restarting, install-progress, config-changed, reloaded)")
+	servicesEventsCmd.Flags().IntVarP(&eventLimit, "limit", "n", 50, "number of events to show, 0 for all")
+	servicesEventsCmd.Flags().BoolVarP(&eventFollow, "follow", "f", false, "keep printing new events")
+	servicesCmd.AddCommand(servicesConfigCmd)
+	servicesConfigCmd.AddCommand(servicesConfigShowCmd)
+	servicesConfigCmd.AddCommand(servicesConfigEditCmd)
+	servicesConfigCmd.AddCommand(servicesConfigApplyCmd)
+	servicesConfigCmd.AddCommand(servicesConfigValidateCmd)
+	servicesConfigCmd.AddCommand(servicesConfigHistoryCmd)
+	servicesConfigCmd.AddCommand(servicesConfigDiffCmd)
+	servicesConfigCmd.AddCommand(servicesConfigRestoreCmd)
+	servicesConfigShowCmd.Flags().IntVar(&configVersion, "version", 0, "saved version to print (default: the current file)")
+	servicesCmd.AddCommand(servicesWebhooksCmd)
+	servicesWebhooksCmd.AddCommand(servicesWebhooksListCmd)
+	servicesWebhooksCmd.AddCommand(servicesWebhooksAddCmd)
+	servicesWebhooksCmd.AddCommand(servicesWebhooksRemoveCmd)
+	servicesWebhooksAddCmd.Flags().StringArrayVar(&eventWebhookTypes, "event", nil, "event type to post (repeatable, default: all)")
+	servicesCmd.AddCommand(servicesTopCmd)
+	servicesCmd.AddCommand(servicesInstanceCmd)
+	servicesInstanceCmd.AddCommand(servicesInstanceListCmd)
+	servicesInstanceCmd.AddCommand(servicesInstanceAddCmd)
+	servicesInstanceCmd.AddCommand(servicesInstanceRemoveCmd)
+	servicesInstanceAddCmd.Flags().IntVar(&instancePort, "port", 0, "port (default: first free port above the service's)")
+	servicesCmd.AddCommand(servicesConnectionCmd)
+	servicesCmd.AddCommand(servicesCustomCmd)
+	servicesCustomCmd.AddCommand(servicesCustomListCmd)
+	servicesCustomCmd.AddCommand(servicesCustomAddCmd)
+	servicesCustomCmd.AddCommand(servicesCustomRemoveCmd)
+	servicesCustomAddCmd.Flags().StringArrayVar(&customEnv, "env", nil, "environment variable KEY=VALUE (repeatable)")
+	servicesCustomAddCmd.Flags().StringVar(&customDir, "dir", "", "working directory (default: current directory)")
+	servicesCustomAddCmd.Flags().IntVar(&customPort, "port", 0, "port the service listens on, passed as PORT")
+	servicesCustomAddCmd.Flags().StringVar(&customHealth, "health", "", "health check: tcp, http, command or none (default: tcp with a port)")
+	servicesCustomAddCmd.Flags().StringVar(&customHealthPath, "health-path", "", "path requested by the http health check")
+	servicesCustomAddCmd.Flags().StringVar(&customHealthCmd, "health-cmd", "", "command run by the command health check")
+	servicesCustomAddCmd.Flags().StringVar(&customLog, "log", "", "log file (default: logs/<name>.log)")
+	servicesTopCmd.Flags().BoolVar(&topOnce, "once", false, "print once and exit")
+	servicesTopCmd.Flags().DurationVar(&topInterval, "interval", 2*time.Second, "refresh interval")
 	servicesCmd.AddCommand(servicesVersionsCmd)
 	servicesCmd.AddCommand(servicesInstallCmd)
 	servicesCmd.AddCommand(servicesAddCmd)
 	servicesCmd.AddCommand(servicesStartCmd)
 	servicesCmd.AddCommand(servicesStopCmd)
+	servicesCmd.AddCommand(servicesReloadCmd)
 	servicesCmd.AddCommand(servicesStopAllCmd)
 	servicesCmd.AddCommand(servicesUninstallCmd)
 
@@ -696,10 +2773,42 @@ func init() {
 	rootCmd.AddCommand(xdebugCmd)
 	xdebugCmd.AddCommand(xdebugEnableCmd)
 	xdebugCmd.AddCommand(xdebugDisableCmd)
+	xdebugCmd.AddCommand(xdebugProxyCmd)
+	xdebugProxyCmd.AddCommand(xdebugProxyEnableCmd)
+	xdebugProxyCmd.AddCommand(xdebugProxyDisableCmd)
+	xdebugCmd.AddCommand(xdebugModeCmd)
+	xdebugCmd.AddCommand(xdebugIDEConfigCmd)
+	xdebugIDEConfigCmd.Flags().StringVar(&ideConfigIDE, "ide", "vscode", "target IDE: vscode or phpstorm")
+	xdebugCmd.AddCommand(xdebugProfilesCmd)
+	xdebugProfilesCmd.AddCommand(xdebugProfilesShowCmd)
+	xdebugProfilesCmd.AddCommand(xdebugProfilesPruneCmd)
+	xdebugProfilesShowCmd.Flags().StringVar(&profileSort, "sort", "inclusive", "sort by inclusive, exclusive or calls")
+	xdebugProfilesShowCmd.Flags().IntVar(&profileLimit, "limit", 20, "number of functions to show (0 = all)")
+	xdebugProfilesPruneCmd.Flags().IntVar(&profileKeep, "keep", 50, "profiles to keep per site")
+	xdebugProfilesPruneCmd.Flags().IntVar(&profileMaxDays, "max-days", 7, "delete profiles older than this many days")
 
 	rootCmd.AddCommand(forgeCmd)
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsSetCmd)
+	secretsCmd.AddCommand(secretsGetCmd)
+	secretsCmd.AddCommand(secretsListCmd)
+	secretsCmd.AddCommand(secretsDeleteCmd)
 	forgeCmd.AddCommand(forgeServersCmd)
 	forgeCmd.AddCommand(forgeDeployCmd)
+	forgeCmd.AddCommand(forgeSitesCmd)
+	forgeCmd.AddCommand(forgeDeploymentsCmd)
+	forgeCmd.AddCommand(forgeLogCmd)
+	forgeCmd.AddCommand(forgeScriptCmd)
+	forgeCmd.AddCommand(forgePullEnvCmd)
+	forgeCmd.AddCommand(forgePushEnvCmd)
+	forgePullEnvCmd.Flags().BoolVar(&envPullAll, "all", false, "take every Forge value without asking")
+	forgePullEnvCmd.Flags().StringSliceVar(&envPullKeys, "keys", nil, "only take these keys from Forge")
+	forgePullEnvCmd.Flags().BoolVar(&envPullPrune, "prune", false, "also offer to remove keys missing on Forge")
+	forgePushEnvCmd.Flags().BoolVarP(&envPushYes, "yes", "y", false, "skip the confirmation prompt")
+	forgeScriptCmd.AddCommand(forgeScriptGetCmd)
+	forgeScriptCmd.AddCommand(forgeScriptSetCmd)
+	forgeDeployCmd.Flags().BoolVar(&forgeDeployNoWait, "no-wait", false, "return after triggering the deployment")
+	forgeDeployCmd.Flags().DurationVar(&forgeDeployTimeout, "timeout", 15*time.Minute, "how long to wait for the deployment to finish")
 
 	rootCmd.AddCommand(nodeCmd)
 	nodeCmd.AddCommand(nodeListCmd)
@@ -2,24 +2,21 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
 )
 
 type Config struct {
 	Domain  string `json:"domain"`
 	Port    int    `json:"port"`
 	PHPPath string `json:"php_path"`
-	Sites   []Site `json:"sites"`
 	mu      sync.RWMutex
 }
 
-type Site struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
-}
-
 var loadedConfig *Config
 var configMutex sync.RWMutex
 
@@ -46,17 +43,25 @@ func Load(cfgFile string) *Config {
 		Domain:  "*.local",
 		Port:    443,
 		PHPPath: "/usr/bin/php",
-		Sites:   []Site{},
 	}
 
 	if data, err := os.ReadFile(configPath); err == nil {
 		json.Unmarshal(data, cfg)
+		migrateConfigSites(configPath, data)
 	}
 
 	loadedConfig = cfg
 	return cfg
 }
 
+// Reload discards the cached config and reads it from disk again
+func Reload(cfgFile string) *Config {
+	configMutex.Lock()
+	loadedConfig = nil
+	configMutex.Unlock()
+	return Load(cfgFile)
+}
+
 func (c *Config) Save() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -78,48 +83,47 @@ func (c *Config) Save() error {
 	return os.WriteFile(configFile, data, 0644)
 }
 
-func (c *Config) AddSite(name, path string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// migrateConfigSites moves sites stored in config.json by older versions
+// into the site registry and removes them from config.json.
+func migrateConfigSites(configPath string, data []byte) {
+	var legacy struct {
+		Sites []Site `json:"sites"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil || legacy.Sites == nil {
+		return
+	}
+	if err := GetSiteRegistry().importSites(legacy.Sites); err != nil {
+		utils.LogError(fmt.Sprintf("Failed to migrate sites from %s: %v", configPath, err))
+		return
+	}
 
-	for _, site := range c.Sites {
-		if site.Name == name {
-			return
-		}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+	delete(raw, "sites")
+	if out, err := json.MarshalIndent(raw, "", "  "); err == nil {
+		os.WriteFile(configPath, out, 0644)
 	}
-	c.Sites = append(c.Sites, Site{Name: name, Path: path})
 }
 
-func (c *Config) RemoveSite(name string) bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// AddSite registers a site in the shared site registry
+func (c *Config) AddSite(name, path string) (Site, error) {
+	return GetSiteRegistry().Add(Site{Name: name, Path: path})
+}
 
-	for i, site := range c.Sites {
-		if site.Name == name {
-			c.Sites = append(c.Sites[:i], c.Sites[i+1:]...)
-			return true
-		}
-	}
-	return false
+// RemoveSite removes a site from the shared site registry
+func (c *Config) RemoveSite(name string) bool {
+	_, err := GetSiteRegistry().Remove(name)
+	return err == nil
 }
 
+// GetSite looks up a site by host name or short name
 func (c *Config) GetSite(name string) *Site {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	for _, site := range c.Sites {
-		if site.Name == name {
-			return &site
-		}
-	}
-	return nil
+	return GetSiteRegistry().Get(name)
 }
 
+// GetSites returns all registered sites
 func (c *Config) GetSites() []Site {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	sitesCopy := make([]Site, len(c.Sites))
-	copy(sitesCopy, c.Sites)
-	return sitesCopy
+	return GetSiteRegistry().List()
 }
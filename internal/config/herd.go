@@ -1,19 +1,41 @@
 package config
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
 
 	"gopkg.in/yaml.v3"
 )
 
+// ProfileEnv selects a stacker.yml profile when none is given explicitly
+const ProfileEnv = "STACKER_PROFILE"
+
 type StackerConfig struct {
-	PHP      string                 `yaml:"php"`
-	Services []ServiceConfig        `yaml:"services"`
-	Forge    *ForgeConfig           `yaml:"forge,omitempty"`
-	Env      map[string]string      `yaml:"env,omitempty"`
-	Extra    map[string]interface{} `yaml:",inline"`
+	Version  int                       `yaml:"version,omitempty"`
+	PHP      string                    `yaml:"php,omitempty"`
+	Services []ServiceConfig           `yaml:"services,omitempty"`
+	Forge    *ForgeConfig              `yaml:"forge,omitempty"`
+	Env      map[string]string         `yaml:"env,omitempty"`
+	EnvFiles StringList                `yaml:"env_file,omitempty"`
+	Profiles map[string]StackerProfile `yaml:"profiles,omitempty"`
+
+	// Profile is the profile applied by LoadStackerYaml, if any
+	Profile string `yaml:"-"`
+}
+
+// StackerProfile overrides parts of stacker.yml when selected
+type StackerProfile struct {
+	PHP      string            `yaml:"php,omitempty"`
+	Services []ServiceConfig   `yaml:"services,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	EnvFiles StringList        `yaml:"env_file,omitempty"`
 }
 
 type ServiceConfig struct {
@@ -27,10 +49,39 @@ type ForgeConfig struct {
 	SiteID   string `yaml:"site_id"`
 }
 
+// StringList accepts a single string or a list of strings
+type StringList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// LoadStackerYaml loads the project's stacker.yml with the profile named in
+// STACKER_PROFILE, if set. A missing file yields an empty config.
 func LoadStackerYaml(projectPath string) (*StackerConfig, error) {
+	return LoadStackerYamlProfile(projectPath, os.Getenv(ProfileEnv))
+}
+
+// LoadStackerYamlProfile loads, validates and resolves stacker.yml: env files
+// are read, ${VAR} references expanded and the profile applied. Problems are
+// returned as ValidationErrors with line numbers.
+func LoadStackerYamlProfile(projectPath, profile string) (*StackerConfig, error) {
 	configFile := filepath.Join(projectPath, "stacker.yml")
 
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %q requested but %s does not exist", profile, configFile)
+		}
 		return &StackerConfig{}, nil
 	}
 
@@ -39,25 +90,197 @@ func LoadStackerYaml(projectPath string) (*StackerConfig, error) {
 		return nil, fmt.Errorf("failed to read stacker.yml: %w", err)
 	}
 
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse stacker.yml: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return &StackerConfig{}, nil
+	}
+	root := doc.Content[0]
+
+	// Env files are read before interpolation so their variables can be used
+	var errs ValidationErrors
+	var profileNode *yaml.Node
+	if profile != "" {
+		profileNode = mappingValue(mappingValue(root, "profiles"), profile)
+		if profileNode == nil {
+			return nil, ValidationErrors{{File: configFile, Field: "profiles", Message: fmt.Sprintf("profile %q is not defined", profile)}}
+		}
+	}
+	fileEnv := make(map[string]string)
+	for _, owner := range []*yaml.Node{root, profileNode} {
+		for _, entry := range envFileNodes(owner) {
+			if entry.Kind != yaml.ScalarNode {
+				continue // reported by validation
+			}
+			values, err := readEnvFile(filepath.Join(projectPath, entry.Value))
+			if err != nil {
+				errs = append(errs, ValidationError{File: configFile, Line: entry.Line, Column: entry.Column, Field: "env_file", Message: err.Error()})
+				continue
+			}
+			for key, value := range values {
+				fileEnv[key] = value
+			}
+		}
+	}
+
+	// Only the base document and the selected profile are expanded; other
+	// profiles may use variables that are set only where they are selected
+	profiles := mappingValue(root, "profiles")
+	lookup := envLookup(fileEnv)
+	if root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i+1] != profiles {
+				interpolateNode(configFile, root.Content[i+1], lookup, &errs)
+			}
+		}
+	}
+	if profileNode != nil {
+		interpolateNode(configFile, profileNode, lookup, &errs)
+	}
+	validateNode(configFile, stackerSchema, "", root, &errs)
+	if version := mappingValue(root, "version"); version != nil && len(errs) == 0 {
+		if n, _ := strconv.Atoi(version.Value); n > StackerSchemaVersion {
+			errs = append(errs, ValidationError{File: configFile, Line: version.Line, Column: version.Column, Field: "version",
+				Message: fmt.Sprintf("schema version %d is newer than this Stacker supports (%d); please update Stacker", n, StackerSchemaVersion)})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// Of the other profiles only the names are used
+	if profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 1; i < len(profiles.Content); i += 2 {
+			if profiles.Content[i] != profileNode {
+				profiles.Content[i] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+		}
+	}
+
 	var config StackerConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := root.Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse stacker.yml: %w", err)
 	}
+	if config.Version == 0 {
+		config.Version = StackerSchemaVersion
+	}
+
+	if profile != "" {
+		config.applyProfile(profile)
+	}
+
+	// env overrides env_file
+	if len(fileEnv) > 0 {
+		env := fileEnv
+		for key, value := range config.Env {
+			env[key] = value
+		}
+		config.Env = env
+	}
 
 	return &config, nil
 }
 
-func CreateStackerYaml(projectPath string, phpVersion string) error {
+// applyProfile merges a profile over the base config: php replaces, services
+// replace entries of the same type, env is merged
+func (c *StackerConfig) applyProfile(name string) {
+	p := c.Profiles[name]
+	c.Profile = name
+
+	if p.PHP != "" {
+		c.PHP = p.PHP
+	}
+	for _, svc := range p.Services {
+		replaced := false
+		for i := range c.Services {
+			if c.Services[i].Type == svc.Type {
+				c.Services[i] = svc
+				replaced = true
+			}
+		}
+		if !replaced {
+			c.Services = append(c.Services, svc)
+		}
+	}
+	if len(p.Env) > 0 && c.Env == nil {
+		c.Env = make(map[string]string)
+	}
+	for key, value := range p.Env {
+		c.Env[key] = value
+	}
+	c.EnvFiles = append(c.EnvFiles, p.EnvFiles...)
+}
+
+// ProfileNames returns the profiles defined in the file, sorted
+func (c *StackerConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mappingValue returns the value node of key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// envFileNodes returns the env_file entries of a mapping node
+func envFileNodes(node *yaml.Node) []*yaml.Node {
+	value := mappingValue(node, "env_file")
+	if value == nil {
+		return nil
+	}
+	if value.Kind == yaml.ScalarNode {
+		return []*yaml.Node{value}
+	}
+	return value.Content
+}
+
+// readEnvFile reads KEY=VALUE lines, skipping comments and blank lines
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read env file: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := utils.ParseEnvLine(line)
+		if !ok || !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", filepath.Base(path), lineNo)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// CreateStackerYaml writes a stacker.yml for a new project
+func CreateStackerYaml(projectPath, phpVersion string, services []ServiceConfig, env map[string]string) error {
 	config := StackerConfig{
-		PHP: phpVersion,
-		Services: []ServiceConfig{
-			{Type: "mysql", Version: "8.0", Port: 3306},
-			{Type: "redis", Port: 6379},
-		},
-		Env: map[string]string{
-			"APP_ENV":   "local",
-			"APP_DEBUG": "true",
-		},
+		Version:  StackerSchemaVersion,
+		PHP:      phpVersion,
+		Services: services,
+		Env:      env,
 	}
 
 	data, err := yaml.Marshal(config)
@@ -21,6 +21,116 @@ type Preferences struct {
 	NginxPort         int      `json:"nginxPort"`
 	MySQLPort         int      `json:"mysqlPort"`
 	Language          string   `json:"language"`
+
+	// ServicePorts overrides the default port of individual services, keyed by service name
+	ServicePorts map[string]int `json:"servicePorts,omitempty"`
+
+	// RestartPolicies overrides DefaultRestartPolicy, keyed by service name
+	RestartPolicies map[string]RestartPolicy `json:"restartPolicies,omitempty"`
+
+	// ServiceDependencies declares start order and readiness, keyed by service name
+	ServiceDependencies map[string]ServiceDependency `json:"serviceDependencies,omitempty"`
+	// CustomServices are user-defined services, keyed by service name
+	CustomServices map[string]CustomService `json:"customServices,omitempty"`
+	// ServiceInstances are named instances of installed services, keyed by instance name
+	ServiceInstances map[string]ServiceInstance `json:"serviceInstances,omitempty"`
+	// EventWebhooks receive service events as JSON POST requests
+	EventWebhooks []EventWebhook `json:"eventWebhooks,omitempty"`
+	// ServiceSettings tune the generated config files, keyed by service name
+	ServiceSettings map[string]ServiceSettings `json:"serviceSettings,omitempty"`
+}
+
+// ServiceSettings tunes the config Stacker generates for a service. Only the
+// section matching the service type is used; empty fields take the defaults.
+type ServiceSettings struct {
+	MySQL *MySQLSettings `json:"mysql,omitempty"` // mysql and mariadb
+	Redis *RedisSettings `json:"redis,omitempty"`
+	Nginx *NginxSettings `json:"nginx,omitempty"`
+}
+
+// MySQLSettings tunes my.cnf of MySQL and MariaDB
+type MySQLSettings struct {
+	BufferPoolSize string `json:"bufferPoolSize,omitempty"` // innodb_buffer_pool_size, such as 256M
+	MaxConnections int    `json:"maxConnections,omitempty"`
+}
+
+// RedisSettings tunes redis.conf
+type RedisSettings struct {
+	MaxMemory       string `json:"maxMemory,omitempty"`       // such as 256mb, 0 for no limit
+	MaxMemoryPolicy string `json:"maxMemoryPolicy,omitempty"` // such as allkeys-lru
+}
+
+// NginxSettings tunes nginx.conf
+type NginxSettings struct {
+	WorkerProcesses   string `json:"workerProcesses,omitempty"` // a number or auto
+	WorkerConnections int    `json:"workerConnections,omitempty"`
+	KeepaliveTimeout  int    `json:"keepaliveTimeout,omitempty"`  // seconds
+	ClientMaxBodySize string `json:"clientMaxBodySize,omitempty"` // such as 64m
+}
+
+// EventWebhook is a local URL that events are posted to. Events lists the
+// event types it wants; empty means all of them.
+type EventWebhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// ServiceInstance runs an installed service (mysql-8.0) a second time with
+// its own port, config, data directory and socket
+type ServiceInstance struct {
+	Service string `json:"service"`
+	Port    int    `json:"port"`
+}
+
+// CustomService runs an arbitrary command as a managed service, such as
+// Meilisearch, Mailpit, a queue worker or a Vite dev server. Args and Env
+// values may reference ${PORT} and other environment variables.
+type CustomService struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	WorkingDir  string            `json:"workingDir,omitempty"`
+	Port        int               `json:"port,omitempty"`
+	HealthCheck HealthCheck       `json:"healthCheck,omitempty"`
+	LogFile     string            `json:"logFile,omitempty"` // defaults to logs/<name>.log
+}
+
+// HealthCheck tells whether a custom service is up
+type HealthCheck struct {
+	Type    string   `json:"type,omitempty"`    // tcp, http, command or none; tcp when a port is set
+	Path    string   `json:"path,omitempty"`    // path requested by the http check
+	Command []string `json:"command,omitempty"` // run in the working dir, healthy when it exits 0
+}
+
+// ServiceDependency declares the services a service needs and how to tell
+// that it is ready. DependsOn entries are service names (mysql-8.0), which
+// must be installed, or types (mysql), which match any installed service of
+// that type. An entry replaces the defaults for the service's type (web
+// servers wait for PHP).
+type ServiceDependency struct {
+	DependsOn           []string `json:"dependsOn,omitempty"`
+	Probe               string   `json:"probe,omitempty"`     // tcp, http, mysqladmin, redis-cli, command (custom services) or none; defaults by type
+	ProbePath           string   `json:"probePath,omitempty"` // path requested by the http probe
+	ReadyTimeoutSeconds int      `json:"readyTimeoutSeconds,omitempty"`
+}
+
+// RestartPolicy controls how a crashed service is restarted. A service that
+// crashes more than MaxRestarts times within WindowSeconds is left crashed.
+type RestartPolicy struct {
+	Enabled           bool `json:"enabled"`
+	MaxRestarts       int  `json:"maxRestarts"`
+	WindowSeconds     int  `json:"windowSeconds"`
+	BackoffSeconds    int  `json:"backoffSeconds"`    // delay before the first restart, doubled for each further one
+	MaxBackoffSeconds int  `json:"maxBackoffSeconds"` // upper bound of the delay
+}
+
+// DefaultRestartPolicy applies to services without their own policy, enabled
+// for the services marked auto_restart
+var DefaultRestartPolicy = RestartPolicy{
+	MaxRestarts:       5,
+	WindowSeconds:     300,
+	BackoffSeconds:    1,
+	MaxBackoffSeconds: 60,
 }
 
 var prefs *Preferences
@@ -108,3 +218,9 @@ func (p *Preferences) Save() error {
 func GetPreferences() *Preferences {
 	return LoadPreferences()
 }
+
+// ReloadPreferences discards the cached preferences and reads them from disk again
+func ReloadPreferences() *Preferences {
+	prefs = nil
+	return LoadPreferences()
+}
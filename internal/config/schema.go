@@ -0,0 +1,448 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StackerSchemaVersion is the newest stacker.yml schema version this build understands
+const StackerSchemaVersion = 1
+
+// ValidationError is a problem found in stacker.yml, with its position
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	pos := e.File
+	if e.Line > 0 {
+		pos = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s: %s", pos, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", pos, e.Message)
+}
+
+// ValidationErrors collects all problems found in a file
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+type schemaKind string
+
+const (
+	kindString     schemaKind = "string"
+	kindInt        schemaKind = "int"
+	kindObject     schemaKind = "object"
+	kindList       schemaKind = "list"
+	kindStringMap  schemaKind = "map"
+	kindObjectMap  schemaKind = "map of objects"
+	kindStringList schemaKind = "string or list"
+)
+
+// schemaField describes one key of stacker.yml
+type schemaField struct {
+	Name     string
+	Kind     schemaKind
+	Doc      string
+	Example  string
+	Required bool
+	Enum     []string
+	Pattern  *regexp.Regexp
+	Min, Max int
+	Fields   []*schemaField // object fields, list items and map values
+}
+
+var (
+	phpVersionPattern = regexp.MustCompile(`^\d+\.\d+(\.\d+)?$`)
+	envKeyPattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	profilePattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// serviceTypes are the service types "stacker up" can install
+var serviceTypes = []string{"mysql", "mariadb", "redis", "nginx", "apache", "php", "composer", "nodejs"}
+
+func stackerSchemaFields(inProfile bool) []*schemaField {
+	fields := []*schemaField{
+		{Name: "php", Kind: kindString, Pattern: phpVersionPattern, Example: `"8.3"`,
+			Doc: "PHP version the site runs on. The site is pinned to it and its PHP-FPM pool receives env."},
+		{Name: "services", Kind: kindList,
+			Doc: "Services the project needs. \"stacker up\" installs missing versions and starts them.",
+			Fields: []*schemaField{
+				{Name: "type", Kind: kindString, Required: true, Enum: serviceTypes, Example: "mysql",
+					Doc: "Service type."},
+				{Name: "version", Kind: kindString, Example: `"8.0"`,
+					Doc: "Service version. Defaults to the newest installed, or newest available, version."},
+				{Name: "port", Kind: kindInt, Min: 1, Max: 65535, Example: "3307",
+					Doc: "Port to run the service on. Defaults to the service's configured port."},
+			}},
+		{Name: "env", Kind: kindStringMap, Pattern: envKeyPattern, Example: "{APP_ENV: local}",
+			Doc: "Environment variables exported to the site's PHP-FPM pool. Values override env_file."},
+		{Name: "env_file", Kind: kindStringList, Example: ".env.stacker",
+			Doc: "KEY=VALUE files, relative to the project, merged into env in order. Their variables can also be used for ${VAR} interpolation."},
+	}
+	if inProfile {
+		return fields
+	}
+
+	return append([]*schemaField{
+		{Name: "version", Kind: kindInt, Min: 1, Example: "1",
+			Doc: "Schema version of this file. Files without it are read as version 1."},
+	}, append(fields,
+		&schemaField{Name: "forge", Kind: kindObject,
+			Doc: "Laravel Forge site linked to the project, used by \"stacker forge\" commands.",
+			Fields: []*schemaField{
+				{Name: "server_id", Kind: kindString, Required: true, Example: `"123456"`, Doc: "Forge server ID."},
+				{Name: "site_id", Kind: kindString, Required: true, Example: `"654321"`, Doc: "Forge site ID."},
+			}},
+		&schemaField{Name: "profiles", Kind: kindObjectMap, Pattern: profilePattern, Example: "{test: {php: \"8.2\"}}",
+			Doc:    "Named overrides selected with --profile or STACKER_PROFILE. php replaces, services are merged by type, env and env_file are added.",
+			Fields: stackerSchemaFields(true)},
+	)...)
+}
+
+var stackerSchema = &schemaField{Name: "stacker.yml", Kind: kindObject, Fields: stackerSchemaFields(false)}
+
+// validateNode checks node against field and appends problems to errs
+func validateNode(file string, field *schemaField, path string, node *yaml.Node, errs *ValidationErrors) {
+	fail := func(n *yaml.Node, format string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{File: file, Line: n.Line, Column: n.Column, Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch field.Kind {
+	case kindString:
+		if node.Kind != yaml.ScalarNode {
+			fail(node, "must be a string")
+			return
+		}
+		if hasVariable(node.Value) {
+			return
+		}
+		if len(field.Enum) > 0 && !containsString(field.Enum, node.Value) {
+			fail(node, "unknown value %q, expected one of %s", node.Value, strings.Join(field.Enum, ", "))
+		}
+		if field.Pattern != nil && !field.Pattern.MatchString(node.Value) {
+			fail(node, "invalid value %q, expected e.g. %s", node.Value, field.Example)
+		}
+
+	case kindInt:
+		if node.Kind == yaml.ScalarNode && hasVariable(node.Value) {
+			return
+		}
+		n, err := strconv.Atoi(node.Value)
+		if node.Kind != yaml.ScalarNode || err != nil {
+			fail(node, "must be a whole number")
+			return
+		}
+		if field.Max != 0 && (n < field.Min || n > field.Max) {
+			fail(node, "must be between %d and %d", field.Min, field.Max)
+		} else if n < field.Min {
+			fail(node, "must be at least %d", field.Min)
+		}
+
+	case kindStringList:
+		if node.Kind == yaml.ScalarNode {
+			return
+		}
+		if node.Kind != yaml.SequenceNode {
+			fail(node, "must be a string or a list of strings")
+			return
+		}
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				fail(item, "must be a string")
+			}
+		}
+
+	case kindList:
+		if node.Kind != yaml.SequenceNode {
+			fail(node, "must be a list")
+			return
+		}
+		item := &schemaField{Kind: kindObject, Fields: field.Fields}
+		for i, child := range node.Content {
+			validateNode(file, item, fmt.Sprintf("%s[%d]", path, i), child, errs)
+		}
+
+	case kindStringMap, kindObjectMap:
+		if node.Kind != yaml.MappingNode {
+			fail(node, "must be a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if field.Pattern != nil && !field.Pattern.MatchString(key.Value) {
+				fail(key, "invalid key %q", key.Value)
+			}
+			if field.Kind == kindObjectMap {
+				validateNode(file, &schemaField{Kind: kindObject, Fields: field.Fields}, joinPath(path, key.Value), value, errs)
+			} else if value.Kind != yaml.ScalarNode {
+				fail(value, "value of %s must be a string", key.Value)
+			}
+		}
+
+	case kindObject:
+		if node.Kind != yaml.MappingNode {
+			fail(node, "must be a mapping")
+			return
+		}
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child := findField(field.Fields, key.Value)
+			if child == nil {
+				msg := fmt.Sprintf("unknown field %q", key.Value)
+				if suggestion := suggestField(field.Fields, key.Value); suggestion != "" {
+					msg += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				*errs = append(*errs, ValidationError{File: file, Line: key.Line, Column: key.Column, Field: path, Message: msg})
+				continue
+			}
+			if seen[key.Value] {
+				fail(key, "duplicate field %q", key.Value)
+			}
+			seen[key.Value] = true
+			validateNode(file, child, joinPath(path, key.Value), value, errs)
+		}
+		for _, child := range field.Fields {
+			if child.Required && !seen[child.Name] {
+				fail(node, "missing required field %q", child.Name)
+			}
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func findField(fields []*schemaField, name string) *schemaField {
+	for _, f := range fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestField returns the known field closest to a misspelled name
+func suggestField(fields []*schemaField, name string) string {
+	best, bestDistance := "", 3
+	for _, f := range fields {
+		if d := editDistance(strings.ToLower(name), f.Name); d < bestDistance {
+			best, bestDistance = f.Name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// interpolateNode expands ${VAR} and ${VAR:-default} in all scalar values.
+// env_file entries are left as written. "$$" is a literal "$".
+func interpolateNode(file string, node *yaml.Node, lookup func(string) (string, bool), errs *ValidationErrors) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			interpolateNode(file, child, lookup, errs)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "env_file" {
+				continue
+			}
+			interpolateNode(file, node.Content[i+1], lookup, errs)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return
+		}
+		value, err := interpolate(node.Value, lookup)
+		if err != nil {
+			*errs = append(*errs, ValidationError{File: file, Line: node.Line, Column: node.Column, Message: err.Error()})
+			return
+		}
+		if value != node.Value {
+			node.Value = value
+			// The expanded text is always a plain string; let decoding re-resolve its type
+			node.Style = 0
+			node.Tag = ""
+		}
+	}
+}
+
+// hasVariable reports whether s holds a ${VAR} reference, which is only left
+// in profiles that are not selected and so checked when they are
+func hasVariable(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+// interpolate expands variables in s
+func interpolate(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		if s[i+1] != '{' {
+			b.WriteByte(s[i])
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable in %q", s)
+		}
+		expr := s[i+2 : i+end]
+		name, fallback, hasDefault := strings.Cut(expr, ":-")
+		if !envKeyPattern.MatchString(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		value, ok := lookup(name)
+		switch {
+		case ok && value != "":
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(fallback)
+		case ok:
+		default:
+			return "", fmt.Errorf("variable %s is not set (use ${%s:-default} for a fallback)", name, name)
+		}
+		i += end
+	}
+	return b.String(), nil
+}
+
+// ExplainStackerSchema documents the stacker.yml schema. field narrows the
+// output to one key, e.g. "services.port" or "profiles".
+func ExplainStackerSchema(field string) (string, error) {
+	fields := stackerSchema.Fields
+	prefix := ""
+	if field != "" {
+		var found *schemaField
+		for _, part := range strings.Split(field, ".") {
+			found = findField(fields, part)
+			if found == nil {
+				return "", fmt.Errorf("unknown field %q", field)
+			}
+			fields = found.Fields
+		}
+		fields = []*schemaField{found}
+		prefix = strings.TrimSuffix(field, found.Name)
+	}
+
+	var b strings.Builder
+	if field == "" {
+		fmt.Fprintf(&b, "stacker.yml schema, version %d\n", StackerSchemaVersion)
+		b.WriteString("Values may use ${VAR} or ${VAR:-default}; variables come from the environment and env_file.\n\n")
+	}
+	explainFields(&b, fields, prefix, 0)
+	return b.String(), nil
+}
+
+func explainFields(b *strings.Builder, fields []*schemaField, prefix string, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, f := range fields {
+		name := prefix + f.Name
+		kind := string(f.Kind)
+		if f.Required {
+			kind += ", required"
+		}
+		fmt.Fprintf(b, "%s%s (%s)\n", indent, name, kind)
+		fmt.Fprintf(b, "%s    %s\n", indent, f.Doc)
+		if len(f.Enum) > 0 {
+			fmt.Fprintf(b, "%s    One of: %s\n", indent, strings.Join(f.Enum, ", "))
+		}
+		if f.Example != "" {
+			fmt.Fprintf(b, "%s    Example: %s: %s\n", indent, f.Name, f.Example)
+		}
+		if len(f.Fields) > 0 && f.Name != "profiles" {
+			explainFields(b, f.Fields, name+".", depth+1)
+		} else if f.Name == "profiles" {
+			fmt.Fprintf(b, "%s    Profile keys: %s\n", indent, strings.Join(fieldNames(f.Fields), ", "))
+		}
+	}
+}
+
+func fieldNames(fields []*schemaField) []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// envLookup resolves interpolation variables: the process environment wins
+// over values read from env files.
+func envLookup(fileEnv map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		value, ok := fileEnv[name]
+		return value, ok
+	}
+}
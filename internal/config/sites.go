@@ -0,0 +1,276 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// Site is a site served by Stacker. Name is the full host name
+// (e.g. myapp.local).
+type Site struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	PHP       string `json:"php,omitempty"`
+	SSL       bool   `json:"ssl"`
+	Server    string `json:"server,omitempty"`            // "apache" or "nginx", defaults to "apache"
+	Framework string `json:"framework,omitempty"`         // Config preset, detected from the project when empty
+	Url       string `json:"url,omitempty"`               // Dynamic URL based on settings, not persisted
+	Detected  string `json:"detectedFramework,omitempty"` // Detected framework, not persisted
+}
+
+// SiteRegistry is the single list of sites shared by the CLI, the web UI and
+// the daemon. Every access re-reads sites.json when it changed on disk, and
+// writes are serialized across processes with a lock file.
+type SiteRegistry struct {
+	path    string
+	sites   []Site
+	modTime time.Time
+	mu      sync.Mutex
+}
+
+type sitesFile struct {
+	Version int    `json:"version"`
+	Sites   []Site `json:"sites"`
+}
+
+const (
+	sitesFileVersion = 1
+	lockStaleAfter   = 10 * time.Second
+)
+
+var siteRegistry *SiteRegistry
+var siteRegistryOnce sync.Once
+
+// GetSiteRegistry returns the shared site registry
+func GetSiteRegistry() *SiteRegistry {
+	siteRegistryOnce.Do(func() {
+		siteRegistry = &SiteRegistry{
+			path: filepath.Join(utils.GetStackerDir(), "sites.json"),
+		}
+	})
+	return siteRegistry
+}
+
+// SiteHost returns the full host name for a site name, appending the
+// configured domain extension when the name has none.
+func SiteHost(name string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+	ext := strings.TrimPrefix(GetPreferences().DomainExtension, ".")
+	if ext == "" {
+		ext = "local"
+	}
+	return name + "." + ext
+}
+
+// List returns a copy of all sites
+func (r *SiteRegistry) List() []Site {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+
+	result := make([]Site, len(r.sites))
+	copy(result, r.sites)
+	return result
+}
+
+// Get finds a site by full host name or by name without extension
+func (r *SiteRegistry) Get(name string) *Site {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+
+	if i := r.index(name); i >= 0 {
+		site := r.sites[i]
+		return &site
+	}
+	return nil
+}
+
+// Add registers a new site. The name is expanded to a full host name.
+func (r *SiteRegistry) Add(site Site) (Site, error) {
+	site.Name = SiteHost(site.Name)
+	site.Url = ""
+	site.Detected = ""
+	err := r.modify(func(sites []Site) ([]Site, error) {
+		for _, s := range sites {
+			if s.Name == site.Name {
+				return nil, fmt.Errorf("site %s already exists", site.Name)
+			}
+		}
+		return append(sites, site), nil
+	})
+	return site, err
+}
+
+// Update replaces the site registered under name
+func (r *SiteRegistry) Update(name string, site Site) error {
+	site.Name = SiteHost(site.Name)
+	site.Url = ""
+	site.Detected = ""
+	return r.modify(func(sites []Site) ([]Site, error) {
+		i := indexOf(sites, name)
+		if i < 0 {
+			return nil, fmt.Errorf("site %s not found", name)
+		}
+		sites[i] = site
+		return sites, nil
+	})
+}
+
+// Remove deletes a site and returns the removed entry
+func (r *SiteRegistry) Remove(name string) (*Site, error) {
+	var removed *Site
+	err := r.modify(func(sites []Site) ([]Site, error) {
+		i := indexOf(sites, name)
+		if i < 0 {
+			return nil, fmt.Errorf("site %s not found", name)
+		}
+		site := sites[i]
+		removed = &site
+		return append(sites[:i], sites[i+1:]...), nil
+	})
+	return removed, err
+}
+
+// importSites adds sites that are not registered yet, used for migrations
+func (r *SiteRegistry) importSites(legacy []Site) error {
+	return r.modify(func(sites []Site) ([]Site, error) {
+		for _, site := range legacy {
+			site.Name = SiteHost(site.Name)
+			if indexOf(sites, site.Name) < 0 {
+				sites = append(sites, site)
+				utils.LogInfo(fmt.Sprintf("Migrated site %s to the site registry", site.Name))
+			}
+		}
+		return sites, nil
+	})
+}
+
+func (r *SiteRegistry) index(name string) int {
+	return indexOf(r.sites, name)
+}
+
+func indexOf(sites []Site, name string) int {
+	for i, s := range sites {
+		if s.Name == name {
+			return i
+		}
+	}
+	// Allow the short name without domain extension
+	for i, s := range sites {
+		if strings.SplitN(s.Name, ".", 2)[0] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// modify applies fn to the current on-disk state under the cross-process lock
+func (r *SiteRegistry) modify(fn func([]Site) ([]Site, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := lockFile(r.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r.modTime = time.Time{}
+	r.refresh()
+
+	sites := make([]Site, len(r.sites))
+	copy(sites, r.sites)
+	sites, err = fn(sites)
+	if err != nil {
+		return err
+	}
+	return r.save(sites)
+}
+
+// refresh reloads sites.json if it changed since the last read
+func (r *SiteRegistry) refresh() {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		r.sites = nil
+		return
+	}
+	if info.ModTime().Equal(r.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return
+	}
+
+	var file sitesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		// Versions before the registry stored a bare array
+		var legacy []Site
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			utils.LogError(fmt.Sprintf("Failed to parse %s: %v", r.path, err))
+			return
+		}
+		file.Sites = legacy
+	}
+	r.sites = file.Sites
+	r.modTime = info.ModTime()
+}
+
+func (r *SiteRegistry) save(sites []Site) error {
+	data, err := json.MarshalIndent(sitesFile{Version: sitesFileVersion, Sites: sites}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return err
+	}
+
+	r.sites = sites
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// lockFile creates path exclusively, waiting for other processes to release
+// it. Locks older than lockStaleAfter are assumed abandoned.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(2 * lockStaleAfter)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > lockStaleAfter {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,260 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+const (
+	socketName = "stacker.sock"
+	tokenName  = "control.token"
+
+	// maxSocketPath stays below the sun_path limit (104 on macOS, 108 on Linux)
+	maxSocketPath = 100
+)
+
+// ErrNotRunning is returned by Dial when no instance owns the control socket
+var ErrNotRunning = errors.New("no running Stacker instance")
+
+// HandlerFunc handles one control method. args is the raw JSON request body.
+type HandlerFunc func(args json.RawMessage) (interface{}, error)
+
+// Response is the envelope returned for every call
+type Response struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// SocketPath returns the control socket location. Long data dirs (e.g. inside
+// an .app bundle) fall back to the temp dir to stay within the socket path limit.
+func SocketPath() string {
+	path := filepath.Join(utils.GetStackerDir(), socketName)
+	if len(path) > maxSocketPath {
+		path = filepath.Join(os.TempDir(), fmt.Sprintf("stacker-%d.sock", os.Getuid()))
+	}
+	return path
+}
+
+func tokenPath() string {
+	return filepath.Join(utils.GetStackerDir(), tokenName)
+}
+
+// Server exposes control methods on a token-authenticated Unix socket
+type Server struct {
+	path     string
+	token    string
+	handlers map[string]HandlerFunc
+	listener net.Listener
+	server   *http.Server
+	mu       sync.RWMutex
+}
+
+// NewServer creates a control server on the default socket path
+func NewServer() *Server {
+	return &Server{
+		path:     SocketPath(),
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Handle registers a method such as "services.start"
+func (s *Server) Handle(method string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = handler
+}
+
+// Start creates the socket and a fresh token and serves requests in the
+// background. It fails if another instance already owns the socket.
+func (s *Server) Start() error {
+	if _, err := os.Stat(s.path); err == nil {
+		if conn, err := net.DialTimeout("unix", s.path, time.Second); err == nil {
+			conn.Close()
+			return fmt.Errorf("another Stacker instance is already listening on %s", s.path)
+		}
+		// Left behind by an instance that did not shut down cleanly
+		os.Remove(s.path)
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	s.token = hex.EncodeToString(token)
+	if err := os.MkdirAll(filepath.Dir(tokenPath()), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tokenPath(), []byte(s.token), 0600); err != nil {
+		return fmt.Errorf("failed to write control token: %w", err)
+	}
+
+	ln, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.path, err)
+	}
+	os.Chmod(s.path, 0600)
+	s.listener = ln
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/", s.handleCall)
+	s.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			utils.LogError(fmt.Sprintf("Control socket stopped: %v", err))
+		}
+	}()
+
+	utils.LogInfo(fmt.Sprintf("Control socket listening on %s", s.path))
+	return nil
+}
+
+// Stop closes the socket and removes the socket and token files
+func (s *Server) Stop() {
+	if s.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		s.server.Shutdown(ctx)
+	}
+	os.Remove(s.path)
+	os.Remove(tokenPath())
+}
+
+func (s *Server) handleCall(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Error: "invalid control token"})
+		return
+	}
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Error: "method not allowed"})
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/v1/")
+	s.mu.RLock()
+	handler, ok := s.handlers[method]
+	s.mu.RUnlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Error: "unknown method " + method})
+		return
+	}
+
+	var args json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Error: "invalid arguments: " + err.Error()})
+		return
+	}
+
+	result, err := handler(args)
+	if err != nil {
+		json.NewEncoder(w).Encode(Response{Error: err.Error()})
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		json.NewEncoder(w).Encode(Response{Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(Response{OK: true, Result: data})
+}
+
+// Client calls methods on a running instance
+type Client struct {
+	token string
+	http  *http.Client
+}
+
+// Dial connects to the running instance. It returns ErrNotRunning when there
+// is none, so callers can fall back to direct mode.
+func Dial() (*Client, error) {
+	path := SocketPath()
+	if _, err := os.Stat(path); err != nil {
+		return nil, ErrNotRunning
+	}
+	token, err := os.ReadFile(tokenPath())
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+
+	c := &Client{
+		token: strings.TrimSpace(string(token)),
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					d.Timeout = time.Second
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+
+	if err := c.Call("ping", nil, nil); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) || errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotRunning
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// Call invokes a method with args and decodes its result into result (if non-nil)
+func (c *Client) Call(method string, args interface{}, result interface{}) error {
+	var body []byte
+	if args != nil {
+		var err error
+		if body, err = json.Marshal(args); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", "http://stacker/v1/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res Response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("invalid control response: %w", err)
+	}
+	if !res.OK {
+		return errors.New(res.Error)
+	}
+	if result != nil && len(res.Result) > 0 {
+		return json.Unmarshal(res.Result, result)
+	}
+	return nil
+}
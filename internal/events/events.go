@@ -0,0 +1,308 @@
+// Package events carries service lifecycle events to any number of
+// subscribers: the tray, the web UI over SSE and local webhooks. Events are
+// kept in a history that survives restarts.
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is the kind of an event
+type Type string
+
+// Event types
+const (
+	Started         Type = "started"
+	Stopped         Type = "stopped"
+	Exited          Type = "exited" // unexpected exit, before the restart policy decides
+	Crashed         Type = "crashed"
+	Restarting      Type = "restarting"
+	InstallProgress Type = "install-progress"
+	ConfigChanged   Type = "config-changed"
+	Reloaded        Type = "reloaded"
+)
+
+// Types lists every event type
+var Types = []Type{Started, Stopped, Exited, Crashed, Restarting, InstallProgress, ConfigChanged, Reloaded}
+
+// maxHistory is the number of events kept, in memory and on disk
+const maxHistory = 1000
+
+// Event is something that happened to a service
+type Event struct {
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	Type     Type      `json:"type"`
+	Service  string    `json:"service,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	PID      int       `json:"pid,omitempty"`
+	Attempt  int       `json:"attempt,omitempty"`  // restart attempt
+	Backoff  string    `json:"backoff,omitempty"`  // delay before the restart
+	Progress int       `json:"progress,omitempty"` // install progress in percent, -1 on failure
+}
+
+// Transient reports whether an event is an intermediate install step. Those
+// reach subscribers but are not kept or sent to webhooks.
+func (e Event) Transient() bool {
+	return e.Type == InstallProgress && e.Progress >= 0 && e.Progress < 100
+}
+
+// Filter selects events. Zero values match everything.
+type Filter struct {
+	Service string `json:"service,omitempty"`
+	Types   []Type `json:"types,omitempty"`
+	After   int64  `json:"after,omitempty"` // only events with a higher ID
+	Limit   int    `json:"limit,omitempty"` // newest events only
+}
+
+// Match reports whether an event passes the filter, ignoring Limit
+func (f Filter) Match(e Event) bool {
+	if f.Service != "" && e.Service != f.Service {
+		return false
+	}
+	if f.After > 0 && e.ID <= f.After {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus delivers events to subscribers and keeps their history. Every Stacker
+// process shares the history file: IDs are assigned and the file appended
+// and compacted under a lock, so they stay unique across processes.
+type Bus struct {
+	mu          sync.Mutex
+	path        string
+	history     []Event // when there is no history file
+	lastID      int64
+	written     int // lines this process appended since the last compaction
+	subscribers map[chan Event]bool
+}
+
+// NewBus returns a bus whose history is stored in path, one JSON event per
+// line. An empty path keeps the history in memory only.
+func NewBus(path string) *Bus {
+	b := &Bus{
+		path:        path,
+		subscribers: make(map[chan Event]bool),
+	}
+	if f, err := os.Open(path); err == nil {
+		b.lastID = lastEventID(f)
+		f.Close()
+	}
+	return b
+}
+
+// Publish stamps an event and hands it to every subscriber. Subscribers that
+// fall behind miss events rather than block the publisher, so Publish is safe
+// to call while holding locks.
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Transient() {
+		// Not kept, so it takes the position of the last kept event
+		event.ID = b.lastID
+	} else {
+		b.persist(&event)
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	b.mu.Unlock()
+
+	if !event.Transient() {
+		deliverWebhooks(event)
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on
+func (b *Bus) Subscribe() chan Event {
+	ch := make(chan Event, 100)
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe stops and closes a channel returned by Subscribe
+func (b *Bus) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[ch] {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// History returns the kept events that match a filter, oldest first,
+// including those published by other processes
+func (b *Bus) History(filter Filter) []Event {
+	b.mu.Lock()
+	history := b.history
+	if b.path != "" {
+		history = readHistory(b.path)
+	}
+	b.mu.Unlock()
+
+	result := []Event{}
+	for _, event := range history {
+		if filter.Match(event) {
+			result = append(result, event)
+		}
+	}
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[len(result)-filter.Limit:]
+	}
+	return result
+}
+
+// readHistory reads the newest maxHistory events of a history file. A line
+// being appended by another process is skipped.
+func readHistory(path string) []Event {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var history []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		history = append(history, event)
+	}
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	return history
+}
+
+// lastEventID returns the ID of the last event in a history file
+func lastEventID(f *os.File) int64 {
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	offset := info.Size() - 64*1024
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil {
+		return 0
+	}
+	lines := strings.Split(strings.TrimRight(string(tail), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		var event Event
+		if json.Unmarshal([]byte(lines[i]), &event) == nil {
+			return event.ID
+		}
+	}
+	return 0
+}
+
+// persist assigns the next ID to an event and appends it to the history
+// file, compacting the file once this process has added twice the kept
+// history. Called with b.mu held.
+func (b *Bus) persist(event *Event) {
+	if b.path == "" {
+		b.lastID++
+		event.ID = b.lastID
+		b.history = append(b.history, *event)
+		if len(b.history) > maxHistory {
+			b.history = b.history[len(b.history)-maxHistory:]
+		}
+		return
+	}
+
+	os.MkdirAll(filepath.Dir(b.path), 0755)
+	// The lock file outlives compaction, which replaces the history file
+	lock, err := os.OpenFile(b.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err == nil {
+		defer lock.Close()
+		if lockFile(lock) == nil {
+			defer unlockFile(lock)
+		}
+	}
+
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		b.lastID++
+		event.ID = b.lastID
+		return
+	}
+	defer f.Close()
+	if last := lastEventID(f); last > b.lastID {
+		b.lastID = last
+	}
+	b.lastID++
+	event.ID = b.lastID
+
+	if data, err := json.Marshal(event); err == nil {
+		f.Write(append(data, '\n'))
+		b.written++
+	}
+	if b.written >= maxHistory {
+		b.compact()
+	}
+}
+
+// compact rewrites the history file with the kept events only once it holds
+// twice as many. Called with the lock file held.
+func (b *Bus) compact() {
+	b.written = 0
+	f, err := os.Open(b.path)
+	if err != nil {
+		return
+	}
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	f.Close()
+	if len(lines) < 2*maxHistory {
+		return
+	}
+	lines = lines[len(lines)-maxHistory:]
+
+	tmp := b.path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(out)
+	for _, line := range lines {
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return
+	}
+	out.Close()
+	os.Rename(tmp, b.path)
+}
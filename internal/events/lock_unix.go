@@ -0,0 +1,17 @@
+//go:build !windows
+
+package events
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f, shared with other processes
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// webhookTimeout bounds each webhook request
+const webhookTimeout = 5 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// Webhooks returns the configured webhooks
+func Webhooks() []config.EventWebhook {
+	return append([]config.EventWebhook{}, config.GetPreferences().EventWebhooks...)
+}
+
+// AddWebhook registers a webhook, replacing one with the same URL
+func AddWebhook(hook config.EventWebhook) error {
+	if err := validateWebhookURL(hook.URL); err != nil {
+		return err
+	}
+	for _, name := range hook.Events {
+		if !knownType(Type(name)) {
+			return fmt.Errorf("unknown event type %q", name)
+		}
+	}
+
+	p := config.GetPreferences()
+	hooks := []config.EventWebhook{}
+	for _, existing := range p.EventWebhooks {
+		if existing.URL != hook.URL {
+			hooks = append(hooks, existing)
+		}
+	}
+	p.EventWebhooks = append(hooks, hook)
+	return p.Save()
+}
+
+// RemoveWebhook deletes the webhook with the given URL
+func RemoveWebhook(rawURL string) error {
+	p := config.GetPreferences()
+	hooks := []config.EventWebhook{}
+	for _, existing := range p.EventWebhooks {
+		if existing.URL != rawURL {
+			hooks = append(hooks, existing)
+		}
+	}
+	if len(hooks) == len(p.EventWebhooks) {
+		return fmt.Errorf("webhook %s not found", rawURL)
+	}
+	p.EventWebhooks = hooks
+	return p.Save()
+}
+
+// validateWebhookURL accepts http(s) URLs on this machine only, so events
+// never leave it
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use http or https")
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("webhook URL must point to localhost or a loopback address, not %q", host)
+}
+
+func knownType(t Type) bool {
+	for _, known := range Types {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhooks posts an event to every webhook subscribed to its type
+func deliverWebhooks(event Event) {
+	hooks := config.GetPreferences().EventWebhooks
+	if len(hooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for _, hook := range hooks {
+		if !wants(hook, event.Type) || validateWebhookURL(hook.URL) != nil {
+			continue
+		}
+		go postWebhook(hook.URL, event.Type, body)
+	}
+}
+
+func wants(hook config.EventWebhook, t Type) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, name := range hook.Events {
+		if Type(name) == t {
+			return true
+		}
+	}
+	return false
+}
+
+func postWebhook(target string, t Type, body []byte) {
+	req, err := http.NewRequest("POST", target, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Stacker")
+	req.Header.Set("X-Stacker-Event", string(t))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		utils.LogWarn(fmt.Sprintf("Webhook %s failed: %v", target, err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		utils.LogWarn(fmt.Sprintf("Webhook %s answered %s", target, resp.Status))
+	}
+}
@@ -0,0 +1,119 @@
+package forge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// EnvChange describes how a key differs between two .env files
+type EnvChange struct {
+	Key    string `json:"key"`
+	Kind   string `json:"kind"` // "added", "removed" or "changed", seen from the source side
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// sensitiveKeyParts mark keys whose values are masked in diffs
+var sensitiveKeyParts = []string{"KEY", "SECRET", "PASSWORD", "PASS", "TOKEN", "PRIVATE", "CREDENTIAL", "AUTH", "DSN"}
+
+// ParseEnv reads KEY=VALUE pairs from .env content. Comments, blank lines
+// and export prefixes are ignored; surrounding quotes are removed.
+func ParseEnv(content string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := utils.ParseEnvLine(line)
+		if ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// DiffEnv compares source against target. "added" keys exist only in source,
+// "removed" keys only in target. Changes are sorted by key.
+func DiffEnv(source, target string) []EnvChange {
+	src := ParseEnv(source)
+	dst := ParseEnv(target)
+
+	var changes []EnvChange
+	for key, value := range src {
+		current, ok := dst[key]
+		switch {
+		case !ok:
+			changes = append(changes, EnvChange{Key: key, Kind: "added", Source: value})
+		case current != value:
+			changes = append(changes, EnvChange{Key: key, Kind: "changed", Source: value, Target: current})
+		}
+	}
+	for key, value := range dst {
+		if _, ok := src[key]; !ok {
+			changes = append(changes, EnvChange{Key: key, Kind: "removed", Target: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// IsSensitiveKey reports whether a key likely holds a secret
+func IsSensitiveKey(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(upper, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskValue hides the value of sensitive keys entirely, showing only its
+// length so a change can still be noticed.
+func MaskValue(key, value string) string {
+	if !IsSensitiveKey(key) || value == "" {
+		return value
+	}
+	return fmt.Sprintf("******** (%d chars)", utf8.RuneCountInString(value))
+}
+
+// MergeEnv applies updates to .env content, keeping comments and the order
+// of existing lines. New keys are appended; keys in remove are dropped.
+func MergeEnv(content string, updates map[string]string, remove []string) string {
+	removed := make(map[string]bool, len(remove))
+	for _, key := range remove {
+		removed[key] = true
+	}
+	written := make(map[string]bool, len(updates))
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		key, _, ok := utils.ParseEnvLine(line)
+		if ok && removed[key] {
+			continue
+		}
+		if value, update := updates[key]; ok && update {
+			line = key + "=" + utils.QuoteEnvValue(value)
+			written[key] = true
+		}
+		lines = append(lines, line)
+	}
+
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		if !written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, key+"="+utils.QuoteEnvValue(updates[key]))
+	}
+
+	result := strings.Join(lines, "\n")
+	return strings.TrimLeft(result, "\n") + "\n"
+}
@@ -0,0 +1,106 @@
+package forge
+
+import "testing"
+
+func TestMergeEnvRoundTrip(t *testing.T) {
+	values := map[string]string{
+		"PLAIN":      "value",
+		"EMPTY":      "",
+		"SPACES":     "  hello world  ",
+		"HASH":       "abc#def",
+		"NEWLINE":    "line one\nline two",
+		"LITERAL_NL": `C:\new\dir`,
+		"ESCAPED_NL": `say \n not a newline`,
+		"QUOTE":      `he said "hi"`,
+		"ESCAPED_QT": `a\"b`,
+		"SINGLE":     `'single'`,
+		"BACKSLASH":  `ends with \`,
+		"EQUALS":     "a=b=c",
+	}
+
+	merged := MergeEnv("", values, nil)
+	got := ParseEnv(merged)
+	if len(got) != len(values) {
+		t.Errorf("parsed %d keys, want %d:\n%s", len(got), len(values), merged)
+	}
+	for key, want := range values {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %q\n%s", key, got[key], want, merged)
+		}
+	}
+
+	// Merging the parsed values again must not change the file
+	if again := MergeEnv(merged, got, nil); again != merged {
+		t.Errorf("second merge changed the file:\n%s\nwant:\n%s", again, merged)
+	}
+}
+
+func TestMergeEnvKeepsLayout(t *testing.T) {
+	content := `# App settings
+APP_NAME=Stacker
+export APP_ENV=local
+
+# Database
+DB_HOST=127.0.0.1
+DB_PASSWORD="old secret"
+CACHE_DRIVER=file
+`
+	merged := MergeEnv(content, map[string]string{
+		"DB_PASSWORD": "new secret",
+		"APP_ENV":     "production",
+		"MAIL_HOST":   "smtp.example.com",
+		"ADDED":       "1",
+	}, []string{"CACHE_DRIVER", "MISSING"})
+
+	want := `# App settings
+APP_NAME=Stacker
+APP_ENV=production
+
+# Database
+DB_HOST=127.0.0.1
+DB_PASSWORD="new secret"
+ADDED=1
+MAIL_HOST=smtp.example.com
+`
+	if merged != want {
+		t.Errorf("merged:\n%s\nwant:\n%s", merged, want)
+	}
+
+	values := ParseEnv(merged)
+	if _, ok := values["CACHE_DRIVER"]; ok {
+		t.Error("CACHE_DRIVER was not removed")
+	}
+	if values["DB_PASSWORD"] != "new secret" || values["APP_NAME"] != "Stacker" {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	values := ParseEnv("# comment\n\nexport A=1\nB = 'two words'\r\nC=\"x\\ny\"\nnot a pair\n=empty key\n")
+	want := map[string]string{"A": "1", "B": "two words", "C": "x\ny"}
+	if len(values) != len(want) {
+		t.Errorf("values = %q, want %q", values, want)
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("%s = %q, want %q", key, values[key], value)
+		}
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"APP_NAME", "Stacker", "Stacker"},
+		{"DB_PASSWORD", "", ""},
+		{"DB_PASSWORD", "hunter2", "******** (7 chars)"},
+		{"APP_KEY", "base64:abcdefghijklmnop", "******** (23 chars)"},
+		{"stripe_secret", "sk_live_ünïcode", "******** (15 chars)"},
+	}
+	for _, tt := range tests {
+		if got := MaskValue(tt.key, tt.value); got != tt.want {
+			t.Errorf("MaskValue(%q, %q) = %q, want %q", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
@@ -4,16 +4,36 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// DefaultBaseURL is the Laravel Forge API endpoint
+const DefaultBaseURL = "https://forge.laravel.com/api/v1"
+
 type ForgeClient struct {
-	apiKey  string
-	baseURL string
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// ID is a Forge resource ID. The API returns numbers, the CLI passes strings.
+type ID string
+
+// UnmarshalJSON accepts both numeric and string IDs
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*id = ""
+		return nil
+	}
+	*id = ID(strings.Trim(string(data), `"`))
+	return nil
 }
 
 type ForgeServer struct {
-	ID     string `json:"id"`
+	ID     ID     `json:"id"`
 	Name   string `json:"name"`
 	IP     string `json:"ip_address"`
 	Type   string `json:"type"`
@@ -21,118 +41,289 @@ type ForgeServer struct {
 }
 
 type ForgeSite struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	ServerID string `json:"server_id"`
-	Status   string `json:"status"`
+	ID               ID     `json:"id"`
+	Name             string `json:"name"`
+	ServerID         ID     `json:"server_id"`
+	Status           string `json:"status"`
+	Repository       string `json:"repository"`
+	Branch           string `json:"repository_branch"`
+	DeploymentStatus string `json:"deployment_status"` // "", "queued" or "deploying"
+}
+
+// Deployment is an entry of a site's deployment history
+type Deployment struct {
+	ID            ID     `json:"id"`
+	ServerID      ID     `json:"server_id"`
+	SiteID        ID     `json:"site_id"`
+	Type          string `json:"displayable_type"`
+	CommitHash    string `json:"commit_hash"`
+	CommitAuthor  string `json:"commit_author"`
+	CommitMessage string `json:"commit_message"`
+	Status        string `json:"status"` // "deploying", "finished" or "failed"
+	StartedAt     string `json:"started_at"`
+	EndedAt       string `json:"ended_at"`
+}
+
+// Finished reports whether the deployment has completed, successfully or not
+func (d Deployment) Finished() bool {
+	return d.Status == "finished" || d.Status == "failed"
+}
+
+// APIError is returned for non-2xx responses
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("forge API returned %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("forge API returned %d", e.StatusCode)
 }
 
 func NewForgeClient(apiKey string) *ForgeClient {
 	return &ForgeClient{
-		apiKey:  apiKey,
-		baseURL: "https://forge.laravel.com/api/v1",
+		apiKey:     apiKey,
+		baseURL:    DefaultBaseURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
-func (fc *ForgeClient) GetServers() ([]ForgeServer, error) {
-	req, _ := http.NewRequest("GET", fc.baseURL+"/servers", nil)
+// SetBaseURL points the client at another API endpoint (e.g. a test server)
+func (fc *ForgeClient) SetBaseURL(baseURL string) {
+	fc.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// BaseURL returns the API endpoint in use
+func (fc *ForgeClient) BaseURL() string {
+	return fc.baseURL
+}
+
+// request performs an API call and returns the response body. Non-2xx
+// responses are returned as *APIError.
+func (fc *ForgeClient) request(method, path string, payload interface{}) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, fc.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Authorization", "Bearer "+fc.apiKey)
 	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := fc.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var result struct {
-		Servers []ForgeServer `json:"servers"`
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
 	}
 
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result.Servers, nil
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &msg) == nil {
+			apiErr.Message = msg.Message
+		}
+		return nil, apiErr
+	}
+
+	return data, nil
 }
 
-func (fc *ForgeClient) GetSites(serverID string) ([]ForgeSite, error) {
-	req, _ := http.NewRequest("GET", fc.baseURL+"/servers/"+serverID+"/sites", nil)
-	req.Header.Set("Authorization", "Bearer "+fc.apiKey)
-	req.Header.Set("Accept", "application/json")
+// getJSON performs a GET request and decodes the JSON response into out
+func (fc *ForgeClient) getJSON(path string, out interface{}) error {
+	data, err := fc.request("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// getText performs a GET request for endpoints that return plain text, a
+// JSON encoded string or a {"content": ...} object.
+func (fc *ForgeClient) getText(path string) (string, error) {
+	data, err := fc.request("GET", path, nil)
 	if err != nil {
+		return "", err
+	}
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		return text, nil
+	}
+	var wrapped struct {
+		Content *string `json:"content"`
+	}
+	if json.Unmarshal(data, &wrapped) == nil && wrapped.Content != nil {
+		return *wrapped.Content, nil
+	}
+	return string(data), nil
+}
+
+func sitePath(serverID, siteID string) string {
+	return "/servers/" + serverID + "/sites/" + siteID
+}
+
+func (fc *ForgeClient) GetServers() ([]ForgeServer, error) {
+	var result struct {
+		Servers []ForgeServer `json:"servers"`
+	}
+	if err := fc.getJSON("/servers", &result); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return result.Servers, nil
+}
 
+func (fc *ForgeClient) GetSites(serverID string) ([]ForgeSite, error) {
 	var result struct {
 		Sites []ForgeSite `json:"sites"`
 	}
-
-	json.NewDecoder(resp.Body).Decode(&result)
+	if err := fc.getJSON("/servers/"+serverID+"/sites", &result); err != nil {
+		return nil, err
+	}
 	return result.Sites, nil
 }
 
+// GetSite returns a single site including its current deployment status
+func (fc *ForgeClient) GetSite(serverID, siteID string) (*ForgeSite, error) {
+	var result struct {
+		Site ForgeSite `json:"site"`
+	}
+	if err := fc.getJSON(sitePath(serverID, siteID), &result); err != nil {
+		return nil, err
+	}
+	return &result.Site, nil
+}
+
 func (fc *ForgeClient) DeploySite(serverID, siteID string) error {
-	req, _ := http.NewRequest("POST", fc.baseURL+"/servers/"+serverID+"/sites/"+siteID+"/deploy", nil)
-	req.Header.Set("Authorization", "Bearer "+fc.apiKey)
-	req.Header.Set("Accept", "application/json")
+	if _, err := fc.request("POST", sitePath(serverID, siteID)+"/deployment/deploy", nil); err != nil {
+		return fmt.Errorf("deployment failed: %w", err)
+	}
+	return nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+// GetDeployments returns the deployment history of a site, newest first
+func (fc *ForgeClient) GetDeployments(serverID, siteID string) ([]Deployment, error) {
+	var result struct {
+		Deployments []Deployment `json:"deployments"`
 	}
-	defer resp.Body.Close()
+	if err := fc.getJSON(sitePath(serverID, siteID)+"/deployment-history", &result); err != nil {
+		return nil, err
+	}
+	return result.Deployments, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("deployment failed with status %d", resp.StatusCode)
+// GetDeploymentOutput returns the output of a deployment from the history
+func (fc *ForgeClient) GetDeploymentOutput(serverID, siteID, deploymentID string) (string, error) {
+	var result struct {
+		Output string `json:"output"`
 	}
+	if err := fc.getJSON(sitePath(serverID, siteID)+"/deployment-history/"+deploymentID+"/output", &result); err != nil {
+		return "", err
+	}
+	return result.Output, nil
+}
 
-	return nil
+// GetDeploymentLog returns the log of the latest deployment
+func (fc *ForgeClient) GetDeploymentLog(serverID, siteID string) (string, error) {
+	return fc.getText(sitePath(serverID, siteID) + "/deployment/log")
 }
 
-func (fc *ForgeClient) GetSiteEnv(serverID, siteID string) (string, error) {
-	req, _ := http.NewRequest("GET", fc.baseURL+"/servers/"+serverID+"/sites/"+siteID+"/env", nil)
-	req.Header.Set("Authorization", "Bearer "+fc.apiKey)
-	req.Header.Set("Accept", "application/json")
+// GetDeploymentScript returns the site's deploy script
+func (fc *ForgeClient) GetDeploymentScript(serverID, siteID string) (string, error) {
+	return fc.getText(sitePath(serverID, siteID) + "/deployment/script")
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// UpdateDeploymentScript replaces the site's deploy script
+func (fc *ForgeClient) UpdateDeploymentScript(serverID, siteID, content string) error {
+	_, err := fc.request("PUT", sitePath(serverID, siteID)+"/deployment/script", map[string]interface{}{
+		"content": content,
+	})
 	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	return nil
+}
+
+// LatestDeploymentID returns the ID of the most recent deployment, or "" if
+// the site has never been deployed. Pass it to WaitForDeployment before
+// triggering a new deployment.
+func (fc *ForgeClient) LatestDeploymentID(serverID, siteID string) (string, error) {
+	deployments, err := fc.GetDeployments(serverID, siteID)
+	if err != nil || len(deployments) == 0 {
 		return "", err
 	}
-	defer resp.Body.Close()
+	return string(deployments[0].ID), nil
+}
 
-	var result struct {
-		Content string `json:"content"`
+// WaitForDeployment polls until a deployment newer than previousID has
+// finished or the timeout expires. onOutput, if set, receives new deployment
+// output as it appears. A failed deployment is returned together with an error.
+func (fc *ForgeClient) WaitForDeployment(serverID, siteID, previousID string, interval, timeout time.Duration, onOutput func(string)) (*Deployment, error) {
+	deadline := time.Now().Add(timeout)
+	printed := 0
+
+	for {
+		deployments, err := fc.GetDeployments(serverID, siteID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Until Forge picks up the deployment the history still ends with the previous one
+		if len(deployments) > 0 && string(deployments[0].ID) != previousID {
+			latest := deployments[0]
+			if onOutput != nil {
+				output, err := fc.GetDeploymentOutput(serverID, siteID, string(latest.ID))
+				if err == nil && len(output) > printed {
+					onOutput(output[printed:])
+					printed = len(output)
+				}
+			}
+
+			if latest.Finished() {
+				if latest.Status == "failed" {
+					return &latest, fmt.Errorf("deployment %s failed", latest.ID)
+				}
+				return &latest, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for deployment", timeout)
+		}
+		time.Sleep(interval)
 	}
+}
 
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result.Content, nil
+func (fc *ForgeClient) GetSiteEnv(serverID, siteID string) (string, error) {
+	return fc.getText(sitePath(serverID, siteID) + "/env")
 }
 
 func (fc *ForgeClient) UpdateSiteEnv(serverID, siteID, content string) error {
-	body, _ := json.Marshal(map[string]string{
+	_, err := fc.request("PUT", sitePath(serverID, siteID)+"/env", map[string]string{
 		"content": content,
 	})
-
-	req, _ := http.NewRequest("PUT", fc.baseURL+"/servers/"+serverID+"/sites/"+siteID+"/env", bytes.NewReader(body))
-	req.Header.Set("Authorization", "Bearer "+fc.apiKey)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("update failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("update failed with status %d", resp.StatusCode)
-	}
-
 	return nil
 }
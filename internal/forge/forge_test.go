@@ -0,0 +1,208 @@
+package forge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClient returns a client talking to a test server running handler
+func testClient(t *testing.T, handler http.HandlerFunc) *ForgeClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewForgeClient("test-key")
+	client.SetBaseURL(server.URL + "/")
+	return client
+}
+
+func TestReadReturnsAPIError(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message": "Unauthenticated."}`)
+	})
+
+	reads := map[string]func() error{
+		"GetServers": func() error { _, err := client.GetServers(); return err },
+		"GetSites":   func() error { _, err := client.GetSites("1"); return err },
+		"GetSite":    func() error { _, err := client.GetSite("1", "2"); return err },
+		"GetSiteEnv": func() error { _, err := client.GetSiteEnv("1", "2"); return err },
+		"GetDeploymentLog": func() error {
+			_, err := client.GetDeploymentLog("1", "2")
+			return err
+		},
+	}
+	for name, read := range reads {
+		var apiErr *APIError
+		if err := read(); !errors.As(err, &apiErr) {
+			t.Errorf("%s: error = %v, want *APIError", name, err)
+			continue
+		}
+		if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Unauthenticated." {
+			t.Errorf("%s: got %d %q", name, apiErr.StatusCode, apiErr.Message)
+		}
+	}
+}
+
+func TestReadReturnsAPIErrorWithoutMessage(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, "<html>Bad Gateway</html>")
+	})
+
+	_, err := client.GetServers()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Message != "" {
+		t.Fatalf("error = %v, want a 502 *APIError without message", err)
+	}
+	if err.Error() != "forge API returned 502" {
+		t.Errorf("message = %q", err.Error())
+	}
+}
+
+func TestReadReportsInvalidJSON(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"servers": [{"id": 1,`)
+	})
+
+	_, err := client.GetServers()
+	if err == nil || !strings.Contains(err.Error(), "invalid response from /servers") {
+		t.Fatalf("error = %v, want an invalid response error", err)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		t.Errorf("decode error reported as API error: %v", err)
+	}
+}
+
+func TestGetServersAcceptsNumericIDs(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/servers" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"servers": [{"id": 12, "name": "web"}, {"id": "13", "name": "db"}]}`)
+	})
+
+	servers, err := client.GetServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 || servers[0].ID != "12" || servers[1].ID != "13" {
+		t.Errorf("servers = %+v", servers)
+	}
+}
+
+// deployServer serves a deployment history that advances one step per poll
+type deployServer struct {
+	mu      sync.Mutex
+	history [][]Deployment // history returned by each poll, the last repeated
+	outputs []string       // output returned by each output request
+	polls   int
+	reads   int
+}
+
+func (d *deployServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/output"):
+		output := d.outputs[len(d.outputs)-1]
+		if d.reads < len(d.outputs) {
+			output = d.outputs[d.reads]
+		}
+		d.reads++
+		fmt.Fprintf(w, `{"output": %q}`, output)
+	case strings.HasSuffix(r.URL.Path, "/deployment-history"):
+		history := d.history[len(d.history)-1]
+		if d.polls < len(d.history) {
+			history = d.history[d.polls]
+		}
+		d.polls++
+		var entries []string
+		for _, deployment := range history {
+			entries = append(entries, fmt.Sprintf(`{"id": %s, "status": %q}`, deployment.ID, deployment.Status))
+		}
+		fmt.Fprintf(w, `{"deployments": [%s]}`, strings.Join(entries, ","))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestWaitForDeploymentStreamsOutput(t *testing.T) {
+	previous := []Deployment{{ID: "7", Status: "finished"}}
+	deploys := &deployServer{
+		history: [][]Deployment{
+			previous, // not picked up yet
+			{{ID: "8", Status: "deploying"}, previous[0]},
+			{{ID: "8", Status: "finished"}, previous[0]},
+		},
+		outputs: []string{"Cloning\n", "Cloning\nMigrating\n"},
+	}
+	client := testClient(t, deploys.ServeHTTP)
+
+	var output strings.Builder
+	deployment, err := client.WaitForDeployment("1", "2", "7", time.Millisecond, 5*time.Second, func(s string) {
+		output.WriteString(s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.ID != "8" || deployment.Status != "finished" {
+		t.Errorf("deployment = %+v", deployment)
+	}
+	if output.String() != "Cloning\nMigrating\n" {
+		t.Errorf("output = %q, want each line once", output.String())
+	}
+	if deploys.polls != 3 {
+		t.Errorf("polls = %d, want 3", deploys.polls)
+	}
+}
+
+func TestWaitForDeploymentFailed(t *testing.T) {
+	client := testClient(t, (&deployServer{
+		history: [][]Deployment{{{ID: "8", Status: "failed"}}},
+		outputs: []string{""},
+	}).ServeHTTP)
+
+	deployment, err := client.WaitForDeployment("1", "2", "", time.Millisecond, 5*time.Second, nil)
+	if err == nil || err.Error() != "deployment 8 failed" {
+		t.Fatalf("error = %v, want deployment 8 failed", err)
+	}
+	if deployment == nil || deployment.Status != "failed" {
+		t.Errorf("deployment = %+v, want the failed deployment", deployment)
+	}
+}
+
+func TestWaitForDeploymentTimesOut(t *testing.T) {
+	client := testClient(t, (&deployServer{
+		history: [][]Deployment{{{ID: "7", Status: "finished"}}},
+		outputs: []string{""},
+	}).ServeHTTP)
+
+	_, err := client.WaitForDeployment("1", "2", "7", time.Millisecond, 20*time.Millisecond, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("error = %v, want a timeout", err)
+	}
+}
+
+func TestWaitForDeploymentStopsOnAPIError(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Site not found."}`)
+	})
+
+	_, err := client.WaitForDeployment("1", "2", "", time.Millisecond, 5*time.Second, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("error = %v, want a 404 *APIError", err)
+	}
+}
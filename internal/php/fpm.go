@@ -1,10 +1,12 @@
 package php
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -94,6 +96,7 @@ func (fm *FPMManager) StartFPM(version string) error {
 
 	// Start PHP-FPM
 	cmd := exec.Command(binary, "-y", configPath, "-F")
+	cmd.Env = append(os.Environ(), ScanDirEnv(version))
 
 	// Setup logging
 	logFile := filepath.Join(fm.logDir, fmt.Sprintf("php-fpm-%s.log", version))
@@ -156,6 +159,41 @@ func (fm *FPMManager) StopFPM(version string) error {
 	return nil
 }
 
+// Reload gracefully reloads a running PHP-FPM pool so it re-reads its
+// configuration and ini files without dropping in-flight requests.
+func (fm *FPMManager) Reload(version string) error {
+	fm.mu.RLock()
+	pid := 0
+	if pool, exists := fm.pools[version]; exists && pool.Running {
+		pid = pool.PID
+	}
+	fm.mu.RUnlock()
+
+	// Pools started by another Stacker process are only known by PID file
+	if pid == 0 {
+		pid = fm.loadPID(version)
+	}
+	if pid == 0 {
+		return fmt.Errorf("PHP-FPM %s is not running", version)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("PHP-FPM %s process not found: %w", version, err)
+	}
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		fm.removePID(version)
+		return fmt.Errorf("PHP-FPM %s is not running", version)
+	}
+
+	if err := SignalReload(process); err != nil {
+		return fmt.Errorf("failed to reload PHP-FPM %s: %w", version, err)
+	}
+
+	fmt.Printf("🔄 PHP-FPM %s reloaded (PID: %d)\n", version, pid)
+	return nil
+}
+
 // GetRunningFPM returns a list of running FPM versions
 func (fm *FPMManager) GetRunningFPM() []string {
 	fm.mu.RLock()
@@ -189,6 +227,37 @@ func (fm *FPMManager) IsRunning(version string) bool {
 	return pool.Running
 }
 
+// ConfDir returns the Stacker-managed conf.d directory for a PHP version.
+// Extension ini files (e.g. Xdebug) are dropped here instead of being
+// appended to php.ini.
+func ConfDir(version string) string {
+	return filepath.Join(utils.GetStackerDir(), "conf", "php", version, "conf.d")
+}
+
+// ScanDirEnv returns the PHP_INI_SCAN_DIR entry that adds the Stacker conf.d
+// directory for a version. The leading separator keeps PHP's compiled-in
+// scan directory in front of ours.
+func ScanDirEnv(version string) string {
+	return "PHP_INI_SCAN_DIR=" + string(os.PathListSeparator) + ConfDir(version)
+}
+
+// MinorVersion trims a PHP version such as 8.3.12 to 8.3, the form conf.d
+// directories and PID files are keyed by
+func MinorVersion(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// FPMPIDFile is the PID file of the PHP-FPM master for a version. Every
+// Stacker process that starts or signals PHP-FPM uses it, whichever started
+// the pool.
+func FPMPIDFile(version string) string {
+	return filepath.Join(utils.GetStackerDir(), "pids", "php-fpm-"+MinorVersion(version)+".pid")
+}
+
 // findFPMBinary locates the php-fpm binary for a version
 func (fm *FPMManager) findFPMBinary(version string) string {
 	// Check Stacker installed PHP
@@ -222,7 +291,7 @@ func (fm *FPMManager) findFPMBinary(version string) string {
 // generateConfig creates a PHP-FPM config file for the version
 func (fm *FPMManager) generateConfig(version string, port int) (string, error) {
 	configPath := filepath.Join(fm.confDir, fmt.Sprintf("php-fpm-%s.conf", version))
-	pidFile := filepath.Join(fm.pidDir, fmt.Sprintf("php-fpm-%s.pid", version))
+	pidFile := FPMPIDFile(version)
 	errorLog := filepath.Join(fm.logDir, fmt.Sprintf("php-fpm-%s-error.log", version))
 
 	config := fmt.Sprintf(`[global]
@@ -247,6 +316,8 @@ security.limit_extensions = .php
 pm.status_path = /fpm-status
 `, pidFile, errorLog, port)
 
+	config += fm.poolEnvConfig(version)
+
 	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
 		return "", err
 	}
@@ -254,6 +325,95 @@ pm.status_path = /fpm-status
 	return configPath, nil
 }
 
+// poolEnvPath is where project environment variables for a version's pool are kept
+func (fm *FPMManager) poolEnvPath(version string) string {
+	return filepath.Join(fm.confDir, fmt.Sprintf("env-%s.json", version))
+}
+
+// loadPoolEnv returns the environment of a version's pool, keyed by owner
+// (the project that exported it)
+func (fm *FPMManager) loadPoolEnv(version string) map[string]map[string]string {
+	owners := make(map[string]map[string]string)
+	if data, err := os.ReadFile(fm.poolEnvPath(version)); err == nil {
+		json.Unmarshal(data, &owners)
+	}
+	return owners
+}
+
+// SetPoolEnv exports env into the pool of a PHP version on behalf of owner,
+// replacing what owner exported before. An empty env removes owner's
+// variables. A running pool is reloaded to pick up the change.
+func (fm *FPMManager) SetPoolEnv(version, owner string, env map[string]string) error {
+	owners := fm.loadPoolEnv(version)
+	if len(env) == 0 {
+		delete(owners, owner)
+	} else {
+		owners[owner] = env
+	}
+
+	if len(owners) == 0 {
+		os.Remove(fm.poolEnvPath(version))
+	} else {
+		data, err := json.MarshalIndent(owners, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(fm.poolEnvPath(version), data, 0600); err != nil {
+			return err
+		}
+	}
+
+	if fm.IsRunning(version) || fm.loadPID(version) > 0 {
+		if _, err := fm.generateConfig(version, GetPort(version)); err != nil {
+			return err
+		}
+		if err := fm.Reload(version); err != nil {
+			utils.LogWarn(fmt.Sprintf("PHP-FPM %s env updated but not reloaded: %v", version, err))
+		}
+	}
+	return nil
+}
+
+// poolEnvConfig renders env[] directives for all owners of a version's pool.
+// Pools are shared per PHP version, so when two projects export the same key
+// the owner sorted last wins.
+func (fm *FPMManager) poolEnvConfig(version string) string {
+	owners := fm.loadPoolEnv(version)
+	if len(owners) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(owners))
+	for owner := range owners {
+		names = append(names, owner)
+	}
+	sort.Strings(names)
+
+	merged := make(map[string]string)
+	for _, owner := range names {
+		for key, value := range owners[owner] {
+			if previous, exists := merged[key]; exists && previous != value {
+				utils.LogWarn(fmt.Sprintf("PHP-FPM %s: %s is exported by several projects, using %s", version, key, owner))
+			}
+			merged[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("\n; Project environment (stacker up)\n")
+	for _, key := range keys {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(merged[key])
+		fmt.Fprintf(&b, "env[%s] = \"%s\"\n", key, value)
+	}
+	return b.String()
+}
+
 // monitorProcess watches for FPM process exit
 func (fm *FPMManager) monitorProcess(version string, cmd *exec.Cmd, logFile *os.File) {
 	if logFile != nil {
@@ -296,13 +456,13 @@ func (fm *FPMManager) killProcess(pid int) {
 
 // savePID saves PID to file
 func (fm *FPMManager) savePID(version string, pid int) {
-	pidFile := filepath.Join(fm.pidDir, fmt.Sprintf("php-fpm-%s.pid", version))
+	pidFile := FPMPIDFile(version)
 	os.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0644)
 }
 
 // loadPID loads PID from file
 func (fm *FPMManager) loadPID(version string) int {
-	pidFile := filepath.Join(fm.pidDir, fmt.Sprintf("php-fpm-%s.pid", version))
+	pidFile := FPMPIDFile(version)
 	data, err := os.ReadFile(pidFile)
 	if err != nil {
 		return 0
@@ -313,7 +473,7 @@ func (fm *FPMManager) loadPID(version string) int {
 
 // removePID removes PID file
 func (fm *FPMManager) removePID(version string) {
-	pidFile := filepath.Join(fm.pidDir, fmt.Sprintf("php-fpm-%s.pid", version))
+	pidFile := FPMPIDFile(version)
 	os.Remove(pidFile)
 }
 
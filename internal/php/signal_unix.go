@@ -0,0 +1,14 @@
+//go:build !windows
+
+package php
+
+import (
+	"os"
+	"syscall"
+)
+
+// SignalReload asks a PHP-FPM master to gracefully reload its workers and
+// re-read configuration (SIGUSR2).
+func SignalReload(process *os.Process) error {
+	return process.Signal(syscall.SIGUSR2)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package php
+
+import (
+	"fmt"
+	"os"
+)
+
+// SignalReload is not supported on Windows; PHP-FPM does not run there.
+func SignalReload(process *os.Process) error {
+	return fmt.Errorf("graceful reload is not supported on windows")
+}
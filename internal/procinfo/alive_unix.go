@@ -0,0 +1,15 @@
+//go:build !windows
+
+package procinfo
+
+import "syscall"
+
+// Alive reports whether a process exists. A process owned by another user
+// answers signal 0 with EPERM, which still means it exists.
+func Alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
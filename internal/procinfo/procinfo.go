@@ -0,0 +1,97 @@
+// Package procinfo inspects processes and listening sockets without shelling
+// out: /proc on Linux, sysctl and proc_info on macOS and the Win32 API on
+// Windows.
+package procinfo
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for a process that does not exist
+var ErrNotFound = errors.New("process not found")
+
+// Process is a running process. Usage fields are only filled by Tree.
+type Process struct {
+	PID  int    `json:"pid"`
+	PPID int    `json:"ppid"`
+	Name string `json:"name"`
+	Exe  string `json:"exe,omitempty"` // executable path, empty when it cannot be read
+
+	CPUTime time.Duration `json:"cpuTime,omitempty"` // user + system
+	RSS     int64         `json:"rss,omitempty"`     // bytes
+	Threads int           `json:"threads,omitempty"`
+	FDs     int           `json:"fds,omitempty"` // open handles on Windows
+}
+
+// Listener is a socket accepting TCP connections
+type Listener struct {
+	Address string `json:"address"` // local address, e.g. 127.0.0.1 or ::
+	Port    int    `json:"port"`
+	PID     int    `json:"pid"` // 0 when the owner cannot be determined
+}
+
+// ListenerOn returns the listener on a TCP port, or nil if nothing listens
+func ListenerOn(port int) (*Listener, error) {
+	listeners, err := Listeners()
+	if err != nil {
+		return nil, err
+	}
+	var found *Listener
+	for i := range listeners {
+		if listeners[i].Port != port {
+			continue
+		}
+		// Prefer an entry whose owner is known (IPv4 and IPv6 sockets)
+		if found == nil || (found.PID == 0 && listeners[i].PID > 0) {
+			found = &listeners[i]
+		}
+	}
+	return found, nil
+}
+
+// Describe returns "<exe or name> (PID: <pid>)" for messages
+func (p *Process) Describe() string {
+	name := p.Exe
+	if name == "" {
+		name = p.Name
+	}
+	return name + " (PID: " + strconv.Itoa(p.PID) + ")"
+}
+
+// InDir reports whether the process executable lives under dir
+func (p *Process) InDir(dir string) bool {
+	if p.Exe == "" || dir == "" {
+		return false
+	}
+	exe, err := filepath.EvalSymlinks(p.Exe)
+	if err != nil {
+		exe = p.Exe
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	rel, err := filepath.Rel(dir, exe)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// tree returns pid and its descendants from a process table
+func tree(pid int, procs map[int]Process) []Process {
+	children := make(map[int][]int)
+	for id, p := range procs {
+		if id != pid {
+			children[p.PPID] = append(children[p.PPID], id)
+		}
+	}
+
+	result := []Process{procs[pid]}
+	for i := 0; i < len(result); i++ {
+		for _, child := range children[result[i].PID] {
+			result = append(result, procs[child])
+		}
+	}
+	return result
+}
@@ -0,0 +1,213 @@
+//go:build darwin
+
+package procinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// proc_info(2) calls and flavors, from sys/proc_info.h
+const (
+	procInfoCallPIDInfo = 2
+	procPIDListFDs      = 1
+	procPIDTaskInfo     = 4
+
+	procFDInfoSize   = 8  // struct proc_fdinfo
+	procTaskInfoSize = 96 // struct proc_taskinfo
+)
+
+// Records of the net.inet.tcp.pcblist_n sysctl, from netinet/in_pcb.h,
+// sys/socketvar.h and netinet/tcp_var.h
+const (
+	xsoSocket = 0x001
+	xsoInpcb  = 0x010
+	xsoTcpcb  = 0x020
+
+	xinpgenSize = 24 // struct xinpgen, at the start and end of the list
+
+	inpIPv4 = 0x1
+	inpIPv6 = 0x2
+
+	tcpsListen = 1
+)
+
+// Listeners lists TCP listening sockets from the kernel's PCB list. The owner
+// is the process that last used the socket, which for a pre-forking server
+// may be a worker of the process that opened it.
+func Listeners() ([]Listener, error) {
+	data, err := unix.SysctlRaw("net.inet.tcp.pcblist_n")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each PCB is a run of records starting with its xinpcb_n; every record
+	// begins with its length and kind and is padded to 8 bytes
+	type pcb struct {
+		port   int
+		vflag  byte
+		local4 net.IP
+		local6 net.IP
+		pid    int
+		listen bool
+	}
+	var pcbs []pcb
+	le := binary.LittleEndian
+	for off := xinpgenSize; off+8 <= len(data); {
+		length := int(le.Uint32(data[off:]))
+		kind := le.Uint32(data[off+4:])
+		if length <= xinpgenSize || off+length > len(data) {
+			break
+		}
+		record := data[off : off+length]
+		switch {
+		case kind == xsoInpcb && length >= 84:
+			pcbs = append(pcbs, pcb{
+				port:   int(binary.BigEndian.Uint16(record[18:])),
+				vflag:  record[48],
+				local4: net.IP(append([]byte(nil), record[80:84]...)),
+				local6: net.IP(append([]byte(nil), record[68:84]...)),
+			})
+		case kind == xsoSocket && length >= 72 && len(pcbs) > 0:
+			pcbs[len(pcbs)-1].pid = int(int32(le.Uint32(record[68:])))
+		case kind == xsoTcpcb && length >= 40 && len(pcbs) > 0:
+			pcbs[len(pcbs)-1].listen = int32(le.Uint32(record[36:])) == tcpsListen
+		}
+		off += (length + 7) &^ 7
+	}
+
+	var result []Listener
+	for _, p := range pcbs {
+		if !p.listen {
+			continue
+		}
+		addr := p.local4.String()
+		if p.vflag&inpIPv6 != 0 {
+			addr = p.local6.String()
+		} else if p.vflag&inpIPv4 == 0 {
+			continue
+		}
+		result = append(result, Listener{Address: addr, Port: p.port, PID: p.pid})
+	}
+	return result, nil
+}
+
+// Find returns a process with its name, parent and executable
+func Find(pid int) (*Process, error) {
+	info, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return nil, err
+	}
+	if int(info.Proc.P_pid) != pid {
+		return nil, ErrNotFound
+	}
+	p := fromKinfo(info)
+	p.Exe = executable(pid)
+	return &p, nil
+}
+
+// Tree returns a process and its descendants with their resource usage from
+// proc_pidinfo. Usage of other users' processes is not readable and left 0.
+func Tree(pid int) ([]Process, error) {
+	all, err := unix.SysctlKinfoProcSlice("kern.proc.all")
+	if err != nil {
+		return nil, err
+	}
+	procs := make(map[int]Process, len(all))
+	for i := range all {
+		p := fromKinfo(&all[i])
+		procs[p.PID] = p
+	}
+	if _, ok := procs[pid]; !ok {
+		return nil, ErrNotFound
+	}
+
+	result := tree(pid, procs)
+	for i := range result {
+		p := &result[i]
+		p.Exe = executable(p.PID)
+
+		var task [procTaskInfoSize]byte
+		if procPIDInfo(p.PID, procPIDTaskInfo, task[:]) == procTaskInfoSize {
+			le := binary.LittleEndian
+			p.RSS = int64(le.Uint64(task[8:]))
+			p.CPUTime = machTime(le.Uint64(task[16:]) + le.Uint64(task[24:]))
+			p.Threads = int(int32(le.Uint32(task[84:])))
+		}
+		p.FDs = openFDs(p.PID)
+	}
+	return result, nil
+}
+
+// procPIDInfo calls proc_pidinfo, returning the bytes written to buf
+func procPIDInfo(pid, flavor int, buf []byte) int {
+	var ptr unsafe.Pointer
+	if len(buf) > 0 {
+		ptr = unsafe.Pointer(&buf[0])
+	}
+	n, _, errno := unix.Syscall6(unix.SYS_PROC_INFO, procInfoCallPIDInfo, uintptr(pid), uintptr(flavor), 0, uintptr(ptr), uintptr(len(buf)))
+	if errno != 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// openFDs counts a process's open file descriptors. Without a buffer
+// proc_pidinfo returns the room the list needs, which includes some slack.
+func openFDs(pid int) int {
+	size := procPIDInfo(pid, procPIDListFDs, nil)
+	if size <= 0 {
+		return 0
+	}
+	buf := make([]byte, size)
+	return procPIDInfo(pid, procPIDListFDs, buf) / procFDInfoSize
+}
+
+// timebaseHz is the frequency of the Mach time unit the task CPU times are
+// counted in: 1 GHz on Intel, 24 MHz on Apple silicon
+var timebaseHz = func() uint64 {
+	if hz, err := unix.SysctlUint64("hw.tbfrequency"); err == nil && hz > 0 {
+		return hz
+	}
+	if hz, err := unix.SysctlUint32("hw.tbfrequency"); err == nil && hz > 0 {
+		return uint64(hz)
+	}
+	return uint64(time.Second)
+}()
+
+func machTime(ticks uint64) time.Duration {
+	seconds := ticks / timebaseHz
+	rest := ticks % timebaseHz
+	return time.Duration(seconds)*time.Second + time.Duration(rest*uint64(time.Second)/timebaseHz)
+}
+
+func fromKinfo(info *unix.KinfoProc) Process {
+	name := info.Proc.P_comm[:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return Process{
+		PID:  int(info.Proc.P_pid),
+		PPID: int(info.Eproc.Ppid),
+		Name: string(name),
+	}
+}
+
+// executable reads the exec path from kern.procargs2: a 32-bit argc, then
+// the NUL-terminated path. Other users' processes are not readable.
+func executable(pid int) string {
+	data, err := unix.SysctlRaw("kern.procargs2", pid)
+	if err != nil || len(data) < 4 {
+		return ""
+	}
+	data = data[4:]
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
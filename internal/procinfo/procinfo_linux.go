@@ -0,0 +1,202 @@
+//go:build linux
+
+package procinfo
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, which is 100 on every Linux architecture Go supports
+const clockTicks = 100
+
+// tcpListen is the TCP_LISTEN state in /proc/net/tcp
+const tcpListen = "0A"
+
+// Listeners reads /proc/net/tcp and /proc/net/tcp6, and finds the owner of
+// each socket through the /proc/<pid>/fd links. Sockets of processes we may
+// not inspect have PID 0.
+func Listeners() ([]Listener, error) {
+	inodes := make(map[string]Listener)
+	var firstErr error
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		if err := readTCPTable(file, inodes); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(inodes) == 0 {
+		return nil, firstErr
+	}
+
+	owners := socketOwners(inodes)
+	result := make([]Listener, 0, len(inodes))
+	for inode, l := range inodes {
+		l.PID = owners[inode]
+		result = append(result, l)
+	}
+	return result, nil
+}
+
+// readTCPTable adds the listening sockets of a /proc/net/tcp file, keyed by inode
+func readTCPTable(path string, inodes map[string]Listener) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		addr, port, err := parseHexAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		inodes[fields[9]] = Listener{Address: addr, Port: port}
+	}
+	return scanner.Err()
+}
+
+// parseHexAddr parses "0100007F:1F90". Addresses are 32-bit words in host
+// (little endian) order.
+func parseHexAddr(value string) (string, int, error) {
+	host, portHex, ok := strings.Cut(value, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("malformed address %q", value)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	raw, err := hex.DecodeString(host)
+	if err != nil || len(raw)%4 != 0 {
+		return "", 0, fmt.Errorf("malformed address %q", value)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return net.IP(raw).String(), int(port), nil
+}
+
+// socketOwners maps socket inodes to the PIDs holding them
+func socketOwners(inodes map[string]Listener) map[string]int {
+	owners := make(map[string]int)
+	for _, pid := range pids() {
+		fdDir := filepath.Join("/proc", strconv.Itoa(pid), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, ok := inodes[inode]; ok {
+				if _, seen := owners[inode]; !seen {
+					owners[inode] = pid
+				}
+			}
+		}
+		if len(owners) == len(inodes) {
+			break
+		}
+	}
+	return owners
+}
+
+func pids() []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var result []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			result = append(result, pid)
+		}
+	}
+	return result
+}
+
+// Find returns a process with its name, parent and executable
+func Find(pid int) (*Process, error) {
+	p, err := readStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Tree returns a process and its descendants with their resource usage
+func Tree(pid int) ([]Process, error) {
+	procs := make(map[int]Process)
+	for _, id := range pids() {
+		if p, err := readStat(id); err == nil {
+			procs[id] = p
+		}
+	}
+	if _, ok := procs[pid]; !ok {
+		return nil, ErrNotFound
+	}
+
+	result := tree(pid, procs)
+	for i := range result {
+		if fds, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(result[i].PID), "fd")); err == nil {
+			result[i].FDs = len(fds)
+		}
+	}
+	return result, nil
+}
+
+// readStat parses /proc/<pid>/stat and reads the executable link. The
+// command name may contain spaces and parentheses, so fields are counted
+// from the last ')'.
+func readStat(pid int) (Process, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	data, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Process{}, ErrNotFound
+		}
+		return Process{}, err
+	}
+	start := strings.IndexByte(string(data), '(')
+	end := strings.LastIndexByte(string(data), ')')
+	if start < 0 || end < start {
+		return Process{}, fmt.Errorf("malformed stat for %d", pid)
+	}
+	// fields[0] is field 3 (state) in proc(5)
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return Process{}, fmt.Errorf("malformed stat for %d", pid)
+	}
+	field := func(n int) int64 {
+		v, _ := strconv.ParseInt(fields[n-3], 10, 64)
+		return v
+	}
+
+	exe, _ := os.Readlink(filepath.Join(dir, "exe"))
+	return Process{
+		PID:     pid,
+		PPID:    int(field(4)),
+		Name:    string(data[start+1 : end]),
+		Exe:     strings.TrimSuffix(exe, " (deleted)"),
+		CPUTime: time.Duration(field(14)+field(15)) * time.Second / clockTicks,
+		Threads: int(field(20)),
+		RSS:     field(24) * int64(os.Getpagesize()),
+	}, nil
+}
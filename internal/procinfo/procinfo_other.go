@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !windows
+
+package procinfo
+
+import "errors"
+
+var errUnsupported = errors.New("process inspection is not supported on this platform")
+
+// Listeners is not supported on this platform
+func Listeners() ([]Listener, error) {
+	return nil, errUnsupported
+}
+
+// Find is not supported on this platform
+func Find(pid int) (*Process, error) {
+	return nil, errUnsupported
+}
+
+// Tree is not supported on this platform
+func Tree(pid int) ([]Process, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,235 @@
+//go:build windows
+
+package procinfo
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modiphlpapi = windows.NewLazySystemDLL("iphlpapi.dll")
+	modpsapi    = windows.NewLazySystemDLL("psapi.dll")
+	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+
+	procGetExtendedTcpTable   = modiphlpapi.NewProc("GetExtendedTcpTable")
+	procGetProcessMemoryInfo  = modpsapi.NewProc("GetProcessMemoryInfo")
+	procGetProcessHandleCount = modkernel32.NewProc("GetProcessHandleCount")
+)
+
+const (
+	afInet  = 2
+	afInet6 = 23
+	// tcpTableOwnerPIDListener is TCP_TABLE_OWNER_PID_LISTENER
+	tcpTableOwnerPIDListener = 3
+	// stillActive is the exit code of a running process
+	stillActive = 259
+)
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS
+type processMemoryCounters struct {
+	CB                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// Listeners reads the IPv4 and IPv6 listener tables with their owning PIDs
+func Listeners() ([]Listener, error) {
+	var result []Listener
+
+	// MIB_TCPROW_OWNER_PID: state, local addr, local port, remote addr,
+	// remote port, pid
+	v4, err := tcpTable(afInet)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+24 <= len(v4); i += 24 {
+		row := v4[i : i+24]
+		result = append(result, Listener{
+			Address: net.IP(row[4:8]).String(),
+			Port:    int(binary.BigEndian.Uint16(row[8:10])),
+			PID:     int(binary.LittleEndian.Uint32(row[20:24])),
+		})
+	}
+
+	// MIB_TCP6ROW_OWNER_PID: local addr[16], scope, local port, remote
+	// addr[16], scope, remote port, state, pid
+	if v6, err := tcpTable(afInet6); err == nil {
+		for i := 0; i+56 <= len(v6); i += 56 {
+			row := v6[i : i+56]
+			result = append(result, Listener{
+				Address: net.IP(row[0:16]).String(),
+				Port:    int(binary.BigEndian.Uint16(row[20:22])),
+				PID:     int(binary.LittleEndian.Uint32(row[52:56])),
+			})
+		}
+	}
+	return result, nil
+}
+
+// tcpTable returns the rows of GetExtendedTcpTable for an address family
+func tcpTable(family uintptr) ([]byte, error) {
+	size := uint32(4096)
+	for {
+		buf := make([]byte, size)
+		r, _, _ := procGetExtendedTcpTable.Call(
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(unsafe.Pointer(&size)),
+			0,
+			family,
+			tcpTableOwnerPIDListener,
+			0,
+		)
+		switch windows.Errno(r) {
+		case 0:
+			count := binary.LittleEndian.Uint32(buf[:4])
+			rowSize := uint32(24)
+			if family == afInet6 {
+				rowSize = 56
+			}
+			// Rows start after dwNumEntries
+			return buf[4 : 4+count*rowSize], nil
+		case windows.ERROR_INSUFFICIENT_BUFFER:
+			continue
+		default:
+			return nil, windows.Errno(r)
+		}
+	}
+}
+
+// Find returns a process with its name, parent and executable
+func Find(pid int) (*Process, error) {
+	procs, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := procs[pid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p.Exe = executable(pid)
+	return &p, nil
+}
+
+// Tree returns a process and its descendants with their resource usage.
+// Handles stand in for file descriptors.
+func Tree(pid int) ([]Process, error) {
+	procs, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := procs[pid]; !ok {
+		return nil, ErrNotFound
+	}
+
+	result := tree(pid, procs)
+	for i := range result {
+		usage(&result[i])
+	}
+	return result, nil
+}
+
+// Alive reports whether a process exists and has not exited
+func Alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// A process we may not open still exists
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// snapshot reads the process table from a toolhelp snapshot
+func snapshot() (map[int]Process, error) {
+	snap, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(snap)
+
+	procs := make(map[int]Process)
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snap, &entry); err == nil; err = windows.Process32Next(snap, &entry) {
+		procs[int(entry.ProcessID)] = Process{
+			PID:     int(entry.ProcessID),
+			PPID:    int(entry.ParentProcessID),
+			Name:    windows.UTF16ToString(entry.ExeFile[:]),
+			Threads: int(entry.Threads),
+		}
+	}
+	if err != windows.ERROR_NO_MORE_FILES {
+		return nil, err
+	}
+	return procs, nil
+}
+
+// executable returns the full image path of a process
+func executable(pid int) string {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+	return imageName(h)
+}
+
+func imageName(h windows.Handle) string {
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err != nil {
+		return ""
+	}
+	return windows.UTF16ToString(buf[:size])
+}
+
+// usage fills the executable, CPU time, working set and handle count
+func usage(p *Process) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(p.PID))
+	if err != nil {
+		return
+	}
+	defer windows.CloseHandle(h)
+
+	p.Exe = imageName(h)
+
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err == nil {
+		p.CPUTime = filetimeDuration(kernel) + filetimeDuration(user)
+	}
+
+	var counters processMemoryCounters
+	counters.CB = uint32(unsafe.Sizeof(counters))
+	if r, _, _ := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&counters)), uintptr(counters.CB)); r != 0 {
+		p.RSS = int64(counters.WorkingSetSize)
+	}
+
+	var handles uint32
+	if r, _, _ := procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&handles))); r != 0 {
+		p.FDs = int(handles)
+	}
+}
+
+// filetimeDuration converts a FILETIME interval, in 100ns units
+func filetimeDuration(ft windows.Filetime) time.Duration {
+	return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,404 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/php"
+	"github.com/yasinkuyu/Stacker/internal/services"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// State records what "stacker up" did for a project so "stacker down" can
+// undo exactly that.
+type State struct {
+	Path      string           `json:"path"`
+	Site      string           `json:"site"`
+	PHP       string           `json:"php,omitempty"`
+	Profile   string           `json:"profile,omitempty"`
+	Services  []ProjectService `json:"services"`
+	EnvPHP    string           `json:"env_php,omitempty"` // PHP version whose FPM pool received the project env
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ProjectService is a service declared in a project's stacker.yml
+type ProjectService struct {
+	Name         string `json:"name"`
+	Port         int    `json:"port"`
+	Started      bool   `json:"started"`                 // started by this project, not already running
+	PortChanged  bool   `json:"port_changed,omitempty"`  // port override set by this project
+	PreviousPort int    `json:"previous_port,omitempty"` // override in place before, 0 for the default
+}
+
+// SiteRegistrar registers sites and writes their web server configs
+type SiteRegistrar interface {
+	Register(site config.Site) (config.Site, error)
+	Update(name string, site config.Site) error
+}
+
+// Stack brings projects up and down using the given managers
+type Stack struct {
+	serviceManager *services.ServiceManager
+	fpmManager     *php.FPMManager
+	phpManager     *php.PHPManager
+	sites          SiteRegistrar
+}
+
+var stateMu sync.Mutex
+
+// NewStack creates a Stack
+func NewStack(sm *services.ServiceManager, fm *php.FPMManager, pm *php.PHPManager, sites SiteRegistrar) *Stack {
+	return &Stack{
+		serviceManager: sm,
+		fpmManager:     fm,
+		phpManager:     pm,
+		sites:          sites,
+	}
+}
+
+// Up installs and starts the services declared in the project's stacker.yml
+// on their declared ports, registers the site with the pinned PHP version
+// and exports env into the PHP-FPM pool. profile selects a stacker.yml profile.
+func (s *Stack) Up(path, profile string) (*State, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadStackerYamlProfile(path, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	state := loadState(path)
+	if state == nil {
+		state = &State{Path: path}
+	}
+
+	// Services, recording only what this project changed
+	for _, declared := range cfg.Services {
+		ps, err := s.upService(declared, state)
+		if err != nil {
+			// A port changed before the failure must still be restored by Down
+			if ps.PortChanged {
+				state.setService(ps)
+			}
+			s.saveState(state)
+			return state, err
+		}
+		state.setService(ps)
+	}
+
+	// Site with pinned PHP version
+	state.PHP = cfg.PHP
+	state.Profile = cfg.Profile
+	site, err := s.ensureSite(path, cfg.PHP)
+	if err != nil {
+		s.saveState(state)
+		return state, err
+	}
+	state.Site = site.Name
+
+	phpVersion := site.PHP
+	if phpVersion != "" {
+		s.phpManager.DetectPHPVersions()
+		if err := s.phpManager.PinSite(site.Name, phpVersion); err != nil {
+			fmt.Printf("⚠️  PHP %s: %v\n", phpVersion, err)
+		}
+	}
+
+	// Project env goes into the FPM pool of the site's PHP version
+	if state.EnvPHP != "" && state.EnvPHP != phpVersion {
+		s.fpmManager.SetPoolEnv(state.EnvPHP, path, nil)
+		state.EnvPHP = ""
+	}
+	if len(cfg.Env) > 0 {
+		if phpVersion == "" {
+			fmt.Println("⚠️  No php version in stacker.yml, env not exported to PHP-FPM")
+		} else if err := s.fpmManager.SetPoolEnv(phpVersion, path, cfg.Env); err != nil {
+			fmt.Printf("⚠️  Failed to export env to PHP-FPM %s: %v\n", phpVersion, err)
+		} else {
+			state.EnvPHP = phpVersion
+		}
+	}
+	if phpVersion != "" {
+		if err := s.fpmManager.EnsureRunning(phpVersion); err != nil {
+			fmt.Printf("⚠️  Failed to start PHP-FPM %s: %v\n", phpVersion, err)
+		}
+	}
+
+	if err := s.saveState(state); err != nil {
+		return state, err
+	}
+	utils.LogInfo(fmt.Sprintf("Project %s is up", path))
+	return state, nil
+}
+
+// Down stops the services the project started, restores ports it changed
+// and removes its env from the PHP-FPM pool. Services still used by another
+// project that is up are left running. The site stays registered.
+func (s *Stack) Down(path string) (*State, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	state := loadState(path)
+	if state == nil {
+		return nil, fmt.Errorf("project %s is not up", path)
+	}
+
+	inUse := make(map[string]bool)
+	for _, other := range loadStates() {
+		if other.Path == path {
+			continue
+		}
+		for _, ps := range other.Services {
+			inUse[ps.Name] = true
+		}
+	}
+
+	var errs []string
+	for i := len(state.Services) - 1; i >= 0; i-- {
+		ps := state.Services[i]
+		if inUse[ps.Name] {
+			fmt.Printf("ℹ️  %s is still used by another project, leaving it running\n", ps.Name)
+			continue
+		}
+		if ps.Started {
+			if svc := s.serviceManager.GetService(ps.Name); svc != nil && svc.Status == "running" {
+				if err := s.serviceManager.StopService(ps.Name); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", ps.Name, err))
+					continue
+				}
+				fmt.Printf("⏹️  Stopped %s\n", ps.Name)
+			}
+		}
+		if ps.PortChanged {
+			if err := s.serviceManager.SetServicePort(ps.Name, ps.PreviousPort); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", ps.Name, err))
+			}
+		}
+	}
+
+	if state.EnvPHP != "" {
+		if err := s.fpmManager.SetPoolEnv(state.EnvPHP, path, nil); err != nil {
+			errs = append(errs, fmt.Sprintf("php-fpm %s: %v", state.EnvPHP, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return state, fmt.Errorf("some steps failed: %s", strings.Join(errs, "; "))
+	}
+
+	removeState(path)
+	utils.LogInfo(fmt.Sprintf("Project %s is down", path))
+	return state, nil
+}
+
+// upService installs (if needed) and starts one declared service
+func (s *Stack) upService(declared config.ServiceConfig, state *State) (ProjectService, error) {
+	sm := s.serviceManager
+	version := declared.Version
+	if version == "" {
+		version = s.resolveVersion(declared.Type)
+		if version == "" {
+			return ProjectService{}, fmt.Errorf("no version of %s available", declared.Type)
+		}
+	}
+	name := declared.Type + "-" + version
+
+	ps := ProjectService{Name: name}
+	if previous := state.service(name); previous != nil {
+		ps = *previous
+	}
+
+	if sm.GetService(name) == nil {
+		fmt.Printf("📦 Installing %s %s...\n", declared.Type, version)
+		if err := sm.InstallService(declared.Type, version); err != nil {
+			return ps, fmt.Errorf("failed to install %s: %w", name, err)
+		}
+	}
+
+	svc := sm.GetService(name)
+	if svc == nil {
+		return ps, fmt.Errorf("service %s not found after install", name)
+	}
+
+	if declared.Port > 0 && svc.Port != declared.Port {
+		if svc.Status == "running" {
+			return ps, fmt.Errorf("%s is already running on port %d, but stacker.yml declares %d", name, svc.Port, declared.Port)
+		}
+		if !ps.PortChanged {
+			ps.PortChanged = true
+			ps.PreviousPort = config.GetPreferences().ServicePorts[name]
+		}
+		if err := sm.SetServicePort(name, declared.Port); err != nil {
+			return ps, err
+		}
+		svc = sm.GetService(name)
+	}
+	ps.Port = svc.Port
+
+	if svc.Status != "running" && svc.Runnable {
+		if err := sm.StartService(name); err != nil {
+			return ps, fmt.Errorf("failed to start %s: %w", name, err)
+		}
+		ps.Started = true
+	}
+	return ps, nil
+}
+
+// resolveVersion picks the newest installed version of a service type, or
+// the newest available one when none is installed.
+func (s *Stack) resolveVersion(svcType string) string {
+	best := ""
+	for _, svc := range s.serviceManager.GetServices() {
+		if svc.Type == svcType && compareVersions(svc.Version, best) > 0 {
+			best = svc.Version
+		}
+	}
+	if best != "" {
+		return best
+	}
+	for _, v := range s.serviceManager.GetAvailableVersions(svcType) {
+		if v.Type == svcType && compareVersions(v.Version, best) > 0 {
+			best = v.Version
+		}
+	}
+	return best
+}
+
+// ensureSite returns the site serving path, registering it if needed. An
+// existing site is repinned when stacker.yml declares another PHP version.
+func (s *Stack) ensureSite(path, phpVersion string) (config.Site, error) {
+	for _, site := range config.GetSiteRegistry().List() {
+		if site.Path != path {
+			continue
+		}
+		if phpVersion != "" && site.PHP != phpVersion {
+			site.PHP = phpVersion
+			if err := s.sites.Update(site.Name, site); err != nil {
+				return site, err
+			}
+			fmt.Printf("📌 %s pinned to PHP %s\n", site.Name, phpVersion)
+		}
+		return site, nil
+	}
+
+	site, err := s.sites.Register(config.Site{Name: SiteName(path), Path: path, PHP: phpVersion})
+	if err != nil {
+		return site, fmt.Errorf("failed to register site: %w", err)
+	}
+	fmt.Printf("🌐 Site registered: %s -> %s\n", site.Name, site.Path)
+	return site, nil
+}
+
+var siteNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// SiteName derives a host name label from a project directory
+func SiteName(path string) string {
+	name := siteNameInvalid.ReplaceAllString(strings.ToLower(filepath.Base(path)), "-")
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "site"
+	}
+	return name
+}
+
+// compareVersions compares dotted numeric versions, "" sorts first
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	if a == "" || b == "" {
+		return len(a) - len(b)
+	}
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+func (st *State) service(name string) *ProjectService {
+	for i := range st.Services {
+		if st.Services[i].Name == name {
+			return &st.Services[i]
+		}
+	}
+	return nil
+}
+
+func (st *State) setService(ps ProjectService) {
+	if existing := st.service(ps.Name); existing != nil {
+		*existing = ps
+		return
+	}
+	st.Services = append(st.Services, ps)
+}
+
+func statePath() string {
+	return filepath.Join(utils.GetStackerDir(), "projects.json")
+}
+
+// loadStates returns the state of all projects that are up
+func loadStates() map[string]*State {
+	states := make(map[string]*State)
+	if data, err := os.ReadFile(statePath()); err == nil {
+		json.Unmarshal(data, &states)
+	}
+	return states
+}
+
+// GetState returns the state of a project that is up, or nil
+func GetState(path string) *State {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	return loadState(path)
+}
+
+func loadState(path string) *State {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return loadStates()[path]
+}
+
+func (s *Stack) saveState(state *State) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state.UpdatedAt = time.Now()
+	states := loadStates()
+	states[state.Path] = state
+	return writeStates(states)
+}
+
+func removeState(path string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	states := loadStates()
+	delete(states, path)
+	writeStates(states)
+}
+
+func writeStates(states map[string]*State) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(), data, 0644)
+}
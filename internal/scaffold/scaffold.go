@@ -0,0 +1,497 @@
+package scaffold
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/forge"
+	"github.com/yasinkuyu/Stacker/internal/php"
+	"github.com/yasinkuyu/Stacker/internal/services"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// Templates are the project templates "stacker new" can create
+var Templates = []string{"laravel", "symfony", "wordpress", "statamic", "plain"}
+
+// composerPackages are created with "composer create-project"
+var composerPackages = map[string]string{
+	"laravel":  "laravel/laravel",
+	"symfony":  "symfony/skeleton",
+	"statamic": "statamic/statamic",
+}
+
+const (
+	wordpressURL = "https://wordpress.org/latest.tar.gz"
+
+	// mailHost and mailPort point at Stacker's SMTP catcher
+	mailHost = "127.0.0.1"
+	mailPort = 1025
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Options describe a project to create
+type Options struct {
+	Name     string // project directory and site name, e.g. "blog"
+	Template string
+	Dir      string // parent directory
+	PHP      string // PHP version, defaults to the default PHP
+	NoDB     bool   // skip database creation
+}
+
+// Result describes a created project
+type Result struct {
+	Path      string
+	PHP       string
+	Database  string
+	DBService *services.Service
+	Redis     *services.Service
+	EnvFile   string
+}
+
+// Scaffolder creates projects from templates
+type Scaffolder struct {
+	serviceManager *services.ServiceManager
+	phpManager     *php.PHPManager
+}
+
+// NewScaffolder creates a Scaffolder
+func NewScaffolder(sm *services.ServiceManager, pm *php.PHPManager) *Scaffolder {
+	return &Scaffolder{serviceManager: sm, phpManager: pm}
+}
+
+// TemplateDir is where user templates are looked up before Composer.
+// A directory named after the template is copied as the new project.
+func TemplateDir() string {
+	return filepath.Join(utils.GetStackerDir(), "templates")
+}
+
+// Create scaffolds the project, creates its database, writes its env
+// configuration and stacker.yml. Registering the site is left to the caller.
+func (s *Scaffolder) Create(opts Options) (*Result, error) {
+	if !namePattern.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid project name %q: use lowercase letters, digits and dashes", opts.Name)
+	}
+	if !isTemplate(opts.Template) {
+		return nil, fmt.Errorf("unknown template %q, expected one of %s", opts.Template, strings.Join(Templates, ", "))
+	}
+
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Path: filepath.Join(dir, opts.Name)}
+	if entries, err := os.ReadDir(result.Path); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s already exists and is not empty", result.Path)
+	}
+
+	phpBinary, phpVersion := s.resolvePHP(opts.PHP)
+	result.PHP = phpVersion
+
+	// Project files
+	local := filepath.Join(TemplateDir(), opts.Template)
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		fmt.Printf("📁 Copying template from %s...\n", local)
+		err = copyDir(local, result.Path)
+	} else if pkg, ok := composerPackages[opts.Template]; ok {
+		fmt.Printf("📦 composer create-project %s...\n", pkg)
+		err = s.composerCreateProject(phpBinary, pkg, result.Path)
+	} else if opts.Template == "wordpress" {
+		fmt.Println("📦 Downloading WordPress...")
+		err = downloadWordPress(result.Path)
+	} else {
+		err = writePlainProject(result.Path, opts.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Services: database and Redis, preferring running ones
+	result.DBService = s.pickService("mysql", "mariadb")
+	result.Redis = s.pickService("redis")
+	if result.DBService != nil && !opts.NoDB {
+		result.Database = strings.ReplaceAll(opts.Name, "-", "_")
+		if err := s.serviceManager.CreateDatabase(result.DBService.Name, result.Database); err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		} else {
+			fmt.Printf("🗄️  Database %s created on %s\n", result.Database, result.DBService.Name)
+		}
+	} else if result.DBService == nil {
+		fmt.Println("⚠️  No MySQL or MariaDB service installed, skipping database creation")
+	}
+
+	// Environment
+	host := config.SiteHost(opts.Name)
+	result.EnvFile, err = writeEnv(opts.Template, result, host)
+	if err != nil {
+		return result, fmt.Errorf("failed to write environment: %w", err)
+	}
+
+	// stacker.yml
+	var declared []config.ServiceConfig
+	for _, svc := range []*services.Service{result.DBService, result.Redis} {
+		if svc != nil {
+			declared = append(declared, config.ServiceConfig{Type: svc.Type, Version: svc.Version, Port: svc.Port})
+		}
+	}
+	env := map[string]string{"APP_ENV": "local"}
+	if opts.Template == "symfony" {
+		env = map[string]string{"APP_ENV": "dev"}
+	}
+	if err := config.CreateStackerYaml(result.Path, phpVersion, declared, env); err != nil {
+		return result, fmt.Errorf("failed to write stacker.yml: %w", err)
+	}
+
+	utils.LogInfo(fmt.Sprintf("Created %s project %s", opts.Template, result.Path))
+	return result, nil
+}
+
+func isTemplate(name string) bool {
+	for _, t := range Templates {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePHP returns the PHP binary and version to use
+func (s *Scaffolder) resolvePHP(version string) (string, string) {
+	s.phpManager.DetectPHPVersions()
+	var v *php.PHPVersion
+	if version != "" {
+		v = s.phpManager.GetVersion(version)
+		if v == nil {
+			fmt.Printf("⚠️  PHP %s not found, using the default PHP for setup\n", version)
+		}
+	}
+	if v == nil {
+		v = s.phpManager.GetDefault()
+	}
+	if v == nil {
+		return "php", version
+	}
+	if version == "" {
+		version = v.Version
+	}
+	return v.Binary, version
+}
+
+// pickService returns the first running service of the given types, or the
+// first installed one
+func (s *Scaffolder) pickService(types ...string) *services.Service {
+	var installed *services.Service
+	for _, svcType := range types {
+		for _, svc := range s.serviceManager.GetServices() {
+			if svc.Type != svcType {
+				continue
+			}
+			if svc.Status == "running" {
+				return svc
+			}
+			if installed == nil {
+				installed = svc
+			}
+		}
+	}
+	return installed
+}
+
+// composerCreateProject runs Composer from PATH, or Stacker's composer.phar
+func (s *Scaffolder) composerCreateProject(phpBinary, pkg, target string) error {
+	args := []string{"create-project", pkg, target, "--no-interaction", "--prefer-dist"}
+
+	var cmd *exec.Cmd
+	if composer, err := exec.LookPath("composer"); err == nil {
+		cmd = exec.Command(composer, args...)
+	} else {
+		phar := s.composerPhar()
+		if phar == "" {
+			fmt.Println("📦 Composer not found, installing it...")
+			if err := s.serviceManager.InstallService("composer", "2"); err != nil {
+				return fmt.Errorf("composer is required for this template: %w", err)
+			}
+			if phar = s.composerPhar(); phar == "" {
+				return fmt.Errorf("composer is required for this template")
+			}
+		}
+		cmd = exec.Command(phpBinary, append([]string{phar}, args...)...)
+	}
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "COMPOSER_NO_INTERACTION=1")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("composer create-project %s failed: %w", pkg, err)
+	}
+	return nil
+}
+
+func (s *Scaffolder) composerPhar() string {
+	matches, _ := filepath.Glob(filepath.Join(utils.GetStackerDir(), "bin", "composer", "*", "composer.phar"))
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1]
+}
+
+// downloadWordPress extracts the latest WordPress release into target
+func downloadWordPress(target string) error {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(wordpressURL)
+	if err != nil {
+		return fmt.Errorf("failed to download WordPress: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download WordPress: %s", resp.Status)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Entries are under wordpress/
+		name := strings.TrimPrefix(filepath.ToSlash(header.Name), "wordpress/")
+		if name == "" || strings.Contains(name, "..") {
+			continue
+		}
+		path := filepath.Join(target, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0755|0644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			f.Close()
+		}
+	}
+	return nil
+}
+
+// writePlainProject creates a minimal PHP project with a public docroot
+func writePlainProject(target, name string) error {
+	public := filepath.Join(target, "public")
+	if err := os.MkdirAll(public, 0755); err != nil {
+		return err
+	}
+	index := fmt.Sprintf(`<?php
+
+echo '<h1>%s</h1><p>Served by Stacker, PHP ' . PHP_VERSION . '</p>';
+`, name)
+	if err := os.WriteFile(filepath.Join(public, "index.php"), []byte(index), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(target, ".gitignore"), []byte(".env\n"), 0644)
+}
+
+// copyDir copies a template directory tree
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
+// dbSettings returns host, port, user and password for the project database
+func dbSettings(result *Result) (string, int, string, string) {
+	if result.DBService == nil {
+		return "127.0.0.1", 3306, "root", ""
+	}
+	user := result.DBService.Username
+	if user == "" {
+		user = "root"
+	}
+	return "127.0.0.1", result.DBService.Port, user, result.DBService.Password
+}
+
+func redisPort(result *Result) int {
+	if result.Redis == nil {
+		return 6379
+	}
+	return result.Redis.Port
+}
+
+// writeEnv points the framework at Stacker's services and returns the file written
+func writeEnv(template string, result *Result, host string) (string, error) {
+	dbHost, dbPort, dbUser, dbPassword := dbSettings(result)
+	database := result.Database
+	if database == "" {
+		database = strings.ReplaceAll(filepath.Base(result.Path), "-", "_")
+	}
+
+	switch template {
+	case "wordpress":
+		return writeWordPressConfig(result.Path, database, fmt.Sprintf("%s:%d", dbHost, dbPort), dbUser, dbPassword)
+
+	case "symfony":
+		serverVersion := "8.0"
+		if result.DBService != nil {
+			serverVersion = result.DBService.Version
+			if result.DBService.Type == "mariadb" {
+				serverVersion = "mariadb-" + serverVersion
+			}
+		}
+		// The password may contain @, / or #, which must be escaped in the URL
+		databaseURL := url.URL{
+			Scheme:   "mysql",
+			User:     url.UserPassword(dbUser, dbPassword),
+			Host:     fmt.Sprintf("%s:%d", dbHost, dbPort),
+			Path:     "/" + database,
+			RawQuery: url.Values{"serverVersion": {serverVersion}, "charset": {"utf8mb4"}}.Encode(),
+		}
+		return mergeEnvFile(filepath.Join(result.Path, ".env.local"), map[string]string{
+			"DATABASE_URL": databaseURL.String(),
+			"MAILER_DSN":   fmt.Sprintf("smtp://%s:%d", mailHost, mailPort),
+			"REDIS_URL":    fmt.Sprintf("redis://127.0.0.1:%d", redisPort(result)),
+		})
+
+	default:
+		// Laravel, Statamic and plain projects use Laravel's .env keys
+		connection := "mysql"
+		if result.DBService != nil && result.DBService.Type == "mariadb" {
+			connection = "mariadb"
+		}
+		envPath := filepath.Join(result.Path, ".env")
+		if _, err := os.Stat(envPath); os.IsNotExist(err) {
+			if example, err := os.ReadFile(filepath.Join(result.Path, ".env.example")); err == nil {
+				os.WriteFile(envPath, example, 0600)
+			}
+		}
+		return mergeEnvFile(envPath, map[string]string{
+			"APP_NAME":        filepath.Base(result.Path),
+			"APP_URL":         "https://" + host,
+			"DB_CONNECTION":   connection,
+			"DB_HOST":         dbHost,
+			"DB_PORT":         fmt.Sprintf("%d", dbPort),
+			"DB_DATABASE":     database,
+			"DB_USERNAME":     dbUser,
+			"DB_PASSWORD":     dbPassword,
+			"REDIS_HOST":      "127.0.0.1",
+			"REDIS_PORT":      fmt.Sprintf("%d", redisPort(result)),
+			"MAIL_MAILER":     "smtp",
+			"MAIL_HOST":       mailHost,
+			"MAIL_PORT":       fmt.Sprintf("%d", mailPort),
+			"MAIL_USERNAME":   "null",
+			"MAIL_PASSWORD":   "null",
+			"MAIL_ENCRYPTION": "null",
+		})
+	}
+}
+
+// mergeEnvFile sets keys in a .env file, keeping everything else
+func mergeEnvFile(path string, values map[string]string) (string, error) {
+	content, _ := os.ReadFile(path)
+	merged := forge.MergeEnv(string(content), values, nil)
+	return path, os.WriteFile(path, []byte(merged), 0600)
+}
+
+// writeWordPressConfig creates wp-config.php from the sample and routes
+// outgoing mail to Stacker's SMTP catcher with a must-use plugin
+func writeWordPressConfig(root, database, dbHost, dbUser, dbPassword string) (string, error) {
+	sample, err := os.ReadFile(filepath.Join(root, "wp-config-sample.php"))
+	if err != nil {
+		return "", fmt.Errorf("wp-config-sample.php not found: %w", err)
+	}
+
+	quote := func(s string) string {
+		return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+	}
+	content := strings.NewReplacer(
+		"database_name_here", quote(database),
+		"username_here", quote(dbUser),
+		"password_here", quote(dbPassword),
+		"'localhost'", "'"+quote(dbHost)+"'",
+	).Replace(string(sample))
+
+	// Fresh salts, one per "put your unique phrase here"
+	for strings.Contains(content, "put your unique phrase here") {
+		content = strings.Replace(content, "put your unique phrase here", randomString(48), 1)
+	}
+
+	configPath := filepath.Join(root, "wp-config.php")
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		return "", err
+	}
+
+	muPlugins := filepath.Join(root, "wp-content", "mu-plugins")
+	if err := os.MkdirAll(muPlugins, 0755); err != nil {
+		return configPath, err
+	}
+	plugin := fmt.Sprintf(`<?php
+/**
+ * Plugin Name: Stacker Mail
+ * Description: Sends all mail to Stacker's local SMTP catcher.
+ */
+add_action('phpmailer_init', function ($mailer) {
+    $mailer->isSMTP();
+    $mailer->Host = '%s';
+    $mailer->Port = %d;
+    $mailer->SMTPAuth = false;
+    $mailer->SMTPAutoTLS = false;
+});
+`, mailHost, mailPort)
+	return configPath, os.WriteFile(filepath.Join(muPlugins, "stacker-mail.php"), []byte(plugin), 0644)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n/2)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,46 @@
+//go:build darwin
+
+package secrets
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keyringAvailable reports whether the macOS Keychain can be used
+func keyringAvailable() bool {
+	_, err := exec.LookPath("security")
+	return err == nil
+}
+
+func keyringGet(service, account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", fmt.Errorf("keychain lookup failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func keyringSet(service, account, secret string) error {
+	for _, arg := range []string{service, account, secret} {
+		if strings.ContainsAny(arg, "\"\\\n") {
+			return fmt.Errorf("keychain store failed: unsupported character in %q", service)
+		}
+	}
+
+	// security -i reads the command from stdin, keeping the secret out of
+	// the argument list other users can see; -U updates an existing item
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -w \"%s\"\n", service, account, secret))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("keychain store failed: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	// Interactive mode can exit 0 after a failed command, which it reports
+	// as "security: <call>: <reason>"
+	if msg := strings.TrimSpace(string(out)); strings.Contains(msg, "security: ") {
+		return fmt.Errorf("keychain store failed: %s", msg)
+	}
+	return nil
+}
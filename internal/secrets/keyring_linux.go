@@ -0,0 +1,36 @@
+//go:build linux
+
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// keyringAvailable reports whether libsecret's secret-tool and a session bus
+// are present. Headless machines fall back to the key file.
+func keyringAvailable() bool {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return false
+	}
+	return os.Getenv("DBUS_SESSION_BUS_ADDRESS") != ""
+}
+
+func keyringGet(service, account string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		return "", fmt.Errorf("secret-tool lookup failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func keyringSet(service, account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label="+service+" vault key", "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool store failed: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
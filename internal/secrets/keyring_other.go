@@ -0,0 +1,18 @@
+//go:build !darwin && !linux
+
+package secrets
+
+import "errors"
+
+// keyringAvailable is false on platforms without a supported keyring CLI
+func keyringAvailable() bool {
+	return false
+}
+
+func keyringGet(service, account string) (string, error) {
+	return "", errors.New("no OS keyring support on this platform")
+}
+
+func keyringSet(service, account, secret string) error {
+	return errors.New("no OS keyring support on this platform")
+}
@@ -0,0 +1,333 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// Well-known secret names
+const (
+	ForgeAPIKey = "forge.api_key"
+)
+
+// ServicePassword returns the secret name holding a service's password
+func ServicePassword(serviceName string) string {
+	return "services." + serviceName + ".password"
+}
+
+// PassphraseEnv is read to unlock a passphrase-protected vault
+const PassphraseEnv = "STACKER_VAULT_PASSPHRASE"
+
+// Key sources, stored in the vault file so it is reopened the same way
+const (
+	SourcePassphrase = "passphrase"
+	SourceKeyring    = "keyring"
+	SourceFile       = "file"
+)
+
+const (
+	vaultFileName  = "secrets.vault"
+	keyFileName    = "vault.key"
+	pbkdf2Rounds   = 210000
+	keyLength      = 32
+	keyringService = "Stacker"
+	keyringAccount = "vault-key"
+)
+
+// ErrLocked is returned when the vault needs a passphrase that was not given
+var ErrLocked = errors.New("vault is passphrase protected; set " + PassphraseEnv)
+
+// Vault is an encrypted key/value store for credentials
+type Vault struct {
+	path   string
+	source string
+	key    []byte
+	salt   []byte
+	data   map[string]string
+	mu     sync.Mutex
+}
+
+type vaultFile struct {
+	Version    int    `json:"version"`
+	KeySource  string `json:"key_source"`
+	Salt       string `json:"salt,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Nonce      string `json:"nonce"`
+	Data       string `json:"data"`
+}
+
+// Open loads the vault from the Stacker data dir. A missing vault opens empty
+// and is created when the first secret is saved, protected by
+// STACKER_VAULT_PASSPHRASE if set, otherwise by a random key kept in the OS
+// keyring, or in a 0600 key file when no keyring is available.
+func Open() (*Vault, error) {
+	dir := utils.GetStackerDir()
+	v := &Vault{
+		path: filepath.Join(dir, vaultFileName),
+		data: make(map[string]string),
+	}
+
+	raw, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		// Reads must not create or replace a keyring entry
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var vf vaultFile
+	if err := json.Unmarshal(raw, &vf); err != nil {
+		return nil, fmt.Errorf("corrupt vault %s: %w", v.path, err)
+	}
+	v.source = vf.KeySource
+
+	switch vf.KeySource {
+	case SourcePassphrase:
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, ErrLocked
+		}
+		v.salt, err = base64.StdEncoding.DecodeString(vf.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt vault salt: %w", err)
+		}
+		v.key = deriveKey(passphrase, v.salt, vf.Iterations)
+	case SourceKeyring:
+		encoded, err := keyringGet(keyringService, keyringAccount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault key from keyring: %w", err)
+		}
+		if v.key, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("invalid vault key in keyring: %w", err)
+		}
+	case SourceFile:
+		encoded, err := os.ReadFile(filepath.Join(dir, keyFileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault key: %w", err)
+		}
+		if v.key, err = base64.StdEncoding.DecodeString(string(encoded)); err != nil {
+			return nil, fmt.Errorf("invalid vault key file: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown vault key source %q", vf.KeySource)
+	}
+
+	if err := v.decrypt(vf); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// initKey chooses and stores the key for a new vault
+func (v *Vault) initKey(dir string) error {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		v.source = SourcePassphrase
+		v.salt = make([]byte, 16)
+		if _, err := rand.Read(v.salt); err != nil {
+			return err
+		}
+		v.key = deriveKey(passphrase, v.salt, pbkdf2Rounds)
+		return nil
+	}
+
+	v.key = make([]byte, keyLength)
+	if _, err := rand.Read(v.key); err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(v.key)
+
+	if keyringAvailable() {
+		err := keyringSet(keyringService, keyringAccount, encoded)
+		if err == nil {
+			v.source = SourceKeyring
+			return nil
+		}
+		utils.LogWarn(fmt.Sprintf("OS keyring unavailable, using key file: %v", err))
+	}
+
+	v.source = SourceFile
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, keyFileName), []byte(encoded), 0600)
+}
+
+// Source reports how the vault key is protected
+func (v *Vault) Source() string {
+	return v.source
+}
+
+// Get returns a secret
+func (v *Vault) Get(name string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	value, ok := v.data[name]
+	return value, ok
+}
+
+// Set stores a secret and saves the vault
+func (v *Vault) Set(name, value string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data[name] = value
+	return v.save()
+}
+
+// Delete removes a secret and saves the vault
+func (v *Vault) Delete(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.data[name]; !ok {
+		return fmt.Errorf("secret %s not found", name)
+	}
+	delete(v.data, name)
+	return v.save()
+}
+
+// List returns the names of all stored secrets
+func (v *Vault) List() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	names := make([]string, 0, len(v.data))
+	for name := range v.data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns a secret, or "" if the vault cannot be opened or the secret
+// does not exist. Intended for callers that have their own fallback.
+func Lookup(name string) string {
+	v, err := Open()
+	if err != nil {
+		return ""
+	}
+	value, _ := v.Get(name)
+	return value
+}
+
+// Store saves a single secret, opening the vault as needed
+func Store(name, value string) error {
+	v, err := Open()
+	if err != nil {
+		return err
+	}
+	return v.Set(name, value)
+}
+
+func (v *Vault) save() error {
+	if v.key == nil {
+		if err := v.initKey(filepath.Dir(v.path)); err != nil {
+			return err
+		}
+	}
+	plaintext, err := json.Marshal(v.data)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	vf := vaultFile{
+		Version:   1,
+		KeySource: v.source,
+		Nonce:     base64.StdEncoding.EncodeToString(nonce),
+		Data:      base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil)),
+	}
+	if v.source == SourcePassphrase {
+		vf.Salt = base64.StdEncoding.EncodeToString(v.salt)
+		vf.Iterations = pbkdf2Rounds
+	}
+
+	data, err := json.MarshalIndent(vf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return err
+	}
+	// Write to a temp file first so a crash never leaves a truncated vault
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.path)
+}
+
+func (v *Vault) decrypt(vf vaultFile) error {
+	nonce, err := base64.StdEncoding.DecodeString(vf.Nonce)
+	if err != nil {
+		return fmt.Errorf("corrupt vault nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(vf.Data)
+	if err != nil {
+		return fmt.Errorf("corrupt vault data: %w", err)
+	}
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		if v.source == SourcePassphrase {
+			return errors.New("failed to unlock vault: wrong passphrase")
+		}
+		return errors.New("failed to unlock vault: key does not match")
+	}
+	return json.Unmarshal(plaintext, &v.data)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey implements PBKDF2-HMAC-SHA256 (RFC 8018) for a single output block
+func deriveKey(passphrase string, salt []byte, iterations int) []byte {
+	if iterations <= 0 {
+		iterations = pbkdf2Rounds
+	}
+	mac := hmac.New(sha256.New, []byte(passphrase))
+	mac.Write(salt)
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], 1)
+	mac.Write(index[:])
+	u := mac.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key[:keyLength]
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// configEdits returns the changes content makes outside its overrides block
+// to fresh, the same config as generated, as lines for the overrides block.
+// strict also refuses generated lines that were removed, which the overrides
+// block cannot express; it is used for saves, where the user can fix them.
+// Edits the overrides block cannot carry, such as changes placed before a
+// section generated after the block, are an error either way.
+func configEdits(tmpl, fresh, content string, strict bool) (string, error) {
+	switch tmpl {
+	case "nginx.conf.tmpl":
+		return nginxEdits(fresh, content, strict)
+	case "redis.conf.tmpl":
+		return lineEdits(fresh, content, false, strict)
+	}
+	return lineEdits(fresh, content, true, strict)
+}
+
+// outsideOverrides returns content without its overrides block
+func outsideOverrides(content string) string {
+	var b strings.Builder
+	inside := false
+	for _, line := range splitLines(content) {
+		switch {
+		case strings.HasPrefix(line, overridesStart):
+			inside = true
+		case strings.HasPrefix(line, overridesEnd):
+			inside = false
+		case !inside:
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// hasOverridesBlock reports whether content is a generated config with its
+// overrides block
+func hasOverridesBlock(content string) bool {
+	return strings.Contains(content, overridesStart)
+}
+
+// configLine is a line of an ini-style config (my.cnf) or of redis.conf
+type configLine struct {
+	section string // [mysqld], "" for redis.conf
+	line    string
+}
+
+func (l configLine) key() string {
+	key := l.line
+	if i := strings.IndexAny(key, "= \t"); i >= 0 {
+		key = key[:i]
+	}
+	// MySQL treats dashes and underscores in option names alike
+	return l.section + " " + strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+func isSectionHeader(line string) bool {
+	return strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")
+}
+
+// parseConfigLines returns the non-blank lines of content with the section
+// each belongs to, and the section the overrides block sits in
+func parseConfigLines(content string, sections bool) (lines []configLine, overridesSection string) {
+	section := ""
+	for _, line := range splitLines(content) {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, overridesStart):
+			overridesSection = section
+		case line == "":
+		case sections && isSectionHeader(line):
+			section = line
+		default:
+			lines = append(lines, configLine{section, line})
+		}
+	}
+	return lines, overridesSection
+}
+
+// lineEdits compares configs line by line, where a later line wins over an
+// earlier one with the same key. Changed lines move to the overrides block,
+// which comes after the generated ones of its section.
+func lineEdits(fresh, content string, sections, strict bool) (string, error) {
+	_, blockSection := parseConfigLines(fresh, sections)
+	generated, _ := parseConfigLines(outsideOverrides(fresh), sections)
+	edited, _ := parseConfigLines(outsideOverrides(content), sections)
+
+	// Sections the template writes after the block would win over it
+	after := make(map[string]bool)
+	seenBlock := false
+	for _, line := range splitLines(fresh) {
+		line = strings.TrimSpace(line)
+		seenBlock = seenBlock || strings.HasPrefix(line, overridesStart)
+		if seenBlock && sections && isSectionHeader(line) {
+			after[line] = true
+		}
+	}
+
+	have := make(map[configLine]bool)
+	for _, l := range generated {
+		have[l] = true
+	}
+	kept := make(map[configLine]bool)
+	changedKeys := make(map[string]bool)
+	var moved []configLine
+	for _, l := range edited {
+		kept[l] = true
+		if have[l] {
+			continue
+		}
+		if after[l.section] {
+			return "", fmt.Errorf("%q in %s cannot be kept: that section is generated after the overrides block", l.line, l.section)
+		}
+		moved = append(moved, l)
+		changedKeys[l.key()] = true
+	}
+
+	if strict {
+		for _, l := range generated {
+			if !kept[l] && !strings.HasPrefix(l.line, "#") && !changedKeys[l.key()] {
+				return "", fmt.Errorf("%q is generated and cannot be removed; override its value in the overrides block instead", l.line)
+			}
+		}
+	}
+
+	// Lines of the block's own section first, then other sections under
+	// their headers
+	var b strings.Builder
+	var others []string
+	grouped := make(map[string][]string)
+	for _, l := range moved {
+		if l.section == blockSection {
+			b.WriteString(l.line + "\n")
+			continue
+		}
+		if _, ok := grouped[l.section]; !ok {
+			others = append(others, l.section)
+		}
+		grouped[l.section] = append(grouped[l.section], l.line)
+	}
+	for _, section := range others {
+		b.WriteString(section + "\n")
+		for _, line := range grouped[section] {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// nginxStatement is a directive of nginx.conf, with the block it opens
+type nginxStatement struct {
+	raw   string // as written, without comments
+	text  string // whitespace collapsed, for comparison
+	name  string
+	block bool
+	body  string // inside the braces of a block
+}
+
+// parseNginx splits nginx config text into its top-level statements
+func parseNginx(content string) []nginxStatement {
+	var statements []nginxStatement
+	text := stripNginxComments(content)
+	start, depth, open := 0, 0, 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++ // escaped character
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+			if depth == 0 {
+				statements = append(statements, newNginxStatement(text[start:i+1], text[open+1:i], true))
+				start = i + 1
+			}
+		case c == ';' && depth == 0:
+			statements = append(statements, newNginxStatement(text[start:i+1], "", false))
+			start = i + 1
+		}
+	}
+	return statements
+}
+
+// stripNginxComments drops comments, including the override markers. As in
+// nginx, a "#" starts a comment only at the start of a token and outside
+// quotes, so add_header X "a#b"; keeps its value.
+func stripNginxComments(content string) string {
+	var b strings.Builder
+	var quote byte
+	tokenStart := true
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(content) {
+				b.WriteByte(c)
+				i++
+				c = content[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '#' && tokenStart:
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			if i == len(content) {
+				return b.String()
+			}
+			c = '\n'
+		case c == '"' || c == '\'':
+			quote = c
+		}
+		b.WriteByte(c)
+		tokenStart = quote == 0 && strings.IndexByte(" \t\r\n;{}", c) >= 0
+	}
+	return b.String()
+}
+
+func newNginxStatement(raw, body string, block bool) nginxStatement {
+	raw = strings.Trim(raw, "\n")
+	fields := strings.Fields(raw)
+	s := nginxStatement{raw: raw, text: strings.Join(fields, " "), block: block, body: body}
+	if len(fields) > 0 {
+		s.name = strings.TrimSuffix(fields[0], ";")
+	}
+	return s
+}
+
+// httpBlock splits statements into the http block and the others
+func httpBlock(statements []nginxStatement) (http *nginxStatement, others []nginxStatement) {
+	for i := range statements {
+		if statements[i].block && statements[i].name == "http" && http == nil {
+			http = &statements[i]
+			continue
+		}
+		others = append(others, statements[i])
+	}
+	return http, others
+}
+
+// nginxEdits compares nginx configs statement by statement. Statements added
+// to the http block move to the overrides block, which sits in it; other
+// changes are only possible through the settings.
+func nginxEdits(fresh, content string, strict bool) (string, error) {
+	freshHTTP, freshOthers := httpBlock(parseNginx(outsideOverrides(fresh)))
+	editedHTTP, editedOthers := httpBlock(parseNginx(outsideOverrides(content)))
+	if freshHTTP == nil || editedHTTP == nil {
+		return "", fmt.Errorf("the http block is generated and cannot be removed")
+	}
+
+	if err := sameStatements(freshOthers, editedOthers, "outside the http block"); err != nil {
+		return "", err
+	}
+
+	generated := parseNginx(freshHTTP.body)
+	have := make(map[string]bool)
+	directives := make(map[string]bool)
+	for _, s := range generated {
+		have[s.text] = true
+		if !s.block && s.name != "include" {
+			directives[s.name] = true
+		}
+	}
+
+	var b strings.Builder
+	kept := make(map[string]bool)
+	for _, s := range parseNginx(editedHTTP.body) {
+		kept[s.text] = true
+		if have[s.text] {
+			continue
+		}
+		if directives[s.name] {
+			return "", fmt.Errorf("%s is generated; change it in the service settings or leave it as it is", s.name)
+		}
+		b.WriteString("    " + strings.TrimSpace(s.raw) + "\n")
+	}
+
+	for _, s := range generated {
+		// An edited generated block, such as the default server, would be
+		// kept next to the generated one
+		if !kept[s.text] && (strict || s.block) {
+			return "", fmt.Errorf("the generated %s %s cannot be changed or removed", s.name, kind(s))
+		}
+	}
+	return b.String(), nil
+}
+
+// sameStatements checks that the statements generated in a scope the
+// overrides block cannot reach were left as they are
+func sameStatements(generated, edited []nginxStatement, scope string) error {
+	have := make(map[string]bool)
+	for _, s := range generated {
+		have[s.text] = true
+	}
+	for _, s := range edited {
+		if !have[s.text] {
+			return fmt.Errorf("%q %s cannot be kept; only the service settings change it", s.text, scope)
+		}
+		delete(have, s.text)
+	}
+	for _, s := range generated {
+		if have[s.text] {
+			return fmt.Errorf("the generated %s %s %s cannot be removed", s.name, kind(s), scope)
+		}
+	}
+	return nil
+}
+
+func kind(s nginxStatement) string {
+	if s.block {
+		return "block"
+	}
+	return "directive"
+}
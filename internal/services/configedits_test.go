@@ -0,0 +1,337 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOverrides = "# >>> your overrides: kept when Stacker regenerates this file\n# <<< end of your overrides\n"
+
+const testMyCnf = `# Generated by Stacker from the service settings and rewritten on every start.
+[mysqld]
+port = 3306
+datadir = /data
+max_connections = 151
+` + testOverrides
+
+const testMariaDBCnf = `# Generated by Stacker from the service settings and rewritten on every start.
+[mysqld]
+port = 3306
+max_connections = 151
+` + testOverrides + `
+[mysqld_safe]
+basedir = /opt/mariadb
+
+[client]
+port = 3306
+`
+
+const testRedisConf = `# Generated by Stacker from the service settings.
+port 6379
+daemonize no
+maxmemory 128mb
+` + testOverrides
+
+const testNginxConf = `# Generated by Stacker from the service settings and rewritten on every start.
+worker_processes  1;
+pid "/stacker/pids/nginx.pid";
+
+events {
+    worker_connections  1024;
+}
+http {
+    include       mime.types;
+    sendfile        on;
+    server {
+        listen       8080;
+        location / {
+            try_files $uri $uri/ =404;
+        }
+    }
+` + testOverrides + `    include "/stacker/conf/nginx/*.conf";
+}
+`
+
+// edit returns fresh with old replaced by new, failing when old is missing
+func edit(t *testing.T, fresh, old, new string) string {
+	t.Helper()
+	if !strings.Contains(fresh, old) {
+		t.Fatalf("%q not in the test config", old)
+	}
+	return strings.Replace(fresh, old, new, 1)
+}
+
+func TestConfigEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		fresh   string
+		content func(t *testing.T, fresh string) string
+		strict  bool
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "my.cnf unchanged",
+			tmpl:    "my.cnf.tmpl",
+			fresh:   testMyCnf,
+			content: func(t *testing.T, fresh string) string { return fresh },
+			strict:  true,
+		},
+		{
+			name:  "my.cnf changed value moves",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "max_connections = 151", "max_connections = 500")
+			},
+			strict: true,
+			want:   "max_connections = 500\n",
+		},
+		{
+			name:  "my.cnf dashes and underscores are the same option",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "max_connections = 151", "max-connections = 500")
+			},
+			strict: true,
+			want:   "max-connections = 500\n",
+		},
+		{
+			name:  "my.cnf added lines keep their order",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "datadir = /data\n", "datadir = /data\nslow_query_log = 1\nlong_query_time = 2\n")
+			},
+			strict: true,
+			want:   "slow_query_log = 1\nlong_query_time = 2\n",
+		},
+		{
+			name:  "my.cnf other sections follow the block's own lines",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				content := edit(t, fresh, "[mysqld]\n", "[mysqldump]\nquick\n\n[mysqld]\n")
+				return edit(t, content, "datadir = /data\n", "datadir = /data\nskip-name-resolve\n")
+			},
+			strict: true,
+			want:   "skip-name-resolve\n[mysqldump]\nquick\n",
+		},
+		{
+			name:  "my.cnf lines inside the block are not edits",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "# <<< end", "sql_mode = ''\n# <<< end")
+			},
+			strict: true,
+		},
+		{
+			name:  "my.cnf removed line is refused on save",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "datadir = /data\n", "")
+			},
+			strict:  true,
+			wantErr: `"datadir = /data" is generated and cannot be removed`,
+		},
+		{
+			name:  "my.cnf removed line is ignored when migrating",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "datadir = /data\n", "")
+			},
+		},
+		{
+			name:  "my.cnf removed comment is fine",
+			tmpl:  "my.cnf.tmpl",
+			fresh: testMyCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "# Generated by Stacker from the service settings and rewritten on every start.\n", "")
+			},
+			strict: true,
+		},
+		{
+			name:  "mariadb.cnf edit in [mysqld] moves",
+			tmpl:  "mariadb.cnf.tmpl",
+			fresh: testMariaDBCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "max_connections = 151", "max_connections = 300")
+			},
+			strict: true,
+			want:   "max_connections = 300\n",
+		},
+		{
+			name:  "mariadb.cnf section after the block is refused",
+			tmpl:  "mariadb.cnf.tmpl",
+			fresh: testMariaDBCnf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "[client]\nport = 3306\n", "[client]\nport = 3306\ndefault-character-set = utf8mb4\n")
+			},
+			wantErr: "generated after the overrides block",
+		},
+		{
+			name:  "redis.conf changed directive moves",
+			tmpl:  "redis.conf.tmpl",
+			fresh: testRedisConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "maxmemory 128mb", "maxmemory 256mb\nappendonly yes")
+			},
+			strict: true,
+			want:   "maxmemory 256mb\nappendonly yes\n",
+		},
+		{
+			name:  "redis.conf has no sections",
+			tmpl:  "redis.conf.tmpl",
+			fresh: testRedisConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "port 6379\n", "port 6379\n[not-a-section]\n")
+			},
+			strict: true,
+			want:   "[not-a-section]\n",
+		},
+		{
+			name:  "redis.conf removed directive is refused on save",
+			tmpl:  "redis.conf.tmpl",
+			fresh: testRedisConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "daemonize no\n", "")
+			},
+			strict:  true,
+			wantErr: `"daemonize no" is generated and cannot be removed`,
+		},
+		{
+			name:    "nginx.conf unchanged",
+			tmpl:    "nginx.conf.tmpl",
+			fresh:   testNginxConf,
+			content: func(t *testing.T, fresh string) string { return fresh },
+			strict:  true,
+		},
+		{
+			name:  "nginx.conf http directive moves",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "    sendfile        on;\n", "    sendfile        on;\n    gzip  on; # compress responses\n")
+			},
+			strict: true,
+			want:   "    gzip  on;\n",
+		},
+		{
+			name:  "nginx.conf keeps # inside quotes",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "    sendfile        on;\n", "    sendfile        on;\n    add_header X-Test \"a#b;c\";\n")
+			},
+			strict: true,
+			want:   "    add_header X-Test \"a#b;c\";\n",
+		},
+		{
+			name:  "nginx.conf added server block moves",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "    include \"/stacker", "    server { listen 8081; }\n    include \"/stacker")
+			},
+			strict: true,
+			want:   "    server { listen 8081; }\n",
+		},
+		{
+			name:  "nginx.conf changed generated directive is refused",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "sendfile        on;", "sendfile        off;")
+			},
+			wantErr: "sendfile is generated",
+		},
+		{
+			name:  "nginx.conf change outside http is refused",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "worker_processes  1;", "worker_processes  4;")
+			},
+			wantErr: "outside the http block",
+		},
+		{
+			name:  "nginx.conf changed generated block is refused",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "listen       8080;", "listen       9090;")
+			},
+			wantErr: "the generated server block cannot be changed or removed",
+		},
+		{
+			name:  "nginx.conf removed directive is refused on save",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "    sendfile        on;\n", "")
+			},
+			strict:  true,
+			wantErr: "the generated sendfile directive cannot be changed or removed",
+		},
+		{
+			name:  "nginx.conf removed directive is ignored when migrating",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return edit(t, fresh, "    sendfile        on;\n", "")
+			},
+		},
+		{
+			name:  "nginx.conf without http is refused",
+			tmpl:  "nginx.conf.tmpl",
+			fresh: testNginxConf,
+			content: func(t *testing.T, fresh string) string {
+				return fresh[:strings.Index(fresh, "http {")]
+			},
+			wantErr: "the http block is generated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := configEdits(tt.tmpl, tt.fresh, tt.content(t, tt.fresh), tt.strict)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("edits = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripNginxComments(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"gzip on; # compress\n", "gzip on; \n"},
+		{"# marker\nsendfile on;\n", "\nsendfile on;\n"},
+		{`add_header X "a#b";` + "\n", `add_header X "a#b";` + "\n"},
+		{`add_header X 'a#b' # why` + "\n", `add_header X 'a#b' ` + "\n"},
+		{`return 200 "say \"#hi\"";` + "\n", `return 200 "say \"#hi\"";` + "\n"},
+		{"rewrite ^/a#b /c;\n", "rewrite ^/a#b /c;\n"},
+		{"location / {# open\n}", "location / {\n}"},
+		{"last; # no newline", "last; "},
+	}
+	for _, tt := range tests {
+		if got := stripNginxComments(tt.in); got != tt.want {
+			t.Errorf("stripNginxComments(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
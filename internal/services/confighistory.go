@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// maxConfigVersions is how many versions of a config file are kept
+const maxConfigVersions = 50
+
+// ConfigVersion is one saved version of a service's config file
+type ConfigVersion struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Size    int       `json:"size"`
+	Note    string    `json:"note,omitempty"`
+	Current bool      `json:"current"` // matches the file on disk
+}
+
+// configHistoryDir keeps the versions of a service's config file
+func (sm *ServiceManager) configHistoryDir(name string) string {
+	return filepath.Join(sm.baseDir, "conf", "history", name)
+}
+
+func (sm *ServiceManager) configVersionFile(svc *Service, version int) string {
+	return filepath.Join(sm.configHistoryDir(svc.Name), strconv.Itoa(version)+filepath.Ext(sm.mainConfigFile(svc)))
+}
+
+func (sm *ServiceManager) loadConfigVersions(name string) []ConfigVersion {
+	var versions []ConfigVersion
+	data, err := os.ReadFile(filepath.Join(sm.configHistoryDir(name), "versions.json"))
+	if err == nil {
+		json.Unmarshal(data, &versions)
+	}
+	return versions
+}
+
+func (sm *ServiceManager) saveConfigVersions(name string, versions []ConfigVersion) error {
+	data, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(sm.configHistoryDir(name), "versions.json"), data, 0644)
+}
+
+// recordConfigVersion adds content as the newest version unless it matches
+// the newest one already, dropping the oldest versions past the limit
+func (sm *ServiceManager) recordConfigVersion(svc *Service, content []byte, note string) error {
+	versions := sm.loadConfigVersions(svc.Name)
+	next := 1
+	if len(versions) > 0 {
+		last := versions[len(versions)-1]
+		if data, err := os.ReadFile(sm.configVersionFile(svc, last.Version)); err == nil && string(data) == string(content) {
+			return nil
+		}
+		next = last.Version + 1
+	}
+
+	if err := os.MkdirAll(sm.configHistoryDir(svc.Name), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(sm.configVersionFile(svc, next), content, 0644); err != nil {
+		return err
+	}
+	versions = append(versions, ConfigVersion{Version: next, Time: time.Now(), Size: len(content), Note: note})
+	for len(versions) > maxConfigVersions {
+		os.Remove(sm.configVersionFile(svc, versions[0].Version))
+		versions = versions[1:]
+	}
+	return sm.saveConfigVersions(svc.Name, versions)
+}
+
+// ConfigHistory returns the kept versions of a service's config file, oldest
+// first
+func (sm *ServiceManager) ConfigHistory(name string) ([]ConfigVersion, error) {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	if sm.mainConfigFile(svc) == "" {
+		return nil, fmt.Errorf("config not available for %s", svc.Type)
+	}
+
+	sm.historyMu.Lock()
+	defer sm.historyMu.Unlock()
+
+	versions := sm.loadConfigVersions(name)
+	if len(versions) > 0 {
+		current, _ := os.ReadFile(sm.mainConfigFile(svc))
+		last := versions[len(versions)-1].Version
+		if data, err := os.ReadFile(sm.configVersionFile(svc, last)); err == nil && string(data) == string(current) {
+			versions[len(versions)-1].Current = true
+		}
+	}
+	return versions, nil
+}
+
+// ConfigAtVersion returns a kept version of a service's config file; version
+// 0 is the file on disk
+func (sm *ServiceManager) ConfigAtVersion(name string, version int) (string, error) {
+	if version == 0 {
+		_, content, err := sm.GetServiceConfig(name)
+		return content, err
+	}
+	svc := sm.GetService(name)
+	if svc == nil {
+		return "", fmt.Errorf("service %s not found", name)
+	}
+	if sm.mainConfigFile(svc) == "" {
+		return "", fmt.Errorf("config not available for %s", svc.Type)
+	}
+
+	sm.historyMu.Lock()
+	defer sm.historyMu.Unlock()
+
+	data, err := os.ReadFile(sm.configVersionFile(svc, version))
+	if err != nil {
+		return "", fmt.Errorf("version %d of %s config not found", version, name)
+	}
+	return string(data), nil
+}
+
+// DiffServiceConfig returns a unified diff between two versions of a
+// service's config file; version 0 is the file on disk
+func (sm *ServiceManager) DiffServiceConfig(name string, from, to int) (string, error) {
+	a, err := sm.ConfigAtVersion(name, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := sm.ConfigAtVersion(name, to)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(versionLabel(from), versionLabel(to), a, b), nil
+}
+
+func versionLabel(version int) string {
+	if version == 0 {
+		return "current"
+	}
+	return fmt.Sprintf("version %d", version)
+}
+
+// RestoreServiceConfig saves a kept version as the config file again. It is
+// validated and applied like any other save, and recorded as a new version.
+func (sm *ServiceManager) RestoreServiceConfig(name string, version int) error {
+	if version == 0 {
+		return fmt.Errorf("version is required")
+	}
+	content, err := sm.ConfigAtVersion(name, version)
+	if err != nil {
+		return err
+	}
+	return sm.saveServiceConfig(name, content, fmt.Sprintf("restored version %d", version))
+}
+
+// ValidateServiceConfig checks content with the service's own checker
+// without saving it
+func (sm *ServiceManager) ValidateServiceConfig(name, content string) error {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	configFile := sm.mainConfigFile(svc)
+	if configFile == "" {
+		return fmt.Errorf("config not available for %s", svc.Type)
+	}
+	content, _, err := sm.generatedContent(svc, content)
+	if err != nil {
+		return err
+	}
+	return sm.validateConfig(svc, configFile, content)
+}
+
+// validateConfig checks content next to configFile, so relative includes
+// resolve the way they will once it is saved
+func (sm *ServiceManager) validateConfig(svc *Service, configFile, content string) error {
+	candidate := configFile + ".check"
+	if err := os.MkdirAll(filepath.Dir(candidate), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(candidate, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	defer os.Remove(candidate)
+	return sm.checkConfig(svc, candidate)
+}
+
+// SaveServiceConfig validates and saves a service's config file, keeping the
+// replaced content in its history, and reloads the service if it is running
+func (sm *ServiceManager) SaveServiceConfig(name, content string) error {
+	return sm.saveServiceConfig(name, content, "saved")
+}
+
+func (sm *ServiceManager) saveServiceConfig(name, content, note string) error {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	configFile := sm.mainConfigFile(svc)
+	if configFile == "" {
+		return fmt.Errorf("config not available for %s", svc.Type)
+	}
+
+	// Generated configs keep only their overrides block on regeneration
+	content, moved, err := sm.generatedContent(svc, content)
+	if err != nil {
+		utils.LogService(name, "config", "rejected: "+err.Error())
+		return err
+	}
+	if moved {
+		fmt.Printf("📝 Changes to the generated part of %s moved into its overrides block\n", filepath.Base(configFile))
+	}
+
+	if err := sm.validateConfig(svc, configFile, content); err != nil {
+		utils.LogService(name, "config", "rejected: "+err.Error())
+		return err
+	}
+	return sm.commitServiceConfig(svc, configFile, content, note)
+}
+
+// commitServiceConfig writes validated content as the config file, records
+// it in the history and reloads the service if it is running
+func (sm *ServiceManager) commitServiceConfig(svc *Service, configFile, content, note string) error {
+	name := svc.Name
+	sm.historyMu.Lock()
+	// Keep what is being replaced, including hand edits and generated files
+	if previous, err := os.ReadFile(configFile); err == nil {
+		previousNote := "external change"
+		if len(sm.loadConfigVersions(name)) == 0 {
+			previousNote = "original"
+		}
+		if err := sm.recordConfigVersion(svc, previous, previousNote); err != nil {
+			utils.LogWarn(fmt.Sprintf("Failed to keep config history of %s: %v", name, err))
+		}
+	}
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		sm.historyMu.Unlock()
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := sm.recordConfigVersion(svc, []byte(content), note); err != nil {
+		utils.LogWarn(fmt.Sprintf("Failed to keep config history of %s: %v", name, err))
+	}
+	sm.historyMu.Unlock()
+
+	utils.LogService(name, "config", note)
+	fmt.Printf("💾 Config saved for %s\n", name)
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: filepath.Base(configFile)})
+
+	// Apply right away if running
+	if svc.Status == "running" {
+		fmt.Printf("🔄 Reloading %s after config change...\n", name)
+		return sm.ReloadService(name)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxCheckOutput bounds the checker output quoted in errors
+const maxCheckOutput = 20
+
+// TestWebServerConfig checks the configuration of every installed nginx or
+// apache service with "nginx -t" / "httpd -t", which also covers the site
+// vhosts they include. Types that are not installed pass.
+func (sm *ServiceManager) TestWebServerConfig(svcType string) error {
+	for _, svc := range sm.GetServices() {
+		if svc.Type != svcType {
+			continue
+		}
+		if err := sm.testConfig(svc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testConfig checks the config files a service runs with
+func (sm *ServiceManager) testConfig(svc *Service) error {
+	configFile := sm.mainConfigFile(svc)
+	switch {
+	case svc.Type == "nginx":
+		if _, err := os.Stat(configFile); os.IsNotExist(err) {
+			sm.createNginxConfig(svc.ConfigDir, svc.Port, svc.Version)
+		}
+	case svc.Type == "apache":
+		if _, err := os.Stat(configFile); os.IsNotExist(err) {
+			sm.createApacheConfig(svc.ConfigDir, svc.DataDir, svc.BinaryDir, svc.Version, svc.Port)
+		}
+	case strings.HasPrefix(svc.Type, "php"):
+		return sm.testFPMConfig(svc)
+	}
+	if configFile == "" {
+		return nil
+	}
+	if _, err := os.Stat(configFile); err != nil {
+		return nil
+	}
+	return sm.checkConfig(svc, configFile)
+}
+
+// testFPMConfig checks the generated PHP-FPM config. Only PHP-FPM has a
+// config test.
+func (sm *ServiceManager) testFPMConfig(svc *Service) error {
+	binaryPath := sm.findPHPBinary(svc.BinaryDir)
+	configFile := sm.fpmConfigFile(svc.Name)
+	if !strings.Contains(filepath.Base(binaryPath), "php-fpm") {
+		return nil
+	}
+	if _, err := os.Stat(configFile); os.IsNotExist(err) {
+		return nil
+	}
+	return runConfigCheck(svc, exec.Command(binaryPath, "-t", "-y", configFile))
+}
+
+// checkConfig runs the service's own checker against configFile, read as the
+// service's main config: nginx -t, httpd -t, mysqld --validate-config,
+// mariadbd --help --verbose (which fails on unknown options), a throwaway
+// redis-server and php -m. Services that are not installed, or have no
+// checker, pass.
+func (sm *ServiceManager) checkConfig(svc *Service, configFile string) error {
+	switch svc.Type {
+	case "nginx":
+		binaryPath := sm.findNginxBinary(svc.BinaryDir)
+		if binaryPath == "" {
+			return nil
+		}
+		cmd := sm.startNginx(svc, binaryPath)
+		cmd.Args = []string{binaryPath, "-t", "-c", configFile}
+		return runConfigCheck(svc, cmd)
+	case "apache":
+		// Reuse the start command for its environment (Apache needs its library paths)
+		binaryPath := sm.findApacheBinary(svc.BinaryDir)
+		if binaryPath == "" {
+			return nil
+		}
+		cmd := sm.startApache(svc, binaryPath)
+		cmd.Args = []string{binaryPath, "-t", "-f", configFile}
+		return runConfigCheck(svc, cmd)
+	case "mysql":
+		root := sm.findMySQLBinary(svc.BinaryDir)
+		if root == "" {
+			return nil
+		}
+		// --defaults-file must come first
+		cmd := sm.startMySQL(svc, root)
+		cmd.Args = []string{cmd.Path, "--defaults-file=" + configFile, "--validate-config"}
+		return runConfigCheck(svc, cmd)
+	case "mariadb":
+		root := sm.findMariaDBBinary(svc.BinaryDir)
+		if root == "" {
+			return nil
+		}
+		cmd := sm.startMariaDB(svc, root)
+		cmd.Args = []string{cmd.Path, "--defaults-file=" + configFile, "--help", "--verbose"}
+		return runConfigCheck(svc, cmd)
+	case "redis":
+		return sm.checkRedisConfig(svc, configFile)
+	case "php":
+		binaryPath := sm.findPHPBinary(svc.BinaryDir)
+		if binaryPath == "" {
+			return nil
+		}
+		// PHP only warns about a broken php.ini, so look for the warning
+		output, _ := exec.Command(binaryPath, "-c", configFile, "-m").CombinedOutput()
+		for _, line := range strings.Split(string(output), "\n") {
+			if strings.Contains(line, "syntax error") || strings.Contains(line, "Parse error") {
+				return fmt.Errorf("%s config test failed: %s", svc.Name, strings.TrimSpace(line))
+			}
+		}
+	}
+	return nil
+}
+
+// checkRedisConfig starts redis-server on the config without listening or
+// persisting anything. A config error makes it exit at once; if it is still
+// up after a second the config loaded.
+func (sm *ServiceManager) checkRedisConfig(svc *Service, configFile string) error {
+	binaryPath := redisTool(svc, "redis-server")
+	if binaryPath == "" {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "stacker-redis-check")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Command line options override the file, so the check cannot touch the
+	// running instance's port, socket, pid file, log or data
+	cmd := exec.Command(binaryPath, configFile,
+		"--port", "0", "--daemonize", "no", "--supervised", "no", "--appendonly", "no",
+		"--dir", dir, "--unixsocket", filepath.Join(dir, "redis.sock"),
+		"--pidfile", filepath.Join(dir, "redis.pid"), "--logfile", filepath.Join(dir, "redis.log"))
+	output := &tailBuffer{max: maxCheckOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case <-exited:
+		return fmt.Errorf("%s config test failed: %s", svc.Name, strings.Join(output.Lines(), "\n"))
+	case <-time.After(time.Second):
+		cmd.Process.Kill()
+		<-exited
+		return nil
+	}
+}
+
+// runConfigCheck runs a checker command and turns its failure into an error
+// quoting the checker's output
+func runConfigCheck(svc *Service, cmd *exec.Cmd) error {
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s config test failed: %s", svc.Name, checkOutput(string(output)))
+	}
+	return nil
+}
+
+// checkOutput trims long checker output to its error lines
+func checkOutput(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) <= maxCheckOutput {
+		return strings.TrimSpace(output)
+	}
+	var errs []string
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "error") || strings.Contains(lower, "emerg") || strings.Contains(lower, "unknown") {
+			errs = append(errs, strings.TrimSpace(line))
+		}
+	}
+	if len(errs) == 0 || len(errs) > maxCheckOutput {
+		errs = lines[len(lines)-maxCheckOutput:]
+	}
+	return strings.Join(errs, "\n")
+}
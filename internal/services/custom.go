@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// CustomServiceType is the type of user-defined services
+const CustomServiceType = "custom"
+
+// ProbeCommand runs a custom service's health check command
+const ProbeCommand = "command"
+
+var customServiceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// CustomServices returns the user-defined service definitions
+func (sm *ServiceManager) CustomServices() map[string]config.CustomService {
+	result := make(map[string]config.CustomService)
+	for name, def := range config.GetPreferences().CustomServices {
+		result[name] = def
+	}
+	return result
+}
+
+// AddCustomService registers a command as a managed service, or replaces the
+// definition of a stopped custom service
+func (sm *ServiceManager) AddCustomService(name string, def config.CustomService) error {
+	if !customServiceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid service name %q: use lowercase letters, digits, '.', '_' and '-'", name)
+	}
+	if strings.TrimSpace(def.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if def.Port < 0 || def.Port > 65535 {
+		return fmt.Errorf("invalid port %d", def.Port)
+	}
+	switch def.HealthCheck.Type {
+	case "", ProbeNone:
+	case ProbeTCP, ProbeHTTP:
+		if def.Port == 0 {
+			return fmt.Errorf("a %s health check needs a port", def.HealthCheck.Type)
+		}
+	case ProbeCommand:
+		if len(def.HealthCheck.Command) == 0 {
+			return fmt.Errorf("a command health check needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown health check %q, expected tcp, http, command or none", def.HealthCheck.Type)
+	}
+
+	sm.mu.Lock()
+	if svc, exists := sm.services[name]; exists {
+		if svc.Type != CustomServiceType {
+			sm.mu.Unlock()
+			return fmt.Errorf("%s is an installed service", name)
+		}
+		if svc.Status == "running" {
+			sm.mu.Unlock()
+			return fmt.Errorf("service %s is running; stop it before changing it", name)
+		}
+	}
+
+	p := config.GetPreferences()
+	if p.CustomServices == nil {
+		p.CustomServices = make(map[string]config.CustomService)
+	}
+	p.CustomServices[name] = def
+	if err := p.Save(); err != nil {
+		sm.mu.Unlock()
+		return err
+	}
+	sm.services[name] = sm.newCustomService(name, def)
+	sm.mu.Unlock()
+
+	utils.LogService(name, "add", "custom: "+def.Command)
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: "custom service saved"})
+	return nil
+}
+
+// RemoveCustomService stops a custom service and deletes its definition.
+// Its log file is kept.
+func (sm *ServiceManager) RemoveCustomService(name string) error {
+	sm.mu.Lock()
+	svc, exists := sm.services[name]
+	if !exists || svc.Type != CustomServiceType {
+		sm.mu.Unlock()
+		return fmt.Errorf("custom service %s not found", name)
+	}
+	if svc.Status == "running" {
+		sm.stopServiceInternal(svc)
+	}
+	delete(sm.services, name)
+
+	p := config.GetPreferences()
+	delete(p.CustomServices, name)
+	delete(p.ServicePorts, name)
+	delete(p.RestartPolicies, name)
+	delete(p.ServiceDependencies, name)
+	err := p.Save()
+	sm.mu.Unlock()
+
+	os.Remove(sm.getPIDFile(name))
+	utils.LogService(name, "remove", "custom")
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: "custom service removed"})
+	return err
+}
+
+// loadCustomServices adds the user-defined services. Called with sm.mu held.
+func (sm *ServiceManager) loadCustomServices() {
+	for name, def := range config.GetPreferences().CustomServices {
+		if _, exists := sm.services[name]; exists {
+			utils.LogWarn(fmt.Sprintf("Custom service %s hidden by an installed service of the same name", name))
+			continue
+		}
+		sm.services[name] = sm.newCustomService(name, def)
+	}
+}
+
+func (sm *ServiceManager) newCustomService(name string, def config.CustomService) *Service {
+	svc := &Service{
+		Name:      name,
+		Type:      CustomServiceType,
+		Port:      sm.portFor(name, CustomServiceType),
+		Status:    "stopped",
+		Installed: time.Now().Format(time.RFC3339),
+		Runnable:  true,
+	}
+
+	// Pick up a process started by an earlier run
+	if pid := sm.loadPID(name); sm.adoptPID(svc, pid) {
+		svc.Status = "running"
+		svc.PID = pid
+	}
+	return svc
+}
+
+// customEnv returns the environment of a custom service: Stacker's own,
+// PORT, then the definition's variables
+func customEnv(svc *Service, def config.CustomService) []string {
+	vars := make(map[string]string)
+	if svc.Port > 0 {
+		vars["PORT"] = fmt.Sprintf("%d", svc.Port)
+	}
+	lookup := func(key string) string {
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+
+	env := os.Environ()
+	if port, ok := vars["PORT"]; ok {
+		env = append(env, "PORT="+port)
+	}
+	for key, value := range def.Env {
+		env = append(env, key+"="+os.Expand(value, lookup))
+	}
+	return env
+}
+
+// expandCustom expands ${PORT} and environment variables in a custom
+// service's command line
+func expandCustom(value string, svc *Service) string {
+	return os.Expand(value, func(key string) string {
+		if key == "PORT" && svc.Port > 0 {
+			return fmt.Sprintf("%d", svc.Port)
+		}
+		return os.Getenv(key)
+	})
+}
+
+func (sm *ServiceManager) customWorkingDir(def config.CustomService) string {
+	dir := def.WorkingDir
+	if dir == "" {
+		return sm.baseDir
+	}
+	if strings.HasPrefix(dir, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, dir[1:])
+		}
+	}
+	return dir
+}
+
+// startCustom builds the command of a custom service
+func (sm *ServiceManager) startCustom(svc *Service) (*exec.Cmd, error) {
+	def, ok := config.GetPreferences().CustomServices[svc.Name]
+	if !ok {
+		return nil, fmt.Errorf("custom service %s has no definition", svc.Name)
+	}
+
+	dir := sm.customWorkingDir(def)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("working directory %s: %w", dir, err)
+	}
+
+	// Relative paths like ./bin/worker are resolved from the working dir
+	command := expandCustom(def.Command, svc)
+	if !filepath.IsAbs(command) && strings.ContainsAny(command, `/\`) {
+		command = filepath.Join(dir, command)
+	}
+	args := make([]string, len(def.Args))
+	for i, arg := range def.Args {
+		args[i] = expandCustom(arg, svc)
+	}
+
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	cmd.Env = customEnv(svc, def)
+	return cmd, nil
+}
+
+// customLogFile returns the log file set for a custom service, if any
+func (sm *ServiceManager) customLogFile(name string) string {
+	def := config.GetPreferences().CustomServices[name]
+	if def.LogFile == "" {
+		return ""
+	}
+	path := os.ExpandEnv(def.LogFile)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(sm.customWorkingDir(def), path)
+	}
+	return path
+}
+
+// customHealthCheck returns the readiness probe of a custom service
+func customHealthCheck(svc *Service) (probe, path string) {
+	check := config.GetPreferences().CustomServices[svc.Name].HealthCheck
+	probe = check.Type
+	if probe == "" {
+		probe = ProbeNone
+		if svc.Port > 0 {
+			probe = ProbeTCP
+		}
+	}
+	return probe, check.Path
+}
+
+// probeCustomCommand runs a custom service's health check command
+func (sm *ServiceManager) probeCustomCommand(svc *Service) error {
+	def := config.GetPreferences().CustomServices[svc.Name]
+	if len(def.HealthCheck.Command) == 0 {
+		return fmt.Errorf("no health check command for %s", svc.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	args := make([]string, len(def.HealthCheck.Command))
+	for i, arg := range def.HealthCheck.Command {
+		args[i] = expandCustom(arg, svc)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = sm.customWorkingDir(def)
+	cmd.Env = customEnv(svc, def)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("health check failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
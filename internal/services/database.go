@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// DatabaseClient returns the command line client of a MySQL or MariaDB
+// service, falling back to the client on PATH.
+func (sm *ServiceManager) DatabaseClient(svc *Service) string {
+	if svc.Type == "mariadb" {
+		return sm.databaseTool(svc, "mariadb", "mysql")
+	}
+	return sm.databaseTool(svc, "mysql")
+}
+
+// databaseTool returns the first of tools found in a MySQL or MariaDB
+// install, or on PATH
+func (sm *ServiceManager) databaseTool(svc *Service, tools ...string) string {
+	var root string
+	switch svc.Type {
+	case "mariadb":
+		root = sm.findMariaDBBinary(svc.BinaryDir)
+	case "mysql":
+		root = sm.findMySQLBinary(svc.BinaryDir)
+	}
+
+	for _, tool := range tools {
+		if runtime.GOOS == "windows" {
+			tool += ".exe"
+		}
+		if root != "" {
+			path := filepath.Join(root, "bin", tool)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+		if path, err := exec.LookPath(tool); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// CreateDatabase creates a database on a running MySQL or MariaDB service
+func (sm *ServiceManager) CreateDatabase(serviceName, database string) error {
+	if !databaseNamePattern.MatchString(database) {
+		return fmt.Errorf("invalid database name %q", database)
+	}
+
+	svc := sm.GetService(serviceName)
+	if svc == nil {
+		return fmt.Errorf("service %s not found", serviceName)
+	}
+	if svc.Type != "mysql" && svc.Type != "mariadb" {
+		return fmt.Errorf("service %s is not a database server", serviceName)
+	}
+	if svc.Status != "running" {
+		return fmt.Errorf("service %s is not running", serviceName)
+	}
+
+	client := sm.DatabaseClient(svc)
+	if client == "" {
+		return fmt.Errorf("no mysql client found for %s", serviceName)
+	}
+
+	user := svc.Username
+	if user == "" {
+		user = "root"
+	}
+	cmd := exec.Command(client,
+		"--protocol=TCP", "-h", "127.0.0.1", "-P", fmt.Sprintf("%d", svc.Port), "-u", user,
+		"-e", fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci", database),
+	)
+	// Pass the password through the environment so it does not show up in ps
+	cmd.Env = append(os.Environ(), "MYSQL_PWD="+svc.Password)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create database %s: %v: %s", database, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
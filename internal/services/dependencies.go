@@ -0,0 +1,539 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// Readiness probes
+const (
+	ProbeTCP        = "tcp"
+	ProbeHTTP       = "http"
+	ProbeMySQLAdmin = "mysqladmin"
+	ProbeRedisCLI   = "redis-cli"
+	ProbeNone       = "none"
+)
+
+const defaultReadyTimeout = 30 * time.Second
+
+// defaultDependencies apply when a service declares none. They are types, so
+// they only order services started together and never fail when missing.
+var defaultDependencies = map[string][]string{
+	"nginx":  {"php"},
+	"apache": {"php"},
+}
+
+// DependencyError reports a service that was not started because one of its
+// dependencies failed
+type DependencyError struct {
+	Service    string
+	Dependency string
+	Err        error
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("%s not started: dependency %s failed: %v", e.Service, e.Dependency, e.Err)
+}
+
+func (e *DependencyError) Unwrap() error {
+	return e.Err
+}
+
+// dependencySpec returns a service's declared dependency settings, or the
+// defaults for its type. declared is false for defaults.
+func (sm *ServiceManager) dependencySpec(svc *Service) (spec config.ServiceDependency, declared bool) {
+	spec, ok := config.GetPreferences().ServiceDependencies[svc.Name]
+	if ok {
+		declared = len(spec.DependsOn) > 0
+	} else {
+		spec.DependsOn = defaultDependencies[svc.Type]
+	}
+	// Custom services are probed with their own health check
+	if svc.Type == CustomServiceType && spec.Probe == "" {
+		spec.Probe, spec.ProbePath = customHealthCheck(svc)
+	}
+	return spec, declared
+}
+
+// DependencySettings returns the dependencies and readiness probe of a
+// service, with the probe filled in from its type when not set
+func (sm *ServiceManager) DependencySettings(name string) config.ServiceDependency {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return config.ServiceDependency{}
+	}
+	spec, _ := sm.dependencySpec(svc)
+	if spec.Probe == "" {
+		spec.Probe = defaultProbe(svc.Type)
+	}
+	return spec
+}
+
+// SetDependencies stores a service's dependencies and readiness probe
+func (sm *ServiceManager) SetDependencies(name string, spec config.ServiceDependency) error {
+	if sm.GetService(name) == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	switch spec.Probe {
+	case "", ProbeTCP, ProbeHTTP, ProbeMySQLAdmin, ProbeRedisCLI, ProbeCommand, ProbeNone:
+	default:
+		return fmt.Errorf("unknown probe %q", spec.Probe)
+	}
+
+	p := config.GetPreferences()
+	previous, hadPrevious := p.ServiceDependencies[name]
+	if p.ServiceDependencies == nil {
+		p.ServiceDependencies = make(map[string]config.ServiceDependency)
+	}
+	p.ServiceDependencies[name] = spec
+
+	// Reject unknown services and cycles before saving
+	if _, err := sm.startOrder([]string{name}); err != nil {
+		if hadPrevious {
+			p.ServiceDependencies[name] = previous
+		} else {
+			delete(p.ServiceDependencies, name)
+		}
+		return err
+	}
+	if err := p.Save(); err != nil {
+		return err
+	}
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: "dependencies"})
+	return nil
+}
+
+// Dependencies returns the installed services name depends on, given the
+// services being started together
+func (sm *ServiceManager) Dependencies(name string) ([]string, error) {
+	return sm.resolveDependencies(name, map[string]bool{name: true})
+}
+
+func (sm *ServiceManager) resolveDependencies(name string, starting map[string]bool) ([]string, error) {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	spec, declared := sm.dependencySpec(svc)
+	installed := sm.GetServices()
+
+	seen := make(map[string]bool)
+	var deps []string
+	for _, ref := range spec.DependsOn {
+		if dep := sm.GetService(ref); dep != nil {
+			if !seen[ref] && ref != name {
+				seen[ref] = true
+				deps = append(deps, ref)
+			}
+			continue
+		}
+
+		// A type matches installed services of that type started alongside,
+		// or already running
+		matched := false
+		for _, dep := range installed {
+			if dep.Name == name || !(dep.Type == ref || strings.HasPrefix(dep.Type, ref)) {
+				continue
+			}
+			matched = true
+			if (starting[dep.Name] || dep.Status == "running") && !seen[dep.Name] {
+				seen[dep.Name] = true
+				deps = append(deps, dep.Name)
+			}
+		}
+		if !matched && declared {
+			return nil, fmt.Errorf("%s depends on %s, which is not installed", name, ref)
+		}
+	}
+	return deps, nil
+}
+
+// startOrder returns names and everything they depend on, dependencies first
+func (sm *ServiceManager) startOrder(names []string) ([]string, error) {
+	starting := make(map[string]bool)
+	for _, name := range names {
+		starting[name] = true
+	}
+
+	// Pull in dependencies until nothing new is added
+	for grown := true; grown; {
+		grown = false
+		for name := range starting {
+			deps, err := sm.resolveDependencies(name, starting)
+			if err != nil {
+				return nil, err
+			}
+			for _, dep := range deps {
+				if !starting[dep] {
+					starting[dep] = true
+					grown = true
+				}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(starting))
+	for name := range starting {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var order []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			i := 0
+			for path[i] != name {
+				i++
+			}
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path[i:], name), " -> "))
+		}
+		state[name] = visiting
+		path = append(path, name)
+
+		deps, err := sm.resolveDependencies(name, starting)
+		if err != nil {
+			return err
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = done
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range sorted {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// startInOrder starts services in dependency order, waiting for each to be
+// ready. Services whose dependencies failed are skipped. Returns the failures.
+func (sm *ServiceManager) startInOrder(order []string) map[string]error {
+	starting := make(map[string]bool)
+	for _, name := range order {
+		starting[name] = true
+	}
+
+	failed := make(map[string]error)
+	for _, name := range order {
+		deps, _ := sm.resolveDependencies(name, starting)
+		for _, dep := range deps {
+			if err := failed[dep]; err != nil {
+				failed[name] = &DependencyError{Service: name, Dependency: dep, Err: err}
+				break
+			}
+		}
+		if err := failed[name]; err != nil {
+			fmt.Printf("⛔ %v\n", err)
+			utils.LogService(name, "start", "skipped: "+err.Error())
+			continue
+		}
+
+		if svc := sm.GetService(name); svc != nil && svc.Status != "running" {
+			if err := sm.StartService(name); err != nil {
+				failed[name] = err
+				fmt.Printf("❌ Failed to start %s: %v\n", name, err)
+				continue
+			}
+		}
+		if err := sm.WaitReady(name); err != nil {
+			failed[name] = err
+			fmt.Printf("❌ %v\n", err)
+			utils.LogService(name, "ready", "failed: "+err.Error())
+		}
+	}
+	return failed
+}
+
+// StartWithDependencies starts a service after the services it depends on,
+// waiting for each to accept connections
+func (sm *ServiceManager) StartWithDependencies(name string) error {
+	if svc := sm.GetService(name); svc == nil {
+		return fmt.Errorf("service %s not found", name)
+	} else if svc.Status == "running" {
+		return fmt.Errorf("service %s is already running", name)
+	}
+
+	order, err := sm.startOrder([]string{name})
+	if err != nil {
+		return err
+	}
+	return sm.startInOrder(order)[name]
+}
+
+// StartServices starts names and their dependencies in dependency order.
+// It returns the services started and the failures by service.
+func (sm *ServiceManager) StartServices(names []string) ([]string, map[string]error, error) {
+	order, err := sm.startOrder(names)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pending []string
+	for _, name := range order {
+		if svc := sm.GetService(name); svc != nil && svc.Status != "running" {
+			pending = append(pending, name)
+		}
+	}
+	failed := sm.startInOrder(order)
+	var started []string
+	for _, name := range pending {
+		if failed[name] == nil {
+			started = append(started, name)
+		}
+	}
+	return started, failed, nil
+}
+
+// stopGroups orders running services for shutdown: each group only holds
+// services nothing in a later group depends on, so dependents stop first
+func (sm *ServiceManager) stopGroups(names []string) [][]string {
+	running := make(map[string]bool)
+	for _, name := range names {
+		running[name] = true
+	}
+
+	// Depth in the dependency graph; services are stopped deepest first
+	depth := make(map[string]int)
+	var measure func(name string, seen map[string]bool) int
+	measure = func(name string, seen map[string]bool) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		if seen[name] {
+			return 0 // cycle, reported when starting
+		}
+		seen[name] = true
+		d := 0
+		deps, _ := sm.resolveDependencies(name, running)
+		for _, dep := range deps {
+			if running[dep] {
+				if n := measure(dep, seen) + 1; n > d {
+					d = n
+				}
+			}
+		}
+		depth[name] = d
+		return d
+	}
+
+	maxDepth := 0
+	for _, name := range names {
+		if d := measure(name, make(map[string]bool)); d > maxDepth {
+			maxDepth = d
+		}
+	}
+	groups := make([][]string, maxDepth+1)
+	for _, name := range names {
+		groups[maxDepth-depth[name]] = append(groups[maxDepth-depth[name]], name)
+	}
+	return groups
+}
+
+// WaitReady polls a service's readiness probe until it passes, the service
+// exits or the timeout expires
+func (sm *ServiceManager) WaitReady(name string) error {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	spec, _ := sm.dependencySpec(svc)
+	timeout := defaultReadyTimeout
+	if spec.ReadyTimeoutSeconds > 0 {
+		timeout = time.Duration(spec.ReadyTimeoutSeconds) * time.Second
+	}
+
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		current := sm.GetService(name)
+		if current == nil || current.Status != "running" {
+			status := "removed"
+			if current != nil {
+				status = current.Status
+			}
+			return fmt.Errorf("%s exited before becoming ready (%s)", name, status)
+		}
+		if lastErr = sm.Probe(current); lastErr == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not ready after %s: %v", name, timeout, lastErr)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// Probe checks once whether a service is ready to accept clients
+func (sm *ServiceManager) Probe(svc *Service) error {
+	spec, _ := sm.dependencySpec(svc)
+	probe := spec.Probe
+	if probe == "" {
+		probe = defaultProbe(svc.Type)
+	}
+	if svc.Port == 0 && probe != ProbeCommand {
+		return nil // nothing to connect to
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", svc.Port)
+
+	switch probe {
+	case ProbeNone:
+		return nil
+
+	case ProbeCommand:
+		return sm.probeCustomCommand(svc)
+
+	case ProbeTCP:
+		return probeTCP(addr)
+
+	case ProbeHTTP:
+		// Any HTTP response, even an error page, means the server is up
+		client := &http.Client{Timeout: 2 * time.Second}
+		resp, err := client.Get("http://" + addr + "/" + strings.TrimPrefix(spec.ProbePath, "/"))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+
+	case ProbeMySQLAdmin:
+		admin := sm.databaseTool(svc, "mariadb-admin", "mysqladmin")
+		if admin == "" {
+			return probeTCP(addr)
+		}
+		user := svc.Username
+		if user == "" {
+			user = "root"
+		}
+		cmd := exec.Command(admin, "--protocol=TCP", "-h", "127.0.0.1", "-P", fmt.Sprintf("%d", svc.Port), "-u", user, "--connect-timeout=2", "ping")
+		cmd.Env = append(os.Environ(), "MYSQL_PWD="+svc.Password)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("mysqladmin ping: %s", strings.TrimSpace(string(output)))
+		}
+		return nil
+
+	case ProbeRedisCLI:
+		if cli := redisCLI(svc); cli != "" {
+			output, err := exec.Command(cli, "-h", "127.0.0.1", "-p", fmt.Sprintf("%d", svc.Port), "PING").CombinedOutput()
+			if reply := strings.TrimSpace(string(output)); err != nil || reply != "PONG" {
+				return fmt.Errorf("redis-cli PING: %s", reply)
+			}
+			return nil
+		}
+		return redisPing(addr)
+	}
+	return fmt.Errorf("unknown probe %q", probe)
+}
+
+func probeTCP(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func defaultProbe(svcType string) string {
+	switch svcType {
+	case "mysql", "mariadb":
+		return ProbeMySQLAdmin
+	case "redis":
+		return ProbeRedisCLI
+	case "nginx", "apache":
+		return ProbeHTTP
+	}
+	return ProbeTCP
+}
+
+// redisCLI returns the redis-cli shipped next to redis-server, if any
+func redisCLI(svc *Service) string {
+	return redisTool(svc, "redis-cli")
+}
+
+// redisTool finds a binary of a Redis install, which keeps them in src when
+// built from source
+func redisTool(svc *Service, name string) string {
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	for _, path := range []string{filepath.Join(svc.BinaryDir, name), filepath.Join(svc.BinaryDir, "src", name)} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// redisPing sends PING over the Redis protocol, for installs without redis-cli
+func redisPing(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	// -LOADING means Redis is up but still reading its dataset
+	if reply = strings.TrimSpace(reply); reply != "+PONG" {
+		return fmt.Errorf("redis PING: %s", reply)
+	}
+	return nil
+}
+
+// stopInGroups stops services group by group, each group in parallel
+func (sm *ServiceManager) stopInGroups(groups [][]string) {
+	for _, group := range groups {
+		var wg sync.WaitGroup
+		for _, name := range group {
+			sm.mu.RLock()
+			svc, ok := sm.services[name]
+			sm.mu.RUnlock()
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(service *Service) {
+				defer wg.Done()
+				sm.stopServiceInternal(service)
+			}(svc)
+		}
+		wg.Wait()
+	}
+}
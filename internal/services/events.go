@@ -0,0 +1,24 @@
+package services
+
+import (
+	"path/filepath"
+
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// EventLogPath is the file keeping the event history
+func EventLogPath() string {
+	return filepath.Join(utils.GetStackerDir(), "logs", "events.jsonl")
+}
+
+// EventBus returns the bus carrying service lifecycle events
+func (sm *ServiceManager) EventBus() *events.Bus {
+	return sm.bus
+}
+
+// Events returns the kept events of a service, or of all services when name
+// is empty, oldest first
+func (sm *ServiceManager) Events(name string) []events.Event {
+	return sm.bus.History(events.Filter{Service: name})
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/secrets"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// instanceTypes can run as several named instances side by side
+var instanceTypes = []string{"mysql", "mariadb", "redis"}
+
+// rootPasswordTimeout bounds the server run that sets a new instance's root
+// password
+const rootPasswordTimeout = 2 * time.Minute
+
+// ConnectionInfo tells clients how to reach a service
+type ConnectionInfo struct {
+	Service  string `json:"service"`
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Socket   string `json:"socket,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Status   string `json:"status"`
+}
+
+func isInstanceType(svcType string) bool {
+	for _, t := range instanceTypes {
+		if t == svcType {
+			return true
+		}
+	}
+	return false
+}
+
+// Instances returns the named instances, keyed by instance name
+func (sm *ServiceManager) Instances() map[string]config.ServiceInstance {
+	result := make(map[string]config.ServiceInstance)
+	for name, inst := range config.GetPreferences().ServiceInstances {
+		result[name] = inst
+	}
+	return result
+}
+
+// AddInstance creates a named instance of an installed MySQL, MariaDB or
+// Redis service. Port 0 picks a free port. The data directory is initialized
+// on first start.
+func (sm *ServiceManager) AddInstance(name, service string, port int) (*Service, error) {
+	if !customServiceNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid instance name %q: use lowercase letters, digits, '.', '_' and '-'", name)
+	}
+	if port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	base, ok := sm.services[service]
+	if !ok || base.Instance != "" || base.Type == CustomServiceType {
+		return nil, fmt.Errorf("installed service %s not found", service)
+	}
+	if !isInstanceType(base.Type) {
+		return nil, fmt.Errorf("%s does not support instances, only %s", base.Type, strings.Join(instanceTypes, ", "))
+	}
+	if _, exists := sm.services[name]; exists {
+		return nil, fmt.Errorf("service %s already exists", name)
+	}
+
+	if port == 0 {
+		port = sm.allocatePort(base.Port+1, name)
+		if port == 0 {
+			return nil, fmt.Errorf("no free port found")
+		}
+	} else if owner := sm.portOwner(port, name); owner != "" {
+		return nil, fmt.Errorf("port %d is already used by %s", port, owner)
+	}
+
+	p := config.GetPreferences()
+	if p.ServiceInstances == nil {
+		p.ServiceInstances = make(map[string]config.ServiceInstance)
+	}
+	p.ServiceInstances[name] = config.ServiceInstance{Service: service, Port: port}
+	if err := p.Save(); err != nil {
+		return nil, err
+	}
+
+	svc := sm.newInstanceService(name, base)
+	sm.services[name] = svc
+	utils.LogService(name, "add", fmt.Sprintf("instance of %s on port %d", service, port))
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: fmt.Sprintf("instance of %s added", service)})
+
+	clone := *svc
+	return &clone, nil
+}
+
+// RemoveInstance stops a named instance and deletes its config and data
+func (sm *ServiceManager) RemoveInstance(name string) error {
+	sm.mu.Lock()
+	svc, ok := sm.services[name]
+	if !ok || svc.Instance == "" {
+		sm.mu.Unlock()
+		return fmt.Errorf("instance %s not found", name)
+	}
+	if svc.Status == "running" {
+		sm.stopServiceInternal(svc)
+	}
+	delete(sm.services, name)
+
+	p := config.GetPreferences()
+	delete(p.ServiceInstances, name)
+	delete(p.ServicePorts, name)
+	delete(p.RestartPolicies, name)
+	delete(p.ServiceDependencies, name)
+	err := p.Save()
+	sm.mu.Unlock()
+
+	os.RemoveAll(svc.ConfigDir)
+	os.RemoveAll(svc.DataDir)
+	os.Remove(sm.getPIDFile(name))
+	utils.LogService(name, "remove", "instance")
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: "instance removed"})
+	return err
+}
+
+// instancesOf returns the instance names of an installed service. Called
+// with sm.mu held.
+func (sm *ServiceManager) instancesOf(service string) []string {
+	var names []string
+	for name, svc := range sm.services {
+		if svc.Instance == service {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// loadInstances adds the named instances and sets the socket of every
+// database and Redis service. Called with sm.mu held.
+func (sm *ServiceManager) loadInstances() {
+	for name, inst := range config.GetPreferences().ServiceInstances {
+		base, ok := sm.services[inst.Service]
+		if !ok {
+			utils.LogWarn(fmt.Sprintf("Instance %s skipped: %s is not installed", name, inst.Service))
+			continue
+		}
+		if _, exists := sm.services[name]; exists {
+			continue
+		}
+		sm.services[name] = sm.newInstanceService(name, base)
+	}
+	for _, svc := range sm.services {
+		svc.Socket = serviceSocket(svc)
+	}
+}
+
+func (sm *ServiceManager) newInstanceService(name string, base *Service) *Service {
+	svc := &Service{
+		Name:      name,
+		Type:      base.Type,
+		Version:   base.Version,
+		Port:      sm.portFor(name, base.Type),
+		Status:    "stopped",
+		ConfigDir: filepath.Join(sm.baseDir, "conf", base.Type, "instances", name),
+		DataDir:   filepath.Join(sm.baseDir, "data", base.Type, "instances", name),
+		BinaryDir: base.BinaryDir,
+		Installed: time.Now().Format(time.RFC3339),
+		Runnable:  true,
+		Instance:  base.Name,
+	}
+	if svc.Type == "mysql" || svc.Type == "mariadb" {
+		svc.Username = "root"
+		svc.Password = secrets.Lookup(secrets.ServicePassword(name))
+	}
+	svc.Socket = serviceSocket(svc)
+	svc.HasConfig = sm.checkConfigExists(svc)
+
+	if pid := sm.loadPID(name); sm.adoptPID(svc, pid) {
+		svc.Status = "running"
+		svc.PID = pid
+	}
+	return svc
+}
+
+// serviceSocket returns the unix socket a service listens on, if any
+func serviceSocket(svc *Service) string {
+	switch svc.Type {
+	case "mysql", "mariadb":
+		return filepath.Join(svc.DataDir, "mysql.sock")
+	case "redis":
+		if runtime.GOOS != "windows" {
+			return filepath.Join(svc.DataDir, "redis.sock")
+		}
+	}
+	return ""
+}
+
+// prepareInstance writes an instance's config and initializes its data
+// directory the first time it starts. Called with sm.mu held.
+func (sm *ServiceManager) prepareInstance(svc *Service) error {
+	os.MkdirAll(svc.ConfigDir, 0755)
+
+	switch svc.Type {
+	case "mysql":
+		root := sm.findMySQLBinary(svc.BinaryDir)
+		if root == "" {
+			return fmt.Errorf("MySQL binary not found")
+		}
+		sm.createMySQLConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
+		if empty(svc.DataDir) {
+			return sm.initializeMySQLInstance(svc, root)
+		}
+	case "mariadb":
+		root := sm.findMariaDBBinary(svc.BinaryDir)
+		if root == "" {
+			return fmt.Errorf("MariaDB binary not found")
+		}
+		sm.createMariaDBConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
+		if empty(svc.DataDir) {
+			return sm.initializeMariaDBInstance(svc, root)
+		}
+	case "redis":
+		os.MkdirAll(svc.DataDir, 0755)
+		return sm.createRedisConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
+	}
+	return nil
+}
+
+func empty(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err != nil || len(entries) == 0
+}
+
+// initializeMySQLInstance creates the system tables and sets the root
+// password, which is stored in the vault under the instance name
+func (sm *ServiceManager) initializeMySQLInstance(svc *Service, root string) error {
+	fmt.Printf("🗄️ Initializing data directory for %s...\n", svc.Name)
+	os.MkdirAll(svc.DataDir, 0755)
+
+	mysqld := filepath.Join(root, "bin", "mysqld")
+	initCmd := exec.Command(mysqld, "--initialize-insecure", "--datadir="+svc.DataDir, "--basedir="+root)
+	initCmd.Env = databaseEnv(root)
+	if output, err := initCmd.CombinedOutput(); err != nil {
+		os.RemoveAll(svc.DataDir)
+		return fmt.Errorf("failed to initialize %s: %v: %s", svc.Name, err, strings.TrimSpace(string(output)))
+	}
+	return sm.setRootPassword(svc, mysqld, root)
+}
+
+// initializeMariaDBInstance creates the system tables with mariadb-install-db
+// and sets the root password
+func (sm *ServiceManager) initializeMariaDBInstance(svc *Service, root string) error {
+	fmt.Printf("🗄️ Initializing data directory for %s...\n", svc.Name)
+	os.MkdirAll(svc.DataDir, 0755)
+
+	var installDB string
+	for _, candidate := range []string{
+		filepath.Join(root, "scripts", "mariadb-install-db"),
+		filepath.Join(root, "bin", "mariadb-install-db"),
+		filepath.Join(root, "scripts", "mysql_install_db"),
+		filepath.Join(root, "bin", "mysql_install_db"),
+	} {
+		if _, err := os.Stat(candidate); err == nil {
+			installDB = candidate
+			break
+		}
+	}
+	if installDB == "" {
+		return fmt.Errorf("mariadb-install-db not found for %s", svc.Name)
+	}
+
+	cmd := exec.Command(installDB,
+		"--defaults-file="+filepath.Join(svc.ConfigDir, "my.cnf"),
+		"--basedir="+root,
+		"--datadir="+svc.DataDir,
+		"--auth-root-authentication-method=normal",
+	)
+	cmd.Env = databaseEnv(root)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(svc.DataDir)
+		return fmt.Errorf("failed to initialize %s: %v: %s", svc.Name, err, strings.TrimSpace(string(output)))
+	}
+
+	mariadbd := filepath.Join(root, "bin", "mariadbd")
+	if _, err := os.Stat(mariadbd); err != nil {
+		mariadbd = filepath.Join(root, "bin", "mysqld")
+	}
+	return sm.setRootPassword(svc, mariadbd, root)
+}
+
+// setRootPassword runs the server once without networking to set the root
+// password, the way MySQL installs do
+func (sm *ServiceManager) setRootPassword(svc *Service, server, root string) error {
+	password := "root"
+	initSQL := filepath.Join(svc.ConfigDir, "init.sql")
+	content := fmt.Sprintf("ALTER USER 'root'@'localhost' IDENTIFIED BY '%s';\nFLUSH PRIVILEGES;\nSHUTDOWN;\n", password)
+	if err := os.WriteFile(initSQL, []byte(content), 0600); err != nil {
+		return err
+	}
+	defer os.Remove(initSQL)
+
+	// The init file ends with SHUTDOWN; a server that hangs instead, for
+	// example on a locked data dir, is killed
+	ctx, cancel := context.WithTimeout(context.Background(), rootPasswordTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, server,
+		"--defaults-file="+filepath.Join(svc.ConfigDir, "my.cnf"),
+		"--init-file="+initSQL,
+		"--console",
+		"--skip-networking",
+	)
+	cmd.Env = databaseEnv(root)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("server did not shut down within %s", rootPasswordTimeout)
+		}
+		return fmt.Errorf("failed to set root password for %s: %v: %s", svc.Name, err, strings.TrimSpace(string(output)))
+	}
+	return sm.storeInstancePassword(svc, password)
+}
+
+// databaseEnv points the dynamic linker at a MySQL or MariaDB install
+func databaseEnv(root string) []string {
+	return append(os.Environ(),
+		"DYLD_LIBRARY_PATH="+filepath.Join(root, "lib"),
+		"LD_LIBRARY_PATH="+filepath.Join(root, "lib"),
+	)
+}
+
+func (sm *ServiceManager) storeInstancePassword(svc *Service, password string) error {
+	if err := secrets.Store(secrets.ServicePassword(svc.Name), password); err != nil {
+		utils.LogWarn(fmt.Sprintf("Failed to store %s password in vault: %v", svc.Name, err))
+	}
+	svc.Password = password
+	fmt.Printf("✅ %s initialized (root password stored in vault as %s)\n", svc.Name, secrets.ServicePassword(svc.Name))
+	return nil
+}
+
+// portOwner returns the service other than except configured for port.
+// Called with sm.mu held.
+func (sm *ServiceManager) portOwner(port int, except string) string {
+	for name, svc := range sm.services {
+		if name != except && svc.Port == port {
+			return name
+		}
+	}
+	return ""
+}
+
+// allocatePort returns the first port from start that no other service is
+// configured for and nothing listens on, or 0. Called with sm.mu held.
+func (sm *ServiceManager) allocatePort(start int, except string) int {
+	if start <= 0 {
+		start = 10000
+	}
+	for port := start; port <= 65535; port++ {
+		if sm.portOwner(port, except) != "" {
+			continue
+		}
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			continue
+		}
+		ln.Close()
+		return port
+	}
+	return 0
+}
+
+// resolvePortConflict moves a database or Redis service to a free port when
+// another running service already holds its port, so two versions can run
+// side by side. The new port is saved. Called with sm.mu held.
+func (sm *ServiceManager) resolvePortConflict(svc *Service) {
+	if svc.Port == 0 || !isInstanceType(svc.Type) {
+		return
+	}
+	var holder string
+	for name, other := range sm.services {
+		if name != svc.Name && other.Status == "running" && other.Port == svc.Port {
+			holder = name
+			break
+		}
+	}
+	if holder == "" {
+		return
+	}
+
+	port := sm.allocatePort(svc.Port+1, svc.Name)
+	if port == 0 {
+		return
+	}
+	p := config.GetPreferences()
+	if inst, ok := p.ServiceInstances[svc.Name]; ok {
+		inst.Port = port
+		p.ServiceInstances[svc.Name] = inst
+	} else {
+		if p.ServicePorts == nil {
+			p.ServicePorts = make(map[string]int)
+		}
+		p.ServicePorts[svc.Name] = port
+	}
+	p.Save()
+
+	fmt.Printf("🔀 Port %d is used by %s, %s moves to port %d\n", svc.Port, holder, svc.Name, port)
+	utils.LogService(svc.Name, "port", fmt.Sprintf("%d taken by %s, using %d", svc.Port, holder, port))
+	svc.Port = port
+}
+
+// ConnectionInfo returns how to connect to a service
+func (sm *ServiceManager) ConnectionInfo(name string) (*ConnectionInfo, error) {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+
+	info := &ConnectionInfo{
+		Service:  svc.Name,
+		Type:     svc.Type,
+		Host:     "127.0.0.1",
+		Port:     svc.Port,
+		Socket:   serviceSocket(svc),
+		Username: svc.Username,
+		Password: svc.Password,
+		Status:   svc.Status,
+	}
+	host := fmt.Sprintf("%s:%d", info.Host, info.Port)
+	switch svc.Type {
+	case "mysql", "mariadb":
+		u := url.URL{Scheme: "mysql", Host: host, User: url.UserPassword(svc.Username, svc.Password)}
+		info.URL = u.String()
+	case "redis":
+		info.URL = "redis://" + host
+	case "nginx", "apache":
+		info.URL = "http://" + host
+	}
+	return info, nil
+}
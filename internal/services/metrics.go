@@ -0,0 +1,205 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/procinfo"
+)
+
+const (
+	// metricsInterval is how often running services are sampled
+	metricsInterval = 2 * time.Second
+	// metricsHistorySize is the samples kept per service, 10 minutes
+	metricsHistorySize = 300
+)
+
+// ResourceSample is the resource usage of a service's process and its
+// children (nginx workers, PHP-FPM children) at one point in time
+type ResourceSample struct {
+	Time      time.Time `json:"time"`
+	CPU       float64   `json:"cpu"`    // percent of one core, like top
+	Memory    int64     `json:"memory"` // resident set size in bytes
+	FDs       int       `json:"fds"`
+	Threads   int       `json:"threads"`
+	Children  int       `json:"children"`
+	Processes int       `json:"processes"`
+}
+
+// sampleRing keeps the last metricsHistorySize samples
+type sampleRing struct {
+	samples []ResourceSample
+	next    int
+}
+
+func (r *sampleRing) add(sample ResourceSample) {
+	if len(r.samples) < metricsHistorySize {
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % metricsHistorySize
+}
+
+// list returns the samples oldest first
+func (r *sampleRing) list() []ResourceSample {
+	result := make([]ResourceSample, 0, len(r.samples))
+	result = append(result, r.samples[r.next:]...)
+	return append(result, r.samples[:r.next]...)
+}
+
+func (r *sampleRing) last() (ResourceSample, bool) {
+	if len(r.samples) == 0 {
+		return ResourceSample{}, false
+	}
+	return r.samples[(r.next+len(r.samples)-1)%len(r.samples)], true
+}
+
+// cpuMark is the CPU time of each process at the previous sample
+type cpuMark struct {
+	at    time.Time
+	times map[int]time.Duration
+}
+
+// metrics holds the sampled history of every service
+type metrics struct {
+	mu      sync.Mutex
+	history map[string]*sampleRing
+	marks   map[string]cpuMark
+	started bool
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		history: make(map[string]*sampleRing),
+		marks:   make(map[string]cpuMark),
+	}
+}
+
+// SampleResources measures a running service now and adds the sample to its
+// history. CPU usage is relative to the previous sample, so the first one
+// reads 0.
+func (sm *ServiceManager) SampleResources(name string) (ResourceSample, error) {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return ResourceSample{}, fmt.Errorf("service %s not found", name)
+	}
+	if svc.Status != "running" || svc.PID == 0 {
+		return ResourceSample{}, fmt.Errorf("service %s is not running", name)
+	}
+
+	tree, err := procinfo.Tree(svc.PID)
+	if err != nil {
+		return ResourceSample{}, err
+	}
+
+	now := time.Now()
+	sample := ResourceSample{Time: now, Processes: len(tree), Children: len(tree) - 1}
+	times := make(map[int]time.Duration, len(tree))
+	for _, proc := range tree {
+		sample.Memory += proc.RSS
+		sample.FDs += proc.FDs
+		sample.Threads += proc.Threads
+		times[proc.PID] = proc.CPUTime
+	}
+
+	m := sm.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mark, ok := m.marks[name]; ok {
+		// Processes that exited since the last sample are left out; new ones
+		// count their whole CPU time, which was spent within the interval
+		var used time.Duration
+		for pid, cpu := range times {
+			if before, ok := mark.times[pid]; ok {
+				if cpu > before {
+					used += cpu - before
+				}
+			} else {
+				used += cpu
+			}
+		}
+		if elapsed := now.Sub(mark.at); elapsed > 0 {
+			sample.CPU = float64(used) / float64(elapsed) * 100
+		}
+	}
+	m.marks[name] = cpuMark{at: now, times: times}
+
+	ring, ok := m.history[name]
+	if !ok {
+		ring = &sampleRing{}
+		m.history[name] = ring
+	}
+	ring.add(sample)
+	return sample, nil
+}
+
+// ResourceHistory returns the samples of a service, oldest first
+func (sm *ServiceManager) ResourceHistory(name string) []ResourceSample {
+	sm.metrics.mu.Lock()
+	defer sm.metrics.mu.Unlock()
+	if ring, ok := sm.metrics.history[name]; ok {
+		return ring.list()
+	}
+	return []ResourceSample{}
+}
+
+// latestResources returns the last sample of a service if it is recent
+func (sm *ServiceManager) latestResources(name string) (ResourceSample, bool) {
+	sm.metrics.mu.Lock()
+	defer sm.metrics.mu.Unlock()
+	if ring, ok := sm.metrics.history[name]; ok {
+		if sample, ok := ring.last(); ok && time.Since(sample.Time) < 2*metricsInterval {
+			return sample, true
+		}
+	}
+	return ResourceSample{}, false
+}
+
+// DetailedStatuses returns the detailed status, with resource usage, of
+// every running service
+func (sm *ServiceManager) DetailedStatuses() []*DetailedStatus {
+	result := []*DetailedStatus{}
+	for _, svc := range sm.GetServices() {
+		if svc.Status == "running" {
+			result = append(result, sm.GetDetailedStatus(svc.Name))
+		}
+	}
+	return result
+}
+
+// StartMetrics samples every running service in the background until the
+// manager shuts down. Calling it again has no effect.
+func (sm *ServiceManager) StartMetrics() {
+	sm.metrics.mu.Lock()
+	if sm.metrics.started {
+		sm.metrics.mu.Unlock()
+		return
+	}
+	sm.metrics.started = true
+	sm.metrics.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(metricsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sm.shutdown:
+				return
+			case <-ticker.C:
+			}
+			for _, svc := range sm.GetServices() {
+				if svc.Status == "running" && svc.PID > 0 {
+					sm.SampleResources(svc.Name)
+					continue
+				}
+				// A restarted service starts a fresh CPU baseline
+				sm.metrics.mu.Lock()
+				delete(sm.metrics.marks, svc.Name)
+				sm.metrics.mu.Unlock()
+			}
+		}
+	}()
+}
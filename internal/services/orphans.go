@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/procinfo"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// orphanExitTimeout is how long a killed orphan gets to release its port
+const orphanExitTimeout = 3 * time.Second
+
+// clearOrphans kills processes an earlier run of a service left behind: the
+// process in its PID file and the one holding its port, when they run one of
+// the service's own executables. A port held by anything else is an error.
+// Called with sm.mu held.
+func (sm *ServiceManager) clearOrphans(svc *Service) error {
+	if pid := sm.loadPID(svc.Name); sm.processes[svc.Name] == nil && sm.adoptPID(svc, pid) {
+		if proc, err := procinfo.Find(pid); err == nil {
+			sm.killOrphan(svc, proc)
+		}
+	}
+
+	if svc.Port == 0 {
+		return nil
+	}
+	listener, err := procinfo.ListenerOn(svc.Port)
+	if err != nil || listener == nil {
+		return nil
+	}
+	if listener.PID == 0 {
+		return fmt.Errorf("port %d is in use by another process", svc.Port)
+	}
+	proc, err := procinfo.Find(listener.PID)
+	if err != nil {
+		return fmt.Errorf("port %d is in use by process %d", svc.Port, listener.PID)
+	}
+	for name, other := range sm.services {
+		if name != svc.Name && other.Status == "running" && other.PID == proc.PID {
+			return fmt.Errorf("port %d is in use by service %s", svc.Port, name)
+		}
+	}
+	if !sm.ownedBy(svc, proc) {
+		return fmt.Errorf("port %d is in use by %s", svc.Port, proc.Describe())
+	}
+	sm.killOrphan(svc, proc)
+	return nil
+}
+
+// adoptPID reports whether pid, from the service's PID file or state, is a
+// live process running the service. The PID of a stale file may have been
+// reused by an unrelated process, for example after a reboot; such a file is
+// removed so that nothing signals that process. Called with sm.mu held.
+func (sm *ServiceManager) adoptPID(svc *Service, pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	if cmd := sm.processes[svc.Name]; cmd != nil && cmd.Process != nil && cmd.Process.Pid == pid {
+		return procinfo.Alive(pid)
+	}
+	if procinfo.Alive(pid) {
+		if proc, err := procinfo.Find(pid); err == nil && sm.ownedBy(svc, proc) {
+			return true
+		}
+	}
+	if sm.loadPID(svc.Name) == pid {
+		os.Remove(sm.getPIDFile(svc.Name))
+	}
+	return false
+}
+
+// ownedBy reports whether a process runs a binary of the service's installed
+// version or, for a custom service, its command
+func (sm *ServiceManager) ownedBy(svc *Service, proc *procinfo.Process) bool {
+	if svc.Type == CustomServiceType {
+		cmd, err := sm.startCustom(svc)
+		if err != nil || proc.Exe == "" {
+			return false
+		}
+		want, err := os.Stat(cmd.Path)
+		if err != nil {
+			return false
+		}
+		got, err := os.Stat(proc.Exe)
+		return err == nil && os.SameFile(want, got)
+	}
+	return proc.InDir(svc.BinaryDir)
+}
+
+// killOrphan kills an orphaned process with its children and waits for it
+// to exit
+func (sm *ServiceManager) killOrphan(svc *Service, proc *procinfo.Process) {
+	fmt.Printf("⚠️ Found an orphan %s process: %s. Cleaning up...\n", svc.Name, proc.Describe())
+	utils.LogWarn(fmt.Sprintf("Killing orphan %s process %s", svc.Name, proc.Describe()))
+
+	pids := []int{proc.PID}
+	if tree, err := procinfo.Tree(proc.PID); err == nil {
+		pids = pids[:0]
+		for _, p := range tree {
+			pids = append(pids, p.PID)
+		}
+	}
+	for _, pid := range pids {
+		if process, err := os.FindProcess(pid); err == nil {
+			process.Kill()
+		}
+	}
+
+	deadline := time.Now().Add(orphanExitTimeout)
+	for procinfo.Alive(proc.PID) && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	os.Remove(sm.getPIDFile(svc.Name))
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/php"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// errRestartRequired means a config change cannot be applied in place
+var errRestartRequired = errors.New("change needs a restart")
+
+// redisRestartOnly are directives Redis cannot change while running, or that
+// Stacker manages itself
+var redisRestartOnly = map[string]bool{
+	"port": true, "bind": true, "daemonize": true, "supervised": true, "pidfile": true,
+	"unixsocket": true, "unixsocketperm": true, "databases": true, "include": true,
+	"loadmodule": true, "rename-command": true, "io-threads": true, "cluster-enabled": true,
+	"logfile": true, "syslog-enabled": true, "always-show-logo": true,
+}
+
+// goodConfigs holds the config files each running service last started or
+// reloaded with, to put back when a changed config fails its test
+type goodConfigs struct {
+	mu    sync.Mutex
+	files map[string]map[string][]byte // service name -> path -> content
+}
+
+// mainConfigFile returns the config file of a service, or "" for types
+// without one
+func (sm *ServiceManager) mainConfigFile(svc *Service) string {
+	switch {
+	case svc.Type == "mysql" || svc.Type == "mariadb":
+		return filepath.Join(svc.ConfigDir, "my.cnf")
+	case svc.Type == "nginx":
+		return filepath.Join(svc.ConfigDir, "nginx.conf")
+	case svc.Type == "apache":
+		return filepath.Join(svc.ConfigDir, "httpd.conf")
+	case svc.Type == "redis":
+		return filepath.Join(svc.ConfigDir, "redis.conf")
+	case svc.Type == "php":
+		return filepath.Join(svc.ConfigDir, "php.ini")
+	}
+	return ""
+}
+
+// fpmConfigFile is the generated PHP-FPM config of a PHP service
+func (sm *ServiceManager) fpmConfigFile(name string) string {
+	return filepath.Join(sm.baseDir, "conf", "php-fpm", "php-fpm-"+name+".conf")
+}
+
+// configGlobs lists the files a service reads its config from, including the
+// site vhosts of web servers
+func (sm *ServiceManager) configGlobs(svc *Service) []string {
+	var globs []string
+	if file := sm.mainConfigFile(svc); file != "" {
+		globs = append(globs, file)
+	}
+	switch {
+	case svc.Type == "nginx":
+		globs = append(globs, filepath.Join(sm.baseDir, "conf", "nginx", "*.conf"))
+	case svc.Type == "apache":
+		globs = append(globs, filepath.Join(sm.baseDir, "conf", "apache", "vhosts", "*.conf"))
+	case strings.HasPrefix(svc.Type, "php"):
+		globs = append(globs, sm.fpmConfigFile(svc.Name))
+	}
+	return globs
+}
+
+// rememberConfig records the config files of a service as working
+func (sm *ServiceManager) rememberConfig(svc *Service) {
+	files := make(map[string][]byte)
+	for _, glob := range sm.configGlobs(svc) {
+		matches, _ := filepath.Glob(glob)
+		for _, path := range matches {
+			if data, err := os.ReadFile(path); err == nil {
+				files[path] = data
+			}
+		}
+	}
+
+	sm.configs.mu.Lock()
+	sm.configs.files[svc.Name] = files
+	sm.configs.mu.Unlock()
+}
+
+// rememberedFile returns the working content of one config file
+func (sm *ServiceManager) rememberedFile(name, path string) ([]byte, bool) {
+	sm.configs.mu.Lock()
+	defer sm.configs.mu.Unlock()
+	data, ok := sm.configs.files[name][path]
+	return data, ok
+}
+
+// restoreConfig writes back the working config files of a service and
+// removes config files added since. It reports false when there is nothing
+// to restore.
+func (sm *ServiceManager) restoreConfig(svc *Service) bool {
+	sm.configs.mu.Lock()
+	files, ok := sm.configs.files[svc.Name]
+	sm.configs.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	for _, glob := range sm.configGlobs(svc) {
+		matches, _ := filepath.Glob(glob)
+		for _, path := range matches {
+			if _, known := files[path]; !known {
+				os.Remove(path)
+			}
+		}
+	}
+	for path, data := range files {
+		os.WriteFile(path, data, 0644)
+	}
+	utils.LogWarn(fmt.Sprintf("Restored the last working config of %s", svc.Name))
+	return true
+}
+
+// ReloadService makes a running service pick up config changes without
+// dropping connections: nginx -s reload, apache -k graceful, SIGUSR2 for
+// PHP-FPM and CONFIG SET for Redis. The config is tested first and the last
+// working one is put back if the test fails. Services that cannot reload are
+// restarted.
+func (sm *ServiceManager) ReloadService(name string) error {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	if svc.Status != "running" {
+		return fmt.Errorf("service %s is not running", name)
+	}
+	utils.LogService(name, "reload", "request")
+
+	var err error
+	switch {
+	case svc.Type == "redis":
+		err = sm.reloadRedis(svc)
+	case svc.Type == "nginx" || svc.Type == "apache" || strings.HasPrefix(svc.Type, "php"):
+		if err = sm.testConfig(svc); err != nil {
+			if sm.restoreConfig(svc) {
+				err = fmt.Errorf("%v; previous config restored", err)
+			}
+		} else {
+			err = sm.signalReload(svc)
+		}
+	default:
+		err = errRestartRequired
+	}
+
+	if err == errRestartRequired {
+		fmt.Printf("🔄 %s cannot apply this change in place, restarting...\n", name)
+		return sm.RestartService(name)
+	}
+	if err != nil {
+		utils.LogService(name, "reload", "failed: "+err.Error())
+		return err
+	}
+
+	sm.rememberConfig(svc)
+	utils.LogService(name, "reload", "success")
+	fmt.Printf("♻️ Service %s reloaded\n", name)
+	sm.bus.Publish(events.Event{Type: events.Reloaded, Service: name, PID: svc.PID})
+	return nil
+}
+
+// signalReload tells a running server to re-read its tested config
+func (sm *ServiceManager) signalReload(svc *Service) error {
+	switch svc.Type {
+	case "nginx":
+		binaryPath := sm.findNginxBinary(svc.BinaryDir)
+		if binaryPath == "" {
+			return errRestartRequired
+		}
+		cmd := sm.startNginx(svc, binaryPath)
+		cmd.Args = []string{binaryPath, "-c", filepath.Join(svc.ConfigDir, "nginx.conf"), "-s", "reload"}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s reload failed: %s", svc.Name, strings.TrimSpace(string(output)))
+		}
+	case "apache":
+		// httpd -k graceful needs the Apache service manager on Windows
+		binaryPath := sm.findApacheBinary(svc.BinaryDir)
+		if binaryPath == "" || runtime.GOOS == "windows" {
+			return errRestartRequired
+		}
+		cmd := sm.startApache(svc, binaryPath)
+		cmd.Args = []string{binaryPath, "-f", filepath.Join(svc.ConfigDir, "httpd.conf"), "-k", "graceful"}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s reload failed: %s", svc.Name, strings.TrimSpace(string(output)))
+		}
+	default:
+		// Only PHP-FPM reloads, and not on Windows; php-cgi and the built-in
+		// server restart
+		if !strings.Contains(filepath.Base(sm.findPHPBinary(svc.BinaryDir)), "php-fpm") || runtime.GOOS == "windows" {
+			return errRestartRequired
+		}
+		process, err := os.FindProcess(svc.PID)
+		if err != nil {
+			return err
+		}
+		return php.SignalReload(process)
+	}
+	return nil
+}
+
+// reloadRedis applies the directives changed in redis.conf with CONFIG SET.
+// The file already holds them, in the overrides block where the user put
+// them, so it is not rewritten. A rejected value rolls back the directives
+// already set and restores the previous file.
+func (sm *ServiceManager) reloadRedis(svc *Service) error {
+	configFile := sm.mainConfigFile(svc)
+	previous, ok := sm.rememberedFile(svc.Name, configFile)
+	if !ok {
+		return errRestartRequired
+	}
+	current, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	before, after := redisDirectives(previous), redisDirectives(current)
+	var changed []string
+	for key, value := range after {
+		if before[key] != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			// Redis has no way to reset a directive to its default
+			return errRestartRequired
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	for _, key := range changed {
+		if redisRestartOnly[key] {
+			return errRestartRequired
+		}
+	}
+
+	addr := fmt.Sprintf("127.0.0.1:%d", svc.Port)
+	password := before["requirepass"]
+	var applied []string
+	for _, key := range changed {
+		if err := redisCommand(addr, password, "CONFIG", "SET", key, after[key]); err != nil {
+			for _, done := range applied {
+				redisCommand(addr, password, "CONFIG", "SET", done, before[done])
+			}
+			os.WriteFile(configFile, previous, 0644)
+			if strings.Contains(err.Error(), "immutable") || strings.Contains(err.Error(), "protected") {
+				return errRestartRequired
+			}
+			return fmt.Errorf("%s rejected %s %s: %v; previous config restored", svc.Name, key, after[key], err)
+		}
+		applied = append(applied, key)
+		if key == "requirepass" {
+			password = after[key]
+		}
+	}
+
+	return nil
+}
+
+// redisMultiValue are directives that may repeat, each line adding a value
+var redisMultiValue = map[string]bool{
+	"save": true, "client-output-buffer-limit": true, "include": true,
+	"loadmodule": true, "rename-command": true,
+}
+
+// redisDirectives parses redis.conf into directive -> value. Repeated
+// directives such as save are joined the way CONFIG SET expects them; for
+// the others the last one wins, as in Redis.
+func redisDirectives(data []byte) map[string]string {
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		key = strings.ToLower(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if existing, ok := result[key]; ok && redisMultiValue[key] {
+			value = existing + " " + value
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// redisCommand sends one command over the Redis protocol and fails on an
+// error reply
+func redisCommand(addr, password string, args ...string) error {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	send := func(args ...string) error {
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		if _, err := conn.Write([]byte(b.String())); err != nil {
+			return err
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if reply = strings.TrimSpace(reply); strings.HasPrefix(reply, "-") {
+			return errors.New(strings.TrimPrefix(reply, "-"))
+		}
+		return nil
+	}
+
+	if password != "" {
+		if err := send("AUTH", password); err != nil {
+			return err
+		}
+	}
+	return send(args...)
+}
@@ -21,6 +21,10 @@ import (
 	"time"
 
 	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/php"
+	"github.com/yasinkuyu/Stacker/internal/procinfo"
+	"github.com/yasinkuyu/Stacker/internal/secrets"
 	"github.com/yasinkuyu/Stacker/internal/utils"
 )
 
@@ -44,6 +48,11 @@ type Service struct {
 	Runnable     bool      `json:"runnable"` // true for daemons (nginx, mysql), false for tools (composer, git)
 	Username     string    `json:"username,omitempty"`
 	Password     string    `json:"password,omitempty"`
+	Restarts     int       `json:"restarts,omitempty"`  // automatic restarts within the policy window
+	LastExit     string    `json:"last_exit,omitempty"` // why the service last crashed
+	CrashLog     []string  `json:"crash_log,omitempty"` // last log lines before the crash
+	Instance     string    `json:"instance,omitempty"`  // installed service this is a named instance of
+	Socket       string    `json:"socket,omitempty"`    // unix socket, for databases and Redis
 }
 
 type ServiceVersion = config.ServiceVersion
@@ -60,6 +69,7 @@ type DetailedStatus struct {
 	Error     string            `json:"error,omitempty"`
 	Checks    map[string]string `json:"checks"`
 	Resources map[string]int64  `json:"resources"`
+	History   []ResourceSample  `json:"history,omitempty"`
 }
 
 type ServiceManager struct {
@@ -75,7 +85,11 @@ type ServiceManager struct {
 	processes        map[string]*exec.Cmd
 	wg               sync.WaitGroup
 	shutdown         chan struct{}
-	OnStatusChange   func()
+	bus              *events.Bus
+	supervisor       *supervisor
+	metrics          *metrics
+	configs          goodConfigs
+	historyMu        sync.Mutex
 	apachePort       int
 	nginxPort        int
 	mysqlPort        int
@@ -146,6 +160,10 @@ func NewServiceManager() *ServiceManager {
 		installLogs:   make(map[string]string),
 		processes:     make(map[string]*exec.Cmd),
 		shutdown:      make(chan struct{}),
+		bus:           events.NewBus(EventLogPath()),
+		supervisor:    newSupervisor(),
+		metrics:       newMetrics(),
+		configs:       goodConfigs{files: make(map[string]map[string][]byte)},
 	}
 
 	// Create default index.html if not exists
@@ -278,19 +296,64 @@ func (sm *ServiceManager) UpdatePorts(apache, nginx, mysql int) {
 
 	// Update existing services
 	for _, svc := range sm.services {
-		if svc.Type == "apache" {
-			svc.Port = apache
-		} else if svc.Type == "nginx" {
-			svc.Port = nginx
-		} else if svc.Type == "mysql" || svc.Type == "mariadb" {
-			svc.Port = mysql
+		if svc.Type == "apache" || svc.Type == "nginx" || svc.Type == "mysql" || svc.Type == "mariadb" {
+			svc.Port = sm.portFor(svc.Name, svc.Type)
 		}
 	}
 }
 
+// portFor returns the port of a service: its override from preferences, or
+// the default port of its type.
+func (sm *ServiceManager) portFor(name, svcType string) int {
+	if port := config.GetPreferences().ServicePorts[name]; port > 0 {
+		return port
+	}
+	if svcType == CustomServiceType {
+		return config.GetPreferences().CustomServices[name].Port
+	}
+	if inst, ok := config.GetPreferences().ServiceInstances[name]; ok {
+		return inst.Port
+	}
+	return sm.getDefaultPort(svcType)
+}
+
+// SetServicePort overrides the port of a stopped service. Port 0 restores
+// the default port of the service type.
+func (sm *ServiceManager) SetServicePort(name string, port int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	svc, exists := sm.services[name]
+	if !exists {
+		return fmt.Errorf("service %s not found", name)
+	}
+	if svc.Status == "running" && svc.Port != port {
+		return fmt.Errorf("service %s is running on port %d; stop it before changing the port", name, svc.Port)
+	}
+
+	p := config.GetPreferences()
+	if port > 0 {
+		if p.ServicePorts == nil {
+			p.ServicePorts = make(map[string]int)
+		}
+		p.ServicePorts[name] = port
+	} else {
+		delete(p.ServicePorts, name)
+	}
+	if err := p.Save(); err != nil {
+		return err
+	}
+
+	svc.Port = sm.portFor(name, svc.Type)
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: fmt.Sprintf("port %d", svc.Port)})
+	return nil
+}
+
 func (sm *ServiceManager) loadInstalledServices() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	defer sm.loadCustomServices()
+	defer sm.loadInstances()
 
 	// Load services from config/status files
 	baseDir := sm.baseDir
@@ -432,7 +495,7 @@ func (sm *ServiceManager) loadInstalledServices() {
 						Name:      svcName,
 						Type:      svcType,
 						Version:   version,
-						Port:      sm.getDefaultPort(svcType),
+						Port:      sm.portFor(svcName, svcType),
 						Status:    "stopped",
 						DataDir:   dataDir,
 						ConfigDir: configDir,
@@ -441,19 +504,15 @@ func (sm *ServiceManager) loadInstalledServices() {
 						Runnable:  isRunnable,
 					}
 
+					if svcType == "mysql" || svcType == "mariadb" {
+						svc.Username = "root"
+						svc.Password = secrets.Lookup(secrets.ServicePassword(svcName))
+					}
+
 					// Check if service is running by PID file
-					pidFile := filepath.Join(baseDir, "pids", svcName+".pid")
-					if pidData, err := os.ReadFile(pidFile); err == nil {
-						var pid int
-						if _, err := fmt.Sscanf(string(pidData), "%d", &pid); err == nil && pid > 0 {
-							// Verify process is actually running
-							if process, err := os.FindProcess(pid); err == nil {
-								if err := process.Signal(syscall.Signal(0)); err == nil {
-									svc.Status = "running"
-									svc.PID = pid
-								}
-							}
-						}
+					if pid := sm.loadPID(svcName); sm.adoptPID(svc, pid) {
+						svc.Status = "running"
+						svc.PID = pid
 					}
 
 					// Check if config file exists
@@ -472,54 +531,17 @@ func (sm *ServiceManager) loadInstalledServices() {
 	}
 }
 
+// checkPortInUse reports whether something listens on a port and, when the
+// owner can be read, describes it as "<executable> (PID: <pid>)"
 func (sm *ServiceManager) checkPortInUse(port int) (bool, string) {
-	if runtime.GOOS == "windows" {
-		// Windows: use netstat to find PID
-		cmd := exec.Command("cmd", "/c", fmt.Sprintf("netstat -ano | findstr :%d | findstr LISTENING", port))
-		output, err := cmd.Output()
-		if err == nil && len(output) > 0 {
-			lines := strings.Split(string(output), "\n")
-			for _, line := range lines {
-				parts := strings.Fields(line)
-				if len(parts) >= 5 {
-					pid := parts[len(parts)-1]
-					// Get process name using tasklist
-					nameCmd := exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %s", pid), "/NH", "/FO", "CSV")
-					nameOutput, _ := nameCmd.Output()
-					processName := "Unknown"
-					if len(nameOutput) > 0 {
-						csvParts := strings.Split(string(nameOutput), ",")
-						if len(csvParts) > 0 {
-							processName = strings.Trim(csvParts[0], "\"")
-						}
-					}
-					return true, fmt.Sprintf("%s (PID: %s)", processName, pid)
-				}
-			}
+	if listener, err := procinfo.ListenerOn(port); err == nil && listener != nil {
+		if listener.PID == 0 {
+			return true, "Unknown process"
 		}
-	} else {
-		// macOS/Linux: use lsof to get process name - this is more reliable
-		cmd := exec.Command("lsof", "-i", fmt.Sprintf(":%d", port), "-sTCP:LISTEN", "-t")
-		output, err := cmd.Output()
-		if err == nil && len(output) > 0 {
-			// Get PID from output
-			pidStr := strings.TrimSpace(string(output))
-			pids := strings.Split(pidStr, "\n")
-			if len(pids) > 0 {
-				// Get process name for first PID
-				psCmd := exec.Command("ps", "-ww", "-p", pids[0], "-o", "command=")
-				psOutput, psErr := psCmd.Output()
-				if psErr == nil {
-					processName := strings.TrimSpace(string(psOutput))
-					// If it's too long, just take the first part
-					if len(processName) > 100 {
-						processName = processName[:97] + "..."
-					}
-					return true, fmt.Sprintf("%s (PID: %s)", processName, pids[0])
-				}
-			}
-			return true, fmt.Sprintf("Process PID: %s", pidStr)
+		if proc, err := procinfo.Find(listener.PID); err == nil {
+			return true, proc.Describe()
 		}
+		return true, fmt.Sprintf("Process PID: %d", listener.PID)
 	}
 
 	// Fallback: try TCP connection
@@ -640,7 +662,7 @@ func (sm *ServiceManager) InstallServiceWithPassword(svcType, version, password
 		Name:      svcType + "-" + version,
 		Type:      svcType,
 		Version:   version,
-		Port:      sm.getDefaultPort(svcType),
+		Port:      sm.portFor(svcType+"-"+version, svcType),
 		Status:    "stopped",
 		DataDir:   dataDir,
 		ConfigDir: configDir,
@@ -650,7 +672,7 @@ func (sm *ServiceManager) InstallServiceWithPassword(svcType, version, password
 		Runnable:  isRunnable,
 	}
 
-	// Set credentials for database services
+	// Set credentials for database services, keeping the password in the vault
 	if svcType == "mysql" || svcType == "mariadb" {
 		svc.Username = "root"
 		if password != "" {
@@ -658,6 +680,9 @@ func (sm *ServiceManager) InstallServiceWithPassword(svcType, version, password
 		} else {
 			svc.Password = "root"
 		}
+		if err := secrets.Store(secrets.ServicePassword(svc.Name), svc.Password); err != nil {
+			utils.LogWarn(fmt.Sprintf("Failed to store %s password in vault: %v", svc.Name, err))
+		}
 	}
 
 	sm.mu.Lock()
@@ -728,7 +753,7 @@ func (sm *ServiceManager) installMySQL(version, installDir, configDir, dataDir s
 
 			sm.updateInstallProgress("mysql", version, 70)
 			mysqlPort := sm.getDefaultPort("mysql")
-			sm.createMySQLConfig(configDir, dataDir, mysqlPort, version)
+			sm.createMySQLConfig(configDir, dataDir, mysqlPort, "mysql-"+version)
 
 			// Initialize MySQL data directory
 			sm.updateInstallProgress("mysql", version, 80)
@@ -775,8 +800,8 @@ func (sm *ServiceManager) installMySQL(version, installDir, configDir, dataDir s
 					}
 
 					// Set root password using --init-file
-					sm.UpdateInstallLog("mysql", version, fmt.Sprintf("Setting root password to '%s' (via init-file)...", password))
-					fmt.Printf("🔐 Setting MySQL root password to '%s'...\n", password)
+					sm.UpdateInstallLog("mysql", version, "Setting root password (via init-file)...")
+					fmt.Printf("🔐 Setting MySQL root password...\n")
 
 					// Create init.sql file
 					initSqlPath := filepath.Join(binaryPath, "init.sql")
@@ -807,7 +832,7 @@ SHUTDOWN;
 						fmt.Printf("⚠️ MySQL password set error: %v\nOutput: %s\n", err, string(out))
 					} else {
 						sm.UpdateInstallLog("mysql", version, "Root password set successfully")
-						fmt.Printf("✅ MySQL root password set to '%s'\n", password)
+						fmt.Printf("✅ MySQL root password set (stored in vault as %s)\n", secrets.ServicePassword("mysql-"+version))
 					}
 				}
 			}
@@ -856,18 +881,10 @@ func (sm *ServiceManager) installPHP(version, installDir, configDir string) erro
 	return fmt.Errorf("PHP %s not found in available versions", version)
 }
 
-func (sm *ServiceManager) createMySQLConfig(configDir, dataDir string, port int, version string) error {
-	myCnf := fmt.Sprintf(`[mysqld]
-port = %d
-datadir = %s
-socket = %s/mysql.sock
-pid-file = %s/pids/mysql-%s.pid
-log-error = %s/error.log
-`, port, dataDir, dataDir, sm.baseDir, version, dataDir)
-
-	configPath := filepath.Join(configDir, "my.cnf")
-	os.MkdirAll(configDir, 0755)
-	return os.WriteFile(configPath, []byte(myCnf), 0644)
+// createMySQLConfig writes my.cnf. The socket lives in the data dir and the
+// pid file is named after the service, so instances do not share either.
+func (sm *ServiceManager) createMySQLConfig(configDir, dataDir string, port int, serviceName string) error {
+	return sm.writeConfig(filepath.Join(configDir, "my.cnf"), "my.cnf.tmpl", sm.mysqlConfigData(dataDir, port, serviceName))
 }
 
 func (sm *ServiceManager) installMariaDB(version, installDir, configDir, dataDir string) error {
@@ -894,7 +911,7 @@ func (sm *ServiceManager) installMariaDB(version, installDir, configDir, dataDir
 
 			binDir := filepath.Join(installDir, "bin")
 			mysqlPort := sm.getDefaultPort("mariadb")
-			sm.createMariaDBConfig(configDir, dataDir, mysqlPort, version)
+			sm.createMariaDBConfig(configDir, dataDir, mysqlPort, "mariadb-"+version)
 			sm.updateInstallProgress("mariadb", version, 90)
 
 			if err := sm.initializeMariaDB(binDir, configDir, dataDir); err != nil {
@@ -964,7 +981,7 @@ func (sm *ServiceManager) compileMariaDB(version, installDir, configDir, dataDir
 		return fmt.Errorf("mariadb install failed: %w", err)
 	}
 
-	sm.createMariaDBConfig(configDir, dataDir, 3306, version)
+	sm.createMariaDBConfig(configDir, dataDir, 3306, "mariadb-"+version)
 	sm.updateInstallProgress("mariadb", version, 90)
 
 	if err := sm.initializeMariaDB(binDir, configDir, dataDir); err != nil {
@@ -987,7 +1004,7 @@ func (sm *ServiceManager) alternativeMariaDBInstall(sourceDir, binDir, configDir
 		}
 	}
 
-	sm.createMariaDBConfig(configDir, dataDir, 3306, version)
+	sm.createMariaDBConfig(configDir, dataDir, 3306, "mariadb-"+version)
 
 	binaryPath := binDir
 	mariadbd := filepath.Join(binaryPath, "bin", "mariadbd")
@@ -1033,10 +1050,14 @@ func (sm *ServiceManager) initializeMariaDB(binaryPath, configDir, dataDir strin
 	}
 
 	rootPassword := "root"
-	credFile := filepath.Join(configDir, ".root_creds")
-	os.WriteFile(credFile, []byte(rootPassword), 0600)
+	svcName := "mariadb-" + filepath.Base(configDir)
+	if err := secrets.Store(secrets.ServicePassword(svcName), rootPassword); err != nil {
+		utils.LogWarn(fmt.Sprintf("Failed to store MariaDB password in vault: %v", err))
+	}
+	// Remove plaintext credentials written by older versions
+	os.Remove(filepath.Join(configDir, ".root_creds"))
 
-	fmt.Printf("✅ MariaDB initialized (root password: %s)\n", rootPassword)
+	fmt.Printf("✅ MariaDB initialized (root password stored in vault as %s)\n", secrets.ServicePassword(svcName))
 	return nil
 }
 
@@ -1254,32 +1275,8 @@ func (sm *ServiceManager) findNginxBinary(installDir string) string {
 	return ""
 }
 
-func (sm *ServiceManager) createMariaDBConfig(configDir, dataDir string, port int, version string) error {
-	binaryPath := sm.findMariaDBBinary(filepath.Join(sm.baseDir, "bin", "mariadb"))
-	basedir := "/usr/local"
-	if binaryPath != "" {
-		basedir = binaryPath
-	}
-
-	myCnf := fmt.Sprintf(`[mysqld]
-port = %d
-datadir = %s
-socket = %s/mysql.sock
-pid-file = %s/pids/mariadb-%s.pid
-log-error = %s/error.log
-general-log = 1
-general-log-file = %s/query.log
-
-[mysqld_safe]
-basedir = %s
-
-[client]
-port = %d
-socket = %s/mysql.sock
-`, port, dataDir, dataDir, sm.baseDir, version, dataDir, dataDir, basedir, port, dataDir)
-
-	configPath := filepath.Join(configDir, "my.cnf")
-	return os.WriteFile(configPath, []byte(myCnf), 0644)
+func (sm *ServiceManager) createMariaDBConfig(configDir, dataDir string, port int, serviceName string) error {
+	return sm.writeConfig(filepath.Join(configDir, "my.cnf"), "mariadb.cnf.tmpl", sm.mariaDBConfigData(dataDir, port, serviceName))
 }
 
 func (sm *ServiceManager) installNginx(version, installDir, configDir string) error {
@@ -1378,159 +1375,14 @@ func (sm *ServiceManager) compileNginx(version, installDir, configDir string) er
 
 func (sm *ServiceManager) createNginxConfig(configDir string, port int, version string) error {
 	// Use absolute path for includes to be safe
-	vhostDir := filepath.Join(sm.baseDir, "conf", "nginx")
-	os.MkdirAll(vhostDir, 0755)
+	os.MkdirAll(filepath.Join(sm.baseDir, "conf", "nginx"), 0755)
+	os.MkdirAll(configDir, 0755)
 
-	// Create fastcgi_params for PHP-FPM
-	fastcgiParams := `fastcgi_param  QUERY_STRING       $query_string;
-fastcgi_param  REQUEST_METHOD     $request_method;
-fastcgi_param  CONTENT_TYPE       $content_type;
-fastcgi_param  CONTENT_LENGTH     $content_length;
-
-fastcgi_param  SCRIPT_NAME        $fastcgi_script_name;
-fastcgi_param  REQUEST_URI        $request_uri;
-fastcgi_param  DOCUMENT_URI       $document_uri;
-fastcgi_param  DOCUMENT_ROOT      $document_root;
-fastcgi_param  SERVER_PROTOCOL    $server_protocol;
-fastcgi_param  REQUEST_SCHEME     $scheme;
-fastcgi_param  HTTPS              $https if_not_empty;
-
-fastcgi_param  GATEWAY_INTERFACE  CGI/1.1;
-fastcgi_param  SERVER_SOFTWARE    nginx/$nginx_version;
-
-fastcgi_param  REMOTE_ADDR        $remote_addr;
-fastcgi_param  REMOTE_PORT        $remote_port;
-fastcgi_param  SERVER_ADDR        $server_addr;
-fastcgi_param  SERVER_PORT        $server_port;
-fastcgi_param  SERVER_NAME        $server_name;
-
-# PHP only, required if PHP was built with --enable-force-cgi-redirect
-fastcgi_param  REDIRECT_STATUS    200;
-`
-	os.WriteFile(filepath.Join(configDir, "fastcgi_params"), []byte(fastcgiParams), 0644)
-
-	// Create mime.types for Nginx
-	mimeContent := `types {
-    text/html                             html htm shtml;
-    text/css                              css;
-    text/xml                              xml;
-    image/gif                             gif;
-    image/jpeg                            jpeg jpg;
-    application/javascript                js;
-    application/atom+xml                  atom;
-    application/rss+xml                   rss;
-    text/mathml                           mml;
-    text/plain                            txt;
-    text/vnd.sun.j2me.app-descriptor      jad;
-    text/vnd.wap.wml                      wml;
-    text/x-component                      htc;
-
-    image/png                             png;
-    image/svg+xml                         svg svgz;
-    image/tiff                            tif tiff;
-    image/vnd.wap.wbmp                    wbmp;
-    image/webp                            webp;
-    image/x-icon                          ico;
-    image/x-jng                           jng;
-    image/x-ms-bmp                        bmp;
-
-    application/font-woff                 woff;
-    application/java-archive              jar war ear;
-    application/json                      json;
-    application/mac-binhex40              hqx;
-    application/msword                    doc;
-    application/pdf                       pdf;
-    application/postscript                ps eps ai;
-    application/rtf                       rtf;
-    application/vnd.apple.mpegurl         m3u8;
-    application/vnd.google-earth.kml+xml  kml;
-    application/vnd.google-earth.kmz      kmz;
-    application/vnd.ms-excel              xls;
-    application/vnd.ms-fontobject         eot;
-    application/vnd.ms-powerpoint         ppt;
-    application/vnd.oasis.opendocument.graphics odg;
-    application/vnd.oasis.opendocument.presentation odp;
-    application/vnd.oasis.opendocument.spreadsheet ods;
-    application/vnd.oasis.opendocument.text odt;
-    application/vnd.openxmlformats-officedocument.presentationml.presentation pptx;
-    application/vnd.openxmlformats-officedocument.spreadsheetml.sheet xlsx;
-    application/vnd.openxmlformats-officedocument.wordprocessingml.document docx;
-    application/vnd.wap.wmlc              wmlc;
-    application/x-7z-compressed           7z;
-    application/x-cocoa                   cco;
-    application/x-java-archive-diff       jardiff;
-    application/x-java-jnlp-file          jnlp;
-    application/x-makeself                run;
-    application/x-perl                    pl pm;
-    application/x-pilot                   prc pdb;
-    application/x-rar-compressed          rar;
-    application/x-redhat-package-manager  rpm;
-    application/x-sea                     sea;
-    application/x-shockwave-flash         swf;
-    application/x-stuffit                 sit;
-    application/x-tcl                     tcl tk;
-    application/x-x509-ca-cert            der pem crt;
-    application/x-xpinstall               xpi;
-    application/xhtml+xml                 xhtml;
-    application/xspf+xml                  xspf;
-    application/zip                       zip;
-
-    application/octet-stream              bin exe dll;
-    application/octet-stream              deb;
-    application/octet-stream              dmg;
-    application/octet-stream              iso img;
-    application/octet-stream              msi msp msm;
-
-    audio/midi                            mid midi kar;
-    audio/mpeg                            mp3;
-    audio/ogg                             libvorbis.ogg;
-    audio/x-m4a                           m4a;
-    audio/x-realaudio                     ra;
-
-    video/3gpp                            3gpp 3gp;
-    video/mp4                             mp4;
-    video/mpeg                            mpeg mpg;
-    video/quicktime                       mov;
-    video/webm                            webm;
-    video/x-flv                           flv;
-    video/x-m4v                           m4v;
-    video/x-mng                           mng;
-    video/x-ms-asf                        asx asf;
-    video/x-ms-wmv                        wmv;
-    video/x-msvideo                       avi;
-}`
-	os.WriteFile(filepath.Join(configDir, "mime.types"), []byte(mimeContent), 0644)
+	// fastcgi_params for PHP-FPM and mime.types are included by nginx.conf
+	writeStaticConfig(configDir, "fastcgi_params")
+	writeStaticConfig(configDir, "mime.types")
 
-	htdocsDir := filepath.Join(sm.baseDir, "htdocs")
-	conf := fmt.Sprintf(`worker_processes  1;
-pid "%s/pids/nginx-%s.pid";
-
-events {
-    worker_connections  1024;
-}
-http {
-    include       mime.types;
-    default_type  application/octet-stream;
-    sendfile        on;
-    keepalive_timeout  65;
-    server {
-        listen       %d;
-        server_name  localhost;
-        root         "%s";
-        index        index.html index.htm index.php;
-        
-        location / {
-            try_files $uri $uri/ =404;
-        }
-        error_page   500 502 503 504  /50x.html;
-        location = /50x.html {
-            root   "%s";
-        }
-    }
-    include "%s/*.conf";
-}
-`, sm.baseDir, version, port, htdocsDir, htdocsDir, vhostDir)
-	return os.WriteFile(filepath.Join(configDir, "nginx.conf"), []byte(conf), 0644)
+	return sm.writeConfig(filepath.Join(configDir, "nginx.conf"), "nginx.conf.tmpl", sm.nginxConfigData(port, version))
 }
 
 func (sm *ServiceManager) installApache(version, installDir, configDir, dataDir string) error {
@@ -1973,18 +1825,14 @@ func (sm *ServiceManager) compileRedis(version, installDir, configDir, dataDir s
 		}
 	}
 
-	sm.createRedisConfig(configDir, dataDir)
+	sm.createRedisConfig(configDir, dataDir, sm.getDefaultPort("redis"), "redis-"+version)
 	sm.updateInstallProgress("redis", version, 100)
 	fmt.Printf("✅ Redis %s compiled and installed\n", version)
 	return nil
 }
 
-func (sm *ServiceManager) createRedisConfig(configDir, dataDir string) error {
-	conf := fmt.Sprintf(`port 6379
-daemonize no
-dir %s
-`, dataDir)
-	return os.WriteFile(filepath.Join(configDir, "redis.conf"), []byte(conf), 0644)
+func (sm *ServiceManager) createRedisConfig(configDir, dataDir string, port int, serviceName string) error {
+	return sm.writeConfig(filepath.Join(configDir, "redis.conf"), "redis.conf.tmpl", sm.redisConfigData(dataDir, port, serviceName))
 }
 
 func (sm *ServiceManager) UninstallService(name string) error {
@@ -1994,6 +1842,19 @@ func (sm *ServiceManager) UninstallService(name string) error {
 		sm.mu.Unlock()
 		return fmt.Errorf("service %s not found", name)
 	}
+	if svc.Type == CustomServiceType {
+		sm.mu.Unlock()
+		return sm.RemoveCustomService(name)
+	}
+	if svc.Instance != "" {
+		sm.mu.Unlock()
+		return sm.RemoveInstance(name)
+	}
+	if instances := sm.instancesOf(name); len(instances) > 0 {
+		sm.mu.Unlock()
+		sort.Strings(instances)
+		return fmt.Errorf("remove the instances of %s first: %s", name, strings.Join(instances, ", "))
+	}
 
 	// Use internal stop that doesn't lock
 	sm.stopServiceInternal(svc)
@@ -2025,9 +1886,7 @@ func (sm *ServiceManager) UninstallService(name string) error {
 	sm.saveServices()
 	sm.mu.Unlock()
 
-	if sm.OnStatusChange != nil {
-		sm.OnStatusChange()
-	}
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: "uninstalled"})
 	return nil
 }
 
@@ -2077,11 +1936,16 @@ func (sm *ServiceManager) updateInstallProgress(svcType, version string, progres
 		key = svcType + "-" + version
 	}
 	sm.statusMu.Lock()
+	previous, known := sm.installStatus[key]
 	sm.installStatus[key] = progress
 	if progress == 100 {
 		delete(sm.installErrors, key)
 	}
 	sm.statusMu.Unlock()
+
+	if !known || previous != progress {
+		sm.bus.Publish(events.Event{Type: events.InstallProgress, Service: key, Progress: progress})
+	}
 }
 
 func (sm *ServiceManager) SetInstallError(svcType, version, errMsg string) {
@@ -2093,6 +1957,8 @@ func (sm *ServiceManager) SetInstallError(svcType, version, errMsg string) {
 	sm.installErrors[key] = errMsg
 	sm.installStatus[key] = -1
 	sm.statusMu.Unlock()
+
+	sm.bus.Publish(events.Event{Type: events.InstallProgress, Service: key, Progress: -1, Message: errMsg})
 }
 
 func (sm *ServiceManager) GetInstallStatus(svcType, version string) (int, string) {
@@ -2398,39 +2264,32 @@ func (sm *ServiceManager) StartService(name string) error {
 	if svc.Status == "running" {
 		return fmt.Errorf("service %s is already running", name)
 	}
+	if svc.Status == "crashed" {
+		// Starting by hand gives a crashed service a fresh restart budget
+		sm.supervisor.reset(name)
+	}
+	sm.supervisor.exitExpected(name) // drop a stale stop mark
 
 	sm.updateInstallProgress(svc.Type, svc.Version, 10)
 
 	var cmd *exec.Cmd
 	var binaryPath string
 
-	// Check and clear orphan processes if port is in use
-	if svc.Port > 0 {
-		inUse, conflict := sm.checkPortInUse(svc.Port)
-		if inUse && strings.Contains(conflict, "(PID: ") {
-			// Extract PID
-			parts := strings.Split(conflict, "(PID: ")
-			if len(parts) > 1 {
-				pidStr := strings.TrimRight(parts[1], ")")
-				var pid int
-				fmt.Sscanf(pidStr, "%d", &pid)
-
-				// Verify if it's our process using -ww to get full command line
-				psCmd := exec.Command("ps", "-ww", "-p", pidStr, "-o", "command=")
-				psOutput, _ := psCmd.Output()
-				fullCmd := strings.TrimSpace(string(psOutput))
-
-				if pid > 0 && strings.Contains(fullCmd, "Stacker") {
-					fmt.Printf("⚠️ Port %d is occupied by an orphan Stacker process (PID: %d). Cleaning up...\n", svc.Port, pid)
-					if process, err := os.FindProcess(pid); err == nil {
-						process.Signal(syscall.SIGKILL)
-						time.Sleep(1 * time.Second) // Give it a moment
-					}
-				}
-			}
+	// Another version or instance may already hold the port
+	sm.resolvePortConflict(svc)
+	if svc.Instance != "" {
+		if err := sm.prepareInstance(svc); err != nil {
+			sm.updateInstallProgress(svc.Type, svc.Version, -1)
+			return err
 		}
 	}
 
+	// Clear processes left behind by an earlier run
+	if err := sm.clearOrphans(svc); err != nil {
+		sm.updateInstallProgress(svc.Type, svc.Version, -1)
+		return err
+	}
+
 	switch svc.Type {
 	case "mariadb":
 		sm.updateInstallProgress(svc.Type, svc.Version, 30)
@@ -2439,7 +2298,7 @@ func (sm *ServiceManager) StartService(name string) error {
 			return fmt.Errorf("MariaDB binary not found")
 		}
 		// Regenerate config
-		sm.createMariaDBConfig(svc.ConfigDir, svc.DataDir, sm.getDefaultPort(svc.Type), svc.Version)
+		sm.createMariaDBConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
 		cmd = sm.startMariaDB(svc, binaryPath)
 	case "mysql":
 		sm.updateInstallProgress(svc.Type, svc.Version, 30)
@@ -2448,7 +2307,7 @@ func (sm *ServiceManager) StartService(name string) error {
 			return fmt.Errorf("MySQL binary not found")
 		}
 		// Regenerate config
-		sm.createMySQLConfig(svc.ConfigDir, svc.DataDir, sm.getDefaultPort(svc.Type), svc.Version)
+		sm.createMySQLConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
 		cmd = sm.startMySQL(svc, binaryPath)
 	case "nginx":
 		sm.updateInstallProgress(svc.Type, svc.Version, 30)
@@ -2460,7 +2319,7 @@ func (sm *ServiceManager) StartService(name string) error {
 			return fmt.Errorf("Nginx binary not found at %s", binaryPath)
 		}
 		// Regenerate config
-		sm.createNginxConfig(svc.ConfigDir, sm.getDefaultPort(svc.Type), svc.Version)
+		sm.createNginxConfig(svc.ConfigDir, svc.Port, svc.Version)
 		cmd = sm.startNginx(svc, binaryPath)
 	case "apache":
 		sm.updateInstallProgress(svc.Type, svc.Version, 30)
@@ -2476,19 +2335,20 @@ func (sm *ServiceManager) StartService(name string) error {
 		}
 
 		// Regenerate config
-		sm.createApacheConfig(svc.ConfigDir, svc.DataDir, svc.BinaryDir, svc.Version, sm.getDefaultPort(svc.Type))
+		sm.createApacheConfig(svc.ConfigDir, svc.DataDir, svc.BinaryDir, svc.Version, svc.Port)
 		cmd = sm.startApache(svc, binaryPath)
 	case "redis":
 		sm.updateInstallProgress(svc.Type, svc.Version, 30)
-		binName := "redis-server"
-		if runtime.GOOS == "windows" {
-			binName = "redis-server.exe"
-		}
-		binaryPath = filepath.Join(svc.BinaryDir, binName)
-		if _, err := os.Stat(binaryPath); err != nil {
-			binaryPath = filepath.Join(svc.BinaryDir, "src", binName)
+		binaryPath = redisTool(svc, "redis-server")
+		if binaryPath == "" {
+			return fmt.Errorf("Redis binary not found in %s", svc.BinaryDir)
 		}
 		cmd = sm.startRedis(svc, binaryPath)
+	case CustomServiceType:
+		var err error
+		if cmd, err = sm.startCustom(svc); err != nil {
+			return err
+		}
 	default:
 		// Handle PHP and variants
 		if strings.HasPrefix(svc.Type, "php") {
@@ -2499,16 +2359,16 @@ func (sm *ServiceManager) StartService(name string) error {
 			}
 
 			// Simple PHP-FPM start
-			fpmConfDir := filepath.Join(sm.baseDir, "conf", "php-fpm")
-			os.MkdirAll(fpmConfDir, 0755)
-			fpmConf := filepath.Join(fpmConfDir, "php-fpm-"+svc.Name+".conf")
+			fpmConf := sm.fpmConfigFile(svc.Name)
+			os.MkdirAll(filepath.Dir(fpmConf), 0755)
 
 			// Always regenerate FPM config to ensure correct port and paths
 			port := sm.getDefaultPort(svc.Type)
 			if port == 0 {
 				port = 9000
 			}
-			content := fmt.Sprintf("[global]\npid = %s/pids/%s.pid\nerror_log = %s/logs/php-fpm-%s.error.log\n[www]\nlisten = 127.0.0.1:%d\npm = dynamic\npm.max_children = 5\npm.start_servers = 2\npm.min_spare_servers = 1\npm.max_spare_servers = 3\n", sm.baseDir, svc.Name, sm.baseDir, svc.Name, port)
+			// The PID file is the one php.FPMManager and Xdebug signal
+			content := fmt.Sprintf("[global]\npid = %s\nerror_log = %s/logs/php-fpm-%s.error.log\n[www]\nlisten = 127.0.0.1:%d\npm = dynamic\npm.max_children = 5\npm.start_servers = 2\npm.min_spare_servers = 1\npm.max_spare_servers = 3\n", php.FPMPIDFile(svc.Version), sm.baseDir, svc.Name, port)
 			os.WriteFile(fpmConf, []byte(content), 0644)
 
 			if strings.Contains(binaryPath, "php-fpm") {
@@ -2518,6 +2378,8 @@ func (sm *ServiceManager) StartService(name string) error {
 			} else {
 				cmd = exec.Command(binaryPath, "-S", fmt.Sprintf("127.0.0.1:%d", port))
 			}
+			// Load the managed conf.d files, such as the Xdebug ini
+			cmd.Env = append(os.Environ(), php.ScanDirEnv(php.MinorVersion(svc.Version)))
 		} else {
 			return fmt.Errorf("unsupported service type: %s", svc.Type)
 		}
@@ -2533,6 +2395,12 @@ func (sm *ServiceManager) StartService(name string) error {
 	logsDir := filepath.Join(sm.baseDir, "logs")
 	os.MkdirAll(logsDir, 0755)
 	logFile := filepath.Join(logsDir, name+".log")
+	if svc.Type == CustomServiceType {
+		if path := sm.customLogFile(name); path != "" {
+			os.MkdirAll(filepath.Dir(path), 0755)
+			logFile = path
+		}
+	}
 
 	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err == nil {
@@ -2541,6 +2409,7 @@ func (sm *ServiceManager) StartService(name string) error {
 	} else {
 		utils.LogError(fmt.Sprintf("Failed to open service log file %s: %v", logFile, err))
 	}
+	crashLog := newLogTail(f)
 
 	if err := cmd.Start(); err != nil {
 		utils.LogService(name, "start", "failed: "+err.Error())
@@ -2556,6 +2425,7 @@ func (sm *ServiceManager) StartService(name string) error {
 	svc.Status = "running"
 	svc.PID = cmd.Process.Pid
 	svc.StartTime = time.Now()
+	svc.Restarts = sm.supervisor.restartCount(name)
 	sm.processes[name] = cmd
 
 	sm.saveServiceStatus(svc)
@@ -2576,18 +2446,17 @@ func (sm *ServiceManager) StartService(name string) error {
 	}
 
 	// Start monitoring
-	go sm.monitorProcess(name, cmd, f)
+	go sm.monitorProcess(name, cmd, f, crashLog)
 
 	sm.updateInstallProgress(svc.Type, svc.Version, 100)
+	sm.rememberConfig(svc)
 
 	fmt.Printf("✅ Service %s started (PID: %d)\n", name, cmd.Process.Pid)
-	if sm.OnStatusChange != nil {
-		sm.OnStatusChange()
-	}
+	sm.bus.Publish(events.Event{Type: events.Started, Service: name, PID: cmd.Process.Pid})
 	return nil
 }
 
-func (sm *ServiceManager) monitorProcess(name string, cmd *exec.Cmd, logFile *os.File) {
+func (sm *ServiceManager) monitorProcess(name string, cmd *exec.Cmd, logFile *os.File, crashLog *logTail) {
 	sm.wg.Add(1)
 	defer sm.wg.Done()
 	if logFile != nil {
@@ -2596,19 +2465,18 @@ func (sm *ServiceManager) monitorProcess(name string, cmd *exec.Cmd, logFile *os
 
 	err := cmd.Wait()
 
+	// A process that was replaced (restart) no longer owns the service state
 	sm.mu.Lock()
 	svc, ok := sm.services[name]
-	if ok {
+	current := ok && sm.processes[name] == cmd
+	if current {
 		svc.Status = "stopped"
 		svc.PID = 0
 		delete(sm.processes, name)
 	}
 	isShuttingDown := sm.isShuttingDown()
-	autoRestart := false
-	if ok {
-		autoRestart = svc.AutoRestart
-	}
 	sm.mu.Unlock()
+	expected := sm.supervisor.exitExpected(name)
 
 	if err != nil && !isShuttingDown {
 		fmt.Printf("⚠️ Service %s exited with error: %v\n", name, err)
@@ -2622,15 +2490,9 @@ func (sm *ServiceManager) monitorProcess(name string, cmd *exec.Cmd, logFile *os
 		sm.saveServiceStatus(svc)
 	}
 
-	// Auto-restart logic
-	if autoRestart && !isShuttingDown {
-		fmt.Printf("🔄 Auto-restarting service %s...\n", name)
-		time.Sleep(2 * time.Second)
-		sm.StartService(name)
-	}
-
-	if sm.OnStatusChange != nil {
-		sm.OnStatusChange()
+	// Exits Stacker did not ask for are handled by the restart policy
+	if current && !expected && !isShuttingDown {
+		sm.handleCrash(name, err, crashLog)
 	}
 }
 
@@ -2655,24 +2517,23 @@ func (sm *ServiceManager) Stop() {
 func (sm *ServiceManager) GracefulStopAll() error {
 	fmt.Println("⏳ Gracefully stopping all services...")
 	sm.Stop()
+	return sm.stopRunning()
+}
 
-	sm.mu.RLock()
-	var wg sync.WaitGroup
-	for _, svc := range sm.services {
+// stopRunning stops every running service, dependents before the services
+// they depend on, each dependency level in parallel
+func (sm *ServiceManager) stopRunning() error {
+	var running []string
+	for _, svc := range sm.GetServices() {
 		if svc.Status == "running" {
-			wg.Add(1)
-			go func(service *Service) {
-				defer wg.Done()
-				sm.stopServiceInternal(service)
-			}(svc)
+			running = append(running, svc.Name)
 		}
 	}
-	sm.mu.RUnlock()
 
 	// Wait for all stop commands to finish or timeout
 	c := make(chan struct{})
 	go func() {
-		wg.Wait()
+		sm.stopInGroups(sm.stopGroups(running))
 		c <- struct{}{}
 	}()
 
@@ -2724,8 +2585,25 @@ func (sm *ServiceManager) GetDetailedStatus(name string) *DetailedStatus {
 
 	if svc.Status == "running" && svc.PID > 0 {
 		status.Uptime = time.Since(svc.StartTime).Round(time.Second).String()
-		// In a real app, we'd use gopsutil here for CPU/Memory
-		// For now, let's check if the port is actually listening
+
+		sample, ok := sm.latestResources(name)
+		if !ok {
+			var err error
+			if sample, err = sm.SampleResources(name); err != nil {
+				status.Checks["process"] = err.Error()
+			}
+		}
+		status.CPU = sample.CPU
+		status.Memory = sample.Memory
+		status.Resources = map[string]int64{
+			"rss":       sample.Memory,
+			"fds":       int64(sample.FDs),
+			"threads":   int64(sample.Threads),
+			"children":  int64(sample.Children),
+			"processes": int64(sample.Processes),
+		}
+
+		// Check that the port is actually listening
 		if err := sm.checkPortAvailable(svc.Port); err == nil {
 			status.Checks["port"] = "listening"
 		} else {
@@ -2742,6 +2620,13 @@ func (sm *ServiceManager) GetDetailedStatus(name string) *DetailedStatus {
 				status.Checks["http"] = "no_response"
 				status.Healthy = false
 			}
+		case CustomServiceType:
+			if err := sm.Probe(svc); err != nil {
+				status.Checks["health"] = err.Error()
+				status.Healthy = false
+			} else {
+				status.Checks["health"] = "passing"
+			}
 		}
 	}
 
@@ -2806,9 +2691,6 @@ func (sm *ServiceManager) StopService(name string) error {
 	os.Remove(sm.getPIDFile(name))
 
 	fmt.Printf("⏹️ Service %s stopped\n", name)
-	if sm.OnStatusChange != nil {
-		sm.OnStatusChange()
-	}
 	return nil
 }
 
@@ -2850,19 +2732,8 @@ func (sm *ServiceManager) GetServiceConfig(name string) (string, string, error)
 		return "", "", fmt.Errorf("service %s not found", name)
 	}
 
-	var configFile string
-	switch svc.Type {
-	case "mysql", "mariadb":
-		configFile = filepath.Join(svc.ConfigDir, "my.cnf")
-	case "nginx":
-		configFile = filepath.Join(svc.ConfigDir, "nginx.conf")
-	case "apache":
-		configFile = filepath.Join(svc.ConfigDir, "httpd.conf")
-	case "redis":
-		configFile = filepath.Join(svc.ConfigDir, "redis.conf")
-	case "php":
-		configFile = filepath.Join(svc.ConfigDir, "php.ini")
-	default:
+	configFile := sm.mainConfigFile(svc)
+	if configFile == "" {
 		return "", "", fmt.Errorf("config not available for %s", svc.Type)
 	}
 
@@ -2888,15 +2759,15 @@ func (sm *ServiceManager) createDefaultConfig(svc *Service) error {
 
 	switch svc.Type {
 	case "mysql":
-		return sm.createMySQLConfig(svc.ConfigDir, svc.DataDir, sm.getDefaultPort("mysql"), svc.Version)
+		return sm.createMySQLConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
 	case "mariadb":
-		return sm.createMariaDBConfig(svc.ConfigDir, svc.DataDir, sm.getDefaultPort("mariadb"), svc.Version)
+		return sm.createMariaDBConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
 	case "nginx":
 		return sm.createNginxConfig(svc.ConfigDir, sm.getDefaultPort("nginx"), svc.Version)
 	case "apache":
 		return sm.createApacheConfig(svc.ConfigDir, svc.DataDir, svc.BinaryDir, svc.Version, sm.getDefaultPort("apache"))
 	case "redis":
-		return sm.createRedisConfig(svc.ConfigDir, svc.DataDir)
+		return sm.createRedisConfig(svc.ConfigDir, svc.DataDir, svc.Port, svc.Name)
 	case "php":
 		return sm.createPHPConfig(svc.ConfigDir)
 	}
@@ -2920,58 +2791,16 @@ date.timezone = UTC
 	return os.WriteFile(filepath.Join(configDir, "php.ini"), []byte(phpIni), 0644)
 }
 
-func (sm *ServiceManager) SaveServiceConfig(name, content string) error {
-	sm.mu.RLock()
-	svc, ok := sm.services[name]
-	sm.mu.RUnlock()
-
-	if !ok {
-		return fmt.Errorf("service %s not found", name)
-	}
-
-	var configFile string
-	switch svc.Type {
-	case "mysql", "mariadb":
-		configFile = filepath.Join(svc.ConfigDir, "my.cnf")
-	case "nginx":
-		configFile = filepath.Join(svc.ConfigDir, "nginx.conf")
-	case "apache":
-		configFile = filepath.Join(svc.ConfigDir, "httpd.conf")
-	case "redis":
-		configFile = filepath.Join(svc.ConfigDir, "redis.conf")
-	case "php":
-		configFile = filepath.Join(svc.ConfigDir, "php.ini")
-	default:
-		return fmt.Errorf("config not available for %s", svc.Type)
-	}
-
-	// Backup old config
-	if _, err := os.Stat(configFile); err == nil {
-		backupFile := configFile + ".bak"
-		os.Rename(configFile, backupFile)
-	}
-
-	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
-	}
-
-	utils.LogService(name, "config", "saved")
-	fmt.Printf("💾 Config saved for %s\n", name)
-
-	// Auto-restart if running
-	if svc.Status == "running" {
-		fmt.Printf("🔄 Auto-restarting %s after config change...\n", name)
-		return sm.RestartService(name)
-	}
-
-	return nil
-}
-
 func (sm *ServiceManager) stopServiceInternal(svc *Service) error {
+	sm.supervisor.expectExit(svc.Name)
 	pid := svc.PID
 	if pid == 0 {
 		pid = sm.loadPID(svc.Name)
 	}
+	if !sm.adoptPID(svc, pid) {
+		// Never signal a process that is not the service's own
+		pid = 0
+	}
 
 	if pid > 0 {
 		if runtime.GOOS == "windows" {
@@ -2985,7 +2814,7 @@ func (sm *ServiceManager) stopServiceInternal(svc *Service) error {
 					// Wait a bit for graceful shutdown
 					time.Sleep(500 * time.Millisecond)
 					// Check if still running
-					if err := process.Signal(syscall.Signal(0)); err == nil {
+					if procinfo.Alive(pid) {
 						// Still running, force kill
 						process.Signal(syscall.SIGKILL)
 					}
@@ -2998,6 +2827,7 @@ func (sm *ServiceManager) stopServiceInternal(svc *Service) error {
 
 	svc.Status = "stopped"
 	svc.PID = 0
+	sm.bus.Publish(events.Event{Type: events.Stopped, Service: svc.Name, PID: pid})
 
 	return nil
 }
@@ -3012,6 +2842,10 @@ func (sm *ServiceManager) GetStatus(name string) string {
 	}
 
 	oldStatus := svc.Status
+	stopped := "stopped"
+	if oldStatus == "crashed" {
+		stopped = "crashed" // terminal until started again
+	}
 
 	// Check if process is running
 	pid := svc.PID
@@ -3020,57 +2854,50 @@ func (sm *ServiceManager) GetStatus(name string) string {
 	}
 
 	if pid > 0 {
-		process, err := os.FindProcess(pid)
-		if err == nil {
-			// Signal 0 checks if process exists
-			if err := process.Signal(syscall.Signal(0)); err == nil {
-				svc.Status = "running"
-				svc.PID = pid
-
-				// Verify if it's actually listening on its port (only for TCP services)
-				if svc.Type != "composer" && svc.Type != "nodejs" {
-					// Drop lock for network check to avoid blocking the whole manager
-					port := svc.Port
-					sm.mu.Unlock()
-
-					portErr := sm.checkPortAvailable(port)
-
-					sm.mu.Lock()
-					// Re-fetch in case it was deleted/changed
-					svc, ok = sm.services[name]
-					if ok {
-						if portErr != nil {
-							svc.PortInUse = false
-						} else {
-							svc.PortInUse = true
-						}
-					}
-				}
-			} else {
+		if sm.adoptPID(svc, pid) {
+			svc.Status = "running"
+			svc.PID = pid
+
+			// Verify if it's actually listening on its port (only for TCP services)
+			if svc.Type != "composer" && svc.Type != "nodejs" {
+				// Drop lock for network check to avoid blocking the whole manager
+				port := svc.Port
+				sm.mu.Unlock()
+
+				portErr := sm.checkPortAvailable(port)
+
+				sm.mu.Lock()
+				// Re-fetch in case it was deleted/changed
+				svc, ok = sm.services[name]
 				if ok {
-					svc.Status = "stopped"
-					svc.PID = 0
+					if portErr != nil {
+						svc.PortInUse = false
+					} else {
+						svc.PortInUse = true
+					}
 				}
 			}
 		} else {
 			if ok {
-				svc.Status = "stopped"
+				svc.Status = stopped
 				svc.PID = 0
 			}
 		}
 	} else {
 		if ok {
-			svc.Status = "stopped"
+			svc.Status = stopped
 		}
 	}
 
 	if ok {
 		svc.LastCheck = time.Now().Format(time.RFC3339)
 
+		// The process was started or ended outside Stacker
 		if oldStatus != svc.Status {
-			if sm.OnStatusChange != nil {
-				// Prevent deadlocks
-				go sm.OnStatusChange()
+			if svc.Status == "running" {
+				sm.bus.Publish(events.Event{Type: events.Started, Service: name, PID: svc.PID, Message: "detected"})
+			} else {
+				sm.bus.Publish(events.Event{Type: events.Stopped, Service: name, Message: "process is gone"})
 			}
 		}
 		return svc.Status
@@ -3134,50 +2961,22 @@ func (sm *ServiceManager) StartAll() {
 	}
 	sm.mu.RUnlock()
 
-	// Priority order: DBs and PHP first, then Web Servers
-	priority := []string{"mysql", "mariadb", "redis", "php"}
-	others := []string{}
-	webServers := []string{}
-
-	for _, name := range names {
-		sm.mu.RLock()
-		s, ok := sm.services[name]
-		sm.mu.RUnlock()
-		if !ok {
-			continue
-		}
-
-		isPriority := false
-		for _, p := range priority {
-			if strings.HasPrefix(s.Type, p) {
-				isPriority = true
-				break
-			}
-		}
-
-		if s.Type == "apache" || s.Type == "nginx" {
-			webServers = append(webServers, name)
-		} else if isPriority {
-			// Start priority services immediately in order
+	// Dependencies first, each waited on until it accepts connections
+	sort.Strings(names)
+	if _, _, err := sm.StartServices(names); err != nil {
+		fmt.Printf("❌ %v, starting services without ordering\n", err)
+		utils.LogError(fmt.Sprintf("Service dependencies: %v", err))
+		for _, name := range names {
 			sm.StartService(name)
-		} else {
-			others = append(others, name)
 		}
 	}
-
-	// Start other services
-	for _, name := range others {
-		sm.StartService(name)
-	}
-
-	// Start web servers last
-	for _, name := range webServers {
-		sm.StartService(name)
-	}
 }
 
+// StopAll stops every running service. Unlike GracefulStopAll the manager
+// keeps running, so services can be started and supervised again.
 func (sm *ServiceManager) StopAll() {
-	sm.GracefulStopAll()
+	fmt.Println("⏳ Stopping all services...")
+	sm.stopRunning()
 }
 
 func (sm *ServiceManager) FormatStatus() string {
@@ -3196,6 +2995,8 @@ func (sm *ServiceManager) FormatStatus() string {
 		status := strings.Title(svc.Status)
 		if svc.Status == "running" && svc.PID > 0 {
 			status = fmt.Sprintf("%s (PID: %d)", status, svc.PID)
+		} else if svc.Status == "crashed" && svc.LastExit != "" {
+			status = fmt.Sprintf("%s: %s", status, svc.LastExit)
 		}
 		output = append(output, fmt.Sprintf("  • %-15s %s", svc.Name, status))
 	}
@@ -3318,8 +3119,10 @@ func (sm *ServiceManager) startApache(svc *Service, binaryPath string) *exec.Cmd
 }
 
 func (sm *ServiceManager) startRedis(svc *Service, binaryPath string) *exec.Cmd {
-	cmd := exec.Command(binaryPath,
-		filepath.Join(svc.ConfigDir, "redis.conf"),
-	)
-	return cmd
+	args := []string{filepath.Join(svc.ConfigDir, "redis.conf")}
+	if svc.Port > 0 {
+		// Command line options override redis.conf
+		args = append(args, "--port", strconv.Itoa(svc.Port))
+	}
+	return exec.Command(binaryPath, args...)
 }
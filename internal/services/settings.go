@@ -0,0 +1,193 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+var (
+	mysqlSizePattern = regexp.MustCompile(`^[0-9]+[KMGkmg]?$`)
+	redisSizePattern = regexp.MustCompile(`(?i)^[0-9]+(b|k|kb|m|mb|g|gb)?$`)
+	nginxSizePattern = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+	nginxWorkers     = regexp.MustCompile(`^(auto|[1-9][0-9]*)$`)
+)
+
+// redisPolicies are the values Redis accepts for maxmemory-policy
+var redisPolicies = []string{
+	"noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random",
+	"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl",
+}
+
+// withDefaults returns a copy of settings with every section present and
+// empty fields set to the defaults, which match the servers' own
+func withDefaults(s config.ServiceSettings) config.ServiceSettings {
+	mysql := config.MySQLSettings{BufferPoolSize: "128M", MaxConnections: 151}
+	if s.MySQL != nil {
+		if s.MySQL.BufferPoolSize != "" {
+			mysql.BufferPoolSize = s.MySQL.BufferPoolSize
+		}
+		if s.MySQL.MaxConnections > 0 {
+			mysql.MaxConnections = s.MySQL.MaxConnections
+		}
+	}
+
+	redis := config.RedisSettings{MaxMemory: "0", MaxMemoryPolicy: "noeviction"}
+	if s.Redis != nil {
+		if s.Redis.MaxMemory != "" {
+			redis.MaxMemory = s.Redis.MaxMemory
+		}
+		if s.Redis.MaxMemoryPolicy != "" {
+			redis.MaxMemoryPolicy = s.Redis.MaxMemoryPolicy
+		}
+	}
+
+	nginx := config.NginxSettings{WorkerProcesses: "1", WorkerConnections: 1024, KeepaliveTimeout: 65, ClientMaxBodySize: "1m"}
+	if s.Nginx != nil {
+		if s.Nginx.WorkerProcesses != "" {
+			nginx.WorkerProcesses = s.Nginx.WorkerProcesses
+		}
+		if s.Nginx.WorkerConnections > 0 {
+			nginx.WorkerConnections = s.Nginx.WorkerConnections
+		}
+		if s.Nginx.KeepaliveTimeout > 0 {
+			nginx.KeepaliveTimeout = s.Nginx.KeepaliveTimeout
+		}
+		if s.Nginx.ClientMaxBodySize != "" {
+			nginx.ClientMaxBodySize = s.Nginx.ClientMaxBodySize
+		}
+	}
+
+	return config.ServiceSettings{MySQL: &mysql, Redis: &redis, Nginx: &nginx}
+}
+
+// validateSettings checks the section of settings used by svcType, so no
+// value can break out of its line in the generated config
+func validateSettings(svcType string, s config.ServiceSettings) error {
+	switch svcType {
+	case "mysql", "mariadb":
+		if s.MySQL == nil {
+			return fmt.Errorf("mysql settings are required")
+		}
+		if v := s.MySQL.BufferPoolSize; v != "" && !mysqlSizePattern.MatchString(v) {
+			return fmt.Errorf("invalid bufferPoolSize %q, use a size such as 256M", v)
+		}
+		if s.MySQL.MaxConnections < 0 {
+			return fmt.Errorf("maxConnections must be positive")
+		}
+	case "redis":
+		if s.Redis == nil {
+			return fmt.Errorf("redis settings are required")
+		}
+		if v := s.Redis.MaxMemory; v != "" && !redisSizePattern.MatchString(v) {
+			return fmt.Errorf("invalid maxMemory %q, use a size such as 256mb or 0 for no limit", v)
+		}
+		if v := s.Redis.MaxMemoryPolicy; v != "" {
+			known := false
+			for _, policy := range redisPolicies {
+				known = known || policy == v
+			}
+			if !known {
+				return fmt.Errorf("invalid maxMemoryPolicy %q", v)
+			}
+		}
+	case "nginx":
+		if s.Nginx == nil {
+			return fmt.Errorf("nginx settings are required")
+		}
+		if v := s.Nginx.WorkerProcesses; v != "" && !nginxWorkers.MatchString(v) {
+			return fmt.Errorf("invalid workerProcesses %q, use a number or auto", v)
+		}
+		if s.Nginx.WorkerConnections < 0 || s.Nginx.KeepaliveTimeout < 0 {
+			return fmt.Errorf("workerConnections and keepaliveTimeout must be positive")
+		}
+		if v := s.Nginx.ClientMaxBodySize; v != "" && !nginxSizePattern.MatchString(v) {
+			return fmt.Errorf("invalid clientMaxBodySize %q, use a size such as 64m", v)
+		}
+	default:
+		return fmt.Errorf("settings not available for %s", svcType)
+	}
+	return nil
+}
+
+// hasSettings reports whether the config of svcType is generated from settings
+func hasSettings(svcType string) bool {
+	switch svcType {
+	case "mysql", "mariadb", "redis", "nginx":
+		return true
+	}
+	return false
+}
+
+// onlySection keeps the section of settings used by svcType
+func onlySection(svcType string, s config.ServiceSettings) config.ServiceSettings {
+	switch svcType {
+	case "mysql", "mariadb":
+		return config.ServiceSettings{MySQL: s.MySQL}
+	case "redis":
+		return config.ServiceSettings{Redis: s.Redis}
+	case "nginx":
+		return config.ServiceSettings{Nginx: s.Nginx}
+	}
+	return config.ServiceSettings{}
+}
+
+// GetServiceSettings returns the settings a service's config is generated
+// with, defaults included
+func (sm *ServiceManager) GetServiceSettings(name string) (config.ServiceSettings, error) {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return config.ServiceSettings{}, fmt.Errorf("service %s not found", name)
+	}
+	if !hasSettings(svc.Type) {
+		return config.ServiceSettings{}, fmt.Errorf("settings not available for %s", svc.Type)
+	}
+	return onlySection(svc.Type, withDefaults(config.GetPreferences().ServiceSettings[name])), nil
+}
+
+// SetServiceSettings regenerates a service's config with new settings,
+// keeping the overrides block. The result is validated, kept in the config
+// history and applied like a saved config; the settings are stored only when
+// the config passes.
+func (sm *ServiceManager) SetServiceSettings(name string, settings config.ServiceSettings) error {
+	svc := sm.GetService(name)
+	if svc == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	tmpl, data, ok := sm.generatedConfig(svc)
+	if !ok {
+		return fmt.Errorf("settings not available for %s", svc.Type)
+	}
+	if err := validateSettings(svc.Type, settings); err != nil {
+		return err
+	}
+	settings = onlySection(svc.Type, settings)
+
+	configFile := sm.mainConfigFile(svc)
+	overrides, err := sm.currentOverrides(configFile, tmpl, data)
+	if err != nil {
+		return fmt.Errorf("cannot regenerate %s: %w", filepath.Base(configFile), err)
+	}
+	content, err := sm.renderConfig(tmpl, data, settings, overrides)
+	if err != nil {
+		return err
+	}
+	if err := sm.validateConfig(svc, configFile, content); err != nil {
+		utils.LogService(name, "settings", "rejected: "+err.Error())
+		return err
+	}
+
+	// Stored before the reload, as a restart regenerates the config from them
+	p := config.GetPreferences()
+	if p.ServiceSettings == nil {
+		p.ServiceSettings = make(map[string]config.ServiceSettings)
+	}
+	p.ServiceSettings[name] = settings
+	if err := p.Save(); err != nil {
+		return err
+	}
+	return sm.commitServiceConfig(svc, configFile, content, "settings changed")
+}
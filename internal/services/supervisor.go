@@ -0,0 +1,314 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// crashLogLines is how many log lines are kept for a crashed service
+const crashLogLines = 50
+
+// supervisor tracks restarts per service. It has its own lock because exits
+// are handled outside sm.mu.
+type supervisor struct {
+	mu       sync.Mutex
+	restarts map[string][]time.Time // restart times within the policy window
+	stopping map[string]bool        // exits requested by Stacker, not crashes
+	gen      map[string]int         // bumped to cancel pending restarts
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{
+		restarts: make(map[string][]time.Time),
+		stopping: make(map[string]bool),
+		gen:      make(map[string]int),
+	}
+}
+
+// expectExit marks the next exit of a service as requested
+func (s *supervisor) expectExit(name string) {
+	s.mu.Lock()
+	s.stopping[name] = true
+	s.gen[name]++
+	s.mu.Unlock()
+}
+
+// exitExpected reports and clears the mark set by expectExit
+func (s *supervisor) exitExpected(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expected := s.stopping[name]
+	delete(s.stopping, name)
+	return expected
+}
+
+// reset forgets the restart history and cancels pending restarts
+func (s *supervisor) reset(name string) {
+	s.mu.Lock()
+	delete(s.restarts, name)
+	s.gen[name]++
+	s.mu.Unlock()
+}
+
+func (s *supervisor) generation(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen[name]
+}
+
+// nextRestart records a restart attempt and returns its number and delay, or
+// false when the policy allows no more restarts within its window
+func (s *supervisor) nextRestart(name string, policy config.RestartPolicy) (int, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	window := time.Duration(policy.WindowSeconds) * time.Second
+	var recent []time.Time
+	for _, t := range s.restarts[name] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= policy.MaxRestarts {
+		s.restarts[name] = recent
+		return len(recent), 0, false
+	}
+	recent = append(recent, now)
+	s.restarts[name] = recent
+
+	backoff := time.Duration(policy.BackoffSeconds) * time.Second
+	maxBackoff := time.Duration(policy.MaxBackoffSeconds) * time.Second
+	for i := 1; i < len(recent) && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if maxBackoff > 0 && backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return len(recent), backoff, true
+}
+
+func (s *supervisor) restartCount(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.restarts[name])
+}
+
+// RestartPolicy returns the restart policy of a service. Without one of its
+// own, restarts are enabled as the service's auto_restart says.
+func (sm *ServiceManager) RestartPolicy(name string) config.RestartPolicy {
+	if policy, ok := config.GetPreferences().RestartPolicies[name]; ok {
+		return policy
+	}
+	policy := config.DefaultRestartPolicy
+	if svc := sm.GetService(name); svc != nil {
+		policy.Enabled = svc.AutoRestart
+	}
+	return policy
+}
+
+// SetRestartPolicy stores a service's restart policy
+func (sm *ServiceManager) SetRestartPolicy(name string, policy config.RestartPolicy) error {
+	if sm.GetService(name) == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	if policy.MaxRestarts < 0 || policy.WindowSeconds < 0 || policy.BackoffSeconds < 0 || policy.MaxBackoffSeconds < 0 {
+		return fmt.Errorf("restart policy values must not be negative")
+	}
+	if policy.Enabled && (policy.MaxRestarts == 0 || policy.WindowSeconds == 0) {
+		return fmt.Errorf("maxRestarts and windowSeconds are required when restarts are enabled")
+	}
+
+	p := config.GetPreferences()
+	if p.RestartPolicies == nil {
+		p.RestartPolicies = make(map[string]config.RestartPolicy)
+	}
+	p.RestartPolicies[name] = policy
+	sm.supervisor.reset(name)
+	if err := p.Save(); err != nil {
+		return err
+	}
+	sm.bus.Publish(events.Event{Type: events.ConfigChanged, Service: name, Message: "restart policy"})
+	return nil
+}
+
+// handleCrash restarts a service that exited on its own, with exponential
+// backoff, until its policy gives up and marks it crashed
+func (sm *ServiceManager) handleCrash(name string, exitErr error, log *logTail) {
+	reason := "exited"
+	if exitErr != nil {
+		reason = exitErr.Error()
+	}
+	sm.bus.Publish(events.Event{Type: events.Exited, Service: name, Message: reason})
+
+	for {
+		policy := sm.RestartPolicy(name)
+		if !policy.Enabled {
+			sm.markCrashed(name, reason, log.Lines(), 0)
+			return
+		}
+		attempt, backoff, ok := sm.supervisor.nextRestart(name, policy)
+		if !ok {
+			sm.markCrashed(name, reason, log.Lines(), attempt)
+			return
+		}
+
+		sm.bus.Publish(events.Event{Type: events.Restarting, Service: name, Attempt: attempt, Backoff: backoff.String()})
+		fmt.Printf("🔄 Restarting %s in %s (attempt %d/%d)...\n", name, backoff, attempt, policy.MaxRestarts)
+		utils.LogService(name, "restart", fmt.Sprintf("attempt %d in %s", attempt, backoff))
+
+		gen := sm.supervisor.generation(name)
+		select {
+		case <-time.After(backoff):
+		case <-sm.shutdown:
+			return
+		}
+		if sm.supervisor.generation(name) != gen {
+			return // stopped, started or reconfigured meanwhile
+		}
+
+		err := sm.StartService(name)
+		if err == nil {
+			return
+		}
+		if svc := sm.GetService(name); svc == nil || svc.Status == "running" {
+			return
+		}
+		reason = err.Error()
+		sm.bus.Publish(events.Event{Type: events.Exited, Service: name, Message: reason, Attempt: attempt})
+	}
+}
+
+// markCrashed leaves a service in the crashed state until it is started again
+func (sm *ServiceManager) markCrashed(name, reason string, crashLog []string, restarts int) {
+	sm.mu.Lock()
+	if svc, ok := sm.services[name]; ok {
+		svc.Status = "crashed"
+		svc.PID = 0
+		svc.LastExit = reason
+		svc.CrashLog = crashLog
+		svc.Restarts = restarts
+	}
+	sm.mu.Unlock()
+
+	message := reason
+	if restarts > 0 {
+		message = fmt.Sprintf("%s, gave up after %d restarts", reason, restarts)
+	}
+	sm.bus.Publish(events.Event{Type: events.Crashed, Service: name, Message: message, Attempt: restarts})
+	fmt.Printf("💥 Service %s crashed: %s\n", name, message)
+	utils.LogService(name, "crashed", message)
+}
+
+// logTail reads the last lines a service wrote to its log file in one run.
+// The log file is the command's stderr itself: any other writer would make
+// exec copy the output, and cmd.Wait would wait for worker processes that
+// inherited stderr instead of for the service.
+type logTail struct {
+	path   string
+	offset int64 // size of the log file when the run started
+}
+
+// newLogTail starts a tail at the current end of an open log file
+func newLogTail(f *os.File) *logTail {
+	if f == nil {
+		return nil
+	}
+	tail := &logTail{path: f.Name()}
+	if info, err := f.Stat(); err == nil {
+		tail.offset = info.Size()
+	}
+	return tail
+}
+
+// Lines returns up to crashLogLines lines written since the run started
+func (t *logTail) Lines() []string {
+	if t == nil {
+		return nil
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	// The last lines are in the final part of the file
+	const window = 64 * 1024
+	start := t.offset
+	if info, err := f.Stat(); err == nil && info.Size()-start > window {
+		start = info.Size() - window
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+	if start > t.offset {
+		// Skip the line the window starts in the middle of
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	tail := &tailBuffer{max: crashLogLines}
+	tail.Write(data)
+	return tail.Lines()
+}
+
+// tailBuffer keeps the last lines written to it
+type tailBuffer struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partial.Write(p)
+	for {
+		line, err := t.partial.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			t.partial.Reset()
+			t.partial.WriteString(line)
+			break
+		}
+		t.lines = append(t.lines, strings.TrimRight(line, "\r\n"))
+		if len(t.lines) > t.max {
+			t.lines = t.lines[len(t.lines)-t.max:]
+		}
+	}
+	return len(p), nil
+}
+
+// Lines returns the captured lines, including an unterminated last one
+func (t *tailBuffer) Lines() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lines := append([]string(nil), t.lines...)
+	if t.partial.Len() > 0 {
+		lines = append(lines, t.partial.String())
+	}
+	if len(lines) > t.max {
+		lines = lines[len(lines)-t.max:]
+	}
+	return lines
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var configTemplates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+// Markers around the part of a generated config that belongs to the user
+const (
+	overridesStart = "# >>> your overrides"
+	overridesEnd   = "# <<< end of your overrides"
+)
+
+// configData is what the config templates are rendered with
+type configData struct {
+	Name       string // service name
+	Version    string
+	Port       int
+	BaseDir    string // Stacker home
+	DataDir    string
+	InstallDir string // MariaDB install, for mysqld_safe
+	UnixSocket string // Redis socket, empty on Windows
+	HTDocs     string
+	VhostDir   string
+	MySQL      config.MySQLSettings
+	Redis      config.RedisSettings
+	Nginx      config.NginxSettings
+	Overrides  string
+}
+
+func (sm *ServiceManager) mysqlConfigData(dataDir string, port int, serviceName string) configData {
+	return configData{Name: serviceName, Port: port, DataDir: dataDir}
+}
+
+func (sm *ServiceManager) mariaDBConfigData(dataDir string, port int, serviceName string) configData {
+	data := configData{Name: serviceName, Port: port, DataDir: dataDir, InstallDir: "/usr/local"}
+	if binaryPath := sm.findMariaDBBinary(filepath.Join(sm.baseDir, "bin", "mariadb")); binaryPath != "" {
+		data.InstallDir = binaryPath
+	}
+	return data
+}
+
+func (sm *ServiceManager) redisConfigData(dataDir string, port int, serviceName string) configData {
+	data := configData{Name: serviceName, Port: port, DataDir: dataDir}
+	if runtime.GOOS != "windows" {
+		data.UnixSocket = filepath.Join(dataDir, "redis.sock")
+	}
+	return data
+}
+
+func (sm *ServiceManager) nginxConfigData(port int, version string) configData {
+	return configData{
+		Name:     "nginx-" + version,
+		Version:  version,
+		Port:     port,
+		HTDocs:   filepath.Join(sm.baseDir, "htdocs"),
+		VhostDir: filepath.Join(sm.baseDir, "conf", "nginx"),
+	}
+}
+
+// generatedConfig returns the template and data a service's config file is
+// generated from, or false for services whose config is not templated
+func (sm *ServiceManager) generatedConfig(svc *Service) (string, configData, bool) {
+	switch svc.Type {
+	case "mysql":
+		return "my.cnf.tmpl", sm.mysqlConfigData(svc.DataDir, svc.Port, svc.Name), true
+	case "mariadb":
+		return "mariadb.cnf.tmpl", sm.mariaDBConfigData(svc.DataDir, svc.Port, svc.Name), true
+	case "redis":
+		return "redis.conf.tmpl", sm.redisConfigData(svc.DataDir, svc.Port, svc.Name), true
+	case "nginx":
+		return "nginx.conf.tmpl", sm.nginxConfigData(svc.Port, svc.Version), true
+	}
+	return "", configData{}, false
+}
+
+// renderConfig renders a config template with the given settings and
+// overrides block
+func (sm *ServiceManager) renderConfig(name string, data configData, settings config.ServiceSettings, overrides string) (string, error) {
+	settings = withDefaults(settings)
+	data.BaseDir = sm.baseDir
+	data.MySQL, data.Redis, data.Nginx = *settings.MySQL, *settings.Redis, *settings.Nginx
+	data.Overrides = overrides
+
+	var b strings.Builder
+	if err := configTemplates.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// currentOverrides returns the overrides block of configFile. A config written
+// before the block existed has none: the lines it changes from the generated
+// config become its overrides block instead, so hand edits survive the first
+// regeneration.
+func (sm *ServiceManager) currentOverrides(configFile, name string, data configData) (string, error) {
+	existing, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", nil
+	}
+	if hasOverridesBlock(string(existing)) {
+		return userOverrides(existing), nil
+	}
+	fresh, err := sm.renderConfig(name, data, config.GetPreferences().ServiceSettings[data.Name], "")
+	if err != nil {
+		return "", err
+	}
+	return configEdits(name, fresh, string(existing), false)
+}
+
+// generatedContent turns content saved for a templated config into the
+// config as Stacker generates it, moving lines changed outside the overrides
+// block into it, so the next regeneration keeps them. Changes the block
+// cannot carry are refused. Content without the block, such as a version kept
+// from before it existed, is taken over as on the first regeneration. moved
+// reports whether lines were moved.
+func (sm *ServiceManager) generatedContent(svc *Service, content string) (generated string, moved bool, err error) {
+	name, data, ok := sm.generatedConfig(svc)
+	if !ok {
+		return content, false, nil
+	}
+	settings := config.GetPreferences().ServiceSettings[data.Name]
+	overrides := ""
+	if hasOverridesBlock(content) {
+		overrides = userOverrides([]byte(content))
+	}
+	fresh, err := sm.renderConfig(name, data, settings, overrides)
+	if err != nil {
+		return "", false, err
+	}
+	edits, err := configEdits(name, fresh, content, hasOverridesBlock(content))
+	if err != nil || edits == "" {
+		return fresh, false, err
+	}
+	generated, err = sm.renderConfig(name, data, settings, overrides+edits)
+	return generated, true, err
+}
+
+// writeConfig regenerates a config file from its template and the stored
+// settings of the service. A config from before the overrides block whose
+// edits cannot be carried into one is left as it is.
+func (sm *ServiceManager) writeConfig(configFile, name string, data configData) error {
+	overrides, err := sm.currentOverrides(configFile, name, data)
+	if err != nil {
+		utils.LogWarn(fmt.Sprintf("Left %s as it is: %v. Move your changes into the overrides block of a generated config to have it regenerated.", configFile, err))
+		return nil
+	}
+	content, err := sm.renderConfig(name, data, config.GetPreferences().ServiceSettings[data.Name], overrides)
+	if err != nil {
+		return err
+	}
+
+	// Keep a config from before the overrides block once, as it was
+	if existing, err := os.ReadFile(configFile); err == nil && !hasOverridesBlock(string(existing)) && overrides != "" {
+		os.WriteFile(configFile+".orig", existing, 0644)
+		utils.LogInfo(fmt.Sprintf("Moved the changes in %s into its overrides block; the original is kept as %s.orig", configFile, filepath.Base(configFile)))
+	}
+	os.MkdirAll(filepath.Dir(configFile), 0755)
+	return os.WriteFile(configFile, []byte(content), 0644)
+}
+
+// writeStaticConfig copies an embedded file such as mime.types into configDir
+func writeStaticConfig(configDir, name string) error {
+	data, err := templateFS.ReadFile("templates/" + name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(configDir, name), data, 0644)
+}
+
+// userOverrides returns the lines between the override markers of a
+// generated config, ending in a newline, or "" when there are none
+func userOverrides(content []byte) string {
+	var b strings.Builder
+	inside := false
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, overridesStart):
+			inside = true
+		case strings.HasPrefix(line, overridesEnd):
+			return b.String()
+		case inside:
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	// An unterminated block still belongs to the user
+	return b.String()
+}
@@ -42,11 +42,13 @@ type TrayManager struct {
 	shutdownTimeout  time.Duration
 }
 
-func NewTrayManager() *TrayManager {
+// NewTrayManager returns a tray acting on sm, the service manager of the web
+// server, so the process has one set of services and one event bus
+func NewTrayManager(sm *services.ServiceManager) *TrayManager {
 	return &TrayManager{
 		quitChan:         make(chan bool),
 		phpManager:       php.NewPHPManager(),
-		svcManager:       services.NewServiceManager(),
+		svcManager:       sm,
 		serviceMenuItems: make(map[string]*systray.MenuItem),
 		serviceTitles:    make(map[string]string),
 		shutdownTimeout:  10 * time.Second,
@@ -66,10 +68,17 @@ func (tm *TrayManager) onReady() {
 	systray.SetTitle("")
 	systray.SetTooltip("Stacker - PHP Development Environment")
 
-	tm.svcManager.OnStatusChange = func() {
-		tm.updateServiceStatus()
-		tm.updateIconByStatus()
-	}
+	// Refresh the menu and icon on every service event except install steps
+	go func() {
+		ch := tm.svcManager.EventBus().Subscribe()
+		for event := range ch {
+			if event.Transient() {
+				continue
+			}
+			tm.updateServiceStatus()
+			tm.updateIconByStatus()
+		}
+	}()
 
 	// Auto-start services if enabled
 	prefs := config.GetPreferences()
@@ -12,13 +12,15 @@ import (
 )
 
 type TrayManager struct {
-	webURL   string
-	quitChan chan bool
+	webURL     string
+	quitChan   chan bool
+	svcManager *services.ServiceManager
 }
 
-func NewTrayManager() *TrayManager {
+func NewTrayManager(sm *services.ServiceManager) *TrayManager {
 	return &TrayManager{
-		quitChan: make(chan bool),
+		quitChan:   make(chan bool),
+		svcManager: sm,
 	}
 }
 
@@ -46,7 +48,7 @@ func OpenBrowser(url string) {
 	cmd.Start()
 }
 
-// GetServiceManager returns nil for no-tray builds
+// GetServiceManager returns the service manager the tray was created with
 func (tm *TrayManager) GetServiceManager() *services.ServiceManager {
-	return nil
+	return tm.svcManager
 }
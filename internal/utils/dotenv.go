@@ -0,0 +1,45 @@
+package utils
+
+import "strings"
+
+// envEscaper and envUnescaper convert the escapes of double-quoted .env
+// values, as dotenv reads them. Backslashes are escaped too, so a value
+// containing \n or \" comes back as written.
+var (
+	envEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	envUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n")
+)
+
+// ParseEnvLine splits a KEY=VALUE line of a .env file. Comments, blank lines
+// and lines without "=" report false. An export prefix is dropped and
+// surrounding quotes are removed, unescaping double-quoted values.
+func ParseEnvLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(strings.TrimRight(line, "\r"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	line = strings.TrimPrefix(line, "export ")
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			value = envUnescaper.Replace(value[1 : len(value)-1])
+		} else {
+			value = value[1 : len(value)-1]
+		}
+	}
+	return key, value, key != ""
+}
+
+// QuoteEnvValue returns a value as written to a .env file, double-quoted
+// when it contains spaces, quotes, "#" or newlines
+func QuoteEnvValue(value string) string {
+	if strings.ContainsAny(value, " #\"'\t\n") {
+		return `"` + envEscaper.Replace(value) + `"`
+	}
+	return value
+}
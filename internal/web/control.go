@@ -0,0 +1,339 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/control"
+	"github.com/yasinkuyu/Stacker/internal/events"
+	"github.com/yasinkuyu/Stacker/internal/project"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// ControlService is the service state returned by services.list
+type ControlService struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	Port    int    `json:"port"`
+	Status  string `json:"status"`
+	PID     int    `json:"pid,omitempty"`
+}
+
+// ControlName is the argument of methods acting on a single service or site
+type ControlName struct {
+	Name string `json:"name"`
+}
+
+// ControlInstall is the argument of services.install
+type ControlInstall struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+}
+
+// ControlCustomService is the argument of services.custom.add
+type ControlCustomService struct {
+	Name    string               `json:"name"`
+	Service config.CustomService `json:"service"`
+}
+
+// ControlInstance is the argument of services.instances.add
+type ControlInstance struct {
+	Name    string `json:"name"`
+	Service string `json:"service"`
+	Port    int    `json:"port,omitempty"`
+}
+
+// ControlServiceConfig is the argument of the services.config methods.
+// Version 0 is the config file on disk.
+type ControlServiceConfig struct {
+	Name    string `json:"name"`
+	Content string `json:"content,omitempty"`
+	Version int    `json:"version,omitempty"`
+	From    int    `json:"from,omitempty"`
+	To      int    `json:"to,omitempty"`
+}
+
+// ControlProject is the argument of project.up and project.down
+type ControlProject struct {
+	Path    string `json:"path"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// startControlServer exposes the running instance on the control socket so
+// CLI commands act on it instead of starting a second service manager.
+func (ws *WebServer) startControlServer() {
+	cs := control.NewServer()
+
+	cs.Handle("ping", func(args json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"pid": os.Getpid()}, nil
+	})
+
+	cs.Handle("services.list", func(args json.RawMessage) (interface{}, error) {
+		var result []ControlService
+		for _, svc := range ws.serviceManager.GetServices() {
+			result = append(result, ControlService{
+				Name:    svc.Name,
+				Type:    svc.Type,
+				Version: svc.Version,
+				Port:    svc.Port,
+				Status:  svc.Status,
+				PID:     svc.PID,
+			})
+		}
+		return result, nil
+	})
+	cs.Handle("services.status", func(args json.RawMessage) (interface{}, error) {
+		return ws.serviceManager.FormatStatus(), nil
+	})
+	cs.Handle("services.start", ws.controlService(ws.serviceManager.StartWithDependencies))
+	cs.Handle("services.stop", ws.controlService(ws.serviceManager.StopService))
+	cs.Handle("services.restart", ws.controlService(ws.serviceManager.RestartService))
+	cs.Handle("services.reload", ws.controlService(ws.serviceManager.ReloadService))
+	cs.Handle("services.config.get", func(args json.RawMessage) (interface{}, error) {
+		req, err := serviceConfigArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return ws.serviceManager.ConfigAtVersion(req.Name, req.Version)
+	})
+	cs.Handle("services.config.save", func(args json.RawMessage) (interface{}, error) {
+		req, err := serviceConfigArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ws.serviceManager.SaveServiceConfig(req.Name, req.Content)
+	})
+	cs.Handle("services.config.validate", func(args json.RawMessage) (interface{}, error) {
+		req, err := serviceConfigArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ws.serviceManager.ValidateServiceConfig(req.Name, req.Content)
+	})
+	cs.Handle("services.config.history", func(args json.RawMessage) (interface{}, error) {
+		req, err := serviceConfigArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return ws.serviceManager.ConfigHistory(req.Name)
+	})
+	cs.Handle("services.config.diff", func(args json.RawMessage) (interface{}, error) {
+		req, err := serviceConfigArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return ws.serviceManager.DiffServiceConfig(req.Name, req.From, req.To)
+	})
+	cs.Handle("services.config.restore", func(args json.RawMessage) (interface{}, error) {
+		req, err := serviceConfigArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ws.serviceManager.RestoreServiceConfig(req.Name, req.Version)
+	})
+	cs.Handle("services.uninstall", ws.controlService(ws.serviceManager.UninstallService))
+	cs.Handle("services.stop-all", func(args json.RawMessage) (interface{}, error) {
+		ws.serviceManager.StopAll()
+		return nil, nil
+	})
+	cs.Handle("services.custom.list", func(args json.RawMessage) (interface{}, error) {
+		return ws.serviceManager.CustomServices(), nil
+	})
+	cs.Handle("services.custom.add", func(args json.RawMessage) (interface{}, error) {
+		var req ControlCustomService
+		if err := json.Unmarshal(args, &req); err != nil || req.Name == "" {
+			return nil, fmt.Errorf("service name is required")
+		}
+		return nil, ws.serviceManager.AddCustomService(req.Name, req.Service)
+	})
+	cs.Handle("services.custom.remove", ws.controlService(ws.serviceManager.RemoveCustomService))
+	cs.Handle("services.instances.list", func(args json.RawMessage) (interface{}, error) {
+		return ws.instanceInfos(), nil
+	})
+	cs.Handle("services.instances.add", func(args json.RawMessage) (interface{}, error) {
+		var req ControlInstance
+		if err := json.Unmarshal(args, &req); err != nil || req.Name == "" || req.Service == "" {
+			return nil, fmt.Errorf("instance name and service are required")
+		}
+		svc, err := ws.serviceManager.AddInstance(req.Name, req.Service, req.Port)
+		if err != nil {
+			return nil, err
+		}
+		return ws.serviceManager.ConnectionInfo(svc.Name)
+	})
+	cs.Handle("services.instances.remove", ws.controlService(ws.serviceManager.RemoveInstance))
+	cs.Handle("services.connection", func(args json.RawMessage) (interface{}, error) {
+		var req ControlName
+		if err := json.Unmarshal(args, &req); err != nil || req.Name == "" {
+			return nil, fmt.Errorf("service name is required")
+		}
+		return ws.serviceManager.ConnectionInfo(req.Name)
+	})
+	cs.Handle("services.top", func(args json.RawMessage) (interface{}, error) {
+		return ws.serviceManager.DetailedStatuses(), nil
+	})
+	cs.Handle("services.events", func(args json.RawMessage) (interface{}, error) {
+		var req ControlName
+		json.Unmarshal(args, &req)
+		return ws.serviceManager.Events(req.Name), nil
+	})
+	cs.Handle("events.list", func(args json.RawMessage) (interface{}, error) {
+		var filter events.Filter
+		json.Unmarshal(args, &filter)
+		return ws.serviceManager.EventBus().History(filter), nil
+	})
+	cs.Handle("events.webhooks.list", func(args json.RawMessage) (interface{}, error) {
+		return events.Webhooks(), nil
+	})
+	cs.Handle("events.webhooks.add", func(args json.RawMessage) (interface{}, error) {
+		var hook config.EventWebhook
+		if err := json.Unmarshal(args, &hook); err != nil || hook.URL == "" {
+			return nil, fmt.Errorf("webhook URL is required")
+		}
+		return nil, events.AddWebhook(hook)
+	})
+	cs.Handle("events.webhooks.remove", func(args json.RawMessage) (interface{}, error) {
+		var hook config.EventWebhook
+		if err := json.Unmarshal(args, &hook); err != nil || hook.URL == "" {
+			return nil, fmt.Errorf("webhook URL is required")
+		}
+		return nil, events.RemoveWebhook(hook.URL)
+	})
+	cs.Handle("services.install", func(args json.RawMessage) (interface{}, error) {
+		var req ControlInstall
+		if err := json.Unmarshal(args, &req); err != nil || req.Type == "" || req.Version == "" {
+			return nil, fmt.Errorf("type and version are required")
+		}
+		return nil, ws.serviceManager.InstallService(req.Type, req.Version)
+	})
+
+	cs.Handle("php.list", func(args json.RawMessage) (interface{}, error) {
+		ws.phpManager.DetectPHPVersions()
+		return ws.phpManager.FormatVersions(), nil
+	})
+	cs.Handle("php.set", func(args json.RawMessage) (interface{}, error) {
+		var req struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(args, &req); err != nil || req.Version == "" {
+			return nil, fmt.Errorf("version is required")
+		}
+		ws.phpManager.DetectPHPVersions()
+		if err := ws.phpManager.SetDefault(req.Version); err != nil {
+			return nil, err
+		}
+		os.WriteFile(filepath.Join(ws.stackerDir, "php_default.txt"), []byte(req.Version), 0644)
+		utils.LogInfo(fmt.Sprintf("PHP default version changed to %s", req.Version))
+		return nil, nil
+	})
+
+	cs.Handle("sites.add", func(args json.RawMessage) (interface{}, error) {
+		var site config.Site
+		if err := json.Unmarshal(args, &site); err != nil || site.Name == "" {
+			return nil, fmt.Errorf("site name is required")
+		}
+		site, err := ws.sites.Register(site)
+		if err != nil {
+			return nil, err
+		}
+		if site.PHP != "" {
+			ws.phpManager.PinSite(site.Name, site.PHP)
+		}
+		ws.reloadWebServers()
+		return site, nil
+	})
+	cs.Handle("sites.remove", func(args json.RawMessage) (interface{}, error) {
+		var req ControlName
+		if err := json.Unmarshal(args, &req); err != nil || req.Name == "" {
+			return nil, fmt.Errorf("site name is required")
+		}
+		site, err := ws.sites.Unregister(req.Name)
+		if err != nil {
+			return nil, err
+		}
+		ws.phpManager.UnpinSite(site.Name)
+		ws.reloadWebServers()
+		return site, nil
+	})
+
+	cs.Handle("sites.snippets", func(args json.RawMessage) (interface{}, error) {
+		var req ControlName
+		if err := json.Unmarshal(args, &req); err != nil || req.Name == "" {
+			return nil, fmt.Errorf("site name is required")
+		}
+		return ws.sites.Snippets(config.SiteHost(req.Name)), nil
+	})
+	cs.Handle("sites.snippet", func(args json.RawMessage) (interface{}, error) {
+		var req SiteSnippet
+		if err := json.Unmarshal(args, &req); err != nil || req.Site == "" {
+			return nil, fmt.Errorf("site name is required")
+		}
+		if err := ws.sites.SaveSnippet(config.SiteHost(req.Site), req.Server, req.Hook, req.Content); err != nil {
+			return nil, err
+		}
+		return nil, ws.reloadWebServers()
+	})
+
+	cs.Handle("project.up", func(args json.RawMessage) (interface{}, error) {
+		var req ControlProject
+		if err := json.Unmarshal(args, &req); err != nil || req.Path == "" {
+			return nil, fmt.Errorf("project path is required")
+		}
+		state, err := ws.projectStack().Up(req.Path, req.Profile)
+		ws.reloadWebServers()
+		if err != nil {
+			return nil, err
+		}
+		return state, nil
+	})
+	cs.Handle("project.down", func(args json.RawMessage) (interface{}, error) {
+		var req ControlProject
+		if err := json.Unmarshal(args, &req); err != nil || req.Path == "" {
+			return nil, fmt.Errorf("project path is required")
+		}
+		return ws.projectStack().Down(req.Path)
+	})
+
+	if err := cs.Start(); err != nil {
+		fmt.Printf("⚠️ Control socket disabled: %v\n", err)
+		return
+	}
+	ws.control = cs
+}
+
+// controlService adapts a ServiceManager method taking a service name
+func (ws *WebServer) controlService(fn func(string) error) control.HandlerFunc {
+	return func(args json.RawMessage) (interface{}, error) {
+		var req ControlName
+		if err := json.Unmarshal(args, &req); err != nil || req.Name == "" {
+			return nil, fmt.Errorf("service name is required")
+		}
+		return nil, fn(req.Name)
+	}
+}
+
+// serviceConfigArgs decodes the argument of the services.config methods
+func serviceConfigArgs(args json.RawMessage) (ControlServiceConfig, error) {
+	var req ControlServiceConfig
+	if err := json.Unmarshal(args, &req); err != nil || req.Name == "" {
+		return req, fmt.Errorf("service name is required")
+	}
+	return req, nil
+}
+
+// projectStack brings projects up and down on this instance's managers
+func (ws *WebServer) projectStack() *project.Stack {
+	return project.NewStack(ws.serviceManager, ws.fpmManager, ws.phpManager, ws.sites)
+}
+
+// Close releases the control socket so CLI commands fall back to direct mode
+func (ws *WebServer) Close() {
+	if ws.control != nil {
+		ws.control.Stop()
+		ws.control = nil
+	}
+}
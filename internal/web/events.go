@@ -0,0 +1,134 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/events"
+)
+
+// eventFilter reads ?service=, ?type= (comma separated), ?after= and ?limit=
+func eventFilter(r *http.Request) events.Filter {
+	q := r.URL.Query()
+	filter := events.Filter{Service: q.Get("service")}
+	for _, t := range strings.Split(q.Get("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.Types = append(filter.Types, events.Type(t))
+		}
+	}
+	filter.After, _ = strconv.ParseInt(q.Get("after"), 10, 64)
+	filter.Limit, _ = strconv.Atoi(q.Get("limit"))
+	return filter
+}
+
+// handleEvents returns the kept service events, oldest first
+func (ws *WebServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.serviceManager.EventBus().History(eventFilter(r)))
+}
+
+// handleEventStream streams service events as server-sent events. A client
+// that reconnects with Last-Event-ID, or passes ?after=, first receives the
+// kept events it missed.
+func (ws *WebServer) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	filter := eventFilter(r)
+	filter.Limit = 0
+	if id, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		filter.After = id
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	bus := ws.serviceManager.EventBus()
+	ch := bus.Subscribe()
+	defer bus.Unsubscribe(ch)
+
+	send := func(event events.Event) {
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, toJSON(event))
+	}
+
+	last := filter.After
+	if filter.After > 0 {
+		for _, event := range bus.History(filter) {
+			send(event)
+			last = event.ID
+		}
+	}
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			// Skip events already replayed from the history. Transient events
+			// carry the ID of the last kept one and are never replayed.
+			if !event.Transient() && event.ID <= last {
+				continue
+			}
+			matcher := filter
+			matcher.After = 0
+			if !matcher.Match(event) {
+				continue
+			}
+			send(event)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleEventWebhooks lists (GET), adds or replaces (POST) and removes
+// (DELETE ?url=) the local URLs that events are posted to
+func (ws *WebServer) handleEventWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(events.Webhooks())
+	case "POST":
+		var hook config.EventWebhook
+		if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := events.AddWebhook(hook); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(events.Webhooks())
+	case "DELETE":
+		if err := events.RemoveWebhook(r.URL.Query().Get("url")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(events.Webhooks())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Frameworks with a server config preset
+const (
+	FrameworkLaravel   = "laravel"
+	FrameworkSymfony   = "symfony"
+	FrameworkWordPress = "wordpress"
+	FrameworkDrupal    = "drupal"
+	FrameworkMagento   = "magento"
+	FrameworkCraftCMS  = "craftcms"
+	FrameworkStatic    = "static"
+	FrameworkSPA       = "spa"
+	FrameworkPHP       = "php" // generic PHP project with a front controller
+)
+
+// Frameworks lists every preset, used to validate overrides
+var Frameworks = []string{
+	FrameworkLaravel, FrameworkSymfony, FrameworkWordPress, FrameworkDrupal,
+	FrameworkMagento, FrameworkCraftCMS, FrameworkStatic, FrameworkSPA, FrameworkPHP,
+}
+
+// Framework is what a site's files look like to the web server
+type Framework struct {
+	Name    string `json:"name"`
+	DocRoot string `json:"docRoot"` // absolute document root
+	Index   string `json:"index"`   // front controller, e.g. index.php or index.html
+
+	// WordPress multisite
+	Multisite bool `json:"multisite,omitempty"`
+	Subdomain bool `json:"subdomain,omitempty"`
+}
+
+// UsesPHP reports whether requests are handed to PHP-FPM
+func (f Framework) UsesPHP() bool {
+	return f.Name != FrameworkStatic && f.Name != FrameworkSPA
+}
+
+var (
+	wpMultisitePattern = regexp.MustCompile(`(?i)define\(\s*['"]MULTISITE['"]\s*,\s*true\s*\)`)
+	wpSubdomainPattern = regexp.MustCompile(`(?i)define\(\s*['"]SUBDOMAIN_INSTALL['"]\s*,\s*true\s*\)`)
+)
+
+// DetectFramework inspects a project directory. override forces a preset
+// (the document root is still detected); an unknown override is ignored.
+func DetectFramework(path, override string) Framework {
+	fw := detectFramework(path)
+	if override == "" || override == fw.Name || !isFramework(override) {
+		return fw
+	}
+
+	fw.Name = override
+	fw.Multisite, fw.Subdomain = false, false
+	fw.Index = "index.php"
+	if !fw.UsesPHP() {
+		fw.Index = "index.html"
+	}
+	if override == FrameworkWordPress {
+		fw.Multisite, fw.Subdomain = wordpressMultisite(fw.DocRoot)
+	}
+	return fw
+}
+
+func isFramework(name string) bool {
+	for _, f := range Frameworks {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func detectFramework(path string) Framework {
+	has := func(rel ...string) bool {
+		_, err := os.Stat(filepath.Join(append([]string{path}, rel...)...))
+		return err == nil
+	}
+	fw := func(name string, docRoot ...string) Framework {
+		return Framework{Name: name, DocRoot: filepath.Join(append([]string{path}, docRoot...)...), Index: "index.php"}
+	}
+
+	switch {
+	case has("artisan") && has("public"):
+		return fw(FrameworkLaravel, "public")
+
+	case has("bin", "magento"):
+		if has("pub") {
+			return fw(FrameworkMagento, "pub")
+		}
+		return fw(FrameworkMagento)
+
+	case has("craft") && has("web"):
+		return fw(FrameworkCraftCMS, "web")
+
+	case has("bin", "console") && has("public", "index.php"):
+		return fw(FrameworkSymfony, "public")
+	case has("bin", "console") && has("web", "app.php"):
+		// Symfony 2/3
+		f := fw(FrameworkSymfony, "web")
+		f.Index = "app.php"
+		return f
+
+	case has("web", "core", "lib", "Drupal.php"):
+		return fw(FrameworkDrupal, "web")
+	case has("docroot", "core", "lib", "Drupal.php"):
+		return fw(FrameworkDrupal, "docroot")
+	case has("core", "lib", "Drupal.php"):
+		return fw(FrameworkDrupal)
+	}
+
+	// WordPress, plain or in a public folder; Bedrock keeps core in web/wp
+	for _, dir := range []string{"", "web", "public", "public_html"} {
+		if has(dir, "wp-config.php") || has(dir, "wp-load.php") || has(dir, "wp", "wp-load.php") {
+			f := fw(FrameworkWordPress, dir)
+			if dir == "" && has("web", "wp") {
+				f.DocRoot = filepath.Join(path, "web")
+			}
+			f.Multisite, f.Subdomain = wordpressMultisite(path, f.DocRoot)
+			return f
+		}
+	}
+
+	docRoot := path
+	for _, dir := range []string{"public", "public_html", "web", "htdocs"} {
+		if has(dir) {
+			docRoot = filepath.Join(path, dir)
+			break
+		}
+	}
+	if containsPHP(docRoot) || (docRoot == path && containsPHP(path)) {
+		return Framework{Name: FrameworkPHP, DocRoot: docRoot, Index: "index.php"}
+	}
+
+	// No PHP: a JavaScript build is served as a single page app
+	if isJavaScriptProject(path) {
+		for _, dir := range []string{"dist", "build", "out", "public"} {
+			if has(dir, "index.html") {
+				return Framework{Name: FrameworkSPA, DocRoot: filepath.Join(path, dir), Index: "index.html"}
+			}
+		}
+		if has("index.html") {
+			return Framework{Name: FrameworkSPA, DocRoot: path, Index: "index.html"}
+		}
+	}
+	for _, index := range []string{"index.html", "index.htm"} {
+		if _, err := os.Stat(filepath.Join(docRoot, index)); err == nil {
+			return Framework{Name: FrameworkStatic, DocRoot: docRoot, Index: index}
+		}
+	}
+
+	// Empty or new projects get the generic PHP preset
+	return Framework{Name: FrameworkPHP, DocRoot: docRoot, Index: "index.php"}
+}
+
+// wordpressMultisite reads MULTISITE and SUBDOMAIN_INSTALL from the first
+// wp-config.php found in dirs or their parents (WordPress looks one level up)
+func wordpressMultisite(dirs ...string) (multisite, subdomain bool) {
+	for _, dir := range dirs {
+		for _, candidate := range []string{filepath.Join(dir, "wp-config.php"), filepath.Join(filepath.Dir(dir), "wp-config.php")} {
+			data, err := os.ReadFile(candidate)
+			if err != nil {
+				continue
+			}
+			return wpMultisitePattern.Match(data), wpSubdomainPattern.Match(data)
+		}
+	}
+	return false, false
+}
+
+// containsPHP reports whether dir directly contains a .php file
+func containsPHP(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.php"))
+	return len(matches) > 0
+}
+
+// isJavaScriptProject reports whether package.json uses a front-end build
+func isJavaScriptProject(path string) bool {
+	data, err := os.ReadFile(filepath.Join(path, "package.json"))
+	if err != nil {
+		return false
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return false
+	}
+	_, build := pkg.Scripts["build"]
+	return build || strings.Contains(string(data), "\"react") || strings.Contains(string(data), "\"vue")
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/yasinkuyu/Stacker/internal/services"
+)
+
+// ServiceInstanceInfo is a named instance with its connection details
+type ServiceInstanceInfo struct {
+	Name       string                   `json:"name"`
+	Service    string                   `json:"service"`
+	Connection *services.ConnectionInfo `json:"connection,omitempty"`
+}
+
+// instanceInfos lists the named instances, sorted by name
+func (ws *WebServer) instanceInfos() []ServiceInstanceInfo {
+	result := []ServiceInstanceInfo{}
+	for name, inst := range ws.serviceManager.Instances() {
+		info := ServiceInstanceInfo{Name: name, Service: inst.Service}
+		info.Connection, _ = ws.serviceManager.ConnectionInfo(name)
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// handleServiceInstances lists and creates named instances on
+// /api/services/instances and removes one on /api/services/instances/<name>
+func (ws *WebServer) handleServiceInstances(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/services/instances"), "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == "GET" && name == "":
+		json.NewEncoder(w).Encode(ws.instanceInfos())
+
+	case r.Method == "POST" && name == "":
+		var req ControlInstance
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		svc, err := ws.serviceManager.AddInstance(req.Name, req.Service, req.Port)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn, _ := ws.serviceManager.ConnectionInfo(svc.Name)
+		json.NewEncoder(w).Encode(ServiceInstanceInfo{Name: svc.Name, Service: svc.Instance, Connection: conn})
+
+	case r.Method == "DELETE" && name != "":
+		if err := ws.serviceManager.RemoveInstance(name); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "removed"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleServiceConnection returns how to connect to any service:
+// /api/services/connection/<name>
+func (ws *WebServer) handleServiceConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	info, err := ws.serviceManager.ConnectionInfo(strings.TrimPrefix(r.URL.Path, "/api/services/connection/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// localHosts are the host names the dashboard answers to
+var localHosts = map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+
+// originExempt are endpoints that pages of local sites post to from their own
+// origin, and that cannot change any state beyond what they record
+var originExempt = map[string]bool{"/api/dumps/ingest": true}
+
+// localOnly guards the dashboard API against other web pages and rebound DNS
+// names: the Host must be a loopback name on the dashboard port, and requests
+// that change state are refused when the browser says they come from another
+// origin.
+func localOnly(port int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLocalHost(r.Host, port) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+		default:
+			if !originExempt[r.URL.Path] && !sameOrigin(r, port) {
+				http.Error(w, "Cross-origin request refused", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLocalHost reports whether hostport names this dashboard on a loopback name
+func isLocalHost(hostport string, port int) bool {
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return false
+	}
+	return localHosts[host] && p == strconv.Itoa(port)
+}
+
+// sameOrigin reports whether a request comes from the dashboard itself or from
+// a client that is not a browser. Browsers send Origin on every cross-origin
+// POST, so a missing header means a local tool such as curl.
+func sameOrigin(r *http.Request, port int) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != "http" {
+		return false
+	}
+	return isLocalHost(u.Host, port)
+}
@@ -0,0 +1,145 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+)
+
+// handleServiceConfigHistory serves the history of a service's config file
+// below /api/services/config/<name>/:
+//
+//	GET  history            kept versions, oldest first
+//	GET  history/<version>  content of a version
+//	GET  diff?from=&to=     unified diff, version 0 being the file on disk
+//	POST restore            {"version": n}
+//	POST validate           {"content": "..."} checked without saving
+func (ws *WebServer) handleServiceConfigHistory(w http.ResponseWriter, r *http.Request, name string, path []string) {
+	w.Header().Set("Content-Type", "application/json")
+	sm := ws.serviceManager
+
+	switch path[0] {
+	case "history":
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(path) > 1 && path[1] != "" {
+			version, err := strconv.Atoi(path[1])
+			if err != nil {
+				http.Error(w, "Invalid version", http.StatusBadRequest)
+				return
+			}
+			content, err := sm.ConfigAtVersion(name, version)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "version": version, "content": content})
+			return
+		}
+		versions, err := sm.ConfigHistory(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(versions)
+
+	case "diff":
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		from, err1 := strconv.Atoi(r.URL.Query().Get("from"))
+		to, err2 := strconv.Atoi(r.URL.Query().Get("to"))
+		if err1 != nil || (err2 != nil && r.URL.Query().Get("to") != "") {
+			http.Error(w, "from is required, from and to must be versions", http.StatusBadRequest)
+			return
+		}
+		diff, err := sm.DiffServiceConfig(name, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "from": from, "to": to, "diff": diff})
+
+	case "restore":
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Version int `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := sm.RestoreServiceConfig(name, req.Version); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "restored", "name": name, "version": req.Version})
+
+	case "validate":
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Content string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := sm.ValidateServiceConfig(name, req.Content); err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"valid": false, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"valid": true})
+
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// handleServiceSettings reads (GET) and changes (PUT or POST) the settings a
+// service's config is generated from, such as {"mysql": {"bufferPoolSize":
+// "512M"}}. Empty fields take the defaults. A change regenerates the config,
+// keeping its overrides block, and applies it like a saved config.
+func (ws *WebServer) handleServiceSettings(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/services/settings/")
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+	case "PUT", "POST":
+		var settings config.ServiceSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := ws.serviceManager.SetServiceSettings(name, settings); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := ws.serviceManager.GetServiceSettings(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(settings)
+}
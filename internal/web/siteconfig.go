@@ -0,0 +1,683 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/php"
+	"github.com/yasinkuyu/Stacker/internal/services"
+	"github.com/yasinkuyu/Stacker/internal/ssl"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// SiteConfigurator registers sites and writes their nginx/apache configs.
+// The web UI and the CLI both use it so a site gets the same setup no matter
+// where it was added.
+type SiteConfigurator struct {
+	stackerDir     string
+	serviceManager *services.ServiceManager // optional, used to find running PHP services
+}
+
+// NewSiteConfigurator creates a configurator. sm may be nil outside the web server.
+func NewSiteConfigurator(sm *services.ServiceManager) *SiteConfigurator {
+	return &SiteConfigurator{
+		stackerDir:     utils.GetStackerDir(),
+		serviceManager: sm,
+	}
+}
+
+// Register adds a site to the registry: the name gets the domain extension,
+// an empty path defaults to the Stacker sites folder, an SSL certificate is
+// created if requested and the server configs are written.
+func (sc *SiteConfigurator) Register(site Site) (Site, error) {
+	site.Name = config.SiteHost(site.Name)
+	if site.Framework != "" && !isFramework(site.Framework) {
+		return site, fmt.Errorf("unknown framework %q, expected one of %s", site.Framework, strings.Join(Frameworks, ", "))
+	}
+
+	// Create site directory in the Stacker data folder (use full domain name)
+	sitePath := filepath.Join(sc.stackerDir, "sites", site.Name)
+	if site.Path == "" {
+		site.Path = sitePath
+	}
+	os.MkdirAll(sitePath, 0755)
+
+	// Generate SSL certificate if SSL is enabled
+	if site.SSL {
+		if err := sc.EnsureSSLCertificate(site.Name); err != nil {
+			fmt.Printf("⚠️ Failed to generate SSL certificate: %v\n", err)
+			// Don't fail the registration, just disable SSL
+			site.SSL = false
+		}
+	}
+
+	site, err := config.GetSiteRegistry().Add(site)
+	if err != nil {
+		return site, err
+	}
+	if err := sc.WriteConfig(site); err != nil {
+		config.GetSiteRegistry().Remove(site.Name)
+		return site, fmt.Errorf("failed to create site config: %w", err)
+	}
+	return site, nil
+}
+
+// Update replaces a registered site and rewrites its configs
+func (sc *SiteConfigurator) Update(name string, site Site) error {
+	if site.Framework != "" && !isFramework(site.Framework) {
+		return fmt.Errorf("unknown framework %q, expected one of %s", site.Framework, strings.Join(Frameworks, ", "))
+	}
+	if site.SSL {
+		if err := sc.EnsureSSLCertificate(config.SiteHost(site.Name)); err != nil {
+			fmt.Printf("⚠️ Failed to generate SSL certificate: %v\n", err)
+			site.SSL = false
+		}
+	}
+	if err := config.GetSiteRegistry().Update(name, site); err != nil {
+		return err
+	}
+	if updated := config.GetSiteRegistry().Get(site.Name); updated != nil {
+		if updated.Name != name {
+			sc.RemoveConfig(name)
+			os.Rename(sc.SnippetDir(name), sc.SnippetDir(updated.Name))
+		}
+		return sc.WriteConfig(*updated)
+	}
+	return nil
+}
+
+// Unregister removes a site from the registry together with its configs
+func (sc *SiteConfigurator) Unregister(name string) (*Site, error) {
+	site, err := config.GetSiteRegistry().Remove(name)
+	if err != nil {
+		return nil, err
+	}
+	sc.RemoveConfig(site.Name)
+	os.RemoveAll(sc.SnippetDir(site.Name))
+	return site, nil
+}
+
+// RemoveConfig deletes a site's nginx and apache configs
+func (sc *SiteConfigurator) RemoveConfig(name string) {
+	os.Remove(filepath.Join(sc.stackerDir, "conf", "nginx", name+".conf"))
+	os.Remove(filepath.Join(sc.stackerDir, "conf", "apache", "vhosts", name+".conf"))
+}
+
+// RegenerateAll rewrites the configs of every registered site
+func (sc *SiteConfigurator) RegenerateAll() {
+	for _, site := range config.GetSiteRegistry().List() {
+		if err := sc.WriteConfig(site); err != nil {
+			fmt.Printf("⚠️  Failed to regenerate config for %s: %v\n", site.Name, err)
+		}
+	}
+}
+
+// WriteConfig generates the nginx and apache configs for a site
+func (sc *SiteConfigurator) WriteConfig(site Site) error {
+	// Always create both Nginx and Apache configs for flexibility
+	// The "Server" field indicates which one is primary/active
+	// but both configs are generated so user can switch between them
+	if err := sc.writeNginxConfig(site); err != nil {
+		return fmt.Errorf("nginx config: %w", err)
+	}
+	if err := sc.writeApacheConfig(site); err != nil {
+		return fmt.Errorf("apache config: %w", err)
+	}
+	return nil
+}
+
+// Layout returns the framework preset of a site with its document root.
+// Sites whose path does not exist yet are served from the Stacker sites folder.
+func (sc *SiteConfigurator) Layout(site Site) (Framework, error) {
+	if _, err := os.Stat(site.Path); os.IsNotExist(err) {
+		return DetectFramework(filepath.Join(sc.stackerDir, "sites", site.Name, "public_html"), site.Framework), nil
+	} else if err != nil {
+		return Framework{}, err
+	}
+	return DetectFramework(site.Path, site.Framework), nil
+}
+
+// layoutForConfig is Layout, creating the document root if needed
+func (sc *SiteConfigurator) layoutForConfig(site Site) (Framework, error) {
+	fw, err := sc.Layout(site)
+	if err != nil {
+		return fw, err
+	}
+	return fw, os.MkdirAll(fw.DocRoot, 0755)
+}
+
+func (sc *SiteConfigurator) writeNginxConfig(site Site) error {
+	confDir := filepath.Join(sc.stackerDir, "conf", "nginx")
+	if err := os.MkdirAll(confDir, 0755); err != nil {
+		return err
+	}
+
+	// Use full domain name for config file and directory naming
+	configPath := filepath.Join(confDir, site.Name+".conf")
+
+	fw, err := sc.layoutForConfig(site)
+	if err != nil {
+		return err
+	}
+	phpPort := 0
+	if fw.UsesPHP() {
+		phpPort = sc.PHPPort(site.PHP)
+	}
+	snippets := sc.snippetIncludes(site.Name, "nginx")
+	locations := nginxLocations(fw, phpPort, snippets)
+
+	index := "index.php index.html index.htm"
+	if !fw.UsesPHP() {
+		index = "index.html index.htm"
+	} else if fw.Index != "index.php" {
+		index = fw.Index + " " + index
+	}
+	serverName := site.Name
+	if fw.Multisite && fw.Subdomain {
+		serverName += " *." + site.Name
+	}
+
+	p := config.GetPreferences()
+	nginxPort := p.NginxPort
+
+	if nginxPort == 0 {
+		nginxPort = 80
+	}
+
+	config := fmt.Sprintf(`# Stacker Site Config: %[1]s (%[7]s)
+# Generated: %[2]s
+server {
+    listen %[6]d;
+    server_name %[5]s;
+    root "%[3]s";
+    index %[4]s;
+
+    client_max_body_size 100M;
+%[8]s%[9]s}
+`, site.Name, time.Now().Format(time.RFC3339), fw.DocRoot, index, serverName, nginxPort, fw.Name, locations, snippets[SnippetServer])
+
+	// Add SSL server block if SSL is enabled
+	if site.SSL {
+		certPath := filepath.Join(sc.stackerDir, "certs", site.Name, "cert.pem")
+		keyPath := filepath.Join(sc.stackerDir, "certs", site.Name, "key.pem")
+
+		sslConfig := fmt.Sprintf(`
+server {
+    listen 443 ssl;
+    server_name %[1]s;
+    root "%[2]s";
+    index %[5]s;
+
+    ssl_certificate "%[3]s";
+    ssl_certificate_key "%[4]s";
+    ssl_protocols TLSv1.2 TLSv1.3;
+    ssl_ciphers HIGH:!aNULL:!MD5;
+
+    client_max_body_size 100M;
+%[6]s%[7]s}
+`, serverName, fw.DocRoot, certPath, keyPath, index, locations, snippets[SnippetServer])
+
+		config += sslConfig
+	}
+
+	return os.WriteFile(configPath, []byte(config), 0644)
+}
+
+// nginxLocations returns the location blocks of a framework preset with the
+// site's snippets included at the location and php hooks
+func nginxLocations(fw Framework, phpPort int, snippets map[string]string) string {
+	return strings.NewReplacer(
+		"        # hook: location\n", snippets[SnippetLocation],
+		"        # hook: php\n", snippets[SnippetPHP],
+	).Replace(nginxPreset(fw, phpPort))
+}
+
+// nginxPreset returns the location blocks of a framework preset
+func nginxPreset(fw Framework, phpPort int) string {
+	php := fmt.Sprintf(`
+    location ~ \.php$ {
+        # hook: php
+        fastcgi_pass 127.0.0.1:%d;
+        fastcgi_index index.php;
+        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+        include fastcgi_params;
+    }
+`, phpPort)
+
+	switch fw.Name {
+	case FrameworkStatic:
+		return `
+    location / {
+        # hook: location
+        try_files $uri $uri/ =404;
+    }
+
+    location ~ /\.(?!well-known) {
+        deny all;
+    }
+`
+
+	case FrameworkSPA:
+		// Unknown paths are client-side routes
+		return `
+    location / {
+        # hook: location
+        try_files $uri $uri/ /index.html;
+    }
+
+    location ~ /\.(?!well-known) {
+        deny all;
+    }
+`
+
+	case FrameworkSymfony:
+		// Only the front controller is executed
+		controller, internal := `^/index\.php(/|$)`, "\n        internal;"
+		if fw.Index == "app.php" {
+			controller, internal = `^/(app|app_dev|config)\.php(/|$)`, ""
+		}
+		return fmt.Sprintf(`
+    location / {
+        # hook: location
+        try_files $uri /%[1]s$is_args$args;
+    }
+
+    location ~ %[2]s {
+        # hook: php
+        fastcgi_pass 127.0.0.1:%[3]d;
+        fastcgi_split_path_info ^(.+\.php)(/.*)$;
+        include fastcgi_params;
+        fastcgi_param SCRIPT_FILENAME $realpath_root$fastcgi_script_name;
+        fastcgi_param DOCUMENT_ROOT $realpath_root;%[4]s
+    }
+
+    location ~ \.php$ {
+        return 404;
+    }
+`, fw.Index, controller, phpPort, internal)
+
+	case FrameworkWordPress:
+		rewrites := ""
+		if fw.Multisite && !fw.Subdomain {
+			// Subdirectory multisite: /site/wp-admin maps to /wp-admin
+			rewrites = `
+    if (!-e $request_filename) {
+        rewrite /wp-admin$ $scheme://$host$request_uri/ permanent;
+        rewrite ^(/[^/]+)?(/wp-.*) $2 last;
+        rewrite ^(/[^/]+)?(/.*\.php) $2 last;
+    }
+`
+		}
+		return rewrites + `
+    location / {
+        # hook: location
+        try_files $uri $uri/ /index.php?$args;
+    }
+
+    location ~* /(?:uploads|files)/.*\.php$ {
+        deny all;
+    }
+` + php + `
+    location ~ /\.ht {
+        deny all;
+    }
+`
+
+	case FrameworkDrupal:
+		return fmt.Sprintf(`
+    location / {
+        # hook: location
+        try_files $uri /index.php?$query_string;
+    }
+
+    location @rewrite {
+        rewrite ^ /index.php;
+    }
+
+    location ~ ^/sites/.*/files/styles/ {
+        try_files $uri @rewrite;
+    }
+
+    location ~ ^(/[a-z\-]+)?/system/files/ {
+        try_files $uri /index.php?$query_string;
+    }
+
+    location ~ ^/sites/.*/private/ {
+        return 403;
+    }
+
+    location ~ \..*/.*\.php$ {
+        return 403;
+    }
+
+    location ~ (^|/)\. {
+        return 403;
+    }
+
+    location ~ '\.php$|^/update.php' {
+        # hook: php
+        fastcgi_split_path_info ^(.+?\.php)(|/.*)$;
+        try_files $fastcgi_script_name =404;
+        include fastcgi_params;
+        fastcgi_param HTTP_PROXY "";
+        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+        fastcgi_param PATH_INFO $fastcgi_path_info;
+        fastcgi_param QUERY_STRING $query_string;
+        fastcgi_pass 127.0.0.1:%d;
+    }
+`, phpPort)
+
+	case FrameworkMagento:
+		// Condensed from Magento's nginx.conf.sample for the pub/ docroot
+		return fmt.Sprintf(`
+    location / {
+        # hook: location
+        try_files $uri $uri/ /index.php$is_args$args;
+    }
+
+    location /static/ {
+        location ~ ^/static/version\d*/ {
+            rewrite ^/static/version\d*/(.*)$ /static/$1 last;
+        }
+        if (!-f $request_filename) {
+            rewrite ^/static/?(.*)$ /static.php?resource=$1 last;
+        }
+    }
+
+    location /media/ {
+        try_files $uri $uri/ /get.php$is_args$args;
+        location ~ ^/media/theme_customization/.*\.xml {
+            deny all;
+        }
+    }
+
+    location ~ ^/media/(customer|downloadable|import)/ {
+        deny all;
+    }
+
+    location ~ ^/(index|get|static|errors/report|errors/404|errors/503|health_check)\.php$ {
+        # hook: php
+        fastcgi_pass 127.0.0.1:%d;
+        fastcgi_buffers 16 16k;
+        fastcgi_buffer_size 32k;
+        fastcgi_read_timeout 600s;
+        fastcgi_index index.php;
+        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+        include fastcgi_params;
+    }
+
+    location ~* (\.php$|\.phtml$|\.htaccess$|\.git) {
+        deny all;
+    }
+`, phpPort)
+
+	case FrameworkLaravel, FrameworkCraftCMS:
+		return `
+    location / {
+        # hook: location
+        try_files $uri $uri/ /index.php?$query_string;
+    }
+` + php + `
+    location ~ /\.(?!well-known).* {
+        deny all;
+    }
+`
+	}
+
+	// Generic PHP front controller
+	return `
+    location / {
+        # hook: location
+        try_files $uri $uri/ /index.php?$query_string;
+    }
+` + php + `
+    location ~ /\.ht {
+        deny all;
+    }
+`
+}
+
+func (sc *SiteConfigurator) writeApacheConfig(site Site) error {
+	confDir := filepath.Join(sc.stackerDir, "conf", "apache", "vhosts")
+	if err := os.MkdirAll(confDir, 0755); err != nil {
+		return err
+	}
+
+	// Use full domain name for config file and directory naming
+	configPath := filepath.Join(confDir, site.Name+".conf")
+
+	fw, err := sc.layoutForConfig(site)
+	if err != nil {
+		return err
+	}
+
+	snippets := sc.snippetIncludes(site.Name, "apache")
+	directory, handler := apachePreset(fw)+snippets[SnippetLocation], ""
+	if fw.UsesPHP() {
+		handler = fmt.Sprintf(`
+    <FilesMatch \.php$>
+        SetHandler "proxy:fcgi://127.0.0.1:%d"
+%s    </FilesMatch>
+`, sc.PHPPort(site.PHP), snippets[SnippetPHP])
+	}
+	handler += snippets[SnippetServer]
+	index := "index.php index.html index.htm"
+	if !fw.UsesPHP() {
+		index = "index.html index.htm"
+	} else if fw.Index != "index.php" {
+		index = fw.Index + " " + index
+	}
+
+	p := config.GetPreferences()
+	apachePort := p.ApachePort
+
+	if apachePort == 0 {
+		apachePort = 80
+	}
+
+	config := fmt.Sprintf(`# Stacker Site Config: %[1]s (%[7]s)
+# Generated: %[2]s
+<VirtualHost *:%[5]d>
+    ServerName %[1]s
+    ServerAlias *.%[1]s
+    DocumentRoot "%[3]s"
+    DirectoryIndex %[4]s
+    AcceptPathInfo On
+    
+    <Directory "%[3]s">%[6]s    </Directory>
+%[8]s
+    ErrorLog "${APACHE_LOG_DIR}/%[1]s-error.log"
+    CustomLog "${APACHE_LOG_DIR}/%[1]s-access.log" combined
+</VirtualHost>
+`, site.Name, time.Now().Format(time.RFC3339), fw.DocRoot, index, apachePort, directory, fw.Name, handler)
+
+	// Add SSL VirtualHost if SSL is enabled
+	if site.SSL {
+		certPath := filepath.Join(sc.stackerDir, "certs", site.Name, "cert.pem")
+		keyPath := filepath.Join(sc.stackerDir, "certs", site.Name, "key.pem")
+
+		alias := ""
+		if fw.Multisite && fw.Subdomain {
+			alias = "\n    ServerAlias *." + site.Name
+		}
+
+		sslConfig := fmt.Sprintf(`
+<VirtualHost *:443>
+    ServerName %[1]s%[7]s
+    DocumentRoot "%[2]s"
+    DirectoryIndex %[6]s
+    
+    SSLEngine on
+    SSLCertificateFile "%[3]s"
+    SSLCertificateKeyFile "%[4]s"
+    
+    <Directory "%[2]s">%[5]s    </Directory>
+%[8]s
+    ErrorLog "${APACHE_LOG_DIR}/%[1]s-ssl-error.log"
+    CustomLog "${APACHE_LOG_DIR}/%[1]s-ssl-access.log" combined
+</VirtualHost>
+`, site.Name, fw.DocRoot, certPath, keyPath, directory, index, alias, handler)
+
+		config += sslConfig
+	}
+
+	return os.WriteFile(configPath, []byte(config), 0644)
+}
+
+// apachePreset returns the <Directory> body of a framework preset. Projects
+// that ship an .htaccess still win since AllowOverride is All.
+func apachePreset(fw Framework) string {
+	directory := `
+        Options Indexes FollowSymLinks MultiViews
+        AllowOverride All
+        Require all granted
+`
+
+	switch fw.Name {
+	case FrameworkStatic:
+		return `
+        Options FollowSymLinks
+        AllowOverride All
+        Require all granted
+`
+
+	case FrameworkSPA:
+		return `
+        Options FollowSymLinks
+        AllowOverride All
+        Require all granted
+        FallbackResource /index.html
+`
+
+	case FrameworkWordPress:
+		if !fw.Multisite {
+			break
+		}
+		// WordPress multisite rewrites, as written by Network Setup
+		prefix, admin, target := `([_0-9a-zA-Z-]+/)?`, "$1", "$2"
+		if fw.Subdomain {
+			prefix, admin, target = "", "", "$1"
+		}
+		return directory + `        RewriteEngine On
+        RewriteBase /
+        RewriteRule ^index\.php$ - [L]
+        RewriteRule ^` + prefix + `wp-admin$ ` + admin + `wp-admin/ [R=301,L]
+        RewriteCond %{REQUEST_FILENAME} -f [OR]
+        RewriteCond %{REQUEST_FILENAME} -d
+        RewriteRule ^ - [L]
+        RewriteRule ^` + prefix + `(wp-(content|admin|includes).*) ` + target + ` [L]
+        RewriteRule ^` + prefix + `(.*\.php)$ ` + target + ` [L]
+        RewriteRule . index.php [L]
+`
+
+	case FrameworkMagento, FrameworkDrupal:
+		// Both rely on the .htaccess they ship
+		return directory
+	}
+
+	// Front controller fallback for projects without an .htaccess
+	return directory + "        FallbackResource /" + fw.Index + "\n"
+}
+
+// EnsureSSLCertificate ensures mkcert is installed and generates certificate for domain
+func (sc *SiteConfigurator) EnsureSSLCertificate(domain string) error {
+	// Ensure mkcert is downloaded
+	mkcertPath, err := ssl.EnsureMkcert(sc.stackerDir)
+	if err != nil {
+		return fmt.Errorf("failed to ensure mkcert: %w", err)
+	}
+
+	// Install root CA (first time only)
+	if err := ssl.InstallRootCA(mkcertPath); err != nil {
+		fmt.Printf("⚠️  Root CA installation failed: %v\n", err)
+		fmt.Printf("💡 You may need to run: sudo %s -install\n", mkcertPath)
+		// Continue anyway, certificate generation might still work
+	}
+
+	// Generate certificate for this domain
+	certPath, keyPath, err := ssl.GenerateCertificate(mkcertPath, sc.stackerDir, domain)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ SSL certificate ready: %s\n", certPath)
+	fmt.Printf("   Key: %s\n", keyPath)
+	return nil
+}
+
+// PHPPort returns the PHP-FPM port a site using the given PHP version should use
+func (sc *SiteConfigurator) PHPPort(version string) int {
+	// helper to check if port is listening
+	isListening := func(port int) bool {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 100*time.Millisecond)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	// 1. If version is specified, use its calculated port
+	if version != "" {
+		clean := strings.ReplaceAll(version, ".", "")
+		var port int
+		fmt.Sscanf(clean, "%d", &port)
+		calculated := 9000
+		if port < 100 {
+			calculated = 9000 + port
+		} else {
+			calculated = port
+		}
+
+		// If calculated port is listening, use it
+		if isListening(calculated) {
+			return calculated
+		}
+
+		// Fallback to 9000 if calculated fails but 9000 is alive
+		if calculated != 9000 && isListening(9000) {
+			return 9000
+		}
+		return calculated
+	}
+
+	// 2. Try to find a running PHP service in ServiceManager
+	if sc.serviceManager != nil {
+		for _, svc := range sc.serviceManager.GetServices() {
+			if strings.HasPrefix(svc.Type, "php") && svc.Status == "running" {
+				return svc.Port
+			}
+		}
+	}
+
+	// 3. Fallback to default detection
+	pm := php.NewPHPManager()
+	pm.DetectPHPVersions()
+	if def := pm.GetDefault(); def != nil {
+		clean := strings.ReplaceAll(def.Version, ".", "")
+		var port int
+		fmt.Sscanf(clean, "%d", &port)
+		calculated := 9000
+		if port < 100 {
+			calculated = 9000 + port
+		} else {
+			calculated = port
+		}
+
+		if isListening(calculated) {
+			return calculated
+		}
+	}
+
+	// 4. Final fallback to 9000 if it's listening
+	if isListening(9000) {
+		return 9000
+	}
+
+	return 9000 // Ultimate fallback
+}
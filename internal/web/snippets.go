@@ -0,0 +1,188 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// Snippet hook points in the generated site configs
+const (
+	SnippetServer   = "server"   // server {} / <VirtualHost>
+	SnippetLocation = "location" // location / {} / <Directory>
+	SnippetPHP      = "php"      // the PHP location / <FilesMatch \.php$>
+)
+
+// SnippetHooks lists the hook points in config order
+var SnippetHooks = []string{SnippetServer, SnippetLocation, SnippetPHP}
+
+// SnippetServers are the web servers snippets can be written for
+var SnippetServers = []string{"nginx", "apache"}
+
+// SiteSnippet is a user snippet included in a site's generated config
+type SiteSnippet struct {
+	Site    string `json:"site"`
+	Server  string `json:"server"`
+	Hook    string `json:"hook"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// SnippetDir holds a site's snippets as <server>-<hook>.conf. The files are
+// included, not copied, so they survive config regeneration.
+func (sc *SiteConfigurator) SnippetDir(site string) string {
+	return filepath.Join(sc.stackerDir, "conf", "snippets", site)
+}
+
+func (sc *SiteConfigurator) snippetPath(site, server, hook string) string {
+	return filepath.Join(sc.SnippetDir(site), server+"-"+hook+".conf")
+}
+
+// Snippets returns the snippets of a site
+func (sc *SiteConfigurator) Snippets(site string) []SiteSnippet {
+	var result []SiteSnippet
+	for _, server := range SnippetServers {
+		for _, hook := range SnippetHooks {
+			path := sc.snippetPath(site, server, hook)
+			content, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			result = append(result, SiteSnippet{Site: site, Server: server, Hook: hook, Path: path, Content: string(content)})
+		}
+	}
+	return result
+}
+
+// snippetIncludes returns the include directives of a site's snippets for
+// one server, keyed by hook and indented for their place in the config
+func (sc *SiteConfigurator) snippetIncludes(site, server string) map[string]string {
+	includes := make(map[string]string)
+	for _, hook := range SnippetHooks {
+		path := sc.snippetPath(site, server, hook)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		indent := "        "
+		if hook == SnippetServer {
+			indent = "    "
+		}
+		if server == "nginx" {
+			includes[hook] = fmt.Sprintf("%sinclude \"%s\";\n", indent, path)
+		} else {
+			includes[hook] = fmt.Sprintf("%sInclude \"%s\"\n", indent, path)
+		}
+	}
+	return includes
+}
+
+// SaveSnippet writes a snippet, or removes it when content is empty, then
+// regenerates the site's configs and checks them with the web server. If the
+// check fails the previous snippet and config are restored.
+func (sc *SiteConfigurator) SaveSnippet(siteName, server, hook, content string) error {
+	if !contains(SnippetServers, server) {
+		return fmt.Errorf("unknown server %q, expected one of %s", server, strings.Join(SnippetServers, ", "))
+	}
+	if !contains(SnippetHooks, hook) {
+		return fmt.Errorf("unknown hook %q, expected one of %s", hook, strings.Join(SnippetHooks, ", "))
+	}
+	site := config.GetSiteRegistry().Get(siteName)
+	if site == nil {
+		return fmt.Errorf("site %s not found", siteName)
+	}
+
+	path := sc.snippetPath(site.Name, server, hook)
+	previous, readErr := os.ReadFile(path)
+	restore := func() {
+		if readErr == nil {
+			os.WriteFile(path, previous, 0644)
+		} else {
+			os.Remove(path)
+		}
+		sc.WriteConfig(*site)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := sc.WriteConfig(*site); err != nil {
+		restore()
+		return err
+	}
+	if err := sc.TestConfig(server); err != nil {
+		restore()
+		utils.LogWarn(fmt.Sprintf("Snippet %s-%s for %s rejected: %v", server, hook, site.Name, err))
+		return fmt.Errorf("snippet rejected, previous config restored: %w", err)
+	}
+
+	utils.LogInfo(fmt.Sprintf("Snippet %s-%s saved for %s", server, hook, site.Name))
+	return nil
+}
+
+// TestConfig runs "nginx -t" or "httpd -t" for the installed server. Without a
+// service manager there is nothing to test against and the check passes.
+func (sc *SiteConfigurator) TestConfig(server string) error {
+	if sc.serviceManager == nil {
+		return nil
+	}
+	return sc.serviceManager.TestWebServerConfig(server)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSiteSnippets serves /api/sites/<name>/snippets
+func (ws *WebServer) handleSiteSnippets(w http.ResponseWriter, r *http.Request, siteName string) {
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"snippets": ws.sites.Snippets(config.SiteHost(siteName)),
+			"hooks":    SnippetHooks,
+			"servers":  SnippetServers,
+		})
+
+	case "PUT", "POST":
+		var snippet SiteSnippet
+		if err := json.NewDecoder(r.Body).Decode(&snippet); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := ws.sites.SaveSnippet(config.SiteHost(siteName), snippet.Server, snippet.Hook, snippet.Content); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := ws.reloadWebServers(); err != nil {
+			http.Error(w, "Reload failed: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "saved"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
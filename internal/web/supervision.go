@@ -0,0 +1,155 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/yasinkuyu/Stacker/internal/config"
+)
+
+// handleServiceEvents returns the kept service events. ?service=<name>
+// limits them to one service.
+func (ws *WebServer) handleServiceEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.serviceManager.Events(r.URL.Query().Get("service")))
+}
+
+// handleServiceRestartPolicy reads or replaces the restart policy of a
+// service: /api/services/restart-policy/<name>
+func (ws *WebServer) handleServiceRestartPolicy(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/services/restart-policy/")
+	if name == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	svc := ws.serviceManager.GetService(name)
+	if svc == nil {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		_, custom := config.GetPreferences().RestartPolicies[name]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"policy":   ws.serviceManager.RestartPolicy(name),
+			"custom":   custom,
+			"status":   svc.Status,
+			"restarts": svc.Restarts,
+			"lastExit": svc.LastExit,
+			"crashLog": svc.CrashLog,
+		})
+
+	case "PUT", "POST":
+		var policy config.RestartPolicy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := ws.serviceManager.SetRestartPolicy(name, policy); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "saved"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleServiceDependencies reads or replaces what a service depends on and
+// how its readiness is probed: /api/services/dependencies/<name>
+func (ws *WebServer) handleServiceDependencies(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/services/dependencies/")
+	if name == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	svc := ws.serviceManager.GetService(name)
+	if svc == nil {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		_, custom := config.GetPreferences().ServiceDependencies[name]
+		resolved, err := ws.serviceManager.Dependencies(name)
+		result := map[string]interface{}{
+			"settings": ws.serviceManager.DependencySettings(name),
+			"custom":   custom,
+			"resolved": resolved,
+		}
+		if err != nil {
+			result["error"] = err.Error()
+		}
+		if svc.Status == "running" {
+			ready := ws.serviceManager.Probe(svc)
+			result["ready"] = ready == nil
+			if ready != nil {
+				result["probeError"] = ready.Error()
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+
+	case "PUT", "POST":
+		var spec config.ServiceDependency
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := ws.serviceManager.SetDependencies(name, spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "saved"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// customControlOnly is the answer to requests that would run a custom
+// service's command over HTTP
+const customControlOnly = "Custom services are added and started with stacker services custom, over the control socket"
+
+// isCustomService reports whether name is a user-defined service
+func (ws *WebServer) isCustomService(name string) bool {
+	_, ok := ws.serviceManager.CustomServices()[name]
+	return ok
+}
+
+// handleCustomServices lists user-defined services on /api/services/custom and
+// reads one on /api/services/custom/<name>. Adding and removing them runs
+// arbitrary commands, so it is only offered on the token-authenticated
+// control socket.
+func (ws *WebServer) handleCustomServices(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/services/custom"), "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == "GET" && name == "":
+		json.NewEncoder(w).Encode(ws.serviceManager.CustomServices())
+
+	case r.Method == "GET":
+		def, ok := ws.serviceManager.CustomServices()[name]
+		if !ok {
+			http.Error(w, "Custom service not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(def)
+
+	case r.Method == "POST" || r.Method == "PUT" || r.Method == "DELETE":
+		http.Error(w, customControlOnly, http.StatusForbidden)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
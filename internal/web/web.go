@@ -8,25 +8,26 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/yasinkuyu/Stacker/internal/config"
+	"github.com/yasinkuyu/Stacker/internal/control"
 	"github.com/yasinkuyu/Stacker/internal/dumps"
 	"github.com/yasinkuyu/Stacker/internal/logs"
 	"github.com/yasinkuyu/Stacker/internal/mail"
 	"github.com/yasinkuyu/Stacker/internal/php"
 	"github.com/yasinkuyu/Stacker/internal/services"
-	"github.com/yasinkuyu/Stacker/internal/ssl"
 	"github.com/yasinkuyu/Stacker/internal/utils"
+	"github.com/yasinkuyu/Stacker/internal/xdebug"
 )
 
 //go:embed index.html
@@ -45,14 +46,8 @@ var localeFS embed.FS
 var changelogMD string
 
 // Site represents a local development site
-type Site struct {
-	Name   string `json:"name"`
-	Path   string `json:"path"`
-	PHP    string `json:"php,omitempty"`
-	SSL    bool   `json:"ssl"`
-	Server string `json:"server,omitempty"` // "apache" or "nginx", defaults to "apache"
-	Url    string `json:"url"`              // Dynamic URL based on settings
-}
+// Site is the shared site model from the config registry
+type Site = config.Site
 
 // Use centralized Preferences from config package
 type Preferences = config.Preferences
@@ -72,8 +67,6 @@ var (
 		Language:          "en",
 	}
 	prefMutex sync.RWMutex
-	sites     = make([]Site, 0)
-	sitesMu   sync.RWMutex
 )
 
 type WebServer struct {
@@ -83,6 +76,9 @@ type WebServer struct {
 	serviceManager  *services.ServiceManager
 	fpmManager      *php.FPMManager
 	phpManager      *php.PHPManager
+	debugProxy      *xdebug.DBGpProxy
+	sites           *SiteConfigurator
+	control         *control.Server
 	stackerDir      string
 	installProgress map[string]int
 	progressMu      sync.RWMutex
@@ -92,8 +88,6 @@ func NewWebServer(cfg *config.Config) *WebServer {
 	sm := services.NewServiceManager()
 	stackerDir := utils.GetStackerDir()
 
-	// Load saved sites
-	loadSites(stackerDir)
 	loadPreferences(stackerDir)
 
 	// Update service manager with initial ports
@@ -111,6 +105,7 @@ func NewWebServer(cfg *config.Config) *WebServer {
 		serviceManager:  sm,
 		fpmManager:      fm,
 		phpManager:      pm,
+		sites:           NewSiteConfigurator(sm),
 		stackerDir:      stackerDir,
 		installProgress: make(map[string]int),
 	}
@@ -121,21 +116,6 @@ func NewWebServer(cfg *config.Config) *WebServer {
 	return ws
 }
 
-func loadSites(stackerDir string) {
-	sitesFile := filepath.Join(stackerDir, "sites.json")
-	data, err := os.ReadFile(sitesFile)
-	if err != nil {
-		return
-	}
-	json.Unmarshal(data, &sites)
-}
-
-func saveSites(stackerDir string) {
-	sitesFile := filepath.Join(stackerDir, "sites.json")
-	data, _ := json.MarshalIndent(sites, "", "  ")
-	os.WriteFile(sitesFile, data, 0644)
-}
-
 func loadPreferences(stackerDir string) {
 	p := config.GetPreferences()
 	if p != nil {
@@ -172,7 +152,7 @@ func (ws *WebServer) setupDefaultPages() {
 	}
 
 	// Detect active php port for default setup
-	phpPort := ws.getPHPPort("")
+	phpPort := ws.sites.PHPPort("")
 
 	// Create default Nginx config
 	nginxConfDir := filepath.Join(stackerDir, "conf", "nginx")
@@ -186,13 +166,7 @@ func (ws *WebServer) setupDefaultPages() {
 	os.MkdirAll(vhostDir, 0755)
 
 	// Regenerate all site configs
-	for _, site := range sites {
-		if site.Server == "apache" || site.Server == "" {
-			ws.createApacheSiteConfig(site)
-		} else if site.Server == "nginx" {
-			ws.createNginxSiteConfig(site)
-		}
-	}
+	ws.sites.RegenerateAll()
 
 	// Create default Apache config inside vhosts directory to ensure it's included
 	logsDir := filepath.Join(stackerDir, "logs")
@@ -406,9 +380,22 @@ func (ws *WebServer) Start() error {
 	http.HandleFunc("/api/services/start/", ws.handleServiceStart)
 	http.HandleFunc("/api/services/stop/", ws.handleServiceStop)
 	http.HandleFunc("/api/services/restart/", ws.handleServiceRestart)
+	http.HandleFunc("/api/services/reload/", ws.handleServiceReload)
 	http.HandleFunc("/api/services/start-all", ws.handleServiceStartAll)
 	http.HandleFunc("/api/services/stop-all", ws.handleServiceStopAll)
 	http.HandleFunc("/api/services/config/", ws.handleServiceConfig)
+	http.HandleFunc("/api/services/settings/", ws.handleServiceSettings)
+	http.HandleFunc("/api/services/events", ws.handleServiceEvents)
+	http.HandleFunc("/api/events", ws.handleEvents)
+	http.HandleFunc("/api/events/stream", ws.handleEventStream)
+	http.HandleFunc("/api/events/webhooks", ws.handleEventWebhooks)
+	http.HandleFunc("/api/services/restart-policy/", ws.handleServiceRestartPolicy)
+	http.HandleFunc("/api/services/dependencies/", ws.handleServiceDependencies)
+	http.HandleFunc("/api/services/custom", ws.handleCustomServices)
+	http.HandleFunc("/api/services/custom/", ws.handleCustomServices)
+	http.HandleFunc("/api/services/instances", ws.handleServiceInstances)
+	http.HandleFunc("/api/services/instances/", ws.handleServiceInstances)
+	http.HandleFunc("/api/services/connection/", ws.handleServiceConnection)
 	http.HandleFunc("/api/dumps", ws.handleDumps)
 	http.HandleFunc("/api/mail", ws.handleMail)
 	http.HandleFunc("/api/logs", ws.handleLogs)
@@ -426,6 +413,9 @@ func (ws *WebServer) Start() error {
 	http.HandleFunc("/api/run-terminal-command", ws.handleRunTerminalCommand)
 	http.HandleFunc("/api/browse-folder", ws.handleBrowseFolder)
 	http.HandleFunc("/api/dumps/ingest", ws.handleDumpIngest)
+	http.HandleFunc("/api/xdebug/sessions", ws.handleXDebugSessions)
+	http.HandleFunc("/api/xdebug/profiles", ws.handleXDebugProfiles)
+	http.HandleFunc("/api/xdebug/profiles/", ws.handleXDebugProfile)
 
 	// Hosts Management API
 	http.HandleFunc("/api/hosts", ws.handleHosts)
@@ -442,10 +432,24 @@ func (ws *WebServer) Start() error {
 	http.Handle("/api/static/services/", http.StripPrefix("/api/static/services/", http.FileServer(http.FS(logoFS))))
 
 	ws.mailManager.Start()
+	ws.serviceManager.StartMetrics()
 
 	// Auto-start PHP-FPM pools for configured sites
 	ws.startRequiredFPMPools()
 
+	// Start the DBGp proxy if the user opted in
+	if xm := xdebug.NewXDebugManager(); xm.IsProxyEnabled() {
+		proxy := xm.NewProxy()
+		if err := proxy.Start(); err != nil {
+			fmt.Printf("⚠️ Failed to start DBGp proxy: %v\n", err)
+		} else {
+			ws.debugProxy = proxy
+		}
+	}
+
+	// Let CLI commands talk to this instance
+	ws.startControlServer()
+
 	// Start background service status worker (checks every 3 seconds)
 	ws.serviceManager.StartStatusWorker(3 * time.Second)
 
@@ -455,7 +459,7 @@ func (ws *WebServer) Start() error {
 
 	fmt.Printf("🚀 Web UI starting on http://localhost:%d\n", port)
 	fmt.Printf("📁 Data directory: %s\n", ws.stackerDir)
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	return http.ListenAndServe(fmt.Sprintf("127.0.0.1:%d", port), localOnly(port, http.DefaultServeMux))
 }
 
 func (ws *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
@@ -490,9 +494,7 @@ func (ws *WebServer) handleStatus(w http.ResponseWriter, r *http.Request) {
 
 	dumpCount := len(ws.dumpManager.GetDumps())
 
-	sitesMu.RLock()
-	siteCount := len(sites)
-	sitesMu.RUnlock()
+	siteCount := len(config.GetSiteRegistry().List())
 
 	status := map[string]interface{}{
 		"status":     "running",
@@ -517,8 +519,7 @@ func (ws *WebServer) handleSites(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		sitesMu.RLock()
-		defer sitesMu.RUnlock()
+		sites := config.GetSiteRegistry().List()
 
 		prefMutex.RLock()
 		domainExt := prefs.DomainExtension
@@ -551,6 +552,9 @@ func (ws *WebServer) handleSites(w http.ResponseWriter, r *http.Request) {
 			} else if port != 80 && port != 0 {
 				s.Url = fmt.Sprintf("http://%s:%d", s.Name, port)
 			}
+			if fw, err := ws.sites.Layout(s); err == nil {
+				s.Detected = fw.Name
+			}
 			displaySites[i] = s
 		}
 
@@ -568,56 +572,24 @@ func (ws *WebServer) handleSites(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Site name is required", http.StatusBadRequest)
 			return
 		}
-
-		// Smart domain extension handling
-		// If site name doesn't contain a dot, append default extension
-		// If it contains a dot (e.g., "mysite.dev"), use as-is
-		prefMutex.RLock()
-		domainExt := prefs.DomainExtension
-		prefMutex.RUnlock()
-		if domainExt == "" {
-			domainExt = ".local"
-		}
-
-		siteName := site.Name
-		if !strings.Contains(siteName, ".") {
-			// No extension provided, append default
-			siteName = siteName + domainExt
-		}
-		// Update site name with proper extension
-		site.Name = siteName
-
-		// If path is empty, auto-create in Stacker data folder
-		if site.Path == "" {
-			// Create path as sites/{name} (e.g., sites/myproject.local)
-			site.Path = filepath.Join(ws.stackerDir, "sites", siteName)
+		if site.Framework != "" && !isFramework(site.Framework) {
+			http.Error(w, "Unknown framework: "+site.Framework, http.StatusBadRequest)
+			return
 		}
 
-		// Create site directory if needed (use full domain name with extension)
-		sitePath := filepath.Join(ws.stackerDir, "sites", siteName)
-		os.MkdirAll(sitePath, 0755)
-
 		// Pin site to PHP version if specified
 		if site.PHP != "" {
-			ws.phpManager.PinSite(site.Name, site.PHP)
+			ws.phpManager.PinSite(config.SiteHost(site.Name), site.PHP)
 			// Start PHP-FPM pool for this version
 			if err := ws.fpmManager.EnsureRunning(site.PHP); err != nil {
 				fmt.Printf("⚠️ Failed to start PHP-FPM %s: %v\n", site.PHP, err)
 			}
 		}
 
-		// Generate SSL certificate if SSL is enabled
-		if site.SSL {
-			if err := ws.ensureSSLCertificate(site.Name); err != nil {
-				fmt.Printf("⚠️ Failed to generate SSL certificate: %v\n", err)
-				// Don't fail the request, just disable SSL
-				site.SSL = false
-			}
-		}
-
-		// Add to hosts file simulation - create a config file
-		if err := ws.createSiteConfig(site); err != nil {
-			http.Error(w, "Failed to create site config: "+err.Error(), http.StatusInternalServerError)
+		// Registers the site, creates the SSL certificate and writes the configs
+		site, err := ws.sites.Register(site)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -643,21 +615,12 @@ func (ws *WebServer) handleSites(w http.ResponseWriter, r *http.Request) {
 			fmt.Printf("✅ Added %s to hosts file\n", fullDomain)
 		}
 
-		// Reload Nginx if it's running
-		ws.serviceManager.RestartService("nginx-active") // We need a way to find the active nginx
-		// Actually, let's just attempt to reload any service of type nginx
-		for _, svc := range ws.serviceManager.GetServices() {
-			if svc.Type == "nginx" && svc.Status == "running" {
-				ws.serviceManager.RestartService(svc.Name)
-			}
+		// Reload running web servers so the new site is served
+		response := map[string]string{"status": "created", "name": site.Name}
+		if err := ws.reloadWebServers(); err != nil {
+			response["warning"] = err.Error()
 		}
-
-		sitesMu.Lock()
-		sites = append(sites, site)
-		sitesMu.Unlock()
-		saveSites(ws.stackerDir)
-
-		json.NewEncoder(w).Encode(map[string]string{"status": "created", "name": site.Name})
+		json.NewEncoder(w).Encode(response)
 
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -682,6 +645,10 @@ func (ws *WebServer) handleSiteByName(w http.ResponseWriter, r *http.Request) {
 		ws.handleSiteConfigRequest(w, r, siteName)
 		return
 	}
+	if len(parts) >= 5 && parts[4] == "snippets" {
+		ws.handleSiteSnippets(w, r, siteName)
+		return
+	}
 
 	switch r.Method {
 	case "PUT":
@@ -690,6 +657,10 @@ func (ws *WebServer) handleSiteByName(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
+		if updatedSite.Framework != "" && !isFramework(updatedSite.Framework) {
+			http.Error(w, "Unknown framework: "+updatedSite.Framework, http.StatusBadRequest)
+			return
+		}
 
 		// Handle PHP version change
 		if updatedSite.PHP != "" {
@@ -701,35 +672,18 @@ func (ws *WebServer) handleSiteByName(w http.ResponseWriter, r *http.Request) {
 			ws.phpManager.UnpinSite(updatedSite.Name)
 		}
 
-		sitesMu.Lock()
-		for i, s := range sites {
-			if s.Name == siteName {
-				sites[i] = updatedSite
-				break
-			}
+		if err := ws.sites.Update(siteName, updatedSite); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
-		sitesMu.Unlock()
-		saveSites(ws.stackerDir)
-
-		ws.createSiteConfig(updatedSite)
 		json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
 
 	case "DELETE":
-		sitesMu.Lock()
-		for i, s := range sites {
-			if s.Name == siteName {
-				sites = append(sites[:i], sites[i+1:]...)
-				break
-			}
+		// Removes the site and its nginx and apache vhosts
+		if _, err := ws.sites.Unregister(siteName); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
-		sitesMu.Unlock()
-		saveSites(ws.stackerDir)
-
-		// Remove site config from both nginx and apache vhosts
-		nginxConfigPath := filepath.Join(ws.stackerDir, "conf", "nginx", siteName+".conf")
-		apacheConfigPath := filepath.Join(ws.stackerDir, "conf", "apache", "vhosts", siteName+".conf")
-		os.Remove(nginxConfigPath)
-		os.Remove(apacheConfigPath)
 
 		json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 
@@ -740,16 +694,7 @@ func (ws *WebServer) handleSiteByName(w http.ResponseWriter, r *http.Request) {
 
 func (ws *WebServer) handleSiteConfigRequest(w http.ResponseWriter, r *http.Request, siteName string) {
 	// Find the site to determine server type
-	sitesMu.RLock()
-	var site *Site
-	for _, s := range sites {
-		if s.Name == siteName {
-			siteCopy := s
-			site = &siteCopy
-			break
-		}
-	}
-	sitesMu.RUnlock()
+	site := config.GetSiteRegistry().Get(siteName)
 
 	serverType := "apache"
 	if site != nil && site.Server != "" {
@@ -787,23 +732,37 @@ func (ws *WebServer) handleSiteConfigRequest(w http.ResponseWriter, r *http.Requ
 			return
 		}
 
+		// Hand edits are checked like snippets, but are overwritten on the
+		// next regeneration; snippets are the durable way to customize a site
+		previous, readErr := os.ReadFile(configPath)
 		if err := os.WriteFile(configPath, []byte(payload.Content), 0644); err != nil {
 			http.Error(w, "Failed to write config: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := ws.sites.TestConfig(serverType); err != nil {
+			if readErr == nil {
+				os.WriteFile(configPath, previous, 0644)
+			}
+			http.Error(w, "Config rejected, previous config restored: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
 
-		// Restart the appropriate server
-		if payload.Server == "nginx" {
-			ws.serviceManager.RestartService("nginx-active")
-		} else {
-			// Find and restart/start apache service
+		// Reload the servers of that type; apache is started when none runs
+		reloaded := false
+		for _, svc := range ws.serviceManager.GetServices() {
+			if svc.Type != serverType || svc.Status != "running" {
+				continue
+			}
+			if err := ws.serviceManager.ReloadService(svc.Name); err != nil {
+				http.Error(w, "Reload failed: "+err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			reloaded = true
+		}
+		if !reloaded && serverType == "apache" {
 			for _, svc := range ws.serviceManager.GetServices() {
 				if svc.Type == "apache" {
-					if svc.Status == "running" {
-						ws.serviceManager.RestartService(svc.Name)
-					} else {
-						ws.serviceManager.StartService(svc.Name)
-					}
+					ws.serviceManager.StartService(svc.Name)
 					break
 				}
 			}
@@ -1166,228 +1125,6 @@ const defaultIndexHTML = `<!DOCTYPE html>
 </body>
 </html>`
 
-func (ws *WebServer) createSiteConfig(site Site) error {
-	// Always create both Nginx and Apache configs for flexibility
-	// The "Server" field indicates which one is primary/active
-	// but both configs are generated so user can switch between them
-	if err := ws.createNginxSiteConfig(site); err != nil {
-		return fmt.Errorf("nginx config: %w", err)
-	}
-	if err := ws.createApacheSiteConfig(site); err != nil {
-		return fmt.Errorf("apache config: %w", err)
-	}
-	return nil
-}
-
-func (ws *WebServer) createNginxSiteConfig(site Site) error {
-	confDir := filepath.Join(ws.stackerDir, "conf", "nginx")
-	if err := os.MkdirAll(confDir, 0755); err != nil {
-		return err
-	}
-
-	// Use full domain name for config file and directory naming
-	configPath := filepath.Join(confDir, site.Name+".conf")
-
-	phpPort := ws.getPHPPort(site.PHP)
-
-	// Detect document root
-	docRoot := site.Path
-	// If path doesn't exist, create it within sites folder
-	if _, err := os.Stat(site.Path); os.IsNotExist(err) {
-		docRoot = filepath.Join(ws.stackerDir, "sites", site.Name, "public_html")
-		if err := os.MkdirAll(docRoot, 0755); err != nil {
-			return err
-		}
-	} else {
-		// If path exists, check for public folder
-		if _, err := os.Stat(filepath.Join(site.Path, "public")); err == nil {
-			docRoot = filepath.Join(site.Path, "public")
-		} else if _, err := os.Stat(filepath.Join(site.Path, "public_html")); err == nil {
-			docRoot = filepath.Join(site.Path, "public_html")
-		}
-	}
-
-	prefMutex.RLock()
-	domainExt := prefs.DomainExtension
-	nginxPort := prefs.NginxPort
-	prefMutex.RUnlock()
-
-	if nginxPort == 0 {
-		nginxPort = 80
-	}
-
-	if domainExt == "" {
-		domainExt = ".local" // Default fallback if empty
-	}
-
-	config := fmt.Sprintf(`# Stacker Site Config: %[1]s
-# Generated: %[2]s
-server {
-    listen %[6]d;
-    server_name %[1]s;
-    root "%[3]s";
-    index index.php index.html index.htm;
-
-    client_max_body_size 100M;
-
-    location / {
-        try_files $uri $uri/ /index.php?$query_string;
-    }
-
-    location ~ \.php$ {
-        fastcgi_pass 127.0.0.1:%[4]d;
-        fastcgi_index index.php;
-        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
-        include fastcgi_params;
-    }
-
-    location ~ /\.ht {
-        deny all;
-    }
-}
-`, site.Name, time.Now().Format(time.RFC3339), docRoot, phpPort, domainExt, nginxPort)
-
-	// Add SSL server block if SSL is enabled
-	if site.SSL {
-		certPath := filepath.Join(ws.stackerDir, "certs", site.Name, "cert.pem")
-		keyPath := filepath.Join(ws.stackerDir, "certs", site.Name, "key.pem")
-
-		sslConfig := fmt.Sprintf(`
-server {
-    listen 443 ssl;
-    server_name %[1]s;
-    root "%[2]s";
-    index index.php index.html index.htm;
-
-    ssl_certificate "%[3]s";
-    ssl_certificate_key "%[4]s";
-    ssl_protocols TLSv1.2 TLSv1.3;
-    ssl_ciphers HIGH:!aNULL:!MD5;
-
-    client_max_body_size 100M;
-
-    location / {
-        try_files $uri $uri/ /index.php?$query_string;
-    }
-
-    location ~ \.php$ {
-        fastcgi_pass 127.0.0.1:%[5]d;
-        fastcgi_index index.php;
-        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
-        include fastcgi_params;
-    }
-
-    location ~ /\.ht {
-        deny all;
-    }
-}
-`, site.Name, docRoot, certPath, keyPath, phpPort, domainExt)
-
-		config += sslConfig
-	}
-
-	return os.WriteFile(configPath, []byte(config), 0644)
-}
-
-func (ws *WebServer) createApacheSiteConfig(site Site) error {
-	confDir := filepath.Join(ws.stackerDir, "conf", "apache", "vhosts")
-	if err := os.MkdirAll(confDir, 0755); err != nil {
-		return err
-	}
-
-	// Use full domain name for config file and directory naming
-	configPath := filepath.Join(confDir, site.Name+".conf")
-
-	phpPort := ws.getPHPPort(site.PHP)
-
-	// Detect document root (same logic as Nginx)
-	docRoot := site.Path
-	// If path doesn't exist, create it within sites folder
-	if _, err := os.Stat(site.Path); os.IsNotExist(err) {
-		docRoot = filepath.Join(ws.stackerDir, "sites", site.Name, "public_html")
-		if err := os.MkdirAll(docRoot, 0755); err != nil {
-			return err
-		}
-	} else {
-		if _, err := os.Stat(filepath.Join(site.Path, "public")); err == nil {
-			docRoot = filepath.Join(site.Path, "public")
-		} else if _, err := os.Stat(filepath.Join(site.Path, "public_html")); err == nil {
-			docRoot = filepath.Join(site.Path, "public_html")
-		}
-	}
-
-	prefMutex.RLock()
-	domainExt := prefs.DomainExtension
-	apachePort := prefs.ApachePort
-	prefMutex.RUnlock()
-
-	if apachePort == 0 {
-		apachePort = 80
-	}
-
-	if domainExt == "" {
-		domainExt = ".local"
-	}
-
-	config := fmt.Sprintf(`# Stacker Site Config: %[1]s
-# Generated: %[2]s
-<VirtualHost *:%[5]d>
-    ServerName %[1]s
-    ServerAlias *.%[1]s
-    DocumentRoot "%[3]s"
-    DirectoryIndex index.php index.html index.htm
-    AcceptPathInfo On
-    
-    <Directory "%[3]s">
-        Options Indexes FollowSymLinks MultiViews
-        AllowOverride All
-        Require all granted
-    </Directory>
-
-    <FilesMatch \.php$>
-        SetHandler "proxy:fcgi://127.0.0.1:%[4]d"
-    </FilesMatch>
-
-    ErrorLog "${APACHE_LOG_DIR}/%[1]s-error.log"
-    CustomLog "${APACHE_LOG_DIR}/%[1]s-access.log" combined
-</VirtualHost>
-`, site.Name, time.Now().Format(time.RFC3339), docRoot, phpPort, apachePort, domainExt)
-
-	// Add SSL VirtualHost if SSL is enabled
-	if site.SSL {
-		certPath := filepath.Join(ws.stackerDir, "certs", site.Name, "cert.pem")
-		keyPath := filepath.Join(ws.stackerDir, "certs", site.Name, "key.pem")
-
-		sslConfig := fmt.Sprintf(`
-<VirtualHost *:443>
-    ServerName %[1]s
-    DocumentRoot "%[2]s"
-    
-    SSLEngine on
-    SSLCertificateFile "%[3]s"
-    SSLCertificateKeyFile "%[4]s"
-    
-    <Directory "%[2]s">
-        Options Indexes FollowSymLinks
-        AllowOverride All
-        Require all granted
-    </Directory>
-
-    <FilesMatch \.php$>
-        SetHandler "proxy:fcgi://127.0.0.1:%[5]d"
-    </FilesMatch>
-
-    ErrorLog "${APACHE_LOG_DIR}/%[1]s-ssl-error.log"
-    CustomLog "${APACHE_LOG_DIR}/%[1]s-ssl-access.log" combined
-</VirtualHost>
-`, site.Name, docRoot, certPath, keyPath, phpPort, domainExt)
-
-		config += sslConfig
-	}
-
-	return os.WriteFile(configPath, []byte(config), 0644)
-}
-
 type ProgressReader struct {
 	io.Reader
 	Total   int64
@@ -1553,101 +1290,6 @@ func (ws *WebServer) downloadAndExtractPHP(version, targetDir string) error {
 	return lastErr
 }
 
-// ensureSSLCertificate ensures mkcert is installed and generates certificate for domain
-func (ws *WebServer) ensureSSLCertificate(domain string) error {
-	// Ensure mkcert is downloaded
-	mkcertPath, err := ssl.EnsureMkcert(ws.stackerDir)
-	if err != nil {
-		return fmt.Errorf("failed to ensure mkcert: %w", err)
-	}
-
-	// Install root CA (first time only)
-	if err := ssl.InstallRootCA(mkcertPath); err != nil {
-		fmt.Printf("⚠️  Root CA installation failed: %v\n", err)
-		fmt.Printf("💡 You may need to run: sudo %s -install\n", mkcertPath)
-		// Continue anyway, certificate generation might still work
-	}
-
-	// Generate certificate for this domain
-	certPath, keyPath, err := ssl.GenerateCertificate(mkcertPath, ws.stackerDir, domain)
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("✅ SSL certificate ready: %s\n", certPath)
-	fmt.Printf("   Key: %s\n", keyPath)
-	return nil
-}
-
-func (ws *WebServer) getPHPPort(version string) int {
-	// helper to check if port is listening
-	isListening := func(port int) bool {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 100*time.Millisecond)
-		if err != nil {
-			return false
-		}
-		conn.Close()
-		return true
-	}
-
-	// 1. If version is specified, use its calculated port
-	if version != "" {
-		clean := strings.ReplaceAll(version, ".", "")
-		var port int
-		fmt.Sscanf(clean, "%d", &port)
-		calculated := 9000
-		if port < 100 {
-			calculated = 9000 + port
-		} else {
-			calculated = port
-		}
-
-		// If calculated port is listening, use it
-		if isListening(calculated) {
-			return calculated
-		}
-
-		// Fallback to 9000 if calculated fails but 9000 is alive
-		if calculated != 9000 && isListening(9000) {
-			return 9000
-		}
-		return calculated
-	}
-
-	// 2. Try to find a running PHP service in ServiceManager
-	for _, svc := range ws.serviceManager.GetServices() {
-		if strings.HasPrefix(svc.Type, "php") && svc.Status == "running" {
-			return svc.Port
-		}
-	}
-
-	// 3. Fallback to default detection
-	pm := php.NewPHPManager()
-	pm.DetectPHPVersions()
-	if def := pm.GetDefault(); def != nil {
-		clean := strings.ReplaceAll(def.Version, ".", "")
-		var port int
-		fmt.Sscanf(clean, "%d", &port)
-		calculated := 9000
-		if port < 100 {
-			calculated = 9000 + port
-		} else {
-			calculated = port
-		}
-
-		if isListening(calculated) {
-			return calculated
-		}
-	}
-
-	// 4. Final fallback to 9000 if it's listening
-	if isListening(9000) {
-		return 9000
-	}
-
-	return 9000 // Ultimate fallback
-}
-
 // ===========================================
 // SERVICES API - FULLY FUNCTIONAL
 // ===========================================
@@ -1859,8 +1501,12 @@ func (ws *WebServer) handleServiceStart(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	serviceName := parts[4]
+	if ws.isCustomService(serviceName) {
+		http.Error(w, customControlOnly, http.StatusForbidden)
+		return
+	}
 
-	if err := ws.serviceManager.StartService(serviceName); err != nil {
+	if err := ws.serviceManager.StartWithDependencies(serviceName); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -1903,6 +1549,10 @@ func (ws *WebServer) handleServiceRestart(w http.ResponseWriter, r *http.Request
 		return
 	}
 	serviceName := parts[4]
+	if ws.isCustomService(serviceName) {
+		http.Error(w, customControlOnly, http.StatusForbidden)
+		return
+	}
 
 	if err := ws.serviceManager.RestartService(serviceName); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -1913,23 +1563,57 @@ func (ws *WebServer) handleServiceRestart(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(map[string]string{"status": "restarted", "name": serviceName})
 }
 
+// handleServiceReload applies config changes to a running service without a
+// full restart where the service supports it
+func (ws *WebServer) handleServiceReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	serviceName := parts[4]
+
+	if err := ws.serviceManager.ReloadService(serviceName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "reloaded", "name": serviceName})
+}
+
 func (ws *WebServer) handleServiceStartAll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	started := []string{}
+	var names []string
 	for _, svc := range ws.serviceManager.GetServices() {
-		if svc.Status != "running" {
-			if err := ws.serviceManager.StartService(svc.Name); err == nil {
-				started = append(started, svc.Name)
-			}
+		if svc.Status != "running" && svc.Type != services.CustomServiceType {
+			names = append(names, svc.Name)
 		}
 	}
+	started, failed, err := ws.serviceManager.StartServices(names)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if started == nil {
+		started = []string{}
+	}
+	errors := make(map[string]string)
+	for name, err := range failed {
+		errors[name] = err.Error()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"status": "started", "services": started})
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "started", "services": started, "errors": errors})
 }
 
 func (ws *WebServer) handleServiceStopAll(w http.ResponseWriter, r *http.Request) {
@@ -1958,6 +1642,10 @@ func (ws *WebServer) handleServiceConfig(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	serviceName := parts[4]
+	if len(parts) > 5 && parts[5] != "" {
+		ws.handleServiceConfigHistory(w, r, serviceName, parts[5:])
+		return
+	}
 
 	if r.Method == "GET" {
 		configPath, content, err := ws.serviceManager.GetServiceConfig(serviceName)
@@ -1996,6 +1684,83 @@ func (ws *WebServer) handleServiceConfig(w http.ResponseWriter, r *http.Request)
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
+func (ws *WebServer) handleXDebugSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if ws.debugProxy == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"proxy":    false,
+			"ides":     []xdebug.IDERegistration{},
+			"sessions": []xdebug.DebugSession{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"proxy":       true,
+		"engine_port": ws.debugProxy.EnginePort(),
+		"ide_port":    ws.debugProxy.IDEPort(),
+		"ides":        ws.debugProxy.IDEs(),
+		"sessions":    ws.debugProxy.Sessions(),
+	})
+}
+
+func (ws *WebServer) handleXDebugProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	pm := xdebug.NewXDebugManager().NewProfileManager()
+	if err := pm.Collect(); err != nil {
+		utils.LogWarn(fmt.Sprintf("Failed to collect Xdebug profiles: %v", err))
+	}
+
+	profiles := pm.List(r.URL.Query().Get("site"))
+	if profiles == nil {
+		profiles = []xdebug.ProfileInfo{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sites":    pm.Sites(),
+		"profiles": profiles,
+	})
+}
+
+// handleXDebugProfile serves /api/xdebug/profiles/<site>/<name>
+func (ws *WebServer) handleXDebugProfile(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/xdebug/profiles/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "Expected /api/xdebug/profiles/<site>/<name>", http.StatusBadRequest)
+		return
+	}
+	site, name := parts[0], parts[1]
+	pm := xdebug.NewXDebugManager().NewProfileManager()
+
+	switch r.Method {
+	case "GET":
+		profile, err := pm.Load(site, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		xdebug.SortFunctions(profile.Functions, query.Get("sort"))
+		if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 && limit < len(profile.Functions) {
+			profile.Functions = profile.Functions[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	case "DELETE":
+		if err := pm.Delete(site, name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func (ws *WebServer) handleDumps(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "DELETE" {
 		ws.dumpManager.ClearDumps()
@@ -2398,16 +2163,47 @@ func (ws *WebServer) handlePreferences(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) regenerateAllConfigs() {
-	sitesMu.RLock()
-	sitesToUpdate := make([]Site, len(sites))
-	copy(sitesToUpdate, sites)
-	sitesMu.RUnlock()
+	ws.sites.RegenerateAll()
+}
 
-	for _, site := range sitesToUpdate {
-		if err := ws.createSiteConfig(site); err != nil {
-			fmt.Printf("⚠️  Failed to regenerate config for %s: %v\n", site.Name, err)
+// reloadWebServers gracefully reloads running web servers so they pick up
+// site configs. A server whose config fails its test keeps running on the
+// last working config, and the first such error is returned.
+func (ws *WebServer) reloadWebServers() error {
+	var firstErr error
+	for _, svc := range ws.serviceManager.GetServices() {
+		if (svc.Type == "nginx" || svc.Type == "apache") && svc.Status == "running" {
+			if err := ws.serviceManager.ReloadService(svc.Name); err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
 		}
 	}
+	return firstErr
+}
+
+// ServiceManager returns the service manager owned by the web server
+func (ws *WebServer) ServiceManager() *services.ServiceManager {
+	return ws.serviceManager
+}
+
+// Reload re-reads preferences and sites, regenerates the web server configs
+// and reloads running web servers. Used on SIGHUP in daemon mode.
+func (ws *WebServer) Reload(cfg *config.Config) {
+	config.ReloadPreferences()
+	prefMutex.Lock()
+	loadPreferences(ws.stackerDir)
+	apachePort, nginxPort, mysqlPort := prefs.ApachePort, prefs.NginxPort, prefs.MySQLPort
+	prefMutex.Unlock()
+
+	ws.config = cfg
+	ws.serviceManager.UpdatePorts(apachePort, nginxPort, mysqlPort)
+	ws.sites.RegenerateAll()
+	ws.startRequiredFPMPools()
+	ws.reloadWebServers()
+	utils.LogInfo("Configuration reloaded")
 }
 
 func (ws *WebServer) updateAutoStart(enable bool) {
@@ -2533,6 +2329,15 @@ func (ws *WebServer) handleServiceHealthSSE(w http.ResponseWriter, r *http.Reque
 
 	flusher, _ := w.(http.Flusher)
 
+	// Without a name every running service is streamed. The first event of a
+	// single service carries its sampled history.
+	if serviceName != "" {
+		health := ws.serviceManager.GetDetailedStatus(serviceName)
+		health.History = ws.serviceManager.ResourceHistory(serviceName)
+		fmt.Fprintf(w, "data: %s\n\n", toJSON(health))
+		flusher.Flush()
+	}
+
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
@@ -2541,8 +2346,11 @@ func (ws *WebServer) handleServiceHealthSSE(w http.ResponseWriter, r *http.Reque
 		case <-r.Context().Done():
 			return
 		case <-ticker.C:
-			health := ws.serviceManager.GetDetailedStatus(serviceName)
-			fmt.Fprintf(w, "data: %s\n\n", toJSON(health))
+			if serviceName == "" {
+				fmt.Fprintf(w, "data: %s\n\n", toJSON(ws.serviceManager.DetailedStatuses()))
+			} else {
+				fmt.Fprintf(w, "data: %s\n\n", toJSON(ws.serviceManager.GetDetailedStatus(serviceName)))
+			}
 			flusher.Flush()
 		}
 	}
@@ -2555,12 +2363,9 @@ func toJSON(v interface{}) string {
 
 // startRequiredFPMPools starts PHP-FPM pools for sites with pinned PHP versions
 func (ws *WebServer) startRequiredFPMPools() {
-	sitesMu.RLock()
-	defer sitesMu.RUnlock()
-
 	// Collect unique PHP versions used by sites
 	versions := make(map[string]bool)
-	for _, site := range sites {
+	for _, site := range config.GetSiteRegistry().List() {
 		if site.PHP != "" {
 			versions[site.PHP] = true
 		}
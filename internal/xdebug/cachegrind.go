@@ -0,0 +1,341 @@
+package xdebug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile is a parsed cachegrind file written by the Xdebug profiler.
+// Costs are per event, in the order given by Events (Xdebug 3 writes
+// "Time_(10ns) Memory_(bytes)").
+type Profile struct {
+	Cmd       string          `json:"cmd"`
+	Creator   string          `json:"creator"`
+	Events    []string        `json:"events"`
+	Summary   []int64         `json:"summary"`
+	Functions []*FunctionCost `json:"functions"`
+}
+
+// FunctionCost aggregates the cost of one function across the profile
+type FunctionCost struct {
+	Name      string     `json:"name"`
+	File      string     `json:"file"`
+	Calls     int64      `json:"calls"`
+	Inclusive []int64    `json:"inclusive"`
+	Exclusive []int64    `json:"exclusive"`
+	Callers   []CallEdge `json:"callers,omitempty"`
+	Callees   []CallEdge `json:"callees,omitempty"`
+}
+
+// CallEdge is one caller -> callee relation with the inclusive cost of the calls
+type CallEdge struct {
+	Function  string  `json:"function"`
+	Calls     int64   `json:"calls"`
+	Inclusive []int64 `json:"inclusive"`
+}
+
+// cachegrindParser holds the state needed while reading a cachegrind file
+type cachegrindParser struct {
+	profile   *Profile
+	functions map[string]*FunctionCost
+	callers   map[string]map[string]*CallEdge // callee -> caller -> edge
+	callees   map[string]map[string]*CallEdge // caller -> callee -> edge
+	files     map[string]string               // compressed id -> file name
+	names     map[string]string               // compressed id -> function name
+
+	file       string
+	current    *FunctionCost
+	callFile   string
+	callName   string
+	pendingHit bool  // next cost line belongs to a calls= line
+	pendingN   int64 // call count of that calls= line
+	lastPos    int64
+}
+
+// ParseCachegrind parses the cachegrind format produced by Xdebug
+func ParseCachegrind(r io.Reader) (*Profile, error) {
+	p := &cachegrindParser{
+		profile:   &Profile{},
+		functions: make(map[string]*FunctionCost),
+		callers:   make(map[string]map[string]*CallEdge),
+		callees:   make(map[string]map[string]*CallEdge),
+		files:     make(map[string]string),
+		names:     make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if err := p.parseLine(strings.TrimRight(scanner.Text(), "\r")); err != nil {
+			return nil, fmt.Errorf("cachegrind line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p.profile.Events) == 0 {
+		return nil, fmt.Errorf("not a cachegrind file: missing events header")
+	}
+
+	p.finish()
+	return p.profile, nil
+}
+
+func (p *cachegrindParser) parseLine(line string) error {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	// Cost lines start with a position: digit, +, - or *
+	switch line[0] {
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '+', '-', '*':
+		return p.parseCost(line)
+	}
+
+	// Header lines use "key: value". They are recognized by their key first:
+	// values such as the cmd: URL may contain "=", and names in fn= lines ":".
+	if key, value, ok := strings.Cut(line, ":"); ok && !strings.ContainsAny(key, "= \t") {
+		p.parseHeader(key, strings.TrimSpace(value))
+		return nil
+	}
+
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return nil
+	}
+
+	switch key {
+	case "fl", "fi", "fe":
+		p.file = p.resolve(p.files, value)
+		if key == "fl" {
+			p.callFile = ""
+		}
+	case "fn":
+		name := p.resolve(p.names, value)
+		p.current = p.function(name, p.file)
+		p.pendingHit = false
+	case "cfl", "cfi":
+		p.callFile = p.resolve(p.files, value)
+	case "cfn":
+		p.callName = p.resolve(p.names, value)
+	case "calls":
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return fmt.Errorf("empty calls line")
+		}
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid call count %q", fields[0])
+		}
+		p.pendingHit = true
+		p.pendingN = n
+	}
+	return nil
+}
+
+func (p *cachegrindParser) parseHeader(key, value string) {
+	switch key {
+	case "cmd":
+		p.profile.Cmd = value
+	case "creator":
+		p.profile.Creator = value
+	case "events":
+		p.profile.Events = strings.Fields(value)
+	case "summary", "totals":
+		p.profile.Summary = parseCosts(strings.Fields(value), len(p.profile.Events))
+	}
+}
+
+// parseCost handles "<position> <cost>..." lines
+func (p *cachegrindParser) parseCost(line string) error {
+	if p.current == nil {
+		return fmt.Errorf("cost line before any fn=")
+	}
+
+	fields := strings.Fields(line)
+	p.lastPos = parsePosition(fields[0], p.lastPos)
+	costs := parseCosts(fields[1:], len(p.profile.Events))
+
+	if !p.pendingHit {
+		addCosts(p.current.Exclusive, costs)
+		addCosts(p.current.Inclusive, costs)
+		return nil
+	}
+
+	// The cost line after calls= is the inclusive cost of that call
+	p.pendingHit = false
+	callFile := p.callFile
+	if callFile == "" {
+		callFile = p.file
+	}
+	callee := p.function(p.callName, callFile)
+	callee.Calls += p.pendingN
+	addCosts(p.current.Inclusive, costs)
+
+	p.edge(p.callees, p.current.Name, callee.Name, p.pendingN, costs)
+	p.edge(p.callers, callee.Name, p.current.Name, p.pendingN, costs)
+	return nil
+}
+
+// resolve expands cachegrind name compression: "(1) name" defines id 1,
+// "(1)" refers back to it.
+func (p *cachegrindParser) resolve(table map[string]string, value string) string {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "(") {
+		return value
+	}
+	end := strings.Index(value, ")")
+	if end < 0 {
+		return value
+	}
+	id := value[:end+1]
+	name := strings.TrimSpace(value[end+1:])
+	if name == "" {
+		return table[id]
+	}
+	table[id] = name
+	return name
+}
+
+func (p *cachegrindParser) function(name, file string) *FunctionCost {
+	if fn, ok := p.functions[name]; ok {
+		return fn
+	}
+	fn := &FunctionCost{
+		Name:      name,
+		File:      file,
+		Inclusive: make([]int64, len(p.profile.Events)),
+		Exclusive: make([]int64, len(p.profile.Events)),
+	}
+	p.functions[name] = fn
+	return fn
+}
+
+func (p *cachegrindParser) edge(graph map[string]map[string]*CallEdge, from, to string, calls int64, costs []int64) {
+	edges, ok := graph[from]
+	if !ok {
+		edges = make(map[string]*CallEdge)
+		graph[from] = edges
+	}
+	e, ok := edges[to]
+	if !ok {
+		e = &CallEdge{Function: to, Inclusive: make([]int64, len(costs))}
+		edges[to] = e
+	}
+	e.Calls += calls
+	addCosts(e.Inclusive, costs)
+}
+
+// finish attaches the call graph and sorts functions by inclusive cost
+func (p *cachegrindParser) finish() {
+	for name, fn := range p.functions {
+		fn.Callers = sortedEdges(p.callers[name])
+		fn.Callees = sortedEdges(p.callees[name])
+		// Entry points ({main}) are never the target of a calls= line
+		if fn.Calls == 0 {
+			fn.Calls = 1
+		}
+		p.profile.Functions = append(p.profile.Functions, fn)
+	}
+	SortFunctions(p.profile.Functions, "inclusive")
+
+	if len(p.profile.Summary) == 0 {
+		p.profile.Summary = make([]int64, len(p.profile.Events))
+		for _, fn := range p.profile.Functions {
+			addCosts(p.profile.Summary, fn.Exclusive)
+		}
+	}
+}
+
+// SortFunctions orders functions by "inclusive", "exclusive" or "calls",
+// descending, using the first event (time) for cost comparisons.
+func SortFunctions(functions []*FunctionCost, by string) {
+	key := func(fn *FunctionCost) int64 {
+		switch by {
+		case "exclusive":
+			return firstCost(fn.Exclusive)
+		case "calls":
+			return fn.Calls
+		default:
+			return firstCost(fn.Inclusive)
+		}
+	}
+	sort.SliceStable(functions, func(i, j int) bool {
+		ki, kj := key(functions[i]), key(functions[j])
+		if ki != kj {
+			return ki > kj
+		}
+		return functions[i].Name < functions[j].Name
+	})
+}
+
+func sortedEdges(edges map[string]*CallEdge) []CallEdge {
+	result := make([]CallEdge, 0, len(edges))
+	for _, e := range edges {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ci, cj := firstCost(result[i].Inclusive), firstCost(result[j].Inclusive)
+		if ci != cj {
+			return ci > cj
+		}
+		return result[i].Function < result[j].Function
+	})
+	return result
+}
+
+func parsePosition(field string, last int64) int64 {
+	switch {
+	case field == "*":
+		return last
+	case strings.HasPrefix(field, "+"):
+		n, _ := strconv.ParseInt(field[1:], 10, 64)
+		return last + n
+	case strings.HasPrefix(field, "-"):
+		n, _ := strconv.ParseInt(field[1:], 10, 64)
+		return last - n
+	}
+	n, _ := strconv.ParseInt(field, 10, 64)
+	return n
+}
+
+func parseCosts(fields []string, n int) []int64 {
+	costs := make([]int64, n)
+	for i := 0; i < n && i < len(fields); i++ {
+		costs[i], _ = strconv.ParseInt(fields[i], 10, 64)
+	}
+	return costs
+}
+
+func addCosts(dst, src []int64) {
+	for i := 0; i < len(dst) && i < len(src); i++ {
+		dst[i] += src[i]
+	}
+}
+
+func firstCost(costs []int64) int64 {
+	if len(costs) == 0 {
+		return 0
+	}
+	return costs[0]
+}
+
+// FormatCost renders a cost value for display based on its event name
+func FormatCost(event string, value int64) string {
+	switch {
+	case strings.HasPrefix(event, "Time_(10ns)"):
+		return fmt.Sprintf("%.2fms", float64(value)/100000)
+	case strings.HasPrefix(event, "Time"):
+		// Xdebug 2 reports microseconds
+		return fmt.Sprintf("%.2fms", float64(value)/1000)
+	case strings.HasPrefix(event, "Memory"):
+		return fmt.Sprintf("%.1fKB", float64(value)/1024)
+	}
+	return fmt.Sprintf("%d", value)
+}
@@ -0,0 +1,141 @@
+package xdebug
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testProfile is Xdebug 3 profiler output with compressed file and function
+// names: "(n) name" defines an id, "(n)" refers back to it
+const testProfile = `version: 1
+creator: xdebug 3.2.2 (PHP 8.2.8)
+cmd: /var/www/app/public/index.php?page=2&sort=name
+part: 1
+positions: line
+
+events: Time_(10ns) Memory_(bytes)
+
+fl=(1) php:internal
+fn=(1) php::strlen
+3 5 0
+
+fl=(2) /var/www/app/src/Util.php
+fn=(2) App\Util->hash
+10 20 64
+cfl=(1)
+cfn=(1)
+calls=1 0 0
+11 5 0
+
+fl=(3) /var/www/app/public/index.php
+fn=(3) {main}
+1 100 1024
+cfl=(2)
+cfn=(2)
+calls=2 0 0
+5 50 128
+
+summary: 175 1216
+`
+
+func TestParseCachegrind(t *testing.T) {
+	profile, err := ParseCachegrind(strings.NewReader(testProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if profile.Cmd != "/var/www/app/public/index.php?page=2&sort=name" {
+		t.Errorf("cmd = %q", profile.Cmd)
+	}
+	if profile.Creator != "xdebug 3.2.2 (PHP 8.2.8)" {
+		t.Errorf("creator = %q", profile.Creator)
+	}
+	if !reflect.DeepEqual(profile.Events, []string{"Time_(10ns)", "Memory_(bytes)"}) {
+		t.Errorf("events = %q", profile.Events)
+	}
+	if !reflect.DeepEqual(profile.Summary, []int64{175, 1216}) {
+		t.Errorf("summary = %v", profile.Summary)
+	}
+
+	var names []string
+	byName := make(map[string]*FunctionCost)
+	for _, fn := range profile.Functions {
+		names = append(names, fn.Name)
+		byName[fn.Name] = fn
+	}
+	// Sorted by inclusive time
+	if want := []string{"{main}", `App\Util->hash`, "php::strlen"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("functions = %q, want %q", names, want)
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		calls     int64
+		inclusive []int64
+		exclusive []int64
+		callers   []CallEdge
+		callees   []CallEdge
+	}{
+		{
+			name: "{main}", file: "/var/www/app/public/index.php", calls: 1,
+			inclusive: []int64{150, 1152}, exclusive: []int64{100, 1024},
+			callers: []CallEdge{},
+			callees: []CallEdge{{Function: `App\Util->hash`, Calls: 2, Inclusive: []int64{50, 128}}},
+		},
+		{
+			name: `App\Util->hash`, file: "/var/www/app/src/Util.php", calls: 2,
+			inclusive: []int64{25, 64}, exclusive: []int64{20, 64},
+			callers: []CallEdge{{Function: "{main}", Calls: 2, Inclusive: []int64{50, 128}}},
+			callees: []CallEdge{{Function: "php::strlen", Calls: 1, Inclusive: []int64{5, 0}}},
+		},
+		{
+			name: "php::strlen", file: "php:internal", calls: 1,
+			inclusive: []int64{5, 0}, exclusive: []int64{5, 0},
+			callers: []CallEdge{{Function: `App\Util->hash`, Calls: 1, Inclusive: []int64{5, 0}}},
+			callees: []CallEdge{},
+		},
+	}
+	for _, tt := range tests {
+		fn := byName[tt.name]
+		if fn.File != tt.file || fn.Calls != tt.calls {
+			t.Errorf("%s: file %q calls %d, want %q and %d", tt.name, fn.File, fn.Calls, tt.file, tt.calls)
+		}
+		if !reflect.DeepEqual(fn.Inclusive, tt.inclusive) || !reflect.DeepEqual(fn.Exclusive, tt.exclusive) {
+			t.Errorf("%s: inclusive %v exclusive %v, want %v and %v", tt.name, fn.Inclusive, fn.Exclusive, tt.inclusive, tt.exclusive)
+		}
+		if !reflect.DeepEqual(fn.Callers, tt.callers) {
+			t.Errorf("%s: callers = %+v, want %+v", tt.name, fn.Callers, tt.callers)
+		}
+		if !reflect.DeepEqual(fn.Callees, tt.callees) {
+			t.Errorf("%s: callees = %+v, want %+v", tt.name, fn.Callees, tt.callees)
+		}
+	}
+}
+
+func TestParseCachegrindSummaryFromCosts(t *testing.T) {
+	input := strings.Replace(testProfile, "summary: 175 1216\n", "", 1)
+	profile, err := ParseCachegrind(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sum of the exclusive costs
+	if !reflect.DeepEqual(profile.Summary, []int64{125, 1088}) {
+		t.Errorf("summary = %v", profile.Summary)
+	}
+}
+
+func TestParseCachegrindErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing events header":    "version: 1\ncmd: /index.php\n",
+		"cost line before any fn=": "events: Time_(10ns)\n\n1 5\n",
+		"invalid call count":       "events: Time_(10ns)\nfn=(1) {main}\ncalls=x 0 0\n",
+	}
+	for want, input := range tests {
+		_, err := ParseCachegrind(strings.NewReader(input))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want one containing %q", err, want)
+		}
+	}
+}
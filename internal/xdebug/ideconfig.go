@@ -0,0 +1,186 @@
+package xdebug
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// vscodeConfigName identifies the launch configuration managed by Stacker
+const vscodeConfigName = "Listen for Xdebug (Stacker)"
+
+// IDESite describes the site an IDE configuration is generated for
+type IDESite struct {
+	Name string // site name as registered in Stacker
+	Host string // host name served by the web server, e.g. myapp.local
+	Path string // project root on disk
+}
+
+// pathMappings maps the path PHP sees to the local project path. Sites run
+// natively, so both are the same unless the project is reached via a symlink.
+func (s IDESite) pathMappings() map[string]string {
+	mappings := map[string]string{s.Path: s.Path}
+	if resolved, err := filepath.EvalSymlinks(s.Path); err == nil && resolved != s.Path {
+		mappings[resolved] = s.Path
+	}
+	return mappings
+}
+
+// WriteIDEConfig generates the debugger configuration for the given IDE
+// ("vscode" or "phpstorm") inside the site directory and returns the files written.
+func (xm *XDebugManager) WriteIDEConfig(ide string, site IDESite) ([]string, error) {
+	switch ide {
+	case "vscode", "code":
+		path, err := xm.writeVSCodeConfig(site)
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	case "phpstorm", "idea":
+		return xm.writePhpStormConfig(site)
+	}
+	return nil, fmt.Errorf("unsupported IDE %q (use vscode or phpstorm)", ide)
+}
+
+// writeVSCodeConfig adds or replaces the Stacker entry in .vscode/launch.json,
+// keeping any other launch configurations intact.
+func (xm *XDebugManager) writeVSCodeConfig(site IDESite) (string, error) {
+	dir := filepath.Join(site.Path, ".vscode")
+	path := filepath.Join(dir, "launch.json")
+
+	launch := map[string]interface{}{"version": "0.2.0"}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &launch); err != nil {
+			return "", fmt.Errorf("cannot update %s (comments are not supported): %w", path, err)
+		}
+	}
+
+	var configurations []interface{}
+	if existing, ok := launch["configurations"].([]interface{}); ok {
+		for _, c := range existing {
+			if m, ok := c.(map[string]interface{}); ok && m["name"] == vscodeConfigName {
+				continue
+			}
+			configurations = append(configurations, c)
+		}
+	}
+
+	configurations = append(configurations, map[string]interface{}{
+		"name":         vscodeConfigName,
+		"type":         "php",
+		"request":      "launch",
+		"port":         xm.GetPort(),
+		"pathMappings": site.pathMappings(),
+		"xdebugSettings": map[string]interface{}{
+			"max_children": 128,
+			"max_depth":    3,
+		},
+	})
+	launch["configurations"] = configurations
+
+	data, err := json.MarshalIndent(launch, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writePhpStormConfig registers the site as a PHP server in .idea/workspace.xml
+// and adds a "PHP Remote Debug" run configuration using the IDE key.
+func (xm *XDebugManager) writePhpStormConfig(site IDESite) ([]string, error) {
+	dir := filepath.Join(site.Path, ".idea")
+	if err := os.MkdirAll(filepath.Join(dir, "runConfigurations"), 0755); err != nil {
+		return nil, err
+	}
+
+	workspace := filepath.Join(dir, "workspace.xml")
+	if err := writePhpStormServer(workspace, site); err != nil {
+		return nil, err
+	}
+
+	runConfig := filepath.Join(dir, "runConfigurations", "Stacker_"+safeFileName(site.Name)+".xml")
+	content := fmt.Sprintf(`<component name="ProjectRunConfigurationManager">
+  <configuration default="false" name="%s" type="PhpRemoteDebugRunConfigurationType" factoryName="PHP Remote Debug" filter_connections="FILTER" server_name="%s" session_id="%s">
+    <method v="2" />
+  </configuration>
+</component>
+`, xmlAttr("Stacker: "+site.Name), xmlAttr(site.Host), xmlAttr(xm.GetIDEKey()))
+	if err := os.WriteFile(runConfig, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+
+	return []string{workspace, runConfig}, nil
+}
+
+var phpServersComponent = regexp.MustCompile(`(?s)<component name="PhpServers">.*?</component>`)
+var phpServerEntry = regexp.MustCompile(`(?s)\s*<server [^>]*name="([^"]*)"[^>]*(?:/>|>.*?</server>)`)
+
+// writePhpStormServer inserts or replaces the server entry for the site in
+// workspace.xml. Other servers and components are left untouched.
+func writePhpStormServer(path string, site IDESite) error {
+	var mappings strings.Builder
+	for remote, local := range site.pathMappings() {
+		fmt.Fprintf(&mappings, "          <mapping local-root=\"%s\" remote-root=\"%s\" />\n", xmlAttr(local), xmlAttr(remote))
+	}
+	server := fmt.Sprintf(`
+      <server host="%s" id="stacker-%s" name="%s" use_path_mappings="true">
+        <path_mappings>
+%s        </path_mappings>
+      </server>`, xmlAttr(site.Host), xmlAttr(safeFileName(site.Name)), xmlAttr(site.Host), mappings.String())
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data = []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<project version=\"4\">\n</project>\n")
+	} else if err != nil {
+		return err
+	}
+	content := string(data)
+
+	if loc := phpServersComponent.FindStringIndex(content); loc != nil {
+		component := strings.Replace(content[loc[0]:loc[1]], "<servers />", "<servers>\n    </servers>", 1)
+		// Drop a previous entry for this host before adding the new one
+		component = phpServerEntry.ReplaceAllStringFunc(component, func(entry string) string {
+			if phpServerEntry.FindStringSubmatch(entry)[1] == html.EscapeString(site.Host) {
+				return ""
+			}
+			return entry
+		})
+		component = strings.Replace(component, "<servers>", "<servers>"+server, 1)
+		if !strings.Contains(component, "<servers>") {
+			component = strings.Replace(component, "</component>", "  <servers>"+server+"\n    </servers>\n  </component>", 1)
+		}
+		content = content[:loc[0]] + component + content[loc[1]:]
+	} else {
+		block := "  <component name=\"PhpServers\">\n    <servers>" + server + "\n    </servers>\n  </component>\n"
+		idx := strings.LastIndex(content, "</project>")
+		if idx < 0 {
+			return fmt.Errorf("%s is not a PhpStorm workspace file", path)
+		}
+		content = content[:idx] + block + content[idx:]
+	}
+
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+func xmlAttr(s string) string {
+	return html.EscapeString(s)
+}
+
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
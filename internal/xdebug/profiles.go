@@ -0,0 +1,215 @@
+package xdebug
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+const (
+	// profilePrefix matches xdebug.profiler_output_name = cachegrind.out.%H.%t.%p
+	profilePrefix = "cachegrind.out."
+
+	// unknownSite collects profiles whose host could not be determined (CLI runs)
+	unknownSite = "_cli"
+
+	defaultProfileKeep   = 50
+	defaultProfileMaxAge = 7 * 24 * time.Hour
+)
+
+// ProfileManager collects Xdebug profiler output into per-site directories
+// and applies retention limits.
+type ProfileManager struct {
+	baseDir string
+	keep    int           // max profiles per site, 0 = unlimited
+	maxAge  time.Duration // max profile age, 0 = unlimited
+}
+
+// ProfileInfo describes a collected profile file
+type ProfileInfo struct {
+	Site    string    `json:"site"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// NewProfileManager creates a profile manager rooted in the Stacker data dir
+func NewProfileManager(keep int, maxAge time.Duration) *ProfileManager {
+	pm := &ProfileManager{
+		baseDir: filepath.Join(utils.GetStackerDir(), "xdebug", "profiles"),
+		keep:    keep,
+		maxAge:  maxAge,
+	}
+	os.MkdirAll(pm.baseDir, 0755)
+	return pm
+}
+
+// OutputDir is the directory Xdebug writes new profiles to
+func (pm *ProfileManager) OutputDir() string {
+	return pm.baseDir
+}
+
+// Collect moves new profiles from the output dir into their site
+// directories and prunes old ones.
+func (pm *ProfileManager) Collect() error {
+	entries, err := os.ReadDir(pm.baseDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), profilePrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		// Xdebug writes the file until the request ends
+		if time.Since(info.ModTime()) < 2*time.Second {
+			continue
+		}
+
+		siteDir := filepath.Join(pm.baseDir, siteFromProfileName(entry.Name()))
+		if err := os.MkdirAll(siteDir, 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(pm.baseDir, entry.Name()), filepath.Join(siteDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to collect %s: %w", entry.Name(), err)
+		}
+	}
+
+	return pm.Prune()
+}
+
+// Sites returns the sites that have collected profiles
+func (pm *ProfileManager) Sites() []string {
+	entries, _ := os.ReadDir(pm.baseDir)
+	var sites []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			sites = append(sites, entry.Name())
+		}
+	}
+	sort.Strings(sites)
+	return sites
+}
+
+// List returns the profiles for a site, newest first. An empty site lists all.
+func (pm *ProfileManager) List(site string) []ProfileInfo {
+	sites := []string{site}
+	if site == "" {
+		sites = pm.Sites()
+	}
+
+	var result []ProfileInfo
+	for _, s := range sites {
+		entries, err := os.ReadDir(filepath.Join(pm.baseDir, s))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), profilePrefix) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			result = append(result, ProfileInfo{
+				Site:    s,
+				Name:    entry.Name(),
+				Size:    info.Size(),
+				Created: info.ModTime(),
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.After(result[j].Created)
+	})
+	return result
+}
+
+// Load parses a collected profile
+func (pm *ProfileManager) Load(site, name string) (*Profile, error) {
+	path, err := pm.path(site, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	return ParseCachegrind(r)
+}
+
+// Delete removes a collected profile
+func (pm *ProfileManager) Delete(site, name string) error {
+	path, err := pm.path(site, name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Prune enforces the per-site count and age limits
+func (pm *ProfileManager) Prune() error {
+	for _, site := range pm.Sites() {
+		for i, p := range pm.List(site) {
+			tooMany := pm.keep > 0 && i >= pm.keep
+			tooOld := pm.maxAge > 0 && time.Since(p.Created) > pm.maxAge
+			if tooMany || tooOld {
+				if err := os.Remove(filepath.Join(pm.baseDir, site, p.Name)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// path validates site/name and returns the file path
+func (pm *ProfileManager) path(site, name string) (string, error) {
+	if site == "" || name == "" || strings.ContainsAny(site+name, `/\`) || strings.Contains(site+name, "..") {
+		return "", fmt.Errorf("invalid profile %s/%s", site, name)
+	}
+	if !strings.HasPrefix(name, profilePrefix) {
+		return "", fmt.Errorf("not a profile: %s", name)
+	}
+	return filepath.Join(pm.baseDir, site, name), nil
+}
+
+// siteFromProfileName extracts %H from "cachegrind.out.<host>.<time>.<pid>[.gz]"
+func siteFromProfileName(name string) string {
+	rest := strings.TrimSuffix(strings.TrimPrefix(name, profilePrefix), ".gz")
+	parts := strings.Split(rest, ".")
+	if len(parts) < 3 {
+		return unknownSite
+	}
+	host := strings.Join(parts[:len(parts)-2], ".")
+	if host == "" || strings.ContainsAny(host, `/\`) {
+		return unknownSite
+	}
+	return host
+}
@@ -0,0 +1,389 @@
+package xdebug
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/utils"
+)
+
+// DefaultIDEPort is the conventional DBGp proxy port IDEs register on
+const DefaultIDEPort = 9001
+
+// DBGpProxy sits between Xdebug and one or more IDEs. Xdebug connects to the
+// engine port, IDEs register themselves by idekey on the IDE port with
+// proxyinit/proxystop, and each debug session is routed to the IDE that
+// registered the session's idekey.
+type DBGpProxy struct {
+	enginePort int
+	idePort    int
+	engineLn   net.Listener
+	ideLn      net.Listener
+	ides       map[string]*IDERegistration // idekey -> registration
+	sessions   map[string]*DebugSession    // session id -> session
+	nextID     int
+	mu         sync.RWMutex
+}
+
+// IDERegistration is an IDE that asked the proxy to forward its sessions
+type IDERegistration struct {
+	IDEKey     string    `json:"idekey"`
+	Address    string    `json:"address"`
+	Port       int       `json:"port"`
+	Multiple   bool      `json:"multiple"`
+	Registered time.Time `json:"registered"`
+}
+
+// DebugSession is an active engine <-> IDE connection
+type DebugSession struct {
+	ID       string    `json:"id"`
+	IDEKey   string    `json:"idekey"`
+	Engine   string    `json:"engine"`
+	IDE      string    `json:"ide"`
+	FileURI  string    `json:"file_uri"`
+	Language string    `json:"language"`
+	AppID    string    `json:"app_id"`
+	Started  time.Time `json:"started"`
+}
+
+// engineInit holds the attributes of the DBGp init packet we route on
+type engineInit struct {
+	IDEKey   string `xml:"idekey,attr"`
+	FileURI  string `xml:"fileuri,attr"`
+	Language string `xml:"language,attr"`
+	AppID    string `xml:"appid,attr"`
+}
+
+// NewDBGpProxy creates a proxy; it does not listen until Start is called
+func NewDBGpProxy(enginePort, idePort int) *DBGpProxy {
+	if enginePort == 0 {
+		enginePort = 9003
+	}
+	if idePort == 0 {
+		idePort = DefaultIDEPort
+	}
+	return &DBGpProxy{
+		enginePort: enginePort,
+		idePort:    idePort,
+		ides:       make(map[string]*IDERegistration),
+		sessions:   make(map[string]*DebugSession),
+	}
+}
+
+// Start opens the engine and IDE listeners and serves them in the background
+func (p *DBGpProxy) Start() error {
+	engineLn, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", p.enginePort))
+	if err != nil {
+		return fmt.Errorf("failed to listen for Xdebug on port %d: %w", p.enginePort, err)
+	}
+
+	ideLn, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", p.idePort))
+	if err != nil {
+		engineLn.Close()
+		return fmt.Errorf("failed to listen for IDEs on port %d: %w", p.idePort, err)
+	}
+
+	p.mu.Lock()
+	p.engineLn = engineLn
+	p.ideLn = ideLn
+	p.mu.Unlock()
+
+	go p.acceptLoop(engineLn, p.handleEngine)
+	go p.acceptLoop(ideLn, p.handleIDE)
+
+	fmt.Printf("🐞 DBGp proxy listening (Xdebug: %d, IDE: %d)\n", p.enginePort, p.idePort)
+	return nil
+}
+
+// Stop closes both listeners. Running sessions finish on their own.
+func (p *DBGpProxy) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.engineLn != nil {
+		p.engineLn.Close()
+		p.engineLn = nil
+	}
+	if p.ideLn != nil {
+		p.ideLn.Close()
+		p.ideLn = nil
+	}
+}
+
+// EnginePort returns the port Xdebug connects to
+func (p *DBGpProxy) EnginePort() int {
+	return p.enginePort
+}
+
+// IDEPort returns the port IDEs register on
+func (p *DBGpProxy) IDEPort() int {
+	return p.idePort
+}
+
+// IDEs returns the registered IDEs sorted by idekey
+func (p *DBGpProxy) IDEs() []IDERegistration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]IDERegistration, 0, len(p.ides))
+	for _, ide := range p.ides {
+		result = append(result, *ide)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].IDEKey < result[j].IDEKey
+	})
+	return result
+}
+
+// Sessions returns the active debug sessions, oldest first
+func (p *DBGpProxy) Sessions() []DebugSession {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]DebugSession, 0, len(p.sessions))
+	for _, s := range p.sessions {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.Before(result[j].Started)
+	})
+	return result
+}
+
+// Register adds or replaces the IDE for an idekey
+func (p *DBGpProxy) Register(ide IDERegistration) {
+	if ide.Registered.IsZero() {
+		ide.Registered = time.Now()
+	}
+	p.mu.Lock()
+	p.ides[ide.IDEKey] = &ide
+	p.mu.Unlock()
+	utils.LogInfo(fmt.Sprintf("DBGp proxy: registered IDE %s at %s:%d", ide.IDEKey, ide.Address, ide.Port))
+}
+
+// Unregister removes the IDE for an idekey
+func (p *DBGpProxy) Unregister(ideKey string) bool {
+	p.mu.Lock()
+	_, ok := p.ides[ideKey]
+	delete(p.ides, ideKey)
+	p.mu.Unlock()
+	if ok {
+		utils.LogInfo(fmt.Sprintf("DBGp proxy: unregistered IDE %s", ideKey))
+	}
+	return ok
+}
+
+func (p *DBGpProxy) acceptLoop(ln net.Listener, handle func(net.Conn)) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			// Listener closed
+			return
+		}
+		go handle(conn)
+	}
+}
+
+// lookupIDE finds the IDE for an idekey. When the engine sends no idekey and
+// exactly one IDE is registered, that IDE gets the session.
+func (p *DBGpProxy) lookupIDE(ideKey string) *IDERegistration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if ide, ok := p.ides[ideKey]; ok {
+		clone := *ide
+		return &clone
+	}
+	if ideKey == "" && len(p.ides) == 1 {
+		for _, ide := range p.ides {
+			clone := *ide
+			return &clone
+		}
+	}
+	return nil
+}
+
+// handleEngine reads Xdebug's init packet, connects to the matching IDE and
+// pipes the session in both directions.
+func (p *DBGpProxy) handleEngine(engine net.Conn) {
+	defer engine.Close()
+
+	reader := bufio.NewReader(engine)
+	engine.SetReadDeadline(time.Now().Add(10 * time.Second))
+	packet, err := readEnginePacket(reader)
+	if err != nil {
+		utils.LogWarn(fmt.Sprintf("DBGp proxy: bad init packet from %s: %v", engine.RemoteAddr(), err))
+		return
+	}
+	engine.SetReadDeadline(time.Time{})
+
+	var init engineInit
+	if err := xml.Unmarshal(packet, &init); err != nil {
+		utils.LogWarn(fmt.Sprintf("DBGp proxy: could not parse init packet: %v", err))
+		return
+	}
+
+	ide := p.lookupIDE(init.IDEKey)
+	if ide == nil {
+		utils.LogWarn(fmt.Sprintf("DBGp proxy: no IDE registered for idekey %q", init.IDEKey))
+		return
+	}
+
+	ideAddr := net.JoinHostPort(ide.Address, strconv.Itoa(ide.Port))
+	ideConn, err := net.DialTimeout("tcp", ideAddr, 5*time.Second)
+	if err != nil {
+		utils.LogWarn(fmt.Sprintf("DBGp proxy: IDE %s unreachable at %s: %v", ide.IDEKey, ideAddr, err))
+		return
+	}
+	defer ideConn.Close()
+
+	// Tell the IDE the session came through a proxy
+	engineHost, _, _ := net.SplitHostPort(engine.RemoteAddr().String())
+	forwarded := strings.Replace(string(packet), "<init ", fmt.Sprintf(`<init proxied="%s" `, engineHost), 1)
+	if _, err := ideConn.Write(encodeEnginePacket([]byte(forwarded))); err != nil {
+		return
+	}
+
+	session := p.addSession(init, engine.RemoteAddr().String(), ideAddr)
+	defer p.removeSession(session.ID)
+
+	// IDE -> engine commands and engine -> IDE responses
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(engine, ideConn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(ideConn, reader)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (p *DBGpProxy) addSession(init engineInit, engineAddr, ideAddr string) *DebugSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextID++
+	session := &DebugSession{
+		ID:       strconv.Itoa(p.nextID),
+		IDEKey:   init.IDEKey,
+		Engine:   engineAddr,
+		IDE:      ideAddr,
+		FileURI:  init.FileURI,
+		Language: init.Language,
+		AppID:    init.AppID,
+		Started:  time.Now(),
+	}
+	p.sessions[session.ID] = session
+	return session
+}
+
+func (p *DBGpProxy) removeSession(id string) {
+	p.mu.Lock()
+	delete(p.sessions, id)
+	p.mu.Unlock()
+}
+
+// handleIDE serves a single proxyinit/proxystop command
+func (p *DBGpProxy) handleIDE(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && line == "" {
+		return
+	}
+	fields := strings.Fields(strings.TrimRight(line, "\x00\r\n"))
+	if len(fields) == 0 {
+		return
+	}
+
+	command := fields[0]
+	opts := parseProxyArgs(fields[1:])
+	ideKey := opts["-k"]
+
+	switch command {
+	case "proxyinit":
+		port, err := strconv.Atoi(opts["-p"])
+		if err != nil || port <= 0 {
+			writeProxyError(conn, command, "invalid or missing port (-p)")
+			return
+		}
+		if ideKey == "" {
+			writeProxyError(conn, command, "missing idekey (-k)")
+			return
+		}
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		p.Register(IDERegistration{
+			IDEKey:   ideKey,
+			Address:  host,
+			Port:     port,
+			Multiple: opts["-m"] == "1",
+		})
+		fmt.Fprintf(conn, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<proxyinit success="1" idekey="%s" address="127.0.0.1" port="%d"/>`, xmlEscape(ideKey), p.enginePort)
+	case "proxystop":
+		if !p.Unregister(ideKey) {
+			writeProxyError(conn, command, "idekey not registered")
+			return
+		}
+		fmt.Fprintf(conn, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<proxystop success="1" idekey="%s"/>`, xmlEscape(ideKey))
+	default:
+		writeProxyError(conn, command, "unknown command")
+	}
+}
+
+// parseProxyArgs turns "-p 9010 -k KEY -m 1" into a flag map
+func parseProxyArgs(args []string) map[string]string {
+	opts := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") && i+1 < len(args) {
+			opts[args[i]] = args[i+1]
+			i++
+		}
+	}
+	return opts
+}
+
+func writeProxyError(w io.Writer, command, message string) {
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<%s success="0"><error id="1"><message>%s</message></error></%s>`, command, xmlEscape(message), command)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// readEnginePacket reads one "<length>\0<xml>\0" DBGp engine packet
+func readEnginePacket(r *bufio.Reader) ([]byte, error) {
+	lengthStr, err := r.ReadString(0)
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimRight(lengthStr, "\x00"))
+	if err != nil || length <= 0 || length > 1<<20 {
+		return nil, fmt.Errorf("invalid packet length %q", lengthStr)
+	}
+
+	data := make([]byte, length+1) // payload plus trailing NUL
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data[:length], nil
+}
+
+func encodeEnginePacket(data []byte) []byte {
+	packet := []byte(strconv.Itoa(len(data)))
+	packet = append(packet, 0)
+	packet = append(packet, data...)
+	return append(packet, 0)
+}
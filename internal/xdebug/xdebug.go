@@ -1,36 +1,279 @@
 package xdebug
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"time"
+
+	"github.com/yasinkuyu/Stacker/internal/php"
+	"github.com/yasinkuyu/Stacker/internal/utils"
 )
 
+// iniFileName is the conf.d file Stacker owns for each PHP version
+const iniFileName = "20-xdebug.ini"
+
 type XDebugManager struct {
-	enabled    bool
 	autoDetect bool
 	port       int
 	ideKey     string
+	mode       string          // xdebug.mode, e.g. "debug" or "debug,profile"
+	versions   map[string]bool // php version -> xdebug enabled
+	proxy      bool            // start the DBGp proxy with Stacker
+	proxyPort  int             // port IDEs register on with the proxy
+	profileMax int             // profiles kept per site
+	profileAge time.Duration   // max age of kept profiles
+	statePath  string
+}
+
+// xdebugState is the persisted form of XDebugManager
+type xdebugState struct {
+	Port     int             `json:"port"`
+	IDEKey   string          `json:"ide_key"`
+	Mode     string          `json:"mode,omitempty"`
+	Versions map[string]bool `json:"versions"`
+	Proxy    bool            `json:"proxy"`
+	IDEPort  int             `json:"proxy_ide_port,omitempty"`
+	// Profile retention; missing keeps the defaults, 0 is unlimited
+	ProfileKeep    *int `json:"profile_keep,omitempty"`
+	ProfileMaxDays *int `json:"profile_max_days,omitempty"`
 }
 
 func NewXDebugManager() *XDebugManager {
-	return &XDebugManager{
-		enabled:    false,
+	xm := &XDebugManager{
 		autoDetect: true,
 		port:       9003,
 		ideKey:     "PHPSTORM",
+		mode:       "debug",
+		versions:   make(map[string]bool),
+		proxyPort:  DefaultIDEPort,
+		profileMax: defaultProfileKeep,
+		profileAge: defaultProfileMaxAge,
+		statePath:  filepath.Join(utils.GetStackerDir(), "xdebug.json"),
+	}
+	xm.loadState()
+	return xm
+}
+
+func (xm *XDebugManager) loadState() {
+	data, err := os.ReadFile(xm.statePath)
+	if err != nil {
+		return
+	}
+
+	var state xdebugState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return
+	}
+
+	if state.Port > 0 {
+		xm.port = state.Port
+	}
+	if state.IDEKey != "" {
+		xm.ideKey = state.IDEKey
+	}
+	for v, enabled := range state.Versions {
+		xm.versions[v] = enabled
+	}
+	if state.Mode != "" {
+		xm.mode = state.Mode
+	}
+	xm.proxy = state.Proxy
+	if state.ProfileKeep != nil && *state.ProfileKeep >= 0 {
+		xm.profileMax = *state.ProfileKeep
+	}
+	if state.ProfileMaxDays != nil && *state.ProfileMaxDays >= 0 {
+		xm.profileAge = time.Duration(*state.ProfileMaxDays) * 24 * time.Hour
+	}
+	if state.IDEPort > 0 {
+		xm.proxyPort = state.IDEPort
+	}
+}
+
+// Save persists the Xdebug state to the Stacker data directory
+func (xm *XDebugManager) Save() error {
+	state := xdebugState{
+		Port:     xm.port,
+		IDEKey:   xm.ideKey,
+		Versions: xm.versions,
+		Proxy:    xm.proxy,
+		IDEPort:  xm.proxyPort,
+		Mode:     xm.mode,
+	}
+	if xm.profileMax != defaultProfileKeep {
+		keep := xm.profileMax
+		state.ProfileKeep = &keep
+	}
+	if xm.profileAge != defaultProfileMaxAge {
+		days := int(xm.profileAge / (24 * time.Hour))
+		state.ProfileMaxDays = &days
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
 	}
+
+	os.MkdirAll(filepath.Dir(xm.statePath), 0755)
+	return os.WriteFile(xm.statePath, data, 0644)
 }
 
+// IsEnabled reports whether Xdebug is enabled for any PHP version
 func (xm *XDebugManager) IsEnabled() bool {
-	return xm.enabled
+	return len(xm.EnabledVersions()) > 0
+}
+
+// GetMode returns the configured xdebug.mode
+func (xm *XDebugManager) GetMode() string {
+	return xm.mode
+}
+
+// SetMode validates and sets xdebug.mode (comma separated: off, develop,
+// coverage, debug, gcstats, profile, trace)
+func (xm *XDebugManager) SetMode(mode string) error {
+	valid := map[string]bool{"off": true, "develop": true, "coverage": true, "debug": true, "gcstats": true, "profile": true, "trace": true}
+	for _, m := range strings.Split(mode, ",") {
+		if !valid[strings.TrimSpace(m)] {
+			return fmt.Errorf("invalid xdebug mode %q", m)
+		}
+	}
+	xm.mode = strings.ReplaceAll(mode, " ", "")
+	return nil
+}
+
+// EnabledVersions returns the PHP versions Xdebug is enabled for
+func (xm *XDebugManager) EnabledVersions() []string {
+	var versions []string
+	for v, enabled := range xm.versions {
+		if enabled {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// SetProfileRetention sets how many profiles are kept per site and for how long
+func (xm *XDebugManager) SetProfileRetention(keep int, maxAge time.Duration) {
+	xm.profileMax = keep
+	xm.profileAge = maxAge
+}
+
+// NewProfileManager creates a profile manager with the configured retention
+func (xm *XDebugManager) NewProfileManager() *ProfileManager {
+	return NewProfileManager(xm.profileMax, xm.profileAge)
+}
+
+func (xm *XDebugManager) profiling() bool {
+	for _, m := range strings.Split(xm.mode, ",") {
+		if m == "profile" {
+			return true
+		}
+	}
+	return false
 }
 
-func (xm *XDebugManager) SetEnabled(enabled bool) {
-	xm.enabled = enabled
+// IsProxyEnabled reports whether the DBGp proxy starts with Stacker
+func (xm *XDebugManager) IsProxyEnabled() bool {
+	return xm.proxy
+}
+
+func (xm *XDebugManager) SetProxyEnabled(enabled bool) {
+	xm.proxy = enabled
+}
+
+// GetProxyPort returns the port IDEs register on with the DBGp proxy
+func (xm *XDebugManager) GetProxyPort() int {
+	return xm.proxyPort
+}
+
+func (xm *XDebugManager) SetProxyPort(port int) {
+	xm.proxyPort = port
+}
+
+// NewProxy creates a DBGp proxy listening on the Xdebug client port
+func (xm *XDebugManager) NewProxy() *DBGpProxy {
+	return NewDBGpProxy(xm.port, xm.proxyPort)
+}
+
+// IsEnabledFor reports whether Xdebug is enabled for a PHP version
+func (xm *XDebugManager) IsEnabledFor(version string) bool {
+	return xm.versions[version]
+}
+
+// IniPath returns the managed Xdebug ini file for a PHP version
+func (xm *XDebugManager) IniPath(version string) string {
+	return filepath.Join(php.ConfDir(version), iniFileName)
+}
+
+// Enable turns Xdebug on for a PHP version. It is idempotent: the managed
+// conf.d file is rewritten rather than appended, the state is persisted and
+// the matching PHP-FPM pool is gracefully reloaded.
+func (xm *XDebugManager) Enable(version string) error {
+	return xm.apply(version, true)
+}
+
+// Disable turns Xdebug off for a PHP version by removing the managed
+// conf.d file, persisting the state and reloading PHP-FPM.
+func (xm *XDebugManager) Disable(version string) error {
+	return xm.apply(version, false)
+}
+
+func (xm *XDebugManager) apply(version string, enabled bool) error {
+	if version == "" {
+		return fmt.Errorf("PHP version required")
+	}
+
+	iniPath := xm.IniPath(version)
+	if enabled {
+		if err := os.MkdirAll(filepath.Dir(iniPath), 0755); err != nil {
+			return err
+		}
+		content := "; Managed by Stacker - changes will be overwritten\n" + strings.TrimLeft(xm.GenerateXDebugIni(), "\n")
+		if err := os.WriteFile(iniPath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", iniPath, err)
+		}
+	} else {
+		if err := os.Remove(iniPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", iniPath, err)
+		}
+	}
+
+	xm.versions[version] = enabled
+	if err := xm.Save(); err != nil {
+		return fmt.Errorf("failed to save xdebug state: %w", err)
+	}
+
+	// Reload FPM so workers pick up the change. A stopped pool will read
+	// the new ini on its next start, so that is not an error.
+	fm := php.NewFPMManager()
+	if err := fm.Reload(version); err != nil {
+		utils.LogWarn(fmt.Sprintf("Xdebug: %v", err))
+	}
+
+	return xm.verify(version, enabled)
+}
+
+// verify checks that the PHP binary for version agrees with the wanted state
+func (xm *XDebugManager) verify(version string, enabled bool) error {
+	pm := php.NewPHPManager()
+	pm.DetectPHPVersions()
+	phpVersion := pm.GetVersion(version)
+	if phpVersion == nil {
+		// Nothing to verify against (e.g. FPM-only install)
+		return nil
+	}
+
+	loaded := xm.IsXDebugLoaded(phpVersion.Binary)
+	if enabled && !loaded {
+		return fmt.Errorf("xdebug did not load for PHP %s; is the extension installed? (pecl install xdebug)", version)
+	}
+	if !enabled && loaded {
+		return fmt.Errorf("xdebug is still loaded for PHP %s; it is probably enabled in php.ini outside Stacker", version)
+	}
+	return nil
 }
 
 func (xm *XDebugManager) GetPort() int {
@@ -56,14 +299,23 @@ func (xm *XDebugManager) DetectBrowserExtension() bool {
 }
 
 func (xm *XDebugManager) GetXDebugConfig() string {
-	return fmt.Sprintf(`
+	config := fmt.Sprintf(`
 zend_extension=xdebug
-xdebug.mode=debug
+xdebug.mode=%s
 xdebug.start_with_request=yes
 xdebug.client_host=localhost
 xdebug.client_port=%d
 xdebug.idekey=%s
-`, xm.port, xm.ideKey)
+`, xm.mode, xm.port, xm.ideKey)
+
+	if xm.profiling() {
+		// %H (host) lets ProfileManager sort profiles per site
+		config += fmt.Sprintf(`xdebug.output_dir=%s
+xdebug.profiler_output_name=cachegrind.out.%%H.%%t.%%p
+`, xm.NewProfileManager().OutputDir())
+	}
+
+	return config
 }
 
 func (xm *XDebugManager) GenerateXDebugIni() string {
@@ -77,42 +329,32 @@ func (xm *XDebugManager) InstallXDebug(phpBinary string) error {
 		return fmt.Errorf("failed to install XDebug: %w", err)
 	}
 
-	// Find php.ini location
-	cmd = exec.Command(phpBinary, "--ini")
-	output, err := cmd.CombinedOutput()
+	version, err := phpMinorVersion(phpBinary)
 	if err != nil {
-		return fmt.Errorf("could not find php.ini: %w", err)
+		return fmt.Errorf("could not detect PHP version: %w", err)
 	}
 
-	re := regexp.MustCompile(`Loaded Configuration File:\s+(.+)`)
-	matches := re.FindStringSubmatch(string(output))
-
-	if len(matches) < 2 {
-		return fmt.Errorf("could not parse php.ini location")
-	}
-
-	phpIni := strings.TrimSpace(matches[1])
-	if phpIni == "(none)" {
-		home, _ := os.UserHomeDir()
-		phpIni = filepath.Join(home, ".stacker-app", "php", "php.ini")
-	}
-
-	// Add xdebug configuration
-	xdebugConfig := xm.GenerateXDebugIni()
+	// pecl may have added its own zend_extension line to php.ini; the
+	// managed conf.d file is what Stacker toggles from here on.
+	return xm.Enable(version)
+}
 
-	f, err := os.OpenFile(phpIni, os.O_APPEND|os.O_WRONLY, 0644)
+// phpMinorVersion returns the major.minor version of a PHP binary
+func phpMinorVersion(phpBinary string) (string, error) {
+	cmd := exec.Command(phpBinary, "-r", "echo PHP_MAJOR_VERSION.'.'.PHP_MINOR_VERSION;")
+	output, err := cmd.Output()
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer f.Close()
-
-	f.WriteString("\n" + xdebugConfig + "\n")
-
-	return nil
+	return strings.TrimSpace(string(output)), nil
 }
 
 func (xm *XDebugManager) IsXDebugLoaded(phpBinary string) bool {
 	cmd := exec.Command(phpBinary, "-m")
+	// Scan the same conf.d directory PHP-FPM is started with
+	if version, err := phpMinorVersion(phpBinary); err == nil {
+		cmd.Env = append(os.Environ(), php.ScanDirEnv(version))
+	}
 	output, _ := cmd.CombinedOutput()
 	return strings.Contains(string(output), "xdebug")
 }
@@ -0,0 +1,37 @@
+package xdebug
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProfileRetentionPersists(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "xdebug.json")
+	load := func() *XDebugManager {
+		xm := NewXDebugManager()
+		xm.statePath = statePath
+		xm.profileMax, xm.profileAge = defaultProfileKeep, defaultProfileMaxAge
+		xm.loadState()
+		return xm
+	}
+
+	tests := []struct {
+		keep   int
+		maxAge time.Duration
+	}{
+		{0, 0}, // unlimited
+		{10, 3 * 24 * time.Hour},
+		{defaultProfileKeep, defaultProfileMaxAge},
+	}
+	for _, tt := range tests {
+		xm := load()
+		xm.SetProfileRetention(tt.keep, tt.maxAge)
+		if err := xm.Save(); err != nil {
+			t.Fatal(err)
+		}
+		if got := load(); got.profileMax != tt.keep || got.profileAge != tt.maxAge {
+			t.Errorf("retention %d/%s loaded as %d/%s", tt.keep, tt.maxAge, got.profileMax, got.profileAge)
+		}
+	}
+}